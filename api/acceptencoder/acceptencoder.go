@@ -38,6 +38,8 @@ var (
 	//List of HTTP methods to compress. If not set, only GET requests are compressed.
 	includedMethods map[string]bool
 	getMethodOnly   bool
+	//Whether InitGzip has been called.
+	gzipInitialized bool
 )
 
 func InitGzip(minLength, compressLevel int, methods []string) {
@@ -53,6 +55,20 @@ func InitGzip(minLength, compressLevel int, methods []string) {
 	for _, v := range methods {
 		includedMethods[strings.ToUpper(v)] = true
 	}
+	gzipInitialized = true
+	// the pooled writers compress at the previous level
+	gzipCompressEncoder.resetPool()
+	deflateCompressEncoder.resetPool()
+}
+
+// GzipInitialized reports whether InitGzip has been called.
+func GzipInitialized() bool {
+	return gzipInitialized
+}
+
+// MinLength returns the length under which the content is not compressed.
+func MinLength() int {
+	return gzipMinLength
 }
 
 type resetWriter interface {
@@ -76,12 +92,18 @@ type acceptEncoder struct {
 }
 
 func (ac acceptEncoder) encode(wr io.Writer, level int) resetWriter {
-	if ac.customCompressLevelPool == nil || ac.bestCompressionPool == nil {
+	if ac.levelEncode == nil {
 		return nopResetWriter{wr}
 	}
 	var rwr resetWriter
+	if ac.customCompressLevelPool == nil || ac.bestCompressionPool == nil {
+		// encoders registered by RegisterEncoder are not pooled
+		rwr = ac.levelEncode(level)
+		rwr.Reset(wr)
+		return rwr
+	}
 	switch level {
-	case flate.BestSpeed:
+	case gzipCompressLevel:
 		rwr = ac.customCompressLevelPool.Get().(resetWriter)
 	case flate.BestCompression:
 		rwr = ac.bestCompressionPool.Get().(resetWriter)
@@ -92,6 +114,12 @@ func (ac acceptEncoder) encode(wr io.Writer, level int) resetWriter {
 	return rwr
 }
 
+func (ac acceptEncoder) resetPool() {
+	if ac.customCompressLevelPool != nil {
+		*ac.customCompressLevelPool = sync.Pool{New: ac.customCompressLevelPool.New}
+	}
+}
+
 func (ac acceptEncoder) put(wr resetWriter, level int) {
 	if ac.customCompressLevelPool == nil || ac.bestCompressionPool == nil {
 		return
@@ -140,6 +168,77 @@ var (
 	}
 )
 
+// EncoderFunc returns a writer compressing to w at the compression level,
+// closing the writer flushes the compressed stream but must not close w.
+type EncoderFunc func(w io.Writer, level int) io.WriteCloser
+
+// encoderResetWriter adapts an EncoderFunc to a resetWriter.
+type encoderResetWriter struct {
+	io.WriteCloser
+	encoder EncoderFunc
+	level   int
+}
+
+func (e *encoderResetWriter) Reset(w io.Writer) {
+	if w == nil {
+		e.WriteCloser = nil
+		return
+	}
+	e.WriteCloser = e.encoder(w, e.level)
+}
+
+// RegisterEncoder adds a content coding, e.g. "br" or "zstd", to the codings
+// negotiated from the Accept-Encoding header. It must be called before serving requests.
+func RegisterEncoder(name string, encoder EncoderFunc) {
+	encoderMap[name] = acceptEncoder{
+		name: name,
+		levelEncode: func(level int) resetWriter {
+			return &encoderResetWriter{encoder: encoder, level: level}
+		},
+	}
+}
+
+// Writer compresses the content written to it with a content coding.
+type Writer struct {
+	resetWriter
+	encoder acceptEncoder
+	level   int
+}
+
+// Close flushes the compressed stream, the underlying writer is not closed.
+func (w *Writer) Close() (err error) {
+	if closer, ok := w.resetWriter.(io.Closer); ok {
+		err = closer.Close()
+	}
+	w.encoder.put(w.resetWriter, w.level)
+	return err
+}
+
+// Flush flushes the pending compressed data if the content coding supports it.
+func (w *Writer) Flush() error {
+	if flusher, ok := w.resetWriter.(interface {
+		Flush() error
+	}); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// NewWriter returns a writer compressing to writer by the specific encoding at
+// the level set by InitGzip, and the content coding used which is empty when
+// the encoding is not supported.
+func NewWriter(encoding string, writer io.Writer) (*Writer, string) {
+	ce := noneCompressEncoder
+	if cf, ok := encoderMap[encoding]; ok {
+		ce = cf
+	}
+	return &Writer{
+		resetWriter: ce.encode(writer, gzipCompressLevel),
+		encoder:     ce,
+		level:       gzipCompressLevel,
+	}, ce.name
+}
+
 // WriteFile reads from file and writes to writer by the specific encoding(gzip/deflate)
 func WriteFile(encoding string, writer io.Writer, file http.File) (bool, string, error) {
 	return writeLevel(encoding, writer, file, flate.BestCompression)
@@ -15,6 +15,8 @@
 package acceptencoder
 
 import (
+	"bytes"
+	"compress/flate"
 	"net/http"
 	"testing"
 )
@@ -56,4 +58,30 @@ func Test_ExtractEncoding(t *testing.T) {
 	if parseEncoding(&http.Request{Header: map[string][]string{"Accept-Encoding": {"gzip;q=0.5,x;q=0.8"}}}) != "gzip" {
 		t.Fail()
 	}
-}
\ No newline at end of file
+}
+func Test_InitGzip(t *testing.T) {
+	request := &http.Request{Method: "GET", Header: map[string][]string{"Accept-Encoding": {"gzip"}}}
+	// nothing is compressed until InitGzip is called
+	if GzipInitialized() || ParseEncoding(request) != "" {
+		t.Fail()
+	}
+	compressedLength := func() int {
+		var buffer bytes.Buffer
+		writer, _ := NewWriter("gzip", &buffer)
+		writer.Write(bytes.Repeat([]byte("ltick"), 100))
+		writer.Close()
+		return buffer.Len()
+	}
+	InitGzip(-1, flate.BestSpeed, nil)
+	if !GzipInitialized() || ParseEncoding(request) != "gzip" {
+		t.Fail()
+	}
+	if compressedLength() >= 500 {
+		t.Fail()
+	}
+	// the pooled writers are not reused at the previous level
+	InitGzip(-1, flate.NoCompression, nil)
+	if compressedLength() <= 500 {
+		t.Fail()
+	}
+}
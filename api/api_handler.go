@@ -3,7 +3,6 @@ package api
 import (
 	"bytes"
 	"encoding/gob"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"mime/multipart"
@@ -156,12 +155,6 @@ func (ps ApiParams) Replace(name string, value string, n int) bool {
 	return changed
 }
 
-// The default body decoder is json format decoding
-var (
-	defaultBodydecoder = func(dest interface{}, body []byte) (err error) {
-		return json.Unmarshal(body, dest)
-	}
-)
 var (
 	defaultApiMap = &ApiMap{
 		Map: map[string]*Api{},
@@ -183,7 +176,7 @@ func SetApi(api *Api) {
 
 // NewApi parses and store the struct object, requires a struct pointer,
 // if `paramNameNormalizer` is nil, `paramNameNormalizer=toSnake`,
-// if `bodydecoder` is nil, `bodydecoder=bodyJSON`,
+// if `bodydecoder` is nil, the body is decoded by the decoder registered for the request content type (JSON by default),
 func NewApi(
 	structPointer interface{},
 	paramNameNormalizer ParamNameMapper,
@@ -213,11 +206,7 @@ func NewApi(
 	} else {
 		api.paramNameNormalizer = utility.SnakeString
 	}
-	if bodydecoder != nil {
-		api.bodydecoder = bodydecoder
-	} else {
-		api.bodydecoder = defaultBodydecoder
-	}
+	api.bodydecoder = bodydecoder
 	err := api.addFields([]int{}, api.structType, v)
 	if err != nil {
 		return nil, err
@@ -410,6 +399,9 @@ func (a *Api) BindAt(
 		req,
 		apiParams,
 	)
+	if err == nil {
+		err = a.validateParams(structPointer)
+	}
 	if err != nil {
 		return errors.Annotate(err, errBindAt)
 	}
@@ -426,6 +418,9 @@ func (a *Api) BindNew(
 ) {
 	structPrinter, fields := a.NewReceiver()
 	err := a.BindFields(fields, req, apiParams)
+	if err == nil {
+		err = a.validateParams(structPrinter)
+	}
 	if err != nil {
 		return structPrinter, errors.Annotate(err, errBindNew)
 	}
@@ -462,6 +457,7 @@ func (a *Api) fieldsForBinding(structElem reflect.Value) []reflect.Value {
 
 // BindFields binds the net/http api params to a struct and validate it.
 // Must ensure that the param `fields` matches `a.params`.
+// The params failing their binding or their validation are all listed by a *ValidationError.
 func (a *Api) BindFields(
 	fields []reflect.Value,
 	req *http.Request,
@@ -478,21 +474,25 @@ func (a *Api) BindFields(
 			err = errors.Annotate(fmt.Errorf("api: %s|%s|%s", a.name, "?", fmt.Sprint(p)), errBindFields)
 		}
 	}()
+	validationError := &ValidationError{ApiName: a.name}
 	for i, param := range a.params {
 		value := fields[i]
 		switch param.In() {
 		case "path":
 			paramValue, ok := apiParams.Get(param.name)
 			if !ok {
-				return errors.Annotate(errors.New("missing path param"), errBindFields)
+				validationError.add(param, KEY_REQUIRED, "missing path param")
+				continue
 			}
 			paramValueString, ok := paramValue.(string)
 			if !ok {
-				return errors.Annotate(errors.New("missing path param"), errBindFields)
+				validationError.add(param, KEY_REQUIRED, "missing path param")
+				continue
 			}
 			// fmt.Printf("paramName:%s\nvalue:%#v\n\n", param.name, paramValueString)
 			if err = utility.ConvertAssign(value, []string{paramValueString}...); err != nil {
-				return errors.Annotate(err, errBindFields)
+				validationError.add(param, ParamRuleType, err.Error())
+				continue
 			}
 
 		case "query":
@@ -505,10 +505,12 @@ func (a *Api) BindFields(
 			paramValues, ok := queryValues[param.name]
 			if ok {
 				if err = utility.ConvertAssign(value, paramValues...); err != nil {
-					return errors.Annotate(err, errBindFields)
+					validationError.add(param, ParamRuleType, err.Error())
+					continue
 				}
 			} else if param.IsRequired() {
-				return errors.Annotate(errors.New("missing query param"), errBindFields)
+				validationError.add(param, KEY_REQUIRED, "missing query param")
+				continue
 			}
 
 		case "formData":
@@ -521,8 +523,9 @@ func (a *Api) BindFields(
 					fhs := req.MultipartForm.File[param.name]
 					if len(fhs) == 0 {
 						if param.IsRequired() {
-							return errors.Annotate(errors.New("missing formData param"), errBindFields)
+							validationError.add(param, KEY_REQUIRED, "missing formData param")
 						}
+						continue
 					}
 					typ := value.Type()
 					switch typ.String() {
@@ -546,24 +549,30 @@ func (a *Api) BindFields(
 						)
 					}
 				} else if param.IsRequired() {
-					return errors.Annotate(errors.New("missing formData param"), errBindFields)
+					validationError.add(param, KEY_REQUIRED, "missing formData param")
+					continue
 				}
+				// the rules of the uploaded files are validated below
+				break
 			}
 			if req.MultipartForm != nil {
 				paramValues, ok := req.MultipartForm.Value[param.name]
 				if ok {
 					if err = utility.ConvertAssign(value, paramValues...); err != nil {
-						return errors.Annotate(err, errBindFields)
+						validationError.add(param, ParamRuleType, err.Error())
+						continue
 					}
 				}
 			}
 			paramValues, ok := req.PostForm[param.name]
 			if ok {
 				if err = utility.ConvertAssign(value, paramValues...); err != nil {
-					return errors.Annotate(err, errBindFields)
+					validationError.add(param, ParamRuleType, err.Error())
+					continue
 				}
 			} else if param.IsRequired() {
-				return errors.Annotate(errors.New("missing formData param"), errBindFields)
+				validationError.add(param, KEY_REQUIRED, "missing formData param")
+				continue
 			}
 		case "body":
 			// Theoretically there should be at most one `body` param, and can not exist with `formData` at the same time
@@ -571,21 +580,32 @@ func (a *Api) BindFields(
 			body, err = ioutil.ReadAll(req.Body)
 			req.Body.Close()
 			if err == nil {
-				if err = a.bodydecoder(value, body); err != nil {
-					return errors.Annotate(err, errBindFields)
+				bodydecoder := a.bodydecoder
+				if bodydecoder == nil {
+					if bodydecoder, err = bodyDecoderOf(req); err != nil {
+						validationError.add(param, ParamRuleDecode, err.Error())
+						continue
+					}
+				}
+				if err = bodydecoder(value.Addr().Interface(), body); err != nil {
+					validationError.add(param, ParamRuleDecode, err.Error())
+					continue
 				}
 			} else if param.IsRequired() {
-				return errors.Annotate(errors.New("missing body param"), errBindFields)
+				validationError.add(param, KEY_REQUIRED, "missing body param")
+				continue
 			}
 
 		case "header":
 			paramValues, ok := req.Header[param.name]
 			if ok {
 				if err = utility.ConvertAssign(value, paramValues...); err != nil {
-					return errors.Annotate(err, errBindFields)
+					validationError.add(param, ParamRuleType, err.Error())
+					continue
 				}
 			} else if param.IsRequired() {
-				return errors.Annotate(errors.New("missing header param"), errBindFields)
+				validationError.add(param, KEY_REQUIRED, "missing header param")
+				continue
 			}
 
 		case "cookie":
@@ -598,18 +618,23 @@ func (a *Api) BindFields(
 					value.Set(reflect.ValueOf(c).Elem())
 				default:
 					if err = utility.ConvertAssign(value, []string{c.Value}...); err != nil {
-						return errors.Annotate(err, errBindFields)
+						validationError.add(param, ParamRuleType, err.Error())
+						continue
 					}
 				}
 			} else if param.IsRequired() {
-				return errors.Annotate(errors.New("missing cookie param"), errBindFields)
+				validationError.add(param, KEY_REQUIRED, "missing cookie param")
+				continue
 			}
 		}
-		if err = param.validate(value); err != nil {
-			return errors.Annotate(err, errBindFields)
+		if rule, reason, err := param.validateRules(value); err != nil {
+			validationError.add(param, rule, reason)
 		}
 	}
-	return
+	if len(validationError.Errors) > 0 {
+		return errors.Annotate(validationError, errBindFields)
+	}
+	return nil
 }
 
 // Params gets the parameter information
@@ -673,7 +698,11 @@ func (h *apiHandler) Serve(ctx *Context) error {
 	obj, err := h.api.BindNew(ctx.Request, ctx.apiParams)
 	if err != nil {
 		ctx.Context.Abort()
-		return routing.NewHTTPError(http.StatusBadRequest, err.Error())
+		if BindErrorHandler == nil {
+			return routing.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		BindErrorHandler(ctx, err)
+		return nil
 	}
 	return obj.(Handler).Serve(ctx)
 }
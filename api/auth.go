@@ -0,0 +1,371 @@
+package api
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ltick/tick-routing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	errNewHtpasswdAuthenticator = "api: new htpasswd authenticator error"
+	errParseJWT                 = "api: parse jwt error"
+)
+
+// JWT signing algorithms
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+)
+
+// PasswordPlainPrefix marks a password of a BasicAuthenticator stored in plain text.
+const PasswordPlainPrefix = "{PLAIN}"
+
+// minHS256SecretLength is the size of the output of SHA-256, the shortest secret RFC 7518 allows for HS256.
+const minHS256SecretLength = 32
+
+type (
+	// Authenticator verifies the credentials carried by a request.
+	// On success it may attach claims to the context, which handlers
+	// can read back with ctx.Claims().
+	Authenticator interface {
+		Authenticate(ctx *Context) error
+	}
+	// AuthenticatorFunc adapts an ordinary function to an Authenticator.
+	AuthenticatorFunc func(ctx *Context) error
+
+	// Claims is the set of attributes an Authenticator asserts about the caller.
+	Claims map[string]interface{}
+
+	// BasicAuthenticator verifies HTTP basic auth credentials against a user list.
+	// Passwords are stored as htpasswd style hashes (bcrypt "$2y$" and "{SHA}"),
+	// or in plain text prefixed with PasswordPlainPrefix. Other formats never match.
+	BasicAuthenticator struct {
+		Realm string
+		users map[string]string
+	}
+
+	// TokenAuthenticator verifies a bearer token or an api key.
+	// The token is read from Header, stripped of Scheme if set, or from
+	// the QueryParam url parameter when the header is absent.
+	TokenAuthenticator struct {
+		Header     string
+		Scheme     string
+		QueryParam string
+		// Validate returns the claims of a valid token.
+		Validate func(token string) (Claims, error)
+	}
+
+	// JWTAuthenticator verifies JSON Web Tokens signed with HS256 or RS256
+	// passed as a bearer token.
+	JWTAuthenticator struct {
+		Algorithm string
+		Secret    []byte
+		PublicKey *rsa.PublicKey
+		Issuer    string
+		Audience  string
+		// Leeway is the clock skew tolerated when checking exp and nbf.
+		Leeway time.Duration
+	}
+)
+
+func (f AuthenticatorFunc) Authenticate(ctx *Context) error {
+	return f(ctx)
+}
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Issuer returns the "iss" claim.
+func (c Claims) Issuer() string {
+	iss, _ := c["iss"].(string)
+	return iss
+}
+
+// HasAudience reports whether the "aud" claim contains audience.
+func (c Claims) HasAudience(audience string) bool {
+	switch aud := c["aud"].(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c Claims) timeClaim(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(i, 0), true
+	}
+	return time.Time{}, false
+}
+
+// Unauthorized returns a 401 error and asks the client to authenticate with scheme.
+func Unauthorized(ctx *Context, scheme string, realm string, message string) error {
+	if realm != "" {
+		scheme += ` realm="` + realm + `"`
+	}
+	ctx.ResponseWriter.Header().Set(HeaderWWWAuthenticate, scheme)
+	return routing.NewHTTPError(http.StatusUnauthorized, message)
+}
+
+/********** Basic **********/
+func NewBasicAuthenticator(realm string, users map[string]string) *BasicAuthenticator {
+	a := &BasicAuthenticator{
+		Realm: realm,
+		users: make(map[string]string, len(users)),
+	}
+	for username, password := range users {
+		a.users[username] = password
+	}
+	return a
+}
+
+// NewHtpasswdAuthenticator loads users from a htpasswd style file,
+// one "username:hash" per line.
+func NewHtpasswdAuthenticator(realm string, htpasswdFile string) (*BasicAuthenticator, error) {
+	f, err := os.Open(htpasswdFile)
+	if err != nil {
+		return nil, errors.Annotate(err, errNewHtpasswdAuthenticator)
+	}
+	defer f.Close()
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.Annotate(errors.Errorf("malformed line '%s'", line), errNewHtpasswdAuthenticator)
+		}
+		users[parts[0]] = parts[1]
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Annotate(err, errNewHtpasswdAuthenticator)
+	}
+	return NewBasicAuthenticator(realm, users), nil
+}
+
+func (a *BasicAuthenticator) Authenticate(ctx *Context) error {
+	username, password, ok := ctx.Request.BasicAuth()
+	if !ok {
+		return Unauthorized(ctx, "Basic", a.Realm, "authorization required")
+	}
+	hashed, ok := a.users[username]
+	if !ok || !verifyPassword(hashed, password) {
+		return Unauthorized(ctx, "Basic", a.Realm, "invalid username or password")
+	}
+	ctx.SetClaims(Claims{"sub": username})
+	return nil
+}
+
+func verifyPassword(hashed string, password string) bool {
+	switch {
+	case strings.HasPrefix(hashed, "$2y$"), strings.HasPrefix(hashed, "$2a$"), strings.HasPrefix(hashed, "$2b$"):
+		return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+	case strings.HasPrefix(hashed, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(hashed[len("{SHA}"):]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	case strings.HasPrefix(hashed, PasswordPlainPrefix):
+		return subtle.ConstantTimeCompare([]byte(hashed[len(PasswordPlainPrefix):]), []byte(password)) == 1
+	}
+	// an unsupported hash ($apr1$, crypt...) would otherwise be the password itself
+	return false
+}
+
+/********** Token **********/
+// NewBearerTokenAuthenticator accepts "Authorization: Bearer <token>" for any of the given tokens.
+func NewBearerTokenAuthenticator(tokens ...string) *TokenAuthenticator {
+	return &TokenAuthenticator{
+		Header:   HeaderAuthorization,
+		Scheme:   "Bearer",
+		Validate: staticTokenValidator(tokens),
+	}
+}
+
+// NewAPIKeyAuthenticator accepts any of the given keys in header, or in the "api_key" url parameter.
+func NewAPIKeyAuthenticator(header string, keys ...string) *TokenAuthenticator {
+	return &TokenAuthenticator{
+		Header:     header,
+		QueryParam: "api_key",
+		Validate:   staticTokenValidator(keys),
+	}
+}
+
+func staticTokenValidator(tokens []string) func(string) (Claims, error) {
+	return func(token string) (Claims, error) {
+		for _, t := range tokens {
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				return Claims{}, nil
+			}
+		}
+		return nil, errors.New("invalid token")
+	}
+}
+
+func (a *TokenAuthenticator) token(ctx *Context) string {
+	if a.Header != "" {
+		if value := ctx.Request.Header.Get(a.Header); value != "" {
+			if a.Scheme == "" {
+				return value
+			}
+			if len(value) > len(a.Scheme) && strings.EqualFold(value[:len(a.Scheme)], a.Scheme) && value[len(a.Scheme)] == ' ' {
+				return strings.TrimSpace(value[len(a.Scheme)+1:])
+			}
+			return ""
+		}
+	}
+	if a.QueryParam != "" {
+		return ctx.Request.URL.Query().Get(a.QueryParam)
+	}
+	return ""
+}
+
+func (a *TokenAuthenticator) Authenticate(ctx *Context) error {
+	scheme := a.Scheme
+	if scheme == "" {
+		scheme = "ApiKey"
+	}
+	token := a.token(ctx)
+	if token == "" {
+		return Unauthorized(ctx, scheme, "", "authorization required")
+	}
+	if a.Validate == nil {
+		return Unauthorized(ctx, scheme, "", "invalid token")
+	}
+	claims, err := a.Validate(token)
+	if err != nil {
+		return Unauthorized(ctx, scheme, "", err.Error())
+	}
+	if claims != nil {
+		ctx.SetClaims(claims)
+	}
+	return nil
+}
+
+/********** JWT **********/
+// NewHS256Authenticator verifies the tokens signed with secret, which needs at least 32 bytes.
+func NewHS256Authenticator(secret []byte) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		Algorithm: JWTAlgorithmHS256,
+		Secret:    secret,
+	}
+}
+
+func NewRS256Authenticator(publicKey *rsa.PublicKey) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		Algorithm: JWTAlgorithmRS256,
+		PublicKey: publicKey,
+	}
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx *Context) error {
+	token := (&TokenAuthenticator{Header: HeaderAuthorization, Scheme: "Bearer"}).token(ctx)
+	if token == "" {
+		return Unauthorized(ctx, "Bearer", "", "authorization required")
+	}
+	claims, err := a.Parse(token)
+	if err != nil {
+		return Unauthorized(ctx, "Bearer", "", errors.Cause(err).Error())
+	}
+	ctx.SetClaims(claims)
+	return nil
+}
+
+// Parse verifies the signature and the registered claims of token and returns its claims.
+func (a *JWTAuthenticator) Parse(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.Annotate(errors.New("token is malformed"), errParseJWT)
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.Annotate(err, errParseJWT)
+	}
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err = json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, errors.Annotate(err, errParseJWT)
+	}
+	if header.Alg != a.Algorithm {
+		return nil, errors.Annotate(errors.Errorf("unexpected signing algorithm '%s'", header.Alg), errParseJWT)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Annotate(err, errParseJWT)
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	switch a.Algorithm {
+	case JWTAlgorithmHS256:
+		if len(a.Secret) < minHS256SecretLength {
+			return nil, errors.Annotate(errors.New("secret is missing or too short"), errParseJWT)
+		}
+		mac := hmac.New(sha256.New, a.Secret)
+		mac.Write(signingInput)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.Annotate(errors.New("signature is invalid"), errParseJWT)
+		}
+	case JWTAlgorithmRS256:
+		if a.PublicKey == nil {
+			return nil, errors.Annotate(errors.New("public key is missing"), errParseJWT)
+		}
+		digest := sha256.Sum256(signingInput)
+		if err = rsa.VerifyPKCS1v15(a.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, errors.Annotate(errors.New("signature is invalid"), errParseJWT)
+		}
+	default:
+		return nil, errors.Annotate(errors.Errorf("unsupported signing algorithm '%s'", a.Algorithm), errParseJWT)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.Annotate(err, errParseJWT)
+	}
+	claims := Claims{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.Annotate(err, errParseJWT)
+	}
+	now := time.Now()
+	if exp, ok := claims.timeClaim("exp"); ok && now.After(exp.Add(a.Leeway)) {
+		return nil, errors.Annotate(errors.New("token is expired"), errParseJWT)
+	}
+	if nbf, ok := claims.timeClaim("nbf"); ok && now.Add(a.Leeway).Before(nbf) {
+		return nil, errors.Annotate(errors.New("token is not valid yet"), errParseJWT)
+	}
+	if a.Issuer != "" && claims.Issuer() != a.Issuer {
+		return nil, errors.Annotate(errors.New("issuer is invalid"), errParseJWT)
+	}
+	if a.Audience != "" && !claims.HasAudience(a.Audience) {
+		return nil, errors.Annotate(errors.New("audience is invalid"), errParseJWT)
+	}
+	return claims, nil
+}
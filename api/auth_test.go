@@ -0,0 +1,105 @@
+package api
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func signJWT(t *testing.T, alg string, claims Claims, sign func([]byte) []byte) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	assert.Nil(t, err)
+	payload, err := json.Marshal(claims)
+	assert.Nil(t, err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signingInput)))
+}
+
+func TestJWTAuthenticatorHS256(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	hs256 := func(input []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	a := NewHS256Authenticator(secret)
+	a.Issuer = "ltick"
+	token := signJWT(t, JWTAlgorithmHS256, Claims{"sub": "foo", "iss": "ltick", "exp": time.Now().Add(time.Minute).Unix()}, hs256)
+	claims, err := a.Parse(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", claims.Subject())
+
+	expired := signJWT(t, JWTAlgorithmHS256, Claims{"sub": "foo", "iss": "ltick", "exp": time.Now().Add(-time.Minute).Unix()}, hs256)
+	_, err = a.Parse(expired)
+	assert.NotNil(t, err)
+
+	wrongIssuer := signJWT(t, JWTAlgorithmHS256, Claims{"sub": "foo", "iss": "other"}, hs256)
+	_, err = a.Parse(wrongIssuer)
+	assert.NotNil(t, err)
+
+	_, err = NewHS256Authenticator([]byte("fedcba9876543210fedcba9876543210")).Parse(token)
+	assert.NotNil(t, err)
+
+	// an empty or short secret would let anyone sign the tokens
+	for _, weak := range [][]byte{nil, []byte("secret")} {
+		weakToken := signJWT(t, JWTAlgorithmHS256, Claims{"sub": "foo"}, func(input []byte) []byte {
+			mac := hmac.New(sha256.New, weak)
+			mac.Write(input)
+			return mac.Sum(nil)
+		})
+		_, err = NewHS256Authenticator(weak).Parse(weakToken)
+		assert.NotNil(t, err)
+	}
+
+	// an RS256 authenticator must not accept an HS256 token
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(t, err)
+	_, err = NewRS256Authenticator(&key.PublicKey).Parse(token)
+	assert.NotNil(t, err)
+}
+
+func TestJWTAuthenticatorRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(t, err)
+	rs256 := func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		assert.Nil(t, err)
+		return signature
+	}
+	a := NewRS256Authenticator(&key.PublicKey)
+	a.Audience = "api"
+	token := signJWT(t, JWTAlgorithmRS256, Claims{"sub": "bar", "aud": []string{"web", "api"}}, rs256)
+	claims, err := a.Parse(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", claims.Subject())
+
+	token = signJWT(t, JWTAlgorithmRS256, Claims{"sub": "bar", "aud": "web"}, rs256)
+	_, err = a.Parse(token)
+	assert.NotNil(t, err)
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	assert.True(t, verifyPassword(string(hashed), "password"))
+	assert.False(t, verifyPassword(string(hashed), "wrong"))
+	// htpasswd -s
+	assert.True(t, verifyPassword("{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "password"))
+	assert.False(t, verifyPassword("{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "wrong"))
+	assert.True(t, verifyPassword(PasswordPlainPrefix+"password", "password"))
+	assert.False(t, verifyPassword(PasswordPlainPrefix+"password", "wrong"))
+	// the unsupported formats never match, not even the stored value itself
+	assert.False(t, verifyPassword("password", "password"))
+	assert.False(t, verifyPassword("$apr1$salt$hash", "$apr1$salt$hash"))
+	assert.False(t, verifyPassword("$6$salt$hash", "$6$salt$hash"))
+}
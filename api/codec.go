@@ -0,0 +1,289 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/juju/errors"
+	"github.com/ltick/tick-framework/utility"
+	"github.com/ltick/tick-routing"
+	"github.com/vmihailenco/msgpack"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	errProtobufMessage  = "api: protobuf codec requires a proto.Message"
+	errFormDestination  = "api: form decoder requires a struct pointer or an url.Values pointer"
+	errFormData         = "api: form data writer requires a struct, a map or an url.Values"
+	errUnsupportedCodec = "api: unsupported content type"
+)
+
+// Other MIME types supported by the body decoders and the data writers
+const (
+	MIMEApplicationYAML      = "application/yaml"
+	MIMEApplicationXYAML     = "application/x-yaml"
+	MIMETextYAML             = "text/yaml"
+	MIMEApplicationXMsgpack  = "application/x-msgpack"
+	MIMEApplicationXProtobuf = "application/x-protobuf"
+)
+
+// TAG_FORM is the struct tag naming the fields in the url-encoded bodies.
+const TAG_FORM = "form"
+
+var bodyDecoders = struct {
+	sync.RWMutex
+	m map[string]Bodydecoder
+}{
+	m: map[string]Bodydecoder{
+		MIMEApplicationJSON:      JSONBodyDecoder,
+		MIMEApplicationXML:       XMLBodyDecoder,
+		MIMETextXML:              XMLBodyDecoder,
+		MIMEApplicationYAML:      YAMLBodyDecoder,
+		MIMEApplicationXYAML:     YAMLBodyDecoder,
+		MIMETextYAML:             YAMLBodyDecoder,
+		MIMEApplicationMsgpack:   MsgpackBodyDecoder,
+		MIMEApplicationXMsgpack:  MsgpackBodyDecoder,
+		MIMEApplicationProtobuf:  ProtobufBodyDecoder,
+		MIMEApplicationXProtobuf: ProtobufBodyDecoder,
+		MIMEApplicationForm:      FormBodyDecoder,
+	},
+}
+
+// RegisterBodyDecoder registers the decoder of the `in:"body"` params sent with the content type,
+// replacing the one registered before.
+func RegisterBodyDecoder(contentType string, decoder Bodydecoder) {
+	bodyDecoders.Lock()
+	bodyDecoders.m[mediaType(contentType)] = decoder
+	bodyDecoders.Unlock()
+}
+
+// GetBodyDecoder returns the decoder registered for the content type, the parameters of the content type are ignored.
+func GetBodyDecoder(contentType string) (Bodydecoder, bool) {
+	bodyDecoders.RLock()
+	decoder, ok := bodyDecoders.m[mediaType(contentType)]
+	bodyDecoders.RUnlock()
+	return decoder, ok
+}
+
+// bodyDecoderOf returns the decoder of the request body, JSON if the request has no content type.
+func bodyDecoderOf(req *http.Request) (Bodydecoder, error) {
+	contentType := req.Header.Get(HeaderContentType)
+	if contentType == "" {
+		return JSONBodyDecoder, nil
+	}
+	decoder, ok := GetBodyDecoder(contentType)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s", errUnsupportedCodec, contentType)
+	}
+	return decoder, nil
+}
+
+func mediaType(contentType string) string {
+	if mediatype, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediatype
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// JSONBodyDecoder decodes JSON bodies.
+func JSONBodyDecoder(dest interface{}, body []byte) error {
+	return json.Unmarshal(body, dest)
+}
+
+// XMLBodyDecoder decodes XML bodies.
+func XMLBodyDecoder(dest interface{}, body []byte) error {
+	return xml.Unmarshal(body, dest)
+}
+
+// YAMLBodyDecoder decodes YAML bodies.
+func YAMLBodyDecoder(dest interface{}, body []byte) error {
+	return yaml.Unmarshal(body, dest)
+}
+
+// MsgpackBodyDecoder decodes msgpack bodies, the fields are named by their `json` tag like in JSON bodies.
+func MsgpackBodyDecoder(dest interface{}, body []byte) error {
+	return msgpack.NewDecoder(bytes.NewReader(body)).UseJSONTag(true).Decode(dest)
+}
+
+// ProtobufBodyDecoder decodes protobuf bodies, dest must be a proto.Message.
+func ProtobufBodyDecoder(dest interface{}, body []byte) error {
+	message, ok := dest.(proto.Message)
+	if !ok {
+		return errors.New(errProtobufMessage)
+	}
+	return proto.Unmarshal(body, message)
+}
+
+// FormBodyDecoder decodes url-encoded bodies into an url.Values or a struct,
+// the fields are named by their `form` tag, else their `json` tag, else their snake cased name.
+func FormBodyDecoder(dest interface{}, body []byte) error {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return err
+	}
+	if v, ok := dest.(*url.Values); ok {
+		*v = values
+		return nil
+	}
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return errors.New(errFormDestination)
+	}
+	value = value.Elem()
+	t := value.Type()
+	for i, count := 0, t.NumField(); i < count; i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := formFieldName(field)
+		if name == "-" {
+			continue
+		}
+		if fieldValues, ok := values[name]; ok {
+			if err := utility.ConvertAssign(value.Field(i), fieldValues...); err != nil {
+				return errors.Annotatef(err, "form field %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+func formFieldName(field reflect.StructField) string {
+	for _, tagName := range []string{TAG_FORM, "json"} {
+		if tag := field.Tag.Get(tagName); tag != "" {
+			if name := strings.Split(tag, ",")[0]; name != "" {
+				return name
+			}
+		}
+	}
+	return utility.SnakeString(field.Name)
+}
+
+// DataWriters are the response writers of the wire formats supported by the body decoders other than JSON and XML,
+// the server registers them to its type negotiator.
+var DataWriters = map[string]routing.DataWriter{
+	MIMEApplicationYAML:     &YAMLDataWriter{},
+	MIMEApplicationMsgpack:  &MsgpackDataWriter{},
+	MIMEApplicationProtobuf: &ProtobufDataWriter{},
+	MIMEApplicationForm:     &FormDataWriter{},
+}
+
+// YAMLDataWriter sets the "Content-Type" response header as "application/yaml; charset=UTF-8" and writes the given data in YAML format to the response.
+type YAMLDataWriter struct{}
+
+func (w *YAMLDataWriter) SetHeader(res http.ResponseWriter) {
+	res.Header().Set(HeaderContentType, MIMEApplicationYAML+"; "+CharsetUTF8)
+}
+
+func (w *YAMLDataWriter) Write(res http.ResponseWriter, data interface{}) error {
+	b, err := yaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = res.Write(b)
+	return err
+}
+
+// MsgpackDataWriter sets the "Content-Type" response header as "application/msgpack" and writes the given data in msgpack format to the response.
+type MsgpackDataWriter struct{}
+
+func (w *MsgpackDataWriter) SetHeader(res http.ResponseWriter) {
+	res.Header().Set(HeaderContentType, MIMEApplicationMsgpack)
+}
+
+func (w *MsgpackDataWriter) Write(res http.ResponseWriter, data interface{}) error {
+	return msgpack.NewEncoder(res).UseJSONTag(true).Encode(data)
+}
+
+// ProtobufDataWriter sets the "Content-Type" response header as "application/protobuf" and writes the given proto.Message to the response.
+type ProtobufDataWriter struct{}
+
+func (w *ProtobufDataWriter) SetHeader(res http.ResponseWriter) {
+	res.Header().Set(HeaderContentType, MIMEApplicationProtobuf)
+}
+
+func (w *ProtobufDataWriter) Write(res http.ResponseWriter, data interface{}) error {
+	message, ok := data.(proto.Message)
+	if !ok {
+		return errors.New(errProtobufMessage)
+	}
+	b, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = res.Write(b)
+	return err
+}
+
+// FormDataWriter sets the "Content-Type" response header as "application/x-www-form-urlencoded" and writes the given
+// url.Values, map or struct url-encoded to the response, the struct fields are named like in FormBodyDecoder.
+type FormDataWriter struct{}
+
+func (w *FormDataWriter) SetHeader(res http.ResponseWriter) {
+	res.Header().Set(HeaderContentType, MIMEApplicationForm)
+}
+
+func (w *FormDataWriter) Write(res http.ResponseWriter, data interface{}) error {
+	values, err := formValues(data)
+	if err != nil {
+		return err
+	}
+	_, err = res.Write([]byte(values.Encode()))
+	return err
+}
+
+func formValues(data interface{}) (url.Values, error) {
+	if values, ok := data.(url.Values); ok {
+		return values, nil
+	}
+	values := url.Values{}
+	value := reflect.Indirect(reflect.ValueOf(data))
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, errors.New(errFormData)
+		}
+		for _, key := range value.MapKeys() {
+			addFormValue(values, key.String(), value.MapIndex(key))
+		}
+	case reflect.Struct:
+		t := value.Type()
+		for i, count := 0, t.NumField(); i < count; i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if name := formFieldName(field); name != "-" {
+				addFormValue(values, name, value.Field(i))
+			}
+		}
+	default:
+		return nil, errors.New(errFormData)
+	}
+	return values, nil
+}
+
+func addFormValue(values url.Values, name string, value reflect.Value) {
+	if value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Slice && value.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < value.Len(); i++ {
+			values.Add(name, fmt.Sprint(value.Index(i).Interface()))
+		}
+		return
+	}
+	if value.IsValid() {
+		values.Add(name, fmt.Sprint(value.Interface()))
+	}
+}
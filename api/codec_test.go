@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack"
+)
+
+type codecUser struct {
+	Name string   `json:"name" yaml:"name" xml:"name"`
+	Age  int      `json:"age" yaml:"age" xml:"age"`
+	Tags []string `json:"tags" yaml:"tags" xml:"tags"`
+}
+
+type codecHandler struct {
+	User codecUser `param:"<in:body>"`
+}
+
+func (h *codecHandler) Serve(ctx *Context) error {
+	return nil
+}
+
+func TestBodyDecoderByContentType(t *testing.T) {
+	msgpackBody := new(bytes.Buffer)
+	assert.Nil(t, msgpack.NewEncoder(msgpackBody).UseJSONTag(true).Encode(codecUser{Name: "ltick", Age: 3, Tags: []string{"a", "b"}}))
+	for contentType, body := range map[string]string{
+		"":                                      `{"name":"ltick","age":3,"tags":["a","b"]}`,
+		MIMEApplicationJSONCharsetUTF8:          `{"name":"ltick","age":3,"tags":["a","b"]}`,
+		MIMEApplicationXML:                      `<codecUser><name>ltick</name><age>3</age><tags>a</tags><tags>b</tags></codecUser>`,
+		MIMEApplicationYAML:                     "name: ltick\nage: 3\ntags: [a, b]\n",
+		MIMEApplicationMsgpack:                  msgpackBody.String(),
+		MIMEApplicationForm + "; charset=UTF-8": "name=ltick&age=3&tags=a&tags=b",
+	} {
+		api, err := NewApi(&codecHandler{}, nil, nil, false)
+		assert.Nil(t, err)
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(body))
+		if contentType != "" {
+			req.Header.Set(HeaderContentType, contentType)
+		}
+		handler, err := api.BindNew(req, nil)
+		if assert.Nil(t, err, contentType) {
+			assert.Equal(t, codecUser{Name: "ltick", Age: 3, Tags: []string{"a", "b"}}, handler.(*codecHandler).User, contentType)
+		}
+	}
+
+	api, err := NewApi(&codecHandler{}, nil, nil, false)
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("POST", "/", bytes.NewBufferString("ltick"))
+	req.Header.Set(HeaderContentType, "application/unknown")
+	_, err = api.BindNew(req, nil)
+	validationError, ok := AsValidationError(err)
+	if assert.True(t, ok) && assert.Len(t, validationError.Errors, 1) {
+		assert.Equal(t, ParamRuleDecode, validationError.Errors[0].Rule)
+	}
+
+	RegisterBodyDecoder("application/unknown", func(dest interface{}, body []byte) error {
+		dest.(*codecUser).Name = string(body)
+		return nil
+	})
+	req, _ = http.NewRequest("POST", "/", bytes.NewBufferString("ltick"))
+	req.Header.Set(HeaderContentType, "application/unknown")
+	handler, err := api.BindNew(req, nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "ltick", handler.(*codecHandler).User.Name)
+	}
+}
+
+func TestDataWriters(t *testing.T) {
+	user := codecUser{Name: "ltick", Age: 3, Tags: []string{"a", "b"}}
+
+	res := httptest.NewRecorder()
+	DataWriters[MIMEApplicationYAML].SetHeader(res)
+	assert.Nil(t, DataWriters[MIMEApplicationYAML].Write(res, user))
+	assert.Equal(t, MIMEApplicationYAML+"; "+CharsetUTF8, res.Header().Get(HeaderContentType))
+	var yamlUser codecUser
+	assert.Nil(t, YAMLBodyDecoder(&yamlUser, res.Body.Bytes()))
+	assert.Equal(t, user, yamlUser)
+
+	res = httptest.NewRecorder()
+	assert.Nil(t, DataWriters[MIMEApplicationMsgpack].Write(res, user))
+	var msgpackUser codecUser
+	assert.Nil(t, MsgpackBodyDecoder(&msgpackUser, res.Body.Bytes()))
+	assert.Equal(t, user, msgpackUser)
+
+	res = httptest.NewRecorder()
+	assert.Nil(t, DataWriters[MIMEApplicationForm].Write(res, user))
+	values, err := url.ParseQuery(res.Body.String())
+	assert.Nil(t, err)
+	assert.Equal(t, url.Values{"name": {"ltick"}, "age": {"3"}, "tags": {"a", "b"}}, values)
+
+	res = httptest.NewRecorder()
+	assert.NotNil(t, DataWriters[MIMEApplicationProtobuf].Write(res, user))
+}
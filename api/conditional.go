@@ -0,0 +1,153 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderIfRange      = "If-Range"
+	HeaderRange        = "Range"
+	HeaderContentRange = "Content-Range"
+	HeaderAcceptRanges = "Accept-Ranges"
+)
+
+// AutoETag enables the ETag generation of the byte and file responses.
+var AutoETag = true
+
+// StrongETag returns the strong entity tag of the content.
+func StrongETag(content []byte) string {
+	sum := sha1.Sum(content)
+	return "\"" + hex.EncodeToString(sum[:]) + "\""
+}
+
+// WeakETag returns the weak entity tag of a file, derived from its size and modification time.
+func WeakETag(size int64, modTime time.Time) string {
+	return "W/\"" + strconv.FormatInt(size, 16) + "-" + strconv.FormatInt(modTime.UnixNano(), 16) + "\""
+}
+
+// ETagWeakMatch reports whether one of the entity tags of an If-None-Match header matches etag,
+// ignoring the weakness of the tags.
+func ETagWeakMatch(ifNoneMatch string, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagStrongMatch reports whether two entity tags are the same strong tag.
+func etagStrongMatch(a string, b string) bool {
+	return a != "" && a == b && !strings.HasPrefix(a, "W/")
+}
+
+// isConditionalMethod reports whether the conditional and range headers apply to the request.
+func (ctx *Context) isConditionalMethod() bool {
+	return ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead
+}
+
+// notModified answers 304 Not Modified when the If-None-Match or, without it, the
+// If-Modified-Since request header matches the ETag or the Last-Modified response header.
+func (ctx *Context) notModified() bool {
+	header := ctx.Response.Header()
+	if ifNoneMatch := ctx.Request.Header.Get(HeaderIfNoneMatch); ifNoneMatch != "" {
+		if !ETagWeakMatch(ifNoneMatch, header.Get(HeaderETag)) {
+			return false
+		}
+	} else {
+		ifModifiedSince, err := http.ParseTime(ctx.Request.Header.Get(HeaderIfModifiedSince))
+		if err != nil {
+			return false
+		}
+		lastModified, err := http.ParseTime(header.Get(HeaderLastModified))
+		if err != nil || lastModified.After(ifModifiedSince) {
+			return false
+		}
+	}
+	header.Del(HeaderContentType)
+	header.Del(HeaderContentLength)
+	header.Del(HeaderContentEncoding)
+	ctx.Response.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// parseRange parses a single range "bytes=start-end" of a content of size bytes,
+// ok is false when the header is not a single byte range, which lets the whole content be served.
+func parseRange(rangeHeader string, size int64) (start int64, end int64, ok bool, satisfiable bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(rangeHeader, prefix) {
+		return 0, 0, false, false
+	}
+	spec := strings.TrimSpace(rangeHeader[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return 0, 0, false, false
+	}
+	index := strings.Index(spec, "-")
+	if index < 0 {
+		return 0, 0, false, false
+	}
+	startSpec, endSpec := strings.TrimSpace(spec[:index]), strings.TrimSpace(spec[index+1:])
+	var err error
+	if startSpec == "" {
+		// the last bytes
+		suffix, err := strconv.ParseInt(endSpec, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, false, false
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size - 1, true, true
+	}
+	if start, err = strconv.ParseInt(startSpec, 10, 64); err != nil || start < 0 {
+		return 0, 0, false, false
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	end = size - 1
+	if endSpec != "" {
+		if end, err = strconv.ParseInt(endSpec, 10, 64); err != nil || end < start {
+			return 0, 0, false, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true, true
+}
+
+// rangeApplies reports whether the Range request header applies, the If-Range
+// header must then match the ETag or the Last-Modified response header.
+func (ctx *Context) rangeApplies() bool {
+	if ctx.Request.Method != http.MethodGet || ctx.Request.Header.Get(HeaderRange) == "" {
+		return false
+	}
+	ifRange := ctx.Request.Header.Get(HeaderIfRange)
+	if ifRange == "" {
+		return true
+	}
+	header := ctx.Response.Header()
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		return etagStrongMatch(ifRange, header.Get(HeaderETag))
+	}
+	ifRangeTime, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get(HeaderLastModified))
+	return err == nil && !lastModified.After(ifRangeTime)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ltick/tick-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func newConditionalTestContext(header http.Header) (*Context, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	res := httptest.NewRecorder()
+	c := routing.NewContext(res, req)
+	return &Context{Context: c, Response: NewResponse(c)}, res
+}
+
+func TestParseRange(t *testing.T) {
+	for rangeHeader, expected := range map[string][4]interface{}{
+		"bytes=0-4":     {int64(0), int64(4), true, true},
+		"bytes=5-":      {int64(5), int64(9), true, true},
+		"bytes=-3":      {int64(7), int64(9), true, true},
+		"bytes=8-100":   {int64(8), int64(9), true, true},
+		"bytes=10-":     {int64(0), int64(0), true, false},
+		"bytes=4-2":     {int64(0), int64(0), false, false},
+		"bytes=0-1,3-4": {int64(0), int64(0), false, false},
+		"items=0-4":     {int64(0), int64(0), false, false},
+	} {
+		start, end, ok, satisfiable := parseRange(rangeHeader, 10)
+		assert.Equal(t, expected, [4]interface{}{start, end, ok, satisfiable}, rangeHeader)
+	}
+}
+
+func TestResponseBytesConditional(t *testing.T) {
+	ctx, res := newConditionalTestContext(nil)
+	assert.Nil(t, ctx.ResponseBytes(http.StatusOK, MIMETextPlainCharsetUTF8, []byte("0123456789")))
+	etag := res.Header().Get(HeaderETag)
+	assert.Equal(t, StrongETag([]byte("0123456789")), etag)
+	assert.Equal(t, "0123456789", res.Body.String())
+
+	ctx, res = newConditionalTestContext(http.Header{HeaderIfNoneMatch: {"W/" + etag}})
+	assert.Nil(t, ctx.ResponseBytes(http.StatusOK, MIMETextPlainCharsetUTF8, []byte("0123456789")))
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Equal(t, 0, res.Body.Len())
+
+	ctx, res = newConditionalTestContext(http.Header{HeaderRange: {"bytes=2-4"}})
+	assert.Nil(t, ctx.ResponseBytes(http.StatusOK, MIMETextPlainCharsetUTF8, []byte("0123456789")))
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, "bytes 2-4/10", res.Header().Get(HeaderContentRange))
+	assert.Equal(t, "234", res.Body.String())
+
+	// a stale If-Range serves the whole content
+	ctx, res = newConditionalTestContext(http.Header{HeaderRange: {"bytes=2-4"}, HeaderIfRange: {"\"stale\""}})
+	assert.Nil(t, ctx.ResponseBytes(http.StatusOK, MIMETextPlainCharsetUTF8, []byte("0123456789")))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "0123456789", res.Body.String())
+
+	ctx, res = newConditionalTestContext(http.Header{HeaderRange: {"bytes=20-"}})
+	err := ctx.ResponseBytes(http.StatusOK, MIMETextPlainCharsetUTF8, []byte("0123456789"))
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, err.(routing.HTTPError).StatusCode())
+	assert.Equal(t, "bytes */10", res.Header().Get(HeaderContentRange))
+}
@@ -1,12 +1,16 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/ltick/tick-framework/database"
 	"github.com/ltick/tick-framework/session"
+	"github.com/ltick/tick-framework/tracing"
 	"github.com/ltick/tick-routing"
+	"github.com/ltick/tick-routing/content"
 )
 
 var errNotEnableSession = errors.New("before using the session, must set config `session::enable = true`...")
@@ -25,6 +29,8 @@ const (
 	HeaderCookie                        = "Cookie"
 	HeaderSetCookie                     = "Set-Cookie"
 	HeaderIfModifiedSince               = "If-Modified-Since"
+	HeaderIfNoneMatch                   = "If-None-Match"
+	HeaderETag                          = "ETag"
 	HeaderLastModified                  = "Last-Modified"
 	HeaderLocation                      = "Location"
 	HeaderReferer                       = "Referer"
@@ -50,6 +56,8 @@ const (
 	HeaderExpires                       = "Expires"
 	HeaderCacheControl                  = "Cache-Control"
 	HeaderPragma                        = "Pragma"
+	HeaderConnection                    = "Connection"
+	HeaderXAccelBuffering               = "X-Accel-Buffering"
 
 	// Security
 	HeaderStrictTransportSecurity = "Strict-Transport-Security"
@@ -79,6 +87,7 @@ const (
 	MIMETextPlainCharsetUTF8             = MIMETextPlain + "; " + CharsetUTF8
 	MIMEMultipartForm                    = "multipart/form-data"
 	MIMEOctetStream                      = "application/octet-stream"
+	MIMETextEventStream                  = "text/event-stream"
 )
 
 const (
@@ -128,9 +137,22 @@ type (
 		Session       *session.Session
 		sessionStore  session.Store
 		enableSession bool // Note: Never reset!
+
+		// claims asserted by the route authenticator
+		claims Claims
 	}
 )
 
+// SetClaims stores the claims of the authenticated caller.
+func (ctx *Context) SetClaims(claims Claims) {
+	ctx.claims = claims
+}
+
+// Claims returns the claims of the authenticated caller, nil if the route is not authenticated.
+func (ctx *Context) Claims() Claims {
+	return ctx.claims
+}
+
 // startSession starts session and load old session data info this controller.
 func (ctx *Context) startSession() (session.Store, error) {
 	if ctx.sessionStore != nil {
@@ -201,6 +223,36 @@ func (ctx *Context) DestroySession() {
 	ctx.Session.Destroy(ctx.ResponseWriter, ctx.Request)
 }
 
+// RequestID returns the id of the request, set by the RequestTracer middleware.
+func (ctx *Context) RequestID() string {
+	return tracing.RequestIDFromContext(ctx.Context.Context)
+}
+
+// TraceContext returns the trace context of the request, set by the RequestTracer middleware.
+func (ctx *Context) TraceContext() *tracing.TraceContext {
+	return tracing.TraceContextFromContext(ctx.Context.Context)
+}
+
+// DatabaseHandler returns the handler named name of the database component, bound to the context of the request:
+// its statements are canceled when the request times out or the client goes away.
+func (ctx *Context) DatabaseHandler(d *database.Database, name string) (database.DatabaseHandler, error) {
+	return d.GetContextHandler(ctx.RequestContext(), name)
+}
+
+// RequestContext returns the context of the request, done when the request times out or the client goes away.
+func (ctx *Context) RequestContext() context.Context {
+	if ctx.Context.Context != nil {
+		return ctx.Context.Context
+	}
+	return ctx.Request.Context()
+}
+
+// Language returns the language of the request chosen by the LanguageNegotiator handler, empty if none.
+func (ctx *Context) Language() string {
+	language, _ := ctx.Context.Get(content.Language).(string)
+	return language
+}
+
 // Redirect replies to the request with a redirect to url,
 // which may be a path relative to the request path.
 //
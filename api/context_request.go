@@ -635,6 +635,19 @@ func (ctx *Context) BindXML(xmlObject interface{}) error {
 	return xml.Unmarshal(rawData, &xmlObject)
 }
 
+// BindBody reads the request's body with the decoder registered for its content type, see RegisterBodyDecoder.
+func (ctx *Context) BindBody(obj interface{}) error {
+	decoder, err := bodyDecoderOf(ctx.Request)
+	if err != nil {
+		return err
+	}
+	rawData, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return err
+	}
+	return decoder(obj, rawData)
+}
+
 // LimitedBodyBytes returns the raw request body data as bytes.
 // Note:
 //  1.limited by maximum length;
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -47,7 +48,12 @@ func (ctx *Context) Status() int {
 // IsCachable returns boolean of this request is cached.
 // HTTP 304 means cached.
 func (ctx *Context) IsCachable() bool {
-	return ctx.Response.Status() >= 200 && ctx.Response.Status() < 300 || ctx.Response.Status() == 304
+	return IsCachableStatus(ctx.Response.Status())
+}
+
+// IsCachableStatus returns boolean of a response with the status is cached.
+func IsCachableStatus(status int) bool {
+	return status >= 200 && status < 300 || status == 304
 }
 
 // IsEmpty returns boolean of this request is empty.
@@ -199,12 +205,38 @@ func (ctx *Context) ResponseBytes(status int, contentType string, content []byte
 		return nil
 	}
 	ctx.Response.Header().Set(HeaderContentType, contentType)
-	if ctx.enableGzip && len(ctx.Response.Header()[HeaderContentEncoding]) == 0 {
+	if status == http.StatusOK && ctx.isConditionalMethod() {
+		if AutoETag && ctx.Response.Header().Get(HeaderETag) == "" {
+			ctx.Response.Header().Set(HeaderETag, StrongETag(content))
+		}
+		if ctx.notModified() {
+			return nil
+		}
+		ctx.Response.Header().Set(HeaderAcceptRanges, "bytes")
+		if ctx.rangeApplies() {
+			start, end, ok, satisfiable := parseRange(ctx.Request.Header.Get(HeaderRange), int64(len(content)))
+			if ok && !satisfiable {
+				ctx.Response.Header().Set(HeaderContentRange, "bytes */"+strconv.Itoa(len(content)))
+				rangeNotSatisfiable := NewResponseData("RequestedRangeNotSatisfiable", nil)
+				return routing.NewHTTPError(rangeNotSatisfiable.GetStatus(), rangeNotSatisfiable.GetMessage())
+			}
+			if ok {
+				ctx.Response.Header().Set(HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+				status = http.StatusPartialContent
+				content = content[start : end+1]
+			}
+		}
+	}
+	if status != http.StatusPartialContent && ctx.enableGzip && len(ctx.Response.Header()[HeaderContentEncoding]) == 0 {
 		buf := &bytes.Buffer{}
 		ok, encoding, _ := acceptencoder.WriteBody(acceptencoder.ParseEncoding(ctx.Request), buf, content)
 		if ok {
 			ctx.Response.Header().Set(HeaderContentEncoding, encoding)
 			content = buf.Bytes()
+			// the compressed content is only semantically equivalent
+			if etag := ctx.Response.Header().Get(HeaderETag); etag != "" && !strings.HasPrefix(etag, "W/") {
+				ctx.Response.Header().Set(HeaderETag, "W/"+etag)
+			}
 		}
 	}
 	ctx.Response.Header().Set(HeaderContentLength, strconv.Itoa(len(content)))
@@ -330,5 +362,11 @@ func (ctx *Context) File(localFilename string, showFilename ...string) {
 	ctx.Response.Header().Set(HeaderExpires, "0")
 	ctx.Response.Header().Set(HeaderCacheControl, "must-revalidate")
 	ctx.Response.Header().Set(HeaderPragma, "public")
+	if AutoETag && ctx.Response.Header().Get(HeaderETag) == "" {
+		if info, err := os.Stat(localFilename); err == nil && !info.IsDir() {
+			ctx.Response.Header().Set(HeaderETag, WeakETag(info.Size(), info.ModTime()))
+		}
+	}
+	// ServeFile answers the conditional and range requests with the ETag and the modification time
 	http.ServeFile(ctx.ResponseWriter, ctx.Request, localFilename)
 }
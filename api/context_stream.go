@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ltick/tick-routing"
+)
+
+// StreamHandler is implemented by the handlers of the long-lived responses, event streams or WebSocket
+// connections, the requests of their routes are not limited by the request timeout of the server router.
+type StreamHandler interface {
+	Handler
+	Stream() bool
+}
+
+// streamHandler marks a Handler as a StreamHandler.
+type streamHandler struct {
+	Handler
+}
+
+func (h streamHandler) Stream() bool {
+	return true
+}
+
+// NewStreamHandler returns handler as a StreamHandler, for the handlers calling Context.Stream or Context.SSE.
+func NewStreamHandler(handler Handler) Handler {
+	return streamHandler{Handler: handler}
+}
+
+// IsStreamHandler reports whether handler serves long-lived responses.
+func IsStreamHandler(handler Handler) bool {
+	h, ok := handler.(StreamHandler)
+	return ok && h.Stream()
+}
+
+// streamWriter records the status of the response written by a stream step.
+type streamWriter struct {
+	response *Response
+}
+
+func (w streamWriter) Write(b []byte) (int, error) {
+	if w.response.Status() == 0 {
+		w.response.WriteHeader(http.StatusOK)
+	}
+	return w.response.ctx.ResponseWriter.Write(b)
+}
+
+// Stream sends a streaming response, step is called until it returns false and
+// what it writes is flushed to the client after each call.
+// It returns true if the client has gone away before the end of the stream.
+func (ctx *Context) Stream(step func(w io.Writer) bool) bool {
+	done := ctx.Request.Context().Done()
+	w := streamWriter{response: ctx.Response}
+	for {
+		select {
+		case <-done:
+			return true
+		default:
+			keepOpen := step(w)
+			ctx.Response.Flush()
+			if !keepOpen {
+				return false
+			}
+		}
+	}
+}
+
+// SSE sends a server-sent event to the client and flushes it, the first event writes the header of the event stream.
+// A string or []byte data is sent as it is, other data are encoded in JSON.
+func (ctx *Context) SSE(event string, data interface{}) error {
+	if err := ctx.Request.Context().Err(); err != nil {
+		return routing.NewHTTPError(499, "Response write error: "+err.Error())
+	}
+	var payload []byte
+	switch v := data.(type) {
+	case string:
+		payload = []byte(v)
+	case []byte:
+		payload = v
+	default:
+		var err error
+		if payload, err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+	if ctx.Response.Status() == 0 {
+		header := ctx.Response.Header()
+		header.Set(HeaderContentType, MIMETextEventStream)
+		header.Set(HeaderCacheControl, "no-cache")
+		header.Set(HeaderConnection, "keep-alive")
+		// disable the buffering of the reverse proxies
+		header.Set(HeaderXAccelBuffering, "no")
+		header.Del(HeaderContentLength)
+		ctx.Response.WriteHeader(http.StatusOK)
+	}
+	buf := &bytes.Buffer{}
+	if event != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(strings.NewReplacer("\r", "", "\n", "").Replace(event))
+		buf.WriteByte('\n')
+	}
+	payload = bytes.Replace(payload, []byte("\r\n"), []byte("\n"), -1)
+	for _, line := range bytes.Split(payload, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	if _, err := ctx.ResponseWriter.Write(buf.Bytes()); err != nil {
+		if BrokenPipe(err) || ConnectionResetByPeer(err) || Timeout(err) || NetworkUnreachable(err) {
+			return routing.NewHTTPError(499, "Response write error: "+err.Error())
+		}
+		return routing.NewHTTPError(http.StatusInternalServerError, "Response write error: "+err.Error())
+	}
+	ctx.Response.Flush()
+	return nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ltick/tick-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSE(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/events", nil)
+	req.Header.Set(HeaderAccept, MIMETextEventStream)
+	res := httptest.NewRecorder()
+	c := routing.NewContext(res, req)
+	ctx := &Context{Context: c, Response: NewResponse(c)}
+
+	assert.Nil(t, ctx.SSE("message", "hello\nworld"))
+	assert.Nil(t, ctx.SSE("", map[string]int{"count": 1}))
+	assert.Equal(t, http.StatusOK, ctx.Response.Status())
+	assert.Equal(t, MIMETextEventStream, res.Header().Get(HeaderContentType))
+	assert.Equal(t, "no-cache", res.Header().Get(HeaderCacheControl))
+	assert.True(t, res.Flushed)
+	assert.Equal(t, "event: message\ndata: hello\ndata: world\n\ndata: {\"count\":1}\n\n", res.Body.String())
+}
+
+func TestStream(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/stream", nil)
+	cancelCtx, cancel := context.WithCancel(req.Context())
+	req = req.WithContext(cancelCtx)
+	res := httptest.NewRecorder()
+	c := routing.NewContext(res, req)
+	ctx := &Context{Context: c, Response: NewResponse(c)}
+
+	count := 0
+	clientGone := ctx.Stream(func(w io.Writer) bool {
+		count++
+		io.WriteString(w, "chunk\n")
+		return count < 3
+	})
+	assert.False(t, clientGone)
+	assert.Equal(t, http.StatusOK, ctx.Response.Status())
+	assert.Equal(t, "chunk\nchunk\nchunk\n", res.Body.String())
+
+	clientGone = ctx.Stream(func(w io.Writer) bool {
+		count++
+		cancel()
+		return true
+	})
+	assert.True(t, clientGone)
+	assert.Equal(t, 4, count)
+	assert.NotNil(t, ctx.SSE("message", "closed"))
+}
+
+func TestIsStreamHandler(t *testing.T) {
+	handler := &codecHandler{}
+	assert.False(t, IsStreamHandler(handler))
+	assert.True(t, IsStreamHandler(NewStreamHandler(handler)))
+	assert.True(t, IsStreamHandler(NewWebSocketHandler(WebSocketHandlerFunc(func(ctx *Context, conn *WebSocketConn) error {
+		return nil
+	}))))
+}
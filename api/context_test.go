@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ltick/tick-framework/database"
+	_ "github.com/ltick/tick-framework/database/sqlite"
+	"github.com/ltick/tick-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextDatabaseHandler(t *testing.T) {
+	assert.Nil(t, database.Register("sqlite3", database.NewSqliteHandler))
+	d := &database.Database{}
+	if !assert.Nil(t, d.Use(context.Background(), "sqlite3")) {
+		return
+	}
+	db, err := d.NewHandler("api", map[string]interface{}{
+		"DATABASE_SQLITE_PATH": ":memory:",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+
+	requestContext, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", "/users", nil)
+	c := routing.NewContext(httptest.NewRecorder(), req.WithContext(requestContext))
+	ctx := &Context{Context: c, Response: NewResponse(c)}
+	handler, err := ctx.DatabaseHandler(d, "api")
+	assert.Nil(t, err)
+	var one int
+	assert.Nil(t, handler.New().Raw("SELECT 1").Row().Scan(&one))
+	cancel()
+	assert.Equal(t, context.Canceled, handler.New().Raw("SELECT 1").Row().Scan(&one))
+	assert.Nil(t, db.New().Raw("SELECT 1").Row().Scan(&one))
+
+	_, err = ctx.DatabaseHandler(d, "unknown")
+	assert.NotNil(t, err)
+}
@@ -59,7 +59,7 @@ func ToAPIHandler(handler Handler, noDefaultParams bool) (*apiHandler, error) {
 	}
 
 	var structPointer = v.Addr().Interface()
-	var bodydecoder = defaultBodydecoder
+	var bodydecoder Bodydecoder
 	if h, ok := structPointer.(HandlerWithBody); ok {
 		bodydecoder = h.Decode
 	}
@@ -0,0 +1,442 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ltick/tick-routing"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification of the generated documents.
+const OpenAPIVersion = "3.0.3"
+
+type (
+	// OpenAPIInfo is the metadata of the API.
+	OpenAPIInfo struct {
+		Title       string `json:"title"`
+		Description string `json:"description,omitempty"`
+		Version     string `json:"version"`
+	}
+	// OpenAPIRoute is a route documented by NewOpenAPIDocument,
+	// the params of its group and its path are in the OpenAPI templating, "/users/{id}".
+	OpenAPIRoute struct {
+		Method  string
+		Group   string
+		Path    string
+		Handler Handler
+		// PathParams are the schemas of the params of the group and the path by name,
+		// the params not documented by the handler are added from them.
+		PathParams map[string]*OpenAPISchema
+	}
+	// OpenAPIDocument is an OpenAPI 3 document.
+	OpenAPIDocument struct {
+		OpenAPI string                                  `json:"openapi"`
+		Info    OpenAPIInfo                             `json:"info"`
+		Paths   map[string]map[string]*OpenAPIOperation `json:"paths"`
+	}
+	OpenAPIOperation struct {
+		Tags        []string                    `json:"tags,omitempty"`
+		Description string                      `json:"description,omitempty"`
+		Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+		RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+		Responses   map[string]*OpenAPIResponse `json:"responses"`
+	}
+	OpenAPIParameter struct {
+		Name        string         `json:"name"`
+		In          string         `json:"in"`
+		Description string         `json:"description,omitempty"`
+		Required    bool           `json:"required,omitempty"`
+		Schema      *OpenAPISchema `json:"schema,omitempty"`
+	}
+	OpenAPIRequestBody struct {
+		Description string                       `json:"description,omitempty"`
+		Required    bool                         `json:"required,omitempty"`
+		Content     map[string]*OpenAPIMediaType `json:"content"`
+	}
+	OpenAPIResponse struct {
+		Description string                       `json:"description"`
+		Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+	}
+	OpenAPIMediaType struct {
+		Schema  *OpenAPISchema `json:"schema,omitempty"`
+		Example interface{}    `json:"example,omitempty"`
+	}
+	OpenAPISchema struct {
+		Type                 string                    `json:"type,omitempty"`
+		Format               string                    `json:"format,omitempty"`
+		Description          string                    `json:"description,omitempty"`
+		Items                *OpenAPISchema            `json:"items,omitempty"`
+		Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+		AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+		Required             []string                  `json:"required,omitempty"`
+		MinLength            *int                      `json:"minLength,omitempty"`
+		MaxLength            *int                      `json:"maxLength,omitempty"`
+		Minimum              *float64                  `json:"minimum,omitempty"`
+		Maximum              *float64                  `json:"maximum,omitempty"`
+		Pattern              string                    `json:"pattern,omitempty"`
+		Default              interface{}               `json:"default,omitempty"`
+	}
+)
+
+// NewOpenAPIDocument generates the OpenAPI document of the routes.
+// The parameters are documented from the `param` tags of the handler structs and the handlers
+// implementing APIDoc add their note, their return model and their extra parameters.
+func NewOpenAPIDocument(info OpenAPIInfo, routes []OpenAPIRoute) *OpenAPIDocument {
+	document := &OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info:    info,
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+	}
+	for _, route := range routes {
+		if route.Handler == nil {
+			continue
+		}
+		path := openAPIPath(route.Group, route.Path)
+		anyMethod := strings.ToUpper(route.Method) == "ANY"
+		methods := strings.Split(route.Method, ",")
+		if anyMethod {
+			methods = routing.Methods
+		}
+		for _, method := range methods {
+			method = strings.ToLower(strings.TrimSpace(method))
+			switch method {
+			case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+			default:
+				continue
+			}
+			if _, ok := document.Paths[path]; !ok {
+				document.Paths[path] = make(map[string]*OpenAPIOperation)
+			}
+			// the routes of a single method are documented rather than the ANY route of the same path
+			if _, ok := document.Paths[path][method]; ok && anyMethod {
+				continue
+			}
+			operation := newOpenAPIOperation(route.Handler)
+			addOpenAPIPathParams(operation, route.PathParams)
+			if group := strings.Trim(route.Group, "/"); group != "" {
+				operation.Tags = []string{group}
+			}
+			document.Paths[path][method] = operation
+		}
+	}
+	return document
+}
+
+// isZeroValue reports whether v is the zero value of its type.
+func isZeroValue(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// openAPIPath joins the group and the path of a route.
+func openAPIPath(group string, path string) string {
+	fullPath := "/" + strings.Trim(group, "/")
+	if path = strings.Trim(path, "/"); path != "" {
+		fullPath = strings.TrimSuffix(fullPath, "/") + "/" + path
+	}
+	return fullPath
+}
+
+// addOpenAPIPathParams adds the path params of the route not documented by the handler,
+// the documented ones only take the format and the pattern of the route constraints.
+func addOpenAPIPathParams(operation *OpenAPIOperation, pathParams map[string]*OpenAPISchema) {
+	names := make([]string, 0, len(pathParams))
+	for name := range pathParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema := pathParams[name]
+		documented := false
+		for _, param := range operation.Parameters {
+			if param.In != "path" || param.Name != name {
+				continue
+			}
+			documented = true
+			if param.Schema == nil || param.Schema.Type == "" {
+				param.Schema = schema
+			} else if param.Schema.Type == schema.Type {
+				if param.Schema.Format == "" {
+					param.Schema.Format = schema.Format
+				}
+				if param.Schema.Pattern == "" {
+					param.Schema.Pattern = schema.Pattern
+				}
+			}
+		}
+		if !documented {
+			operation.Parameters = append(operation.Parameters, &OpenAPIParameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   schema,
+			})
+		}
+	}
+	if len(operation.Parameters) > 0 && operation.Responses[strconv.Itoa(http.StatusBadRequest)] == nil {
+		operation.Responses[strconv.Itoa(http.StatusBadRequest)] = &OpenAPIResponse{Description: http.StatusText(http.StatusBadRequest)}
+	}
+}
+
+func newOpenAPIOperation(handler Handler) *OpenAPIOperation {
+	operation := &OpenAPIOperation{
+		Responses: make(map[string]*OpenAPIResponse),
+	}
+	var (
+		api *Api
+		doc Doc
+	)
+	if h, ok := handler.(*apiHandler); ok {
+		api = h.api
+		if d, ok := api.Raw().(APIDoc); ok {
+			doc = d.Doc()
+		}
+	} else {
+		if d, ok := handler.(APIDoc); ok {
+			doc = d.Doc()
+		}
+		v := reflect.ValueOf(handler)
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+			api, _ = NewApi(handler, nil, nil, false)
+		}
+	}
+	operation.Description = doc.Note
+	documented := make(map[string]bool)
+	var (
+		formProperties = make(map[string]*OpenAPISchema)
+		formRequired   []string
+		hasFile        bool
+	)
+	if api != nil {
+		for _, param := range api.Params() {
+			documented[param.In()+"$"+param.Name()] = true
+			schema := newOpenAPIParamSchema(param)
+			switch param.In() {
+			case "body":
+				operation.RequestBody = &OpenAPIRequestBody{
+					Description: param.Description(),
+					Required:    param.IsRequired(),
+					Content: map[string]*OpenAPIMediaType{
+						MIMEApplicationJSON: {Schema: schema},
+					},
+				}
+			case "formData":
+				schema.Description = param.Description()
+				formProperties[param.Name()] = schema
+				if param.IsRequired() {
+					formRequired = append(formRequired, param.Name())
+				}
+				hasFile = hasFile || param.IsFile()
+			default:
+				operation.Parameters = append(operation.Parameters, &OpenAPIParameter{
+					Name:        param.Name(),
+					In:          param.In(),
+					Description: param.Description(),
+					Required:    param.IsRequired() || param.In() == "path",
+					Schema:      schema,
+				})
+			}
+		}
+	}
+	for _, param := range doc.MoreParams {
+		if documented[param.In+"$"+param.Name] {
+			continue
+		}
+		schema := newOpenAPISchema(reflect.TypeOf(param.Model), nil)
+		if param.Model != nil && !isZeroValue(reflect.ValueOf(param.Model)) {
+			schema.Default = param.Model
+		}
+		if param.In == "formData" {
+			schema.Description = param.Desc
+			formProperties[param.Name] = schema
+			if param.Required {
+				formRequired = append(formRequired, param.Name)
+			}
+			continue
+		}
+		operation.Parameters = append(operation.Parameters, &OpenAPIParameter{
+			Name:        param.Name,
+			In:          param.In,
+			Description: param.Desc,
+			Required:    param.Required || param.In == "path",
+			Schema:      schema,
+		})
+	}
+	if len(formProperties) > 0 && operation.RequestBody == nil {
+		contentType := MIMEApplicationForm
+		if hasFile {
+			contentType = MIMEMultipartForm
+		}
+		sort.Strings(formRequired)
+		operation.RequestBody = &OpenAPIRequestBody{
+			Required: len(formRequired) > 0,
+			Content: map[string]*OpenAPIMediaType{
+				contentType: {Schema: &OpenAPISchema{
+					Type:       "object",
+					Properties: formProperties,
+					Required:   formRequired,
+				}},
+			},
+		}
+	}
+	response := &OpenAPIResponse{Description: http.StatusText(http.StatusOK)}
+	if doc.Return != nil {
+		response.Content = map[string]*OpenAPIMediaType{
+			MIMEApplicationJSON: {
+				Schema:  newOpenAPISchema(reflect.TypeOf(doc.Return), nil),
+				Example: doc.Return,
+			},
+		}
+	}
+	operation.Responses[strconv.Itoa(http.StatusOK)] = response
+	if len(operation.Parameters) > 0 || operation.RequestBody != nil {
+		operation.Responses[strconv.Itoa(http.StatusBadRequest)] = &OpenAPIResponse{Description: http.StatusText(http.StatusBadRequest)}
+	}
+	return operation
+}
+
+// newOpenAPIParamSchema returns the schema of a param with the constraints of its tags,
+// the constraints of a slice param apply to its items like the validation.
+func newOpenAPIParamSchema(param *Param) *OpenAPISchema {
+	schema := newOpenAPISchema(param.rawValue.Type(), nil)
+	if value := param.rawValue; value.IsValid() && !isZeroValue(value) && !param.IsFile() {
+		schema.Default = value.Interface()
+	}
+	constrained := schema
+	if schema.Type == "array" && schema.Items != nil {
+		constrained = schema.Items
+	}
+	if tuple, ok := param.tags[KEY_LEN]; ok {
+		min, max := splitOpenAPITuple(tuple)
+		if n, err := strconv.Atoi(min); err == nil {
+			constrained.MinLength = &n
+		}
+		if n, err := strconv.Atoi(max); err == nil {
+			constrained.MaxLength = &n
+		}
+	}
+	if tuple, ok := param.tags[KEY_RANGE]; ok {
+		min, max := splitOpenAPITuple(tuple)
+		if f, err := strconv.ParseFloat(min, 64); err == nil {
+			constrained.Minimum = &f
+		}
+		if f, err := strconv.ParseFloat(max, 64); err == nil {
+			constrained.Maximum = &f
+		}
+	}
+	if pattern, ok := param.tags[KEY_REGEXP]; ok {
+		constrained.Pattern = pattern
+	}
+	if _, ok := param.tags[KEY_NOTEMPTY]; ok && constrained.Type == "string" && constrained.MinLength == nil {
+		one := 1
+		constrained.MinLength = &one
+	}
+	return schema
+}
+
+// splitOpenAPITuple splits a "min:max" tuple of the tags, a single value is both the min and the max.
+func splitOpenAPITuple(tuple string) (string, string) {
+	c := strings.SplitN(tuple, ":", 2)
+	if len(c) == 1 {
+		return strings.TrimSpace(c[0]), strings.TrimSpace(c[0])
+	}
+	return strings.TrimSpace(c[0]), strings.TrimSpace(c[1])
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// newOpenAPISchema returns the schema of a type, the struct types being described are skipped to stop the recursions.
+func newOpenAPISchema(t reflect.Type, describing map[reflect.Type]bool) *OpenAPISchema {
+	if t == nil {
+		return &OpenAPISchema{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.String() {
+	case fileTypeString2:
+		return &OpenAPISchema{Type: "string", Format: "binary"}
+	case cookieTypeString2:
+		return &OpenAPISchema{Type: "string"}
+	}
+	if t == timeType {
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &OpenAPISchema{Type: "integer"}
+	case reflect.Int32, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: newOpenAPISchema(t.Elem(), describing)}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: newOpenAPISchema(t.Elem(), describing)}
+	case reflect.Struct:
+		schema := &OpenAPISchema{Type: "object"}
+		if describing[t] {
+			return schema
+		}
+		if describing == nil {
+			describing = make(map[reflect.Type]bool)
+		}
+		describing[t] = true
+		defer delete(describing, t)
+		schema.Properties = make(map[string]*OpenAPISchema)
+		addOpenAPIProperties(schema, t, describing)
+		return schema
+	}
+	return &OpenAPISchema{}
+}
+
+// addOpenAPIProperties adds the exported fields of a struct named by their json tags, the embedded structs are inlined.
+func addOpenAPIProperties(schema *OpenAPISchema, t reflect.Type, describing map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Name
+		omitempty := false
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			options := strings.Split(tag, ",")
+			if options[0] != "" {
+				name = options[0]
+			}
+			for _, option := range options[1:] {
+				omitempty = omitempty || option == "omitempty"
+			}
+		} else if field.Anonymous {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				addOpenAPIProperties(schema, fieldType, describing)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		schema.Properties[name] = newOpenAPISchema(field.Type, describing)
+		if !omitempty && field.Type.Kind() != reflect.Ptr {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"mime/multipart"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type openAPIUserHandler struct {
+	ID      int                   `param:"<in:path> <name:id> <range: 1:1000> <desc:user id>"`
+	Fields  []string              `param:"<in:query> <len: 1:16>"`
+	Token   string                `param:"<in:header> <required> <regexp: ^[a-f0-9]+$>"`
+	Avatar  *multipart.FileHeader `param:"<in:formData> <required>"`
+	Comment string                `param:"<in:formData> <notempty>"`
+}
+
+type openAPIUser struct {
+	Name     string         `json:"name"`
+	Email    string         `json:"email,omitempty"`
+	Friends  []*openAPIUser `json:"friends,omitempty"`
+	password string
+}
+
+func (h *openAPIUserHandler) Serve(ctx *Context) error {
+	return nil
+}
+
+func (h *openAPIUserHandler) Doc() Doc {
+	return Doc{
+		Note:   "update a user",
+		Return: openAPIUser{Name: "ltick"},
+		MoreParams: []APIParam{
+			{Name: "page", In: "query", Model: 1, Desc: "page number"},
+			{Name: "id", In: "path", Model: 0},
+		},
+	}
+}
+
+type openAPIBodyHandler struct {
+	User openAPIUser `param:"<in:body> <required>"`
+}
+
+func (h *openAPIBodyHandler) Serve(ctx *Context) error {
+	return nil
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	userHandler, err := ToAPIHandler(&openAPIUserHandler{}, true)
+	assert.Nil(t, err)
+	document := NewOpenAPIDocument(OpenAPIInfo{Title: "test", Version: "1.0"}, []OpenAPIRoute{
+		{Method: "POST", Group: "/v1", Path: "user/{id}", Handler: userHandler, PathParams: map[string]*OpenAPISchema{
+			"id": {Type: "integer"},
+		}},
+		{Method: "PUT", Group: "/", Path: "/user/{uuid}", Handler: &openAPIBodyHandler{}, PathParams: map[string]*OpenAPISchema{
+			"uuid": {Type: "string", Format: "uuid"},
+		}},
+		{Method: "ANY", Group: "/", Path: "/any", Handler: &openAPIBodyHandler{}},
+	})
+	assert.Equal(t, OpenAPIVersion, document.OpenAPI)
+	assert.Len(t, document.Paths, 3)
+	// an ANY route is documented for every method of OpenAPI
+	for _, method := range []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"} {
+		assert.NotNil(t, document.Paths["/any"][method], method)
+	}
+	assert.Len(t, document.Paths["/any"], 8)
+
+	operation := document.Paths["/v1/user/{id}"]["post"]
+	if assert.NotNil(t, operation) {
+		assert.Equal(t, []string{"v1"}, operation.Tags)
+		assert.Equal(t, "update a user", operation.Description)
+		if assert.Len(t, operation.Parameters, 4) {
+			id := operation.Parameters[0]
+			assert.Equal(t, "path", id.In)
+			assert.True(t, id.Required)
+			assert.Equal(t, "user id", id.Description)
+			assert.Equal(t, "integer", id.Schema.Type)
+			assert.Equal(t, 1.0, *id.Schema.Minimum)
+			assert.Equal(t, 1000.0, *id.Schema.Maximum)
+			fields := operation.Parameters[1]
+			assert.Equal(t, "fields", fields.Name)
+			assert.Equal(t, "array", fields.Schema.Type)
+			assert.Equal(t, 16, *fields.Schema.Items.MaxLength)
+			token := operation.Parameters[2]
+			assert.Equal(t, "header", token.In)
+			assert.Equal(t, "Token", token.Name)
+			assert.Equal(t, "^[a-f0-9]+$", token.Schema.Pattern)
+			page := operation.Parameters[3]
+			assert.Equal(t, "page", page.Name)
+			assert.Equal(t, 1, page.Schema.Default)
+		}
+		form := operation.RequestBody.Content[MIMEMultipartForm]
+		if assert.NotNil(t, form) {
+			assert.Equal(t, "binary", form.Schema.Properties["avatar"].Format)
+			assert.Equal(t, 1, *form.Schema.Properties["comment"].MinLength)
+			assert.Equal(t, []string{"avatar", "comment"}, form.Schema.Required)
+		}
+		response := operation.Responses["200"].Content[MIMEApplicationJSON]
+		if assert.NotNil(t, response) {
+			assert.Equal(t, "object", response.Schema.Type)
+			assert.Equal(t, []string{"name"}, response.Schema.Required)
+			assert.Equal(t, "object", response.Schema.Properties["friends"].Items.Type)
+			assert.NotContains(t, response.Schema.Properties, "password")
+		}
+		assert.NotNil(t, operation.Responses["400"])
+	}
+
+	operation = document.Paths["/user/{uuid}"]["put"]
+	if assert.NotNil(t, operation) {
+		assert.Nil(t, operation.Tags)
+		// the path param undocumented by the handler
+		if assert.Len(t, operation.Parameters, 1) {
+			assert.Equal(t, "uuid", operation.Parameters[0].Name)
+			assert.True(t, operation.Parameters[0].Required)
+			assert.Equal(t, "uuid", operation.Parameters[0].Schema.Format)
+		}
+		body := operation.RequestBody.Content[MIMEApplicationJSON]
+		assert.True(t, operation.RequestBody.Required)
+		assert.Equal(t, "string", body.Schema.Properties["name"].Type)
+	}
+
+	_, err = json.Marshal(document)
+	assert.Nil(t, err)
+}
@@ -52,6 +52,7 @@ const (
 	KEY_REGEXP       = "regexp"   // verify the value of the param with a regular expression(param value can not be null)
 	KEY_MAXMB        = "maxmb"    // when request Content-Type is multipart/form-data, the max memory for body.(multi-param, whichever is greater)
 	KEY_ERR          = "err"      // the custom error for binding or validating
+	KEY_VALIDATE     = "validate" // the custom validators registered by RegisterValidator, comma separated, also the rule of the values failing their own validation.Validatable
 
 	MB                 = 1 << 20 // 1MB
 	defaultMaxMemory   = 32 * MB // 32 MB
@@ -84,6 +85,7 @@ type (
 		isFile     bool              // is file param or not
 		tags       map[string]string // struct tags for this param
 		rules      []validation.Rule
+		ruleNames  []string          // the tag keys of the rules
 		rawTag     reflect.StructTag // the raw tag
 		rawValue   reflect.Value       // the raw value
 		err        error             // the custom error for binding or validating
@@ -137,38 +139,60 @@ func (param *Param) Error(reason string) error {
 // validate tests if the param conforms to it's validation constraints specified
 // int the KEY_REGEXP struct tag
 func (param *Param) validate(value reflect.Value) (err error) {
+	_, _, err = param.validateRules(value)
+	return err
+}
+
+// validateRules tests the value like validate and also returns the name of the failing rule,
+// KEY_VALIDATE if the value fails its own validation, and the reason of the failure.
+func (param *Param) validateRules(value reflect.Value) (rule string, reason string, err error) {
 	defer func() {
 		p := recover()
 		if p != nil {
-			err = param.Error(fmt.Sprint(p))
+			rule, reason = KEY_VALIDATE, fmt.Sprint(p)
+			err = param.Error(reason)
 		} else if err != nil {
 			err = param.Error(err.Error())
 		}
+		if err != nil && param.err != nil {
+			reason = param.err.Error()
+		}
 	}()
-	switch value.Kind()  {
+	// the rules apply to the items of the slices and the maps
+	var valueItems []interface{}
+	switch value.Kind() {
 	case reflect.Slice, reflect.Array:
 		l := value.Len()
 		for i := 0; i < l; i++ {
 			if valueItem := value.Index(i).Interface(); valueItem != nil {
-				if err = validation.Validate(valueItem, param.rules...); err != nil {
-					return errors.Annotate(err, errValidateParam)
-				}
+				valueItems = append(valueItems, valueItem)
 			}
 		}
 	case reflect.Map:
 		for _, key := range value.MapKeys() {
 			if valueItem := value.MapIndex(key).Interface(); valueItem != nil {
-				if err = validation.Validate(valueItem, param.rules...); err != nil {
-					return errors.Annotate(err, errValidateParam)
-				}
+				valueItems = append(valueItems, valueItem)
 			}
 		}
 	default:
-		if err = validation.Validate(value.Interface(), param.rules...); err != nil {
-			return errors.Annotate(err, errValidateParam)
+		valueItems = append(valueItems, value.Interface())
+	}
+	for _, valueItem := range valueItems {
+		if err = validation.Validate(valueItem, param.rules...); err != nil {
+			return param.failingRule(valueItem), err.Error(), errors.Annotate(err, errValidateParam)
 		}
 	}
-	return nil
+	return "", "", nil
+}
+
+// failingRule returns the name of the first rule the value fails.
+func (param *Param) failingRule(value interface{}) string {
+	for i, rule := range param.rules {
+		if err := rule.Validate(value); err != nil {
+			return param.ruleNames[i]
+		}
+	}
+	return KEY_VALIDATE
 }
 
 func (param *Param) makeVerifyRules() (err error) {
@@ -179,6 +203,7 @@ func (param *Param) makeVerifyRules() (err error) {
 		}
 	}()
 	param.rules = make([]validation.Rule, 0)
+	param.ruleNames = make([]string, 0)
 	// length
 	if tuple, ok := param.tags[KEY_LEN]; ok {
 		var a, b = parseTuple(tuple)
@@ -201,6 +226,7 @@ func (param *Param) makeVerifyRules() (err error) {
 			LengthRule.Error(param.err.Error())
 		}
 		param.rules = append(param.rules, LengthRule)
+		param.ruleNames = append(param.ruleNames, KEY_LEN)
 	}
 	// range
 	if tuple, ok := param.tags[KEY_RANGE]; ok {
@@ -224,6 +250,7 @@ func (param *Param) makeVerifyRules() (err error) {
 			RangeRule.Error(param.err.Error())
 		}
 		param.rules = append(param.rules, RangeRule)
+		param.ruleNames = append(param.ruleNames, KEY_RANGE)
 	}
 	// notempty
 	if _, ok := param.tags[KEY_NOTEMPTY]; ok {
@@ -232,6 +259,7 @@ func (param *Param) makeVerifyRules() (err error) {
 			NotEmptyRule.Error(param.err.Error())
 		}
 		param.rules = append(param.rules, NotEmptyRule)
+		param.ruleNames = append(param.ruleNames, KEY_NOTEMPTY)
 	}
 	// regexp
 	if reg, ok := param.tags[KEY_REGEXP]; ok {
@@ -244,6 +272,18 @@ func (param *Param) makeVerifyRules() (err error) {
 			MatchRule.Error(param.err.Error())
 		}
 		param.rules = append(param.rules, MatchRule)
+		param.ruleNames = append(param.ruleNames, KEY_REGEXP)
+	}
+	// custom validators
+	if names, ok := param.tags[KEY_VALIDATE]; ok {
+		for _, name := range parseValidators(names) {
+			rule, ok := GetValidator(name)
+			if !ok {
+				return errors.Errorf("%s: %s", errUnknownValidator, name)
+			}
+			param.rules = append(param.rules, rule)
+			param.ruleNames = append(param.ruleNames, name)
+		}
 	}
 	return
 }
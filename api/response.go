@@ -28,6 +28,10 @@ var responseOptions = map[string]map[string]interface{}{
 		"status":  http.StatusBadRequest,
 		"message": "Bad request",
 	},
+	"ValidationFailed": map[string]interface{}{
+		"status":  http.StatusBadRequest,
+		"message": "The request parameters are invalid",
+	},
 	"EntityTooLarge": map[string]interface{}{
 		"status":  http.StatusBadRequest,
 		"message": "Your proposed upload exceeds the maximum allowed object size.",
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// The rules of the param errors which are not validation tags.
+const (
+	ParamRuleType   = "type"   // the value can not be converted to the type of the param
+	ParamRuleDecode = "decode" // the body can not be decoded
+)
+
+type (
+	// ParamError is a param failing its binding or its validation.
+	ParamError struct {
+		Name    string `json:"name" xml:"name"`
+		In      string `json:"in" xml:"in"`
+		Rule    string `json:"rule" xml:"rule"`
+		Message string `json:"message" xml:"message"`
+	}
+	// ValidationError lists every param of a request failing its binding or its validation.
+	ValidationError struct {
+		ApiName string
+		Errors  []*ParamError
+
+		params []*Param // the params of the errors, nil for the errors of the struct
+	}
+)
+
+func (e *ValidationError) add(param *Param, rule string, reason string) {
+	if param.err != nil {
+		reason = param.err.Error()
+	}
+	e.Errors = append(e.Errors, &ParamError{
+		Name:    param.Name(),
+		In:      param.In(),
+		Rule:    rule,
+		Message: reason,
+	})
+	e.params = append(e.params, param)
+}
+
+var paramMessages = struct {
+	sync.RWMutex
+	m map[string]map[string]string
+}{
+	m: map[string]map[string]string{},
+}
+
+// RegisterParamMessages registers the messages of the param errors in the language, keyed by rule,
+// e.g. KEY_REQUIRED, KEY_LEN, ParamRuleType or the name of a custom validator.
+// The messages can refer to {name} and {in} of the param, {value} the value of the rule tag, {min} and {max} its bounds,
+// and {message} the original message.
+func RegisterParamMessages(language string, messages map[string]string) {
+	paramMessages.Lock()
+	defer paramMessages.Unlock()
+	languageMessages, ok := paramMessages.m[language]
+	if !ok {
+		languageMessages = map[string]string{}
+		paramMessages.m[language] = languageMessages
+	}
+	for rule, message := range messages {
+		languageMessages[rule] = message
+	}
+}
+
+func paramMessage(language string, rule string) (string, bool) {
+	paramMessages.RLock()
+	defer paramMessages.RUnlock()
+	if message, ok := paramMessages.m[language][rule]; ok {
+		return message, true
+	}
+	// the base language, "zh" for "zh-CN"
+	if index := strings.IndexAny(language, "-_"); index > 0 {
+		message, ok := paramMessages.m[language[:index]][rule]
+		return message, ok
+	}
+	return "", false
+}
+
+// Localize returns a copy of the error whose messages are in the language, see RegisterParamMessages,
+// the custom errors of the params and the messages not registered in the language are kept.
+func (e *ValidationError) Localize(language string) *ValidationError {
+	localized := &ValidationError{ApiName: e.ApiName, Errors: make([]*ParamError, len(e.Errors)), params: e.params}
+	for i, paramError := range e.Errors {
+		localizedError := *paramError
+		var tag string
+		var custom bool
+		if i < len(e.params) && e.params[i] != nil {
+			tag, custom = e.params[i].tags[paramError.Rule], e.params[i].err != nil
+		}
+		if message, ok := paramMessage(language, paramError.Rule); ok && !custom {
+			var min, max string
+			if bounds := strings.SplitN(tag, ":", 2); len(bounds) == 2 {
+				min, max = strings.TrimSpace(bounds[0]), strings.TrimSpace(bounds[1])
+			} else {
+				min, max = tag, tag
+			}
+			localizedError.Message = strings.NewReplacer(
+				"{name}", paramError.Name,
+				"{in}", paramError.In,
+				"{value}", tag,
+				"{min}", min,
+				"{max}", max,
+				"{message}", paramError.Message,
+			).Replace(message)
+		}
+		localized.Errors[i] = &localizedError
+	}
+	return localized
+}
+
+// Error returns the errors of the params in the format of Param.Error.
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, paramError := range e.Errors {
+		messages[i] = "api: " + e.ApiName + "|" + paramError.Name + "|" + paramError.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// AsValidationError returns the validation error causing err.
+func AsValidationError(err error) (*ValidationError, bool) {
+	validationError, ok := errors.Cause(err).(*ValidationError)
+	return validationError, ok
+}
+
+// BindErrorHandler replies to the requests whose params can not be bound by the api handlers,
+// the binding errors are returned as 400 Bad Request HTTP errors if nil.
+// Set it to WriteBindError to reply with the structured list of the failing params.
+var BindErrorHandler BinderrorFunc
+
+// WriteBindError writes the binding error in JSON or XML, depending on the Accept header,
+// as a ResponseData whose data lists the params of a ValidationError,
+// in the language chosen by the LanguageNegotiator handler.
+func WriteBindError(ctx *Context, err error) {
+	var responseData *ResponseData
+	if validationError, ok := AsValidationError(err); ok {
+		if language := ctx.Language(); language != "" {
+			validationError = validationError.Localize(language)
+		}
+		responseData = NewResponseData("ValidationFailed", validationError.Errors)
+	} else {
+		responseData = NewResponseData("BadRequest", nil, err.Error())
+	}
+	ctx.ResponseJSONOrXML(responseData.GetStatus(), responseData)
+}
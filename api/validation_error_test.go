@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ltick/tick-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+type validationErrorHandler struct {
+	Name  string `param:"<in:query> <len: 3:8>"`
+	Email string `param:"<in:query> <regexp: ^[a-z]+@[a-z]+\\.[a-z]+$> <err:invalid email>"`
+	Age   int    `param:"<in:query> <name:age>"`
+	Token string `param:"<in:header> <required>"`
+	Page  int    `param:"<in:query>"`
+}
+
+func (h *validationErrorHandler) Serve(ctx *Context) error {
+	return ctx.ResponseString(http.StatusOK, "ok")
+}
+
+func TestValidationError(t *testing.T) {
+	api, err := NewApi(&validationErrorHandler{}, nil, nil, false)
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("GET", "/?name=ab&email=ltick&age=old&page=2", nil)
+	_, err = api.BindNew(req, nil)
+	validationError, ok := AsValidationError(err)
+	if assert.True(t, ok) && assert.Len(t, validationError.Errors, 4) {
+		assert.Equal(t, &ParamError{Name: "name", In: "query", Rule: KEY_LEN, Message: "the length must be between 3 and 8"}, validationError.Errors[0])
+		assert.Equal(t, &ParamError{Name: "email", In: "query", Rule: KEY_REGEXP, Message: "invalid email"}, validationError.Errors[1])
+		assert.Equal(t, "age", validationError.Errors[2].Name)
+		assert.Equal(t, ParamRuleType, validationError.Errors[2].Rule)
+		assert.Equal(t, &ParamError{Name: "Token", In: "header", Rule: KEY_REQUIRED, Message: "missing header param"}, validationError.Errors[3])
+	}
+	assert.Contains(t, err.Error(), "api: *api.validationErrorHandler|email|invalid email; ")
+
+	req.Header.Set("Token", "secret")
+	req.URL.RawQuery = "name=ltick&email=ltick@example.com&age=3"
+	_, err = api.BindNew(req, nil)
+	assert.Nil(t, err)
+}
+
+func TestWriteBindError(t *testing.T) {
+	handler, err := ToAPIHandler(&validationErrorHandler{}, true)
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("GET", "/?name=ab", nil)
+	req.Header.Set(HeaderAccept, MIMEApplicationJSON)
+	// the binding errors are returned as HTTP errors by default
+	res := httptest.NewRecorder()
+	c := routing.NewContext(res, req)
+	err = handler.Serve(&Context{Context: c, Response: NewResponse(c)})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(routing.HTTPError).StatusCode())
+	}
+
+	BindErrorHandler = WriteBindError
+	defer func() {
+		BindErrorHandler = nil
+	}()
+	res = httptest.NewRecorder()
+	c = routing.NewContext(res, req)
+	assert.Nil(t, handler.Serve(&Context{Context: c, Response: NewResponse(c)}))
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	var responseData struct {
+		Code    string        `json:"code"`
+		Status  int           `json:"status"`
+		Message string        `json:"message"`
+		Data    []*ParamError `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &responseData))
+	assert.Equal(t, "ValidationFailed", responseData.Code)
+	assert.Equal(t, http.StatusBadRequest, responseData.Status)
+	assert.Len(t, responseData.Data, 2)
+}
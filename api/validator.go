@@ -0,0 +1,127 @@
+package api
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/ltick/ltick-validation"
+)
+
+var (
+	errUnknownValidator = "api: unknown validator"
+)
+
+// ParamRuleStruct is the rule of the param errors returned by ParamsValidator.ValidateParams.
+const ParamRuleStruct = "struct"
+
+// ParamsValidator is implemented by the handlers validating their params together,
+// ValidateParams is called once every param is bound and valid.
+// The validation.Errors returned, e.g. by validation.ValidateStruct, are reported for the params they name,
+// any other error is reported for the whole struct.
+type ParamsValidator interface {
+	ValidateParams() error
+}
+
+var validators = struct {
+	sync.RWMutex
+	m map[string]validation.Rule
+}{
+	m: map[string]validation.Rule{},
+}
+
+// RegisterValidator registers the rule named by the validate tag of the params, e.g. `param:"<in:query> <validate:phone>"`,
+// the validators must be registered before the handlers using them.
+func RegisterValidator(name string, rule validation.Rule) {
+	validators.Lock()
+	validators.m[name] = rule
+	validators.Unlock()
+}
+
+// RegisterValidatorFunc registers the function as the validator named name, see RegisterValidator.
+func RegisterValidatorFunc(name string, f func(value interface{}) error) {
+	RegisterValidator(name, validatorFunc(f))
+}
+
+// GetValidator returns the validator registered with the name.
+func GetValidator(name string) (validation.Rule, bool) {
+	validators.RLock()
+	rule, ok := validators.m[name]
+	validators.RUnlock()
+	return rule, ok
+}
+
+type validatorFunc func(value interface{}) error
+
+func (f validatorFunc) Validate(value interface{}) error {
+	return f(value)
+}
+
+// parseValidators returns the names of the validators of a validate tag, separated by commas.
+func parseValidators(tag string) []string {
+	var names []string
+	for _, name := range strings.Split(tag, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// validateParams runs the ValidateParams method of the struct pointer if it implements ParamsValidator.
+func (a *Api) validateParams(structPointer interface{}) error {
+	paramsValidator, ok := structPointer.(ParamsValidator)
+	if !ok {
+		return nil
+	}
+	err := paramsValidator.ValidateParams()
+	if err == nil {
+		return nil
+	}
+	validationError := &ValidationError{ApiName: a.name}
+	if fieldErrors, ok := errors.Cause(err).(validation.Errors); ok {
+		for _, key := range sortedKeys(fieldErrors) {
+			fieldErr := fieldErrors[key]
+			if fieldErr == nil {
+				continue
+			}
+			if param := a.paramByKey(key); param != nil {
+				validationError.add(param, ParamRuleStruct, fieldErr.Error())
+			} else {
+				validationError.Errors = append(validationError.Errors, &ParamError{Name: key, Rule: ParamRuleStruct, Message: fieldErr.Error()})
+				validationError.params = append(validationError.params, nil)
+			}
+		}
+	} else {
+		validationError.Errors = append(validationError.Errors, &ParamError{Name: "*", Rule: ParamRuleStruct, Message: err.Error()})
+		validationError.params = append(validationError.params, nil)
+	}
+	if len(validationError.Errors) == 0 {
+		return nil
+	}
+	return validationError
+}
+
+// paramByKey returns the param whose name, field name or json name is key.
+func (a *Api) paramByKey(key string) *Param {
+	for _, param := range a.params {
+		if param.name == key {
+			return param
+		}
+		field := a.structType.FieldByIndex(param.indexPath)
+		if field.Name == key || strings.Split(field.Tag.Get("json"), ",")[0] == key {
+			return param
+		}
+	}
+	return nil
+}
+
+func sortedKeys(fieldErrors validation.Errors) []string {
+	keys := make([]string, 0, len(fieldErrors))
+	for key := range fieldErrors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
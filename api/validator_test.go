@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/ltick/ltick-validation"
+	"github.com/ltick/tick-routing"
+	"github.com/ltick/tick-routing/content"
+	"github.com/stretchr/testify/assert"
+)
+
+type validatorHandler struct {
+	Phone string `param:"<in:query> <validate:phone>"`
+	Start int    `param:"<in:query>" json:"start"`
+	End   int    `param:"<in:query>" json:"end"`
+}
+
+func (h *validatorHandler) Serve(ctx *Context) error {
+	return ctx.ResponseString(http.StatusOK, "ok")
+}
+
+func (h *validatorHandler) ValidateParams() error {
+	if h.Start == 0 && h.End == 0 {
+		return errors.New("the range is empty")
+	}
+	return validation.ValidateStruct(h, validation.Field(&h.End, validation.Min(h.Start)))
+}
+
+type fileValidatorHandler struct {
+	Avatar *multipart.FileHeader `param:"<in:formData> <validate:smallfile>"`
+}
+
+func (h *fileValidatorHandler) Serve(ctx *Context) error {
+	return ctx.ResponseString(http.StatusOK, "ok")
+}
+
+func init() {
+	RegisterValidatorFunc("smallfile", func(value interface{}) error {
+		if file, _ := value.(*multipart.FileHeader); file != nil && file.Size > 4 {
+			return errors.New("must be at most 4 bytes")
+		}
+		return nil
+	})
+	phone := regexp.MustCompile(`^\+?[0-9]{6,15}$`)
+	RegisterValidatorFunc("phone", func(value interface{}) error {
+		if s, _ := value.(string); s != "" && !phone.MatchString(s) {
+			return errors.New("must be a phone number")
+		}
+		return nil
+	})
+}
+
+func TestRegisterValidator(t *testing.T) {
+	type unknownValidatorHandler struct {
+		Phone string `param:"<in:query> <validate:unknown>"`
+	}
+	_, err := NewApi(&unknownValidatorHandler{}, nil, nil, false)
+	assert.NotNil(t, err)
+
+	api, err := NewApi(&validatorHandler{}, nil, nil, false)
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("GET", "/?phone=ltick&start=1&end=2", nil)
+	_, err = api.BindNew(req, nil)
+	validationError, ok := AsValidationError(err)
+	if assert.True(t, ok) && assert.Len(t, validationError.Errors, 1) {
+		assert.Equal(t, &ParamError{Name: "phone", In: "query", Rule: "phone", Message: "must be a phone number"}, validationError.Errors[0])
+	}
+
+	req.URL.RawQuery = "phone=%2B33123456789&start=1&end=2"
+	_, err = api.BindNew(req, nil)
+	assert.Nil(t, err)
+}
+
+func TestFileParamValidator(t *testing.T) {
+	api, err := NewApi(&fileValidatorHandler{}, nil, nil, false)
+	assert.Nil(t, err)
+	newRequest := func(content string) *http.Request {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("avatar", "avatar.png")
+		part.Write([]byte(content))
+		writer.Close()
+		req, _ := http.NewRequest("POST", "/", body)
+		req.Header.Set(HeaderContentType, writer.FormDataContentType())
+		return req
+	}
+	_, err = api.BindNew(newRequest("more than 4 bytes"), nil)
+	validationError, ok := AsValidationError(err)
+	if assert.True(t, ok) && assert.Len(t, validationError.Errors, 1) {
+		assert.Equal(t, &ParamError{Name: "avatar", In: "formData", Rule: "smallfile", Message: "must be at most 4 bytes"}, validationError.Errors[0])
+	}
+	_, err = api.BindNew(newRequest("png"), nil)
+	assert.Nil(t, err)
+}
+
+func TestParamsValidator(t *testing.T) {
+	api, err := NewApi(&validatorHandler{}, nil, nil, false)
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("GET", "/?start=3&end=2", nil)
+	_, err = api.BindNew(req, nil)
+	validationError, ok := AsValidationError(err)
+	if assert.True(t, ok) && assert.Len(t, validationError.Errors, 1) {
+		assert.Equal(t, "end", validationError.Errors[0].Name)
+		assert.Equal(t, "query", validationError.Errors[0].In)
+		assert.Equal(t, ParamRuleStruct, validationError.Errors[0].Rule)
+	}
+
+	req.URL.RawQuery = ""
+	err = api.BindAt(&validatorHandler{}, req, nil)
+	validationError, ok = AsValidationError(err)
+	if assert.True(t, ok) && assert.Len(t, validationError.Errors, 1) {
+		assert.Equal(t, &ParamError{Name: "*", Rule: ParamRuleStruct, Message: "the range is empty"}, validationError.Errors[0])
+	}
+}
+
+func TestLocalizeValidationError(t *testing.T) {
+	RegisterParamMessages("zh", map[string]string{
+		KEY_LEN:      "{name} 的长度必须在 {min} 和 {max} 之间",
+		KEY_REQUIRED: "缺少参数 {name}",
+	})
+	api, err := NewApi(&validationErrorHandler{}, nil, nil, false)
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("GET", "/?name=ab&email=ltick", nil)
+	_, err = api.BindNew(req, nil)
+	validationError, ok := AsValidationError(err)
+	assert.True(t, ok)
+	localized := validationError.Localize("zh-CN")
+	if assert.Len(t, localized.Errors, 3) {
+		assert.Equal(t, "name 的长度必须在 3 和 8 之间", localized.Errors[0].Message)
+		// the custom error is kept
+		assert.Equal(t, "invalid email", localized.Errors[1].Message)
+		assert.Equal(t, "缺少参数 Token", localized.Errors[2].Message)
+	}
+	assert.Equal(t, "the length must be between 3 and 8", validationError.Errors[0].Message)
+	assert.Equal(t, validationError.Errors, validationError.Localize("fr").Errors)
+
+	BindErrorHandler = WriteBindError
+	defer func() {
+		BindErrorHandler = nil
+	}()
+	handler, err := ToAPIHandler(&validationErrorHandler{}, true)
+	assert.Nil(t, err)
+	req.Header.Set(HeaderAccept, MIMEApplicationJSON)
+	res := httptest.NewRecorder()
+	c := routing.NewContext(res, req)
+	c.Set(content.Language, "zh-CN")
+	assert.Nil(t, handler.Serve(&Context{Context: c, Response: NewResponse(c)}))
+	var responseData struct {
+		Data []*ParamError `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &responseData))
+	if assert.Len(t, responseData.Data, 3) {
+		assert.Equal(t, "缺少参数 Token", responseData.Data[2].Message)
+	}
+}
@@ -0,0 +1,618 @@
+package api
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/juju/errors"
+	"github.com/ltick/tick-routing"
+)
+
+// The message types of the WebSocket protocol, RFC 6455 section 11.8.
+const (
+	WebSocketTextMessage   = 1
+	WebSocketBinaryMessage = 2
+	WebSocketCloseMessage  = 8
+	WebSocketPingMessage   = 9
+	WebSocketPongMessage   = 10
+)
+
+// The close codes of the WebSocket protocol, RFC 6455 section 11.7.
+const (
+	WebSocketCloseNormalClosure  = 1000
+	WebSocketCloseGoingAway      = 1001
+	WebSocketCloseProtocolError  = 1002
+	WebSocketCloseNoStatus       = 1005
+	WebSocketCloseInvalidPayload = 1007
+	WebSocketCloseMessageTooBig  = 1009
+	WebSocketCloseInternalError  = 1011
+)
+
+const (
+	HeaderSecWebSocketKey      = "Sec-WebSocket-Key"
+	HeaderSecWebSocketAccept   = "Sec-WebSocket-Accept"
+	HeaderSecWebSocketVersion  = "Sec-WebSocket-Version"
+	HeaderSecWebSocketProtocol = "Sec-WebSocket-Protocol"
+)
+
+const (
+	DefaultWebSocketPongWait       = 60 * time.Second
+	DefaultWebSocketWriteWait      = 10 * time.Second
+	DefaultWebSocketMaxMessageSize = 1 << 16
+)
+
+var (
+	errWebSocketUpgrade          = "api: websocket upgrade error"
+	errWebSocketProtocol         = "api: websocket protocol error"
+	errWebSocketMessageTooBig    = "api: websocket message too big"
+	errWebSocketInvalidPayload   = "api: websocket invalid payload"
+	errWebSocketClosed           = "api: websocket connection closed"
+	errWebSocketHijackNotSupport = "api: websocket response writer does not support hijacking"
+)
+
+// webSocketGUID is appended to the key of the client to compute the accept key.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+type WebSocketOptions struct {
+	// PongWait is the time allowed to read the next frame from the client, extended by every frame read.
+	PongWait time.Duration
+	// PingInterval is the period of the pings sent to the client, 9/10 of PongWait if zero.
+	PingInterval time.Duration
+	// WriteWait is the time allowed to write a frame to the client.
+	WriteWait time.Duration
+	// MaxMessageSize is the max size in bytes of a message read from the client.
+	MaxMessageSize int64
+	// Subprotocols are the subprotocols supported by the server, in order of preference.
+	Subprotocols []string
+	// CheckOrigin returns true if the Origin header is accepted,
+	// the origin must match the host of the request if nil.
+	CheckOrigin func(r *http.Request) bool
+	// Hub is the hub the connections are registered to.
+	Hub *WebSocketHub
+}
+
+type WebSocketOption func(*WebSocketOptions)
+
+func WebSocketPongWait(pongWait time.Duration) WebSocketOption {
+	return func(options *WebSocketOptions) {
+		options.PongWait = pongWait
+	}
+}
+func WebSocketPingInterval(pingInterval time.Duration) WebSocketOption {
+	return func(options *WebSocketOptions) {
+		options.PingInterval = pingInterval
+	}
+}
+func WebSocketWriteWait(writeWait time.Duration) WebSocketOption {
+	return func(options *WebSocketOptions) {
+		options.WriteWait = writeWait
+	}
+}
+func WebSocketMaxMessageSize(maxMessageSize int64) WebSocketOption {
+	return func(options *WebSocketOptions) {
+		options.MaxMessageSize = maxMessageSize
+	}
+}
+func WebSocketSubprotocols(subprotocols ...string) WebSocketOption {
+	return func(options *WebSocketOptions) {
+		options.Subprotocols = subprotocols
+	}
+}
+func WebSocketCheckOrigin(checkOrigin func(r *http.Request) bool) WebSocketOption {
+	return func(options *WebSocketOptions) {
+		options.CheckOrigin = checkOrigin
+	}
+}
+func WebSocketWithHub(hub *WebSocketHub) WebSocketOption {
+	return func(options *WebSocketOptions) {
+		options.Hub = hub
+	}
+}
+
+func newWebSocketOptions(opts []WebSocketOption) *WebSocketOptions {
+	options := &WebSocketOptions{
+		PongWait:       DefaultWebSocketPongWait,
+		WriteWait:      DefaultWebSocketWriteWait,
+		MaxMessageSize: DefaultWebSocketMaxMessageSize,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.PingInterval <= 0 {
+		options.PingInterval = options.PongWait * 9 / 10
+	}
+	return options
+}
+
+// WebSocketCloseError is returned by the reads of a connection closed by the peer.
+type WebSocketCloseError struct {
+	Code int
+	Text string
+}
+
+func (e *WebSocketCloseError) Error() string {
+	if e.Text == "" {
+		return "api: websocket closed with code " + strconv.Itoa(e.Code)
+	}
+	return "api: websocket closed with code " + strconv.Itoa(e.Code) + ": " + e.Text
+}
+
+// IsWebSocketCloseError reports whether err is a close of the connection by the peer with one of the codes,
+// or with any code if no code is given.
+func IsWebSocketCloseError(err error, codes ...int) bool {
+	closeError, ok := errors.Cause(err).(*WebSocketCloseError)
+	if !ok {
+		return false
+	}
+	if len(codes) == 0 {
+		return true
+	}
+	for _, code := range codes {
+		if closeError.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+type (
+	// WebSocketHandler serves the connections upgraded to the WebSocket protocol.
+	WebSocketHandler interface {
+		ServeWebSocket(ctx *Context, conn *WebSocketConn) error
+	}
+	// WebSocketHandlerFunc is a function used as WebSocketHandler.
+	WebSocketHandlerFunc func(ctx *Context, conn *WebSocketConn) error
+)
+
+func (f WebSocketHandlerFunc) ServeWebSocket(ctx *Context, conn *WebSocketConn) error {
+	return f(ctx, conn)
+}
+
+// webSocketRouteHandler is the Handler upgrading the requests of a route.
+type webSocketRouteHandler struct {
+	handler WebSocketHandler
+	opts    []WebSocketOption
+}
+
+// NewWebSocketHandler returns a Handler upgrading the requests to the WebSocket protocol
+// and serving the connections with handler, the connection is closed when handler returns.
+//
+//	hub := api.NewWebSocketHub()
+//	server.Get([]string{"*"}, "", "/chat", api.NewWebSocketHandler(api.WebSocketHandlerFunc(
+//	    func(ctx *api.Context, conn *api.WebSocketConn) error {
+//	        for {
+//	            messageType, message, err := conn.ReadMessage()
+//	            if err != nil {
+//	                return err
+//	            }
+//	            hub.Broadcast(messageType, message)
+//	        }
+//	    }), api.WebSocketWithHub(hub)))
+func NewWebSocketHandler(handler WebSocketHandler, opts ...WebSocketOption) Handler {
+	return &webSocketRouteHandler{
+		handler: handler,
+		opts:    opts,
+	}
+}
+
+func (h *webSocketRouteHandler) Serve(ctx *Context) error {
+	conn, err := ctx.UpgradeWebSocket(h.opts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = h.handler.ServeWebSocket(ctx, conn)
+	if err != nil && (IsWebSocketCloseError(err, WebSocketCloseNormalClosure, WebSocketCloseGoingAway, WebSocketCloseNoStatus) || errors.Cause(err) == io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// Stream exempts the WebSocket routes from the request timeout.
+func (h *webSocketRouteHandler) Stream() bool {
+	return true
+}
+
+// UpgradeWebSocket upgrades the request to the WebSocket protocol, the client is pinged
+// until the connection is closed. The response must not be written after the upgrade.
+func (ctx *Context) UpgradeWebSocket(opts ...WebSocketOption) (*WebSocketConn, error) {
+	options := newWebSocketOptions(opts)
+	r := ctx.Request
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, HeaderConnection, "upgrade") ||
+		!headerContainsToken(r.Header, HeaderUpgrade, "websocket") {
+		return nil, routing.NewHTTPError(http.StatusBadRequest, errWebSocketUpgrade+": not a websocket handshake")
+	}
+	if r.Header.Get(HeaderSecWebSocketVersion) != "13" {
+		ctx.Response.Header().Set(HeaderSecWebSocketVersion, "13")
+		return nil, routing.NewHTTPError(http.StatusUpgradeRequired, errWebSocketUpgrade+": unsupported version")
+	}
+	key := r.Header.Get(HeaderSecWebSocketKey)
+	if decodedKey, err := base64.StdEncoding.DecodeString(key); err != nil || len(decodedKey) != 16 {
+		return nil, routing.NewHTTPError(http.StatusBadRequest, errWebSocketUpgrade+": invalid key")
+	}
+	checkOrigin := options.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return nil, routing.NewHTTPError(http.StatusForbidden, errWebSocketUpgrade+": origin not allowed")
+	}
+	subprotocol := ""
+	for _, protocol := range headerTokens(r.Header, HeaderSecWebSocketProtocol) {
+		for _, supported := range options.Subprotocols {
+			if protocol == supported {
+				subprotocol = protocol
+				break
+			}
+		}
+		if subprotocol != "" {
+			break
+		}
+	}
+	hijacker, ok := ctx.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, routing.NewHTTPError(http.StatusInternalServerError, errWebSocketHijackNotSupport)
+	}
+	netConn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, errors.Annotate(err, errWebSocketUpgrade)
+	}
+	handshake := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		HeaderSecWebSocketAccept + ": " + webSocketAcceptKey(key) + "\r\n"
+	if subprotocol != "" {
+		handshake += HeaderSecWebSocketProtocol + ": " + subprotocol + "\r\n"
+	}
+	handshake += "\r\n"
+	netConn.SetDeadline(time.Time{})
+	netConn.SetWriteDeadline(time.Now().Add(options.WriteWait))
+	if _, err = netConn.Write([]byte(handshake)); err != nil {
+		netConn.Close()
+		return nil, errors.Annotate(err, errWebSocketUpgrade)
+	}
+	ctx.Response.status = http.StatusSwitchingProtocols
+	conn := newWebSocketConn(netConn, brw.Reader, true, options)
+	conn.subprotocol = subprotocol
+	if options.Hub != nil {
+		options.Hub.Register(conn)
+	}
+	go conn.keepalive()
+	return conn, nil
+}
+
+func webSocketAcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get(HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+	if index := strings.Index(origin, "://"); index >= 0 {
+		origin = origin[index+3:]
+	}
+	return strings.EqualFold(origin, r.Host)
+}
+
+func headerTokens(header http.Header, name string) []string {
+	tokens := []string{}
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebSocketConn is a connection upgraded to the WebSocket protocol.
+// A connection supports one concurrent reader and many concurrent writers.
+type WebSocketConn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	isServer    bool
+	options     *WebSocketOptions
+	subprotocol string
+
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	closed     chan struct{}
+}
+
+func newWebSocketConn(conn net.Conn, reader *bufio.Reader, isServer bool, options *WebSocketOptions) *WebSocketConn {
+	if reader == nil {
+		reader = bufio.NewReader(conn)
+	}
+	c := &WebSocketConn{
+		conn:     conn,
+		reader:   reader,
+		isServer: isServer,
+		options:  options,
+		closed:   make(chan struct{}),
+	}
+	c.conn.SetReadDeadline(time.Now().Add(options.PongWait))
+	return c
+}
+
+// Subprotocol returns the subprotocol negotiated with the client.
+func (c *WebSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr returns the network address of the peer.
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Closed returns a channel closed when the connection is closed.
+func (c *WebSocketConn) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// keepalive pings the peer until the connection is closed.
+func (c *WebSocketConn) keepalive() {
+	ticker := time.NewTicker(c.options.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if err := c.writeFrame(WebSocketPingMessage, nil); err != nil {
+				c.closeConn()
+				return
+			}
+		}
+	}
+}
+
+// ReadMessage reads the next data message, answering the pings and the close of the peer.
+// A *WebSocketCloseError is returned when the peer closes the connection.
+func (c *WebSocketConn) ReadMessage() (messageType int, message []byte, err error) {
+	for {
+		fin, opcode, payload, err := c.readFrame(c.options.MaxMessageSize - int64(len(message)))
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case WebSocketPingMessage:
+			if err := c.writeFrame(WebSocketPongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case WebSocketPongMessage:
+			continue
+		case WebSocketCloseMessage:
+			closeError := &WebSocketCloseError{Code: WebSocketCloseNoStatus}
+			if len(payload) == 1 {
+				return 0, nil, c.protocolError("bad close frame")
+			}
+			if len(payload) >= 2 {
+				closeError.Code = int(binary.BigEndian.Uint16(payload))
+				if !validWebSocketCloseCode(closeError.Code) {
+					return 0, nil, c.protocolError("invalid close code " + strconv.Itoa(closeError.Code))
+				}
+				if !utf8.Valid(payload[2:]) {
+					return 0, nil, c.invalidPayloadError("invalid UTF-8 close reason")
+				}
+				closeError.Text = string(payload[2:])
+			}
+			c.closeWith(WebSocketCloseNormalClosure, "")
+			return 0, nil, closeError
+		case 0:
+			if messageType == 0 {
+				return 0, nil, c.protocolError("unexpected continuation frame")
+			}
+		case WebSocketTextMessage, WebSocketBinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.protocolError("unexpected data frame in a fragmented message")
+			}
+			messageType = opcode
+		default:
+			return 0, nil, c.protocolError("unknown opcode " + strconv.Itoa(opcode))
+		}
+		message = append(message, payload...)
+		if fin {
+			if messageType == WebSocketTextMessage && !utf8.Valid(message) {
+				return 0, nil, c.invalidPayloadError("invalid UTF-8 text message")
+			}
+			return messageType, message, nil
+		}
+	}
+}
+
+// ReadJSON reads the next message and decodes it from JSON into v.
+func (c *WebSocketConn) ReadJSON(v interface{}) error {
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(message, v)
+}
+
+// WriteMessage writes a data message to the peer.
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != WebSocketTextMessage && messageType != WebSocketBinaryMessage {
+		return errors.New(errWebSocketProtocol + ": not a data message type")
+	}
+	return c.writeFrame(messageType, data)
+}
+
+// WriteJSON encodes v in JSON and writes it as a text message.
+func (c *WebSocketConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(WebSocketTextMessage, data)
+}
+
+// Close sends a normal close to the peer and closes the connection.
+func (c *WebSocketConn) Close() error {
+	return c.closeWith(WebSocketCloseNormalClosure, "")
+}
+
+func (c *WebSocketConn) closeWith(code int, text string) error {
+	payload := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, text...)
+	c.writeFrame(WebSocketCloseMessage, payload)
+	return c.closeConn()
+}
+
+func (c *WebSocketConn) closeConn() (err error) {
+	err = errors.New(errWebSocketClosed)
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.conn.Close()
+		if c.options.Hub != nil {
+			c.options.Hub.Unregister(c)
+		}
+	})
+	return err
+}
+
+func (c *WebSocketConn) protocolError(reason string) error {
+	c.closeWith(WebSocketCloseProtocolError, "")
+	return errors.New(errWebSocketProtocol + ": " + reason)
+}
+
+func (c *WebSocketConn) invalidPayloadError(reason string) error {
+	c.closeWith(WebSocketCloseInvalidPayload, "")
+	return errors.New(errWebSocketInvalidPayload + ": " + reason)
+}
+
+// validWebSocketCloseCode reports whether a peer may send the close code, RFC 6455 section 7.4:
+// the codes reserved for the endpoints, 1005, 1006 and 1015, and the unassigned codes are not.
+func validWebSocketCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// readFrame reads a frame of at most maxSize bytes of payload, the read deadline is extended by every frame.
+func (c *WebSocketConn) readFrame(maxSize int64) (fin bool, opcode int, payload []byte, err error) {
+	header := make([]byte, 2, 8)
+	if _, err = io.ReadFull(c.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	c.conn.SetReadDeadline(time.Now().Add(c.options.PongWait))
+	fin = header[0]&0x80 != 0
+	opcode = int(header[0] & 0x0f)
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.protocolError("reserved bits set")
+	}
+	masked := header[1]&0x80 != 0
+	if masked != c.isServer {
+		return false, 0, nil, c.protocolError("bad frame masking")
+	}
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(c.reader, header[:2]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		header = header[:8]
+		if _, err = io.ReadFull(c.reader, header); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(header))
+	}
+	if opcode >= WebSocketCloseMessage {
+		if !fin || length > 125 {
+			return false, 0, nil, c.protocolError("bad control frame")
+		}
+	} else if length > maxSize || length < 0 {
+		c.closeWith(WebSocketCloseMessageTooBig, "")
+		return false, 0, nil, errors.New(errWebSocketMessageTooBig)
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single final frame, masked by the clients.
+func (c *WebSocketConn) writeFrame(opcode int, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|byte(opcode))
+	var maskBit byte
+	if !c.isServer {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, maskBit|127)
+		var extended [8]byte
+		binary.BigEndian.PutUint64(extended[:], uint64(length))
+		frame = append(frame, extended[:]...)
+	}
+	if c.isServer {
+		frame = append(frame, payload...)
+	} else {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	select {
+	case <-c.closed:
+		return errors.New(errWebSocketClosed)
+	default:
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.options.WriteWait))
+	_, err := c.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// WebSocketHub keeps the open connections to broadcast messages to them,
+// the connections upgraded with the WebSocketWithHub option are registered until they are closed.
+type WebSocketHub struct {
+	mutex sync.RWMutex
+	conns map[*WebSocketConn]struct{}
+}
+
+func NewWebSocketHub() *WebSocketHub {
+	return &WebSocketHub{
+		conns: make(map[*WebSocketConn]struct{}),
+	}
+}
+
+func (h *WebSocketHub) Register(conn *WebSocketConn) {
+	h.mutex.Lock()
+	h.conns[conn] = struct{}{}
+	h.mutex.Unlock()
+}
+
+func (h *WebSocketHub) Unregister(conn *WebSocketConn) {
+	h.mutex.Lock()
+	delete(h.conns, conn)
+	h.mutex.Unlock()
+}
+
+// Len returns the number of registered connections.
+func (h *WebSocketHub) Len() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.conns)
+}
+
+func (h *WebSocketHub) snapshot() []*WebSocketConn {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	conns := make([]*WebSocketConn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// Broadcast writes the message to every registered connection concurrently,
+// the connections failing to receive it are closed. It returns the number of connections written.
+func (h *WebSocketHub) Broadcast(messageType int, data []byte) int {
+	conns := h.snapshot()
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		written int
+	)
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *WebSocketConn) {
+			defer wg.Done()
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				conn.closeConn()
+				return
+			}
+			mutex.Lock()
+			written++
+			mutex.Unlock()
+		}(conn)
+	}
+	wg.Wait()
+	return written
+}
+
+// BroadcastJSON encodes v in JSON and broadcasts it as a text message.
+func (h *WebSocketHub) BroadcastJSON(v interface{}) (int, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return h.Broadcast(WebSocketTextMessage, data), nil
+}
+
+// Close closes every registered connection.
+func (h *WebSocketHub) Close() {
+	for _, conn := range h.snapshot() {
+		conn.Close()
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ltick/tick-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWebSocketTestServer(handler Handler) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := routing.NewContext(w, r)
+		ctx := &Context{Context: c, Response: NewResponse(c)}
+		if err := handler.Serve(ctx); err != nil {
+			if httpError, ok := err.(routing.HTTPError); ok {
+				http.Error(w, httpError.Error(), httpError.StatusCode())
+			}
+		}
+	}))
+}
+
+// dialWebSocket is the local client of the tests.
+func dialWebSocket(t *testing.T, server *httptest.Server, header http.Header) (*WebSocketConn, *http.Response) {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("GET", server.URL+"/ws", nil)
+	req.Header.Set(HeaderConnection, "Upgrade")
+	req.Header.Set(HeaderUpgrade, "websocket")
+	req.Header.Set(HeaderSecWebSocketVersion, "13")
+	req.Header.Set(HeaderSecWebSocketKey, "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	assert.Nil(t, req.Write(conn))
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, req)
+	assert.Nil(t, err)
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, res
+	}
+	return newWebSocketConn(conn, reader, false, newWebSocketOptions(nil)), res
+}
+
+func TestWebSocketAcceptKey(t *testing.T) {
+	// RFC 6455 section 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", webSocketAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestWebSocketHub(t *testing.T) {
+	hub := NewWebSocketHub()
+	registered := make(chan struct{}, 2)
+	server := newWebSocketTestServer(NewWebSocketHandler(WebSocketHandlerFunc(func(ctx *Context, conn *WebSocketConn) error {
+		assert.Equal(t, "chat", conn.Subprotocol())
+		registered <- struct{}{}
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return err
+			}
+			hub.Broadcast(messageType, message)
+		}
+	}), WebSocketWithHub(hub), WebSocketSubprotocols("chat")))
+	defer server.Close()
+
+	alice, res := dialWebSocket(t, server, http.Header{HeaderSecWebSocketProtocol: {"other, chat"}})
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", res.Header.Get(HeaderSecWebSocketAccept))
+	assert.Equal(t, "chat", res.Header.Get(HeaderSecWebSocketProtocol))
+	bob, _ := dialWebSocket(t, server, http.Header{HeaderSecWebSocketProtocol: {"chat"}})
+	<-registered
+	<-registered
+	assert.Equal(t, 2, hub.Len())
+
+	// a message large enough for the 16 bits length
+	message := strings.Repeat("hello ", 100)
+	assert.Nil(t, alice.WriteMessage(WebSocketTextMessage, []byte(message)))
+	for _, conn := range []*WebSocketConn{alice, bob} {
+		messageType, received, err := conn.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, WebSocketTextMessage, messageType)
+		assert.Equal(t, message, string(received))
+	}
+	written, err := hub.BroadcastJSON(map[string]string{"from": "server"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, written)
+	var data map[string]string
+	assert.Nil(t, bob.ReadJSON(&data))
+	assert.Equal(t, "server", data["from"])
+
+	alice.Close()
+	for i := 0; i < 100 && hub.Len() != 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 1, hub.Len())
+	hub.Close()
+	_, _, err = bob.ReadMessage()
+	assert.True(t, IsWebSocketCloseError(err, WebSocketCloseNormalClosure))
+	assert.Equal(t, 0, hub.Len())
+}
+
+func TestWebSocketKeepalive(t *testing.T) {
+	server := newWebSocketTestServer(NewWebSocketHandler(WebSocketHandlerFunc(func(ctx *Context, conn *WebSocketConn) error {
+		_, _, err := conn.ReadMessage()
+		return err
+	}), WebSocketPingInterval(20*time.Millisecond)))
+	defer server.Close()
+
+	client, _ := dialWebSocket(t, server, nil)
+	defer client.Close()
+	fin, opcode, _, err := client.readFrame(0)
+	assert.Nil(t, err)
+	assert.True(t, fin)
+	assert.Equal(t, WebSocketPingMessage, opcode)
+}
+
+func TestWebSocketReadDeadline(t *testing.T) {
+	served := make(chan error, 1)
+	server := newWebSocketTestServer(NewWebSocketHandler(WebSocketHandlerFunc(func(ctx *Context, conn *WebSocketConn) error {
+		_, _, err := conn.ReadMessage()
+		served <- err
+		return err
+	}), WebSocketPongWait(50*time.Millisecond), WebSocketPingInterval(time.Hour)))
+	defer server.Close()
+
+	client, _ := dialWebSocket(t, server, nil)
+	defer client.Close()
+	select {
+	case err := <-served:
+		netErr, ok := err.(net.Error)
+		assert.True(t, ok && netErr.Timeout())
+	case <-time.After(2 * time.Second):
+		t.Fatal("the silent client is not timed out")
+	}
+}
+
+func TestWebSocketMaxMessageSize(t *testing.T) {
+	server := newWebSocketTestServer(NewWebSocketHandler(WebSocketHandlerFunc(func(ctx *Context, conn *WebSocketConn) error {
+		_, _, err := conn.ReadMessage()
+		return err
+	}), WebSocketMaxMessageSize(8)))
+	defer server.Close()
+
+	client, _ := dialWebSocket(t, server, nil)
+	defer client.Close()
+	assert.Nil(t, client.WriteMessage(WebSocketBinaryMessage, []byte("more than 8 bytes")))
+	_, _, err := client.ReadMessage()
+	assert.True(t, IsWebSocketCloseError(err, WebSocketCloseMessageTooBig))
+}
+
+func TestWebSocketUpgradeError(t *testing.T) {
+	server := newWebSocketTestServer(NewWebSocketHandler(WebSocketHandlerFunc(func(ctx *Context, conn *WebSocketConn) error {
+		return nil
+	})))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/ws")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	_, res = dialWebSocket(t, server, http.Header{HeaderSecWebSocketVersion: {"8"}})
+	assert.Equal(t, http.StatusUpgradeRequired, res.StatusCode)
+	assert.Equal(t, "13", res.Header.Get(HeaderSecWebSocketVersion))
+
+	_, res = dialWebSocket(t, server, http.Header{HeaderOrigin: {"http://evil.example.com"}})
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestWebSocketInvalidPayload(t *testing.T) {
+	served := make(chan error, 1)
+	server := newWebSocketTestServer(NewWebSocketHandler(WebSocketHandlerFunc(func(ctx *Context, conn *WebSocketConn) error {
+		_, _, err := conn.ReadMessage()
+		served <- err
+		return err
+	})))
+	defer server.Close()
+
+	closePayload := func(code uint16, reason string) []byte {
+		payload := make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, code)
+		return append(payload, reason...)
+	}
+	for _, c := range []struct {
+		opcode  int
+		payload []byte
+		code    int
+	}{
+		{WebSocketTextMessage, []byte{'l', 't', 0xff, 'k'}, WebSocketCloseInvalidPayload},
+		{WebSocketCloseMessage, closePayload(WebSocketCloseNormalClosure, "\xc3\x28"), WebSocketCloseInvalidPayload},
+		{WebSocketCloseMessage, closePayload(WebSocketCloseNoStatus, ""), WebSocketCloseProtocolError},
+		{WebSocketCloseMessage, closePayload(2000, ""), WebSocketCloseProtocolError},
+		{WebSocketCloseMessage, []byte{0x03}, WebSocketCloseProtocolError},
+	} {
+		client, _ := dialWebSocket(t, server, nil)
+		assert.Nil(t, client.writeFrame(c.opcode, c.payload))
+		_, _, err := client.ReadMessage()
+		assert.True(t, IsWebSocketCloseError(err, c.code), "%v", err)
+		assert.NotNil(t, <-served)
+		client.Close()
+	}
+
+	// a valid close code of the applications
+	client, _ := dialWebSocket(t, server, nil)
+	assert.Nil(t, client.writeFrame(WebSocketCloseMessage, closePayload(4000, "bye")))
+	assert.True(t, IsWebSocketCloseError(<-served, 4000))
+	client.Close()
+
+	// a valid text message split in the middle of a character
+	client, _ = dialWebSocket(t, server, nil)
+	defer client.Close()
+	text := "h\xc3\xa9"
+	frame := []byte{byte(WebSocketTextMessage), 0x80 | 2, 0, 0, 0, 0}
+	frame = append(frame, text[:2]...)
+	frame = append(frame, 0x80, 0x80|1, 0, 0, 0, 0, text[2])
+	_, err := client.conn.Write(frame)
+	assert.Nil(t, err)
+	assert.Nil(t, <-served)
+}
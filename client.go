@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ltick/tick-framework/metrics"
+	"github.com/ltick/tick-framework/tracing"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -46,6 +47,8 @@ type (
 		// observer of send request
 		MetricsHttpClientRequestsTraceRequest []prometheus.ObserverVec
 		MetricsHttpClientRequestLabelFuncs    []metrics.HttpClientRequestLabelFunc
+		// exporter of the client spans
+		TracingExporter tracing.Exporter
 	}
 
 	Client struct {
@@ -182,6 +185,11 @@ func ClientMetricsHttpClientRequestLabelFunc(httpClientRequestLabelFuncs ...metr
 		options.MetricsHttpClientRequestLabelFuncs = httpClientRequestLabelFuncs
 	}
 }
+func ClientTracingExporter(exporter tracing.Exporter) ClientOption {
+	return func(options *ClientOptions) {
+		options.TracingExporter = exporter
+	}
+}
 func NewHttpClient(setters ...ClientOption) *http.Client {
 	c := Client{
 		&ClientOptions{},
@@ -230,6 +238,8 @@ func NewHttpClient(setters ...ClientOption) *http.Client {
 	if c.Timeout > 0 {
 		httpClient.Timeout = c.Timeout
 	}
+	// Forward the request id and trace context of the request context.
+	httpClient.Transport = tracing.NewTransport(httpClient.Transport, c.TracingExporter)
 
 	// Wrap the default RoundTripper with middleware.
 	if c.MetricsHttpClientRequestsDurations != nil {
@@ -0,0 +1,223 @@
+package ltick
+
+import (
+	"bufio"
+	"compress/flate"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ltick/tick-framework/api/acceptencoder"
+	"github.com/ltick/tick-routing"
+)
+
+// DefaultCompressionExcludedContentTypes are the content types which are already compressed.
+var DefaultCompressionExcludedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/pdf",
+}
+
+type CompressionOptions struct {
+	// ExcludedContentTypes are the content types or content type prefixes ending with "/" never compressed,
+	// DefaultCompressionExcludedContentTypes if nil.
+	ExcludedContentTypes []string
+}
+
+// Compressor returns a handler compressing the responses of the following handlers
+// with the content coding negotiated from the Accept-Encoding header.
+// The methods, the level and the min length compressed are the ones set by acceptencoder.InitGzip,
+// the GET responses are compressed at the best speed when it has not been called.
+// gzip and deflate are supported, other codings can be added by acceptencoder.RegisterEncoder.
+func Compressor(opts CompressionOptions) routing.Handler {
+	if !acceptencoder.GzipInitialized() {
+		acceptencoder.InitGzip(-1, flate.BestSpeed, nil)
+	}
+	excludedContentTypes := opts.ExcludedContentTypes
+	if excludedContentTypes == nil {
+		excludedContentTypes = DefaultCompressionExcludedContentTypes
+	}
+	return func(c *routing.Context) error {
+		c.ResponseWriter.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptencoder.ParseEncoding(c.Request)
+		if encoding == "" {
+			return c.Next()
+		}
+		rw := &compressResponseWriter{
+			ResponseWriter:       c.ResponseWriter,
+			encoding:             encoding,
+			excludedContentTypes: excludedContentTypes,
+			status:               http.StatusOK,
+		}
+		c.ResponseWriter = rw
+		err := c.Next()
+		closeErr := rw.close()
+		// the error handlers write to the original writer
+		c.ResponseWriter = rw.ResponseWriter
+		if err != nil {
+			return err
+		}
+		return closeErr
+	}
+}
+
+// compressResponseWriter buffers the beginning of the response until it knows
+// whether the response is worth compressing.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding             string
+	excludedContentTypes []string
+
+	status      int
+	wroteHeader bool
+	started     bool
+	buffer      []byte
+	writer      *acceptencoder.Writer
+	hijacked    bool
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	if w.started || w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		if contentLength := w.Header().Get("Content-Length"); contentLength != "" {
+			if length, err := strconv.Atoi(contentLength); err == nil && length < acceptencoder.MinLength() {
+				if err := w.start(false); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	if !w.started {
+		w.buffer = append(w.buffer, b...)
+		if len(w.buffer) >= acceptencoder.MinLength() {
+			if err := w.start(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush compresses the content written so far whatever its length, the length of a flushed response is unknown.
+func (w *compressResponseWriter) Flush() {
+	if !w.started {
+		if err := w.start(true); err != nil {
+			return
+		}
+	}
+	if w.writer != nil {
+		w.writer.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("ltick: response writer does not support hijacking")
+	}
+	w.hijacked = true
+	return hijacker.Hijack()
+}
+
+func (w *compressResponseWriter) compressible() bool {
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified || w.status == http.StatusPartialContent {
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || len(w.buffer) == 0 {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buffer)
+		header.Set("Content-Type", contentType)
+	}
+	if index := strings.Index(contentType, ";"); index >= 0 {
+		contentType = contentType[:index]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, excludedContentType := range w.excludedContentTypes {
+		if strings.HasSuffix(excludedContentType, "/") {
+			if strings.HasPrefix(contentType, excludedContentType) {
+				return false
+			}
+		} else if contentType == excludedContentType {
+			return false
+		}
+	}
+	return true
+}
+
+// start writes the header and the buffered content, compressed if allowed and worth it.
+func (w *compressResponseWriter) start(allowed bool) error {
+	w.started = true
+	if allowed && w.compressible() {
+		if writer, encoding := acceptencoder.NewWriter(w.encoding, w.ResponseWriter); encoding != "" {
+			header := w.Header()
+			header.Del("Content-Length")
+			header.Set("Content-Encoding", encoding)
+			// the compressed content is only semantically equivalent
+			if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				header.Set("ETag", "W/"+etag)
+			}
+			w.writer = writer
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buffer := w.buffer
+	w.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(buffer)
+	} else {
+		_, err = w.ResponseWriter.Write(buffer)
+	}
+	return err
+}
+
+func (w *compressResponseWriter) close() error {
+	if w.hijacked {
+		return nil
+	}
+	if !w.started {
+		if !w.wroteHeader && len(w.buffer) == 0 {
+			// nothing written, let the outer handlers write the response
+			return nil
+		}
+		if err := w.start(len(w.buffer) >= acceptencoder.MinLength()); err != nil {
+			return err
+		}
+	}
+	if w.writer != nil {
+		return w.writer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package ltick
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ltick/tick-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressor(t *testing.T) {
+	router := routing.New()
+	router.AppendStartupHandler(Compressor(CompressionOptions{}))
+	router.Get("/text", func(c *routing.Context) error {
+		c.ResponseWriter.Header().Set("Content-Type", "text/plain")
+		_, err := c.ResponseWriter.Write([]byte(strings.Repeat("ltick", 100)))
+		return err
+	})
+	router.Get("/short", func(c *routing.Context) error {
+		_, err := c.ResponseWriter.Write([]byte("ltick"))
+		return err
+	})
+	router.Get("/image", func(c *routing.Context) error {
+		c.ResponseWriter.Header().Set("Content-Type", "image/png")
+		_, err := c.ResponseWriter.Write(bytes.Repeat([]byte{0}, 100))
+		return err
+	})
+
+	req, _ := http.NewRequest("GET", "/text", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, "gzip", res.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+	reader, err := gzip.NewReader(res.Body)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("ltick", 100), string(body))
+
+	req, _ = http.NewRequest("GET", "/short", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, "", res.Header().Get("Content-Encoding"))
+	assert.Equal(t, "ltick", res.Body.String())
+
+	req, _ = http.NewRequest("GET", "/image", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, "", res.Header().Get("Content-Encoding"))
+	assert.Equal(t, 100, res.Body.Len())
+
+	req, _ = http.NewRequest("GET", "/text", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, "", res.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+	assert.Equal(t, 500, res.Body.Len())
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"unsafe"
+
+	"github.com/jinzhu/gorm"
+)
+
+// contextDB binds the statements of a connection pool to a context, as gorm ignores the contexts:
+// the driver cancels the running statement when the context is done.
+type contextDB struct {
+	db  *sql.DB
+	ctx context.Context
+}
+
+func (c *contextDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+func (c *contextDB) Prepare(query string) (*sql.Stmt, error) {
+	return c.db.PrepareContext(c.ctx, query)
+}
+func (c *contextDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+func (c *contextDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
+
+// Begin starts a transaction rolled back if the context is done before it is committed.
+func (c *contextDB) Begin() (*sql.Tx, error) {
+	return c.db.BeginTx(c.ctx, nil)
+}
+
+// contextTx binds the statements of a transaction to a context.
+type contextTx struct {
+	*sql.Tx
+	ctx context.Context
+}
+
+func (c *contextTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.Tx.ExecContext(c.ctx, query, args...)
+}
+func (c *contextTx) Prepare(query string) (*sql.Stmt, error) {
+	return c.Tx.PrepareContext(c.ctx, query)
+}
+func (c *contextTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.Tx.QueryContext(c.ctx, query, args...)
+}
+func (c *contextTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.Tx.QueryRowContext(c.ctx, query, args...)
+}
+
+// withContext returns a copy of db, with its query, running its statements with ctx.
+func withContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return db
+	}
+	var common gorm.SQLCommon
+	switch sqlDb := db.CommonDB().(type) {
+	case *sql.DB:
+		common = &contextDB{db: sqlDb, ctx: ctx}
+	case *contextDB:
+		common = &contextDB{db: sqlDb.db, ctx: ctx}
+	case *sql.Tx:
+		if sqlDb == nil {
+			return db
+		}
+		common = &contextTx{Tx: sqlDb, ctx: ctx}
+	case *contextTx:
+		common = &contextTx{Tx: sqlDb.Tx, ctx: ctx}
+	default:
+		return db
+	}
+	// Set clones db with its query, gorm has no setter for the connection of the clone
+	clone := db.Set("ltick:context", ctx)
+	if !setCommonDB(clone, common) {
+		return db
+	}
+	clone.Dialect().SetDB(common)
+	return clone
+}
+
+// gormCommonDBField is the unexported field of gorm.DB holding its connection, there is no supported way
+// to replace it: gorm.Open with a connection returns a new DB without the query and the settings of db.
+// TestGormCommonDBField fails if a version of gorm renames it.
+const gormCommonDBField = "db"
+
+// setCommonDB replaces the connection of db by common, false if gorm.DB has no such field.
+func setCommonDB(db *gorm.DB, common gorm.SQLCommon) bool {
+	field := reflect.ValueOf(db).Elem().FieldByName(gormCommonDBField)
+	if !field.IsValid() || field.Type() != reflect.TypeOf((*gorm.SQLCommon)(nil)).Elem() {
+		return false
+	}
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(common))
+	return true
+}
+
+// begin starts a transaction bound to the context of db if any.
+func begin(db *gorm.DB) *gorm.DB {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx
+	}
+	return withContext(tx, contextOf(tx))
+}
+
+// contextOf returns the context bound to db by withContext, nil if none.
+func contextOf(db *gorm.DB) context.Context {
+	if ctx, ok := db.Get("ltick:context"); ok {
+		return ctx.(context.Context)
+	}
+	return nil
+}
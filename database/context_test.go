@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithContext(t *testing.T) {
+	// the connection of a transaction canceled is discarded, which would drop a memory database
+	dir, err := ioutil.TempDir("", "database")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	handler := NewSqliteHandler()
+	assert.Nil(t, handler.Initiate(context.Background()))
+	db, err := handler.NewHandler("context", map[string]interface{}{
+		"DATABASE_SQLITE_PATH": filepath.Join(dir, "context.db"),
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+	assert.Nil(t, db.New().AutoMigrate(&testUser{}).Error())
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, db.New().WithContext(canceled).Create(&testUser{Name: "canceled"}).Error())
+	assert.Equal(t, context.Canceled, db.New().Model(&testUser{}).WithContext(canceled).Where("name = ?", "ltick").Find(&[]testUser{}).Error())
+	var count int
+	assert.Equal(t, context.Canceled, db.New().WithContext(canceled).Raw("SELECT 1").Row().Scan(&count))
+	// the handler itself isn't bound
+	assert.Nil(t, db.New().Create(&testUser{Name: "ltick"}).Error())
+	assert.Nil(t, db.New().WithContext(context.Background()).New().Model(&testUser{}).Count(&count).Error())
+	assert.Equal(t, 1, count)
+
+	// the transaction is rolled back when its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	tx := db.New().WithContext(ctx).Begin()
+	assert.Nil(t, tx.Error())
+	assert.Nil(t, tx.Create(&testUser{Name: "rollback"}).Error())
+	cancel()
+	assert.NotNil(t, tx.Create(&testUser{Name: "rollback"}).Error())
+	assert.NotNil(t, tx.Commit().Error())
+	assert.Nil(t, db.New().Model(&testUser{}).Count(&count).Error())
+	assert.Equal(t, 1, count)
+
+	// the running statement is interrupted on the deadline
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = db.New().WithContext(ctx).Raw("WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000) SELECT count(*) FROM c").Row().Scan(&count)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestReplicaWithContext(t *testing.T) {
+	primary := openTestReplica(t, "context_primary", "primary")
+	replica := openTestReplica(t, "context_replica", "replica")
+	pool := NewReplicaPool([]*gorm.DB{replica}, 0)
+	handler := &MysqlDatabaseHandler{Db: primary, primary: primary, replicas: pool}
+	defer handler.Close()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	var user testUser
+	assert.Equal(t, context.Canceled, handler.New().WithContext(canceled).First(&user, 1).Error())
+	assert.Equal(t, 1, pool.Healthy())
+	assert.Equal(t, context.Canceled, handler.New().WithContext(canceled).Model(&testUser{}).Where("id = ?", 1).Update("name", "canceled").Error())
+	assert.Nil(t, handler.New().WithContext(context.Background()).First(&user, 1).Error())
+	assert.Equal(t, "replica", user.Name)
+	user = testUser{}
+	assert.Nil(t, primary.First(&user, 1).Error)
+	assert.Equal(t, "primary", user.Name)
+}
+
+func TestGormCommonDBField(t *testing.T) {
+	// withContext replaces the connection of a gorm.DB through its unexported field,
+	// the contexts would be silently ignored without it
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+	common := &contextDB{db: db.DB(), ctx: context.Background()}
+	if !setCommonDB(db, common) {
+		t.Fatalf("gorm.DB has no field %q of type gorm.SQLCommon, withContext can't bind the statements to the contexts", gormCommonDBField)
+	}
+	assert.Equal(t, common, db.CommonDB())
+}
+
+func TestDatabaseGetContextHandler(t *testing.T) {
+	assert.Nil(t, Register("sqlite3", NewSqliteHandler))
+	d := &Database{}
+	if !assert.Nil(t, d.Use(context.Background(), "sqlite3")) {
+		return
+	}
+	db, err := d.NewHandler("request", map[string]interface{}{
+		"DATABASE_SQLITE_PATH": ":memory:",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+
+	requestContext, cancel := context.WithCancel(context.Background())
+	handler, err := d.GetContextHandler(requestContext, "request")
+	assert.Nil(t, err)
+	var one int
+	assert.Nil(t, handler.New().Raw("SELECT 1").Row().Scan(&one))
+	cancel()
+	assert.Equal(t, context.Canceled, handler.New().Raw("SELECT 1").Row().Scan(&one))
+	assert.Nil(t, db.New().Raw("SELECT 1").Row().Scan(&one))
+
+	_, err = d.GetContextHandler(context.Background(), "unknown")
+	assert.NotNil(t, err)
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ltick/tick-framework/utility"
 	"github.com/tsuna/gohbase"
 	"github.com/tsuna/gohbase/hrpc"
-	"time"
+	"github.com/tsuna/gohbase/region"
 )
 
 var (
@@ -22,13 +27,19 @@ var (
 	errHbaseAppend            = "database(hbase): append error"
 	errHbaseIncrement         = "database(hbase): increment error"
 	errHbaseCheckAndPut       = "database(hbase): check and put error"
-	errHbaseGetHandler     = "database(hbase): get handler error"
-	errHbaseDatabaseNotExists = "database(hbase): database not exists"
+	errHbaseBatchGet          = "database(hbase): batch get error"
+	errHbaseBatchPut          = "database(hbase): batch put error"
+	errHbaseBatchDelete       = "database(hbase): batch delete error"
+	errHbaseGetHandler        = "database(hbase): get handler error"
+	errHbaseDatabaseNotExists = "database(hbase): '%s' handler not exists"
 )
 
 const (
 	DEFAULT_MAX_ACTIVE = 30
-	DEFAULT_TIMEOUT    = 120
+	// DEFAULT_TIMEOUT is the wait for a client when all are in use, in seconds
+	DEFAULT_TIMEOUT = 120
+	// DEFAULT_IDLE_TIMEOUT is the time after which an idle client is closed, in seconds
+	DEFAULT_IDLE_TIMEOUT = 300
 )
 
 type HbaseHandler struct {
@@ -36,30 +47,37 @@ type HbaseHandler struct {
 	databases map[string]*HbaseDatabaseHandler
 }
 type HbaseDatabaseHandler struct {
-	Client    chan gohbase.Client
-	MaxIdle   int
-	MaxActive int
-	Timeout   time.Duration
-	Host      string
-	User      string
-	Password  string
-	closed    bool
-	active    int
+	MaxIdle     int
+	MaxActive   int
+	Timeout     time.Duration
+	IdleTimeout time.Duration
+	Host        string
+	User        string
+	Password    string
+
+	// pool creates the clients on demand, up to MaxActive
+	pool     utility.Pool
+	mutex    sync.Mutex
+	borrowed map[gohbase.Client]utility.Conn
 }
 
 type HbaseDatabaseCallback struct {
 	Callback hrpc.Call
 }
 
+// HbaseDatabaseScanner holds a client of the pool until it is closed.
 type HbaseDatabaseScanner struct {
 	Scanner hrpc.Scanner
+	conn    utility.Conn
+	err     error
+	limit   int
+	count   int
 }
 
 func NewHbaseHandler() NosqlHandler {
 	return &HbaseHandler{}
 }
 
-// 批量生成连接，并把连接放到连接池channel里面
 func (this *HbaseHandler) Initiate(ctx context.Context) error {
 	this.databases = make(map[string]*HbaseDatabaseHandler)
 	return nil
@@ -68,7 +86,8 @@ func (this *HbaseHandler) Initiate(ctx context.Context) error {
 func (this *HbaseHandler) NewHandler(name string, config map[string]interface{}) (NosqlDatabaseHandler, error) {
 	db := &HbaseDatabaseHandler{}
 	db.MaxActive = DEFAULT_MAX_ACTIVE
-	db.Timeout = DEFAULT_TIMEOUT
+	db.Timeout = DEFAULT_TIMEOUT * time.Second
+	db.IdleTimeout = DEFAULT_IDLE_TIMEOUT * time.Second
 	configHost := config["DATABASE_HBASE_HOST"]
 	if configHost != nil {
 		host, ok := configHost.(string)
@@ -86,14 +105,29 @@ func (this *HbaseHandler) NewHandler(name string, config map[string]interface{})
 	configTimeout, ok := config["DATABASE_HBASE_TIMEOUT"]
 	if ok && configTimeout != nil {
 		timeoutString, ok := configTimeout.(string)
-		if ok && timeoutString != "" {
+		if !ok {
+			return nil, errors.New(errHbaseNewDatabase + ": invalid config DATABASE_HBASE_TIMEOUT")
+		}
+		if timeoutString != "" {
 			timeout, err := time.ParseDuration(timeoutString)
 			if err != nil {
 				return nil, errors.New(errHbaseNewDatabase + ": invalid config DATABASE_HBASE_TIMEOUT :" + err.Error())
 			}
 			db.Timeout = timeout
-		} else {
-			return nil, errors.New(errHbaseNewDatabase + ": invalid config DATABASE_HBASE_TIMEOUT")
+		}
+	}
+	configIdleTimeout, ok := config["DATABASE_HBASE_IDLE_TIMEOUT"]
+	if ok && configIdleTimeout != nil {
+		timeoutString, ok := configIdleTimeout.(string)
+		if !ok {
+			return nil, errors.New(errHbaseNewDatabase + ": invalid config DATABASE_HBASE_IDLE_TIMEOUT")
+		}
+		if timeoutString != "" {
+			timeout, err := time.ParseDuration(timeoutString)
+			if err != nil {
+				return nil, errors.New(errHbaseNewDatabase + ": invalid config DATABASE_HBASE_IDLE_TIMEOUT :" + err.Error())
+			}
+			db.IdleTimeout = timeout
 		}
 	}
 	configMaxActive, ok := config["DATABASE_HBASE_MAX_ACTIVE"]
@@ -107,14 +141,8 @@ func (this *HbaseHandler) NewHandler(name string, config map[string]interface{})
 			return nil, errors.New(errHbaseNewDatabase + ": invalid config DATABASE_HBASE_MAX_ACTIVE")
 		}
 	}
-	db.Client = make(chan gohbase.Client, db.MaxActive)
-	for x := 0; x < db.MaxActive; x++ {
-		client := gohbase.NewClient(db.Host)
-		if client == nil {
-			return nil, errors.New(errHbaseNewDatabase + ": new client error")
-		}
-		db.Client <- client
-	}
+	db.borrowed = make(map[gohbase.Client]utility.Conn)
+	db.pool = utility.NewPool(db.MaxActive, db.newConn, nil, utility.PoolWaitTimeout(db.Timeout), utility.PoolIdleTimeout(db.IdleTimeout))
 	if this.databases == nil {
 		this.databases = make(map[string]*HbaseDatabaseHandler)
 	}
@@ -122,7 +150,6 @@ func (this *HbaseHandler) NewHandler(name string, config map[string]interface{})
 	return db, nil
 }
 
-// 从连接池里取出连接
 func (this *HbaseHandler) GetHandler(name string) (NosqlDatabaseHandler, error) {
 	handlerDatabase, ok := this.databases[name]
 	if !ok {
@@ -131,214 +158,323 @@ func (this *HbaseHandler) GetHandler(name string) (NosqlDatabaseHandler, error)
 	return handlerDatabase, nil
 }
 
-func (this *HbaseDatabaseScanner) Next() (*hrpc.Result, error) {
+// Close closes the clients of every handler.
+func (this *HbaseHandler) Close() error {
+	for name, db := range this.databases {
+		db.Close()
+		delete(this.databases, name)
+	}
+	return nil
+}
+
+// Next returns the next row, io.EOF after the last row or the limit of the scan.
+func (this *HbaseDatabaseScanner) Next() (*NosqlRow, error) {
+	if this.limit > 0 && this.count >= this.limit {
+		return nil, io.EOF
+	}
 	result, err := this.Scanner.Next()
+	if err == io.EOF {
+		return nil, err
+	}
 	if err != nil {
+		if isBrokenHbaseClient(err) {
+			this.err = err
+		}
 		return nil, errors.New(errHbaseScanNext + ": " + err.Error())
 	}
-	return result, nil
+	this.count++
+	return newNosqlRow(result), nil
 }
+
+// Close closes the scanner and returns its client to the pool, replaced if it is broken.
 func (this *HbaseDatabaseScanner) Close() error {
 	err := this.Scanner.Close()
+	if this.conn != nil {
+		this.conn.Do(func(interface{}) error {
+			return this.err
+		})
+		this.conn.Recycle()
+		this.conn = nil
+	}
 	if err != nil {
 		return errors.New(errHbaseScanClose + ": " + err.Error())
 	}
 	return nil
 }
 
-func (this *HbaseDatabaseHandler) GetHandler() (client interface{}, err error) {
-	if len(this.Client) == 0 {
-		newClient := gohbase.NewClient(this.Host)
-		if newClient == nil {
-			return nil, errors.New(errHbaseGetHandler + ": new client error")
+func (this *HbaseDatabaseHandler) newConn() (utility.Conn, error) {
+	// the client connects to the region servers on demand
+	client := gohbase.NewClient(this.Host)
+	if client == nil {
+		return nil, errors.New(errHbaseGetHandler + ": new client error")
+	}
+	return utility.NewConn(client, func() error {
+		client.Close()
+		return nil
+	}), nil
+}
+
+// acquire borrows a client from the pool, waiting up to Timeout when all are in use.
+func (this *HbaseDatabaseHandler) acquire() (gohbase.Client, utility.Conn, error) {
+	conn, err := this.pool.Get()
+	if err != nil {
+		return nil, nil, errors.New(errHbaseGetHandler + ": " + err.Error())
+	}
+	var client gohbase.Client
+	conn.Do(func(idle interface{}) error {
+		client = idle.(gohbase.Client)
+		return nil
+	})
+	return client, conn, nil
+}
+
+// do runs fn with a client of the pool, the client is replaced if fn fails because it is broken.
+func (this *HbaseDatabaseHandler) do(fn func(client gohbase.Client) error) error {
+	client, conn, err := this.acquire()
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	conn.Do(func(interface{}) error {
+		fnErr = fn(client)
+		if isBrokenHbaseClient(fnErr) {
+			return fnErr
 		}
-		this.Client <- newClient
+		return nil
+	})
+	conn.Recycle()
+	return fnErr
+}
+
+// isBrokenHbaseClient tests if err is returned by a client which can't be used anymore.
+func isBrokenHbaseClient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == gohbase.ErrClientClosed {
+		return true
 	}
-	client = <-this.Client
-	return client, nil
+	switch err.(type) {
+	case region.UnrecoverableError, *region.UnrecoverableError:
+		return true
+	}
+	return false
+}
+
+// GetHandler borrows a client of the pool, to be returned by ReleaseHandler.
+func (this *HbaseDatabaseHandler) GetHandler() (client interface{}, err error) {
+	hbaseClient, conn, err := this.acquire()
+	if err != nil {
+		return nil, err
+	}
+	this.mutex.Lock()
+	this.borrowed[hbaseClient] = conn
+	this.mutex.Unlock()
+	return hbaseClient, nil
 }
 
 // 回收连接到连接池
 func (this *HbaseDatabaseHandler) ReleaseHandler(client interface{}) {
 	hbaseClient, ok := client.(gohbase.Client)
+	if !ok {
+		return
+	}
+	this.mutex.Lock()
+	conn, ok := this.borrowed[hbaseClient]
+	delete(this.borrowed, hbaseClient)
+	this.mutex.Unlock()
 	if ok {
-		if len(this.Client) == this.MaxActive {
-			hbaseClient.Close()
-			return
-		}
-		this.Client <- hbaseClient
+		conn.Recycle()
 	}
 }
 
+// GetHandlerPoolSize returns the number of idle clients.
 func (this *HbaseDatabaseHandler) GetHandlerPoolSize() int {
-	return len(this.Client)
+	return this.pool.Stats().Idle
 }
 
-func (this *HbaseDatabaseHandler) Scan(ctx context.Context, table string) (NosqlDatabaseScanner, error) {
-	client, err := this.GetHandler()
+// PoolStats returns the stats of the clients of the pool.
+func (this *HbaseDatabaseHandler) PoolStats() utility.PoolStats {
+	return this.pool.Stats()
+}
+
+// Scan returns a scanner holding a client of the pool until it is closed.
+func (this *HbaseDatabaseHandler) Scan(ctx context.Context, table string, setters ...NosqlQueryOption) (NosqlDatabaseScanner, error) {
+	options := newNosqlQueryOptions(setters...)
+	scanRequest, err := hrpc.NewScanRangeStr(ctx, table, options.StartRow, options.StopRow, options.hrpcOptions(true)...)
 	if err != nil {
 		return nil, errors.New(errHbaseScan + ": " + err.Error())
 	}
-	hbaseClient, ok := client.(gohbase.Client)
-	if !ok {
-		return nil, errors.New(errHbaseScan + ": invalid client type")
-	}
-	// 使用完把连接回收到连接池里
-	defer this.ReleaseHandler(hbaseClient)
-	scanRequest, err := hrpc.NewScanStr(ctx, table)
+	hbaseClient, conn, err := this.acquire()
 	if err != nil {
 		return nil, errors.New(errHbaseScan + ": " + err.Error())
 	}
-	scanner := &HbaseDatabaseScanner{hbaseClient.Scan(scanRequest)}
+	scanner := &HbaseDatabaseScanner{
+		Scanner: hbaseClient.Scan(scanRequest),
+		conn:    conn,
+		limit:   options.Limit,
+	}
 	return scanner, nil
 }
-func (this *HbaseDatabaseHandler) Get(ctx context.Context, table string, key string) ([]map[string]string, error) {
-	client, err := this.GetHandler()
+func (this *HbaseDatabaseHandler) Get(ctx context.Context, table string, key string, setters ...NosqlQueryOption) (row *NosqlRow, err error) {
+	err = this.do(func(hbaseClient gohbase.Client) error {
+		row, err = this.get(ctx, hbaseClient, table, key, newNosqlQueryOptions(setters...))
+		return err
+	})
 	if err != nil {
-		return nil, errors.New(errHbaseScan + ": " + err.Error())
-	}
-	hbaseClient, ok := client.(gohbase.Client)
-	if !ok {
-		return nil, errors.New(errHbaseScan + ": invalid client type")
+		if NosqlRecordNotFound(err) {
+			return nil, err
+		}
+		return nil, errors.New(errHbaseGet + ": " + err.Error())
 	}
-	// 使用完把连接回收到连接池里
-	defer this.ReleaseHandler(hbaseClient)
-	getRequest, err := hrpc.NewGetStr(ctx, table, key)
+	return row, nil
+}
+func (this *HbaseDatabaseHandler) get(ctx context.Context, hbaseClient gohbase.Client, table string, key string, options *NosqlQueryOptions) (*NosqlRow, error) {
+	getRequest, err := hrpc.NewGetStr(ctx, table, key, options.hrpcOptions(false)...)
 	if err != nil {
-		return nil, errors.New(errHbaseGet + ": " + err.Error())
+		return nil, err
 	}
 	result, err := hbaseClient.Get(getRequest)
-	if err != nil || *result.Exists {
-		return nil, errors.New(errHbaseRecordNotFound + ": " + err.Error())
-	}
-	cells := make([]map[string]string, len(result.Cells))
-	for index, column := range result.Cells {
-		cell := make(map[string]string, 0)
-		cell["row"] = string(column.Row)
-		cell["family"] = string(column.Family)
-		cell["qualifier"] = string(column.Qualifier)
-		cell["value"] = string(column.Value)
-		cells[index] = cell
-	}
-	return cells, nil
+	if err != nil {
+		return nil, err
+	}
+	row := newNosqlRow(result)
+	if row == nil {
+		return nil, errors.New(errHbaseRecordNotFound + ": " + key)
+	}
+	return row, nil
 }
-func (this *HbaseDatabaseHandler) Put(ctx context.Context, table string, key string, values map[string]map[string][]byte) (err error) {
-	client, err := this.GetHandler()
+
+// BatchGet gets the rows of keys concurrently, the rows not found are nil at the index of their key.
+func (this *HbaseDatabaseHandler) BatchGet(ctx context.Context, table string, keys []string, setters ...NosqlQueryOption) ([]*NosqlRow, error) {
+	options := newNosqlQueryOptions(setters...)
+	rows := make([]*NosqlRow, len(keys))
+	err := this.do(func(hbaseClient gohbase.Client) error {
+		return batch(len(keys), func(index int) error {
+			row, err := this.get(ctx, hbaseClient, table, keys[index], options)
+			if err != nil && !NosqlRecordNotFound(err) {
+				return err
+			}
+			rows[index] = row
+			return nil
+		})
+	})
 	if err != nil {
-		return errors.New(errHbaseScan + ": " + err.Error())
+		return nil, errors.New(errHbaseBatchGet + ": " + err.Error())
 	}
-	hbaseClient, ok := client.(gohbase.Client)
-	if !ok {
-		return errors.New(errHbaseScan + ": invalid client type")
+	return rows, nil
+}
+
+// BatchPut puts the values of the rows by key concurrently, the puts succeeded aren't undone if one fails.
+func (this *HbaseDatabaseHandler) BatchPut(ctx context.Context, table string, rows map[string]map[string]map[string][]byte) error {
+	keys := sortedRowKeys(rows)
+	err := this.do(func(hbaseClient gohbase.Client) error {
+		return batch(len(keys), func(index int) error {
+			putRequest, err := hrpc.NewPutStr(ctx, table, keys[index], rows[keys[index]])
+			if err != nil {
+				return err
+			}
+			_, err = hbaseClient.Put(putRequest)
+			return err
+		})
+	})
+	if err != nil {
+		return errors.New(errHbaseBatchPut + ": " + err.Error())
+	}
+	return nil
+}
+
+// BatchDelete deletes the values of the rows by key concurrently, the whole row if its values are empty.
+func (this *HbaseDatabaseHandler) BatchDelete(ctx context.Context, table string, rows map[string]map[string]map[string][]byte) error {
+	keys := sortedRowKeys(rows)
+	err := this.do(func(hbaseClient gohbase.Client) error {
+		return batch(len(keys), func(index int) error {
+			deleteRequest, err := hrpc.NewDelStr(ctx, table, keys[index], rows[keys[index]])
+			if err != nil {
+				return err
+			}
+			_, err = hbaseClient.Delete(deleteRequest)
+			return err
+		})
+	})
+	if err != nil {
+		return errors.New(errHbaseBatchDelete + ": " + err.Error())
 	}
-	// 使用完把连接回收到连接池里
-	defer this.ReleaseHandler(hbaseClient)
+	return nil
+}
+func (this *HbaseDatabaseHandler) Put(ctx context.Context, table string, key string, values map[string]map[string][]byte) (err error) {
 	// Values maps a ColumnFamily -> Qualifiers -> Values.
 	putRequest, err := hrpc.NewPutStr(ctx, table, key, values)
 	if err != nil {
 		return errors.New(errHbasePut + ": " + err.Error())
 	}
-	_, err = hbaseClient.Put(putRequest)
+	err = this.do(func(hbaseClient gohbase.Client) error {
+		_, err := hbaseClient.Put(putRequest)
+		return err
+	})
 	if err != nil {
 		return errors.New(errHbasePut + ": " + err.Error())
 	}
 	return nil
 }
 func (this *HbaseDatabaseHandler) Delete(ctx context.Context, table string, key string, values map[string]map[string][]byte) (err error) {
-	client, err := this.GetHandler()
-	if err != nil {
-		return errors.New(errHbaseScan + ": " + err.Error())
-	}
-	hbaseClient, ok := client.(gohbase.Client)
-	if !ok {
-		return errors.New(errHbaseScan + ": invalid client type")
-	}
-	// 使用完把连接回收到连接池里
-	defer this.ReleaseHandler(client)
 	deleteRequest, err := hrpc.NewDelStr(ctx, table, key, values)
 	if err != nil {
 		return errors.New(errHbaseDelete + ": " + err.Error())
 	}
-	_, err = hbaseClient.Delete(deleteRequest)
+	err = this.do(func(hbaseClient gohbase.Client) error {
+		_, err := hbaseClient.Delete(deleteRequest)
+		return err
+	})
 	if err != nil {
 		return errors.New(errHbaseDelete + ": " + err.Error())
 	}
 	return nil
 }
 func (this *HbaseDatabaseHandler) Append(ctx context.Context, table string, key string, values map[string]map[string][]byte) error {
-	client, err := this.GetHandler()
-	if err != nil {
-		return errors.New(errHbaseScan + ": " + err.Error())
-	}
-	hbaseClient, ok := client.(gohbase.Client)
-	if !ok {
-		return errors.New(errHbaseScan + ": invalid client type")
-	}
-	// 使用完把连接回收到连接池里
-	defer this.ReleaseHandler(client)
 	appendRequest, err := hrpc.NewAppStr(ctx, table, key, values)
 	if err != nil {
 		return errors.New(errHbaseAppend + ": " + err.Error())
 	}
-	_, err = hbaseClient.Append(appendRequest)
+	err = this.do(func(hbaseClient gohbase.Client) error {
+		_, err := hbaseClient.Append(appendRequest)
+		return err
+	})
 	if err != nil {
 		return errors.New(errHbaseAppend + ": " + err.Error())
 	}
 	return nil
 }
-func (this *HbaseDatabaseHandler) Increment(ctx context.Context, table string, key string, values map[string]map[string][]byte) (int64, error) {
-	client, err := this.GetHandler()
-	if err != nil {
-		return 0, errors.New(errHbaseScan + ": " + err.Error())
-	}
-	hbaseClient, ok := client.(gohbase.Client)
-	if !ok {
-		return 0, errors.New(errHbaseScan + ": invalid client type")
-	}
-	// 使用完把连接回收到连接池里
-	defer this.ReleaseHandler(client)
+func (this *HbaseDatabaseHandler) Increment(ctx context.Context, table string, key string, values map[string]map[string][]byte) (i int64, err error) {
 	incrementRequest, err := hrpc.NewIncStr(ctx, table, key, values)
 	if err != nil {
 		return 0, errors.New(errHbaseIncrement + ": " + err.Error())
 	}
-	i, err := hbaseClient.Increment(incrementRequest)
+	err = this.do(func(hbaseClient gohbase.Client) error {
+		i, err = hbaseClient.Increment(incrementRequest)
+		return err
+	})
 	if err != nil {
 		return 0, errors.New(errHbaseIncrement + ": " + err.Error())
 	}
 	return i, nil
 }
-func (this *HbaseDatabaseHandler) CheckAndPut(ctx context.Context, table string, key string, values map[string]map[string][]byte, family string, qualifier string, expectedValue []byte) (bool, error) {
-	client, err := this.GetHandler()
-	if err != nil {
-		return false, errors.New(errHbaseScan + ": " + err.Error())
-	}
-	hbaseClient, ok := client.(gohbase.Client)
-	if !ok {
-		return false, errors.New(errHbaseScan + ": invalid client type")
-	}
-	// 使用完把连接回收到连接池里
-	defer this.ReleaseHandler(client)
+func (this *HbaseDatabaseHandler) CheckAndPut(ctx context.Context, table string, key string, values map[string]map[string][]byte, family string, qualifier string, expectedValue []byte) (b bool, err error) {
 	putRequest, err := hrpc.NewPutStr(ctx, table, key, values)
 	if err != nil {
 		return false, errors.New(errHbaseCheckAndPut + ": " + err.Error())
 	}
-	b, err := hbaseClient.CheckAndPut(putRequest, family, qualifier, expectedValue)
+	err = this.do(func(hbaseClient gohbase.Client) error {
+		b, err = hbaseClient.CheckAndPut(putRequest, family, qualifier, expectedValue)
+		return err
+	})
 	if err != nil {
 		return false, errors.New(errHbaseCheckAndPut + ": " + err.Error())
 	}
 	return b, nil
 }
+
+// Close closes the idle clients, and the clients in use when they are returned to the pool.
 func (this *HbaseDatabaseHandler) Close() {
-	client, _ := this.GetHandler()
-	for client != nil {
-		hbaseClient, ok := client.(gohbase.Client)
-		if !ok {
-			return
-		}
-		hbaseClient.Close()
-		// 使用完把连接回收到连接池里
-		this.ReleaseHandler(client)
-		client, _ = this.GetHandler()
-	}
-	return
+	this.pool.Close()
 }
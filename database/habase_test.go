@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuna/gohbase"
+)
+
+// the clients connect to hbase on demand, the pool is tested without server
+func newTestHbaseHandler(t *testing.T, config map[string]interface{}) (NosqlHandler, *HbaseDatabaseHandler) {
+	handler := NewHbaseHandler()
+	assert.Nil(t, handler.Initiate(context.Background()))
+	config["DATABASE_HBASE_HOST"] = "localhost"
+	db, err := handler.NewHandler("test", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler, db.(*HbaseDatabaseHandler)
+}
+
+func newTestHbaseHandlerConfig(config map[string]interface{}) (NosqlDatabaseHandler, error) {
+	config["DATABASE_HBASE_HOST"] = "localhost"
+	return NewHbaseHandler().NewHandler("test", config)
+}
+
+func TestHbaseHandlerPool(t *testing.T) {
+	handler, db := newTestHbaseHandler(t, map[string]interface{}{
+		"DATABASE_HBASE_MAX_ACTIVE": 1,
+		"DATABASE_HBASE_TIMEOUT":    "50ms",
+	})
+	defer handler.Close()
+	assert.Equal(t, 0, db.GetHandlerPoolSize())
+
+	client, err := db.GetHandler()
+	assert.Nil(t, err)
+	start := time.Now()
+	_, err = db.GetHandler()
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	stats := db.PoolStats()
+	assert.Equal(t, 1, stats.InUse)
+	assert.Equal(t, int64(1), stats.WaitCount)
+	assert.Equal(t, int64(1), stats.Timeouts)
+
+	// a waiting GetHandler gets the client released
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		db.ReleaseHandler(client)
+	}()
+	waited, err := db.GetHandler()
+	assert.Nil(t, err)
+	assert.Equal(t, client, waited)
+	db.ReleaseHandler(waited)
+	assert.Equal(t, 1, db.GetHandlerPoolSize())
+	assert.Equal(t, 0, db.PoolStats().InUse)
+}
+
+func TestHbaseHandlerBrokenClient(t *testing.T) {
+	handler, db := newTestHbaseHandler(t, map[string]interface{}{
+		"DATABASE_HBASE_MAX_ACTIVE": 1,
+	})
+	defer handler.Close()
+	var first, second gohbase.Client
+	assert.NotNil(t, db.do(func(client gohbase.Client) error {
+		first = client
+		return errors.New("table not found")
+	}))
+	assert.NotNil(t, db.do(func(client gohbase.Client) error {
+		second = client
+		return gohbase.ErrClientClosed
+	}))
+	// the client isn't replaced for an error of the request
+	assert.Equal(t, first, second)
+	assert.Nil(t, db.do(func(client gohbase.Client) error {
+		second = client
+		return nil
+	}))
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, 1, db.PoolStats().Open)
+}
+
+func TestHbaseHandlerIdleTimeout(t *testing.T) {
+	handler, db := newTestHbaseHandler(t, map[string]interface{}{
+		"DATABASE_HBASE_IDLE_TIMEOUT": "10ms",
+	})
+	defer handler.Close()
+	client, err := db.GetHandler()
+	assert.Nil(t, err)
+	db.ReleaseHandler(client)
+	time.Sleep(20 * time.Millisecond)
+	evicted, err := db.GetHandler()
+	assert.Nil(t, err)
+	assert.NotEqual(t, client, evicted)
+	db.ReleaseHandler(evicted)
+	assert.Equal(t, 1, db.PoolStats().Open)
+
+	_, err = newTestHbaseHandlerConfig(map[string]interface{}{"DATABASE_HBASE_IDLE_TIMEOUT": "idle"})
+	assert.NotNil(t, err)
+}
+
+func TestHbaseHandlerClose(t *testing.T) {
+	handler, db := newTestHbaseHandler(t, map[string]interface{}{})
+	idle, err := db.GetHandler()
+	assert.Nil(t, err)
+	inUse, err := db.GetHandler()
+	assert.Nil(t, err)
+	db.ReleaseHandler(idle)
+	assert.Equal(t, 2, db.PoolStats().Open)
+
+	assert.Nil(t, handler.Close())
+	_, err = handler.GetHandler("test")
+	assert.True(t, HandlerNotExists(err))
+	assert.Equal(t, 1, db.PoolStats().Open)
+	_, err = db.GetHandler()
+	assert.NotNil(t, err)
+	// the client in use is closed when it is released
+	db.ReleaseHandler(inUse)
+	assert.Equal(t, 0, db.PoolStats().Open)
+}
+
+func TestInstrumentNosql(t *testing.T) {
+	handler, db := newTestHbaseHandler(t, map[string]interface{}{})
+	defer handler.Close()
+	client, err := db.GetHandler()
+	assert.Nil(t, err)
+	defer db.ReleaseHandler(client)
+	InstrumentNosql("nosql_metrics_test", NewTracedNosqlDatabaseHandler(db, nil))
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.Nil(t, err)
+	inUse := -1.0
+	for _, family := range families {
+		if family.GetName() != "database_nosql_clients_in_use" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == "nosql_metrics_test" {
+				inUse = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, 1.0, inUse)
+}
@@ -0,0 +1,504 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ltick/tick-framework/config"
+)
+
+var (
+	errMemoryNewDatabase       = "database(memory): new database error"
+	errMemoryDatabaseNotExists = "database(memory): '%s' handler not exists"
+	errMemoryClosed            = "database(memory): handler closed"
+	errMemoryScan              = "database(memory): scan error"
+	errMemoryGet               = "database(memory): get error"
+	errMemoryRecordNotFound    = "database(memory): record not found"
+	errMemoryPut               = "database(memory): put error"
+	errMemoryDelete            = "database(memory): delete error"
+	errMemoryAppend            = "database(memory): append error"
+	errMemoryIncrement         = "database(memory): increment error"
+	errMemoryCheckAndPut       = "database(memory): check and put error"
+)
+
+const DEFAULT_MEMORY_MAX_VERSIONS = 1
+
+// NewMemoryDatabase returns a started Database whose handlers are in-memory sqlite databases and whose nosql
+// handlers are in memory, isolated from those of the other databases, for the tests needing no server.
+// The values of configs override the config of the handlers. The sqlite3 driver must be registered
+// by importing the database/sqlite package.
+func NewMemoryDatabase(ctx context.Context, configs ...map[string]interface{}) (*Database, error) {
+	c := config.NewConfig()
+	ctx, err := c.Initiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d := &Database{Config: c}
+	if ctx, err = d.Prepare(ctx); err != nil {
+		return nil, err
+	}
+	c.Set("DATABASE_PROVIDER", "sqlite3")
+	c.Set("DATABASE_SQLITE_PATH", ":memory:")
+	c.Set("DATABASE_NOSQL_PROVIDER", "memory")
+	for _, values := range configs {
+		for key, value := range values {
+			c.Set(key, value)
+		}
+	}
+	if ctx, err = d.Initiate(ctx); err != nil {
+		return nil, err
+	}
+	if _, err = d.OnStartup(ctx); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// MemoryHandler is a nosql provider keeping the tables in memory, with the semantics of hbase,
+// for the tests needing no hbase server.
+type MemoryHandler struct {
+	databases map[string]*MemoryDatabaseHandler
+}
+
+// MemoryDatabaseHandler stores the versions of the values of the columns of the rows of its tables,
+// latest first, up to MaxVersions by column. The filters of the queries aren't supported.
+type MemoryDatabaseHandler struct {
+	MaxVersions int
+
+	mutex  sync.RWMutex
+	tables map[string]map[string]memoryRow
+	clock  uint64
+	closed bool
+}
+
+// memoryRow maps a family -> qualifier -> versions of the value.
+type memoryRow map[string]map[string][]*NosqlCell
+
+type MemoryDatabaseScanner struct {
+	rows []*NosqlRow
+}
+
+func NewMemoryHandler() NosqlHandler {
+	return &MemoryHandler{}
+}
+
+func (this *MemoryHandler) Initiate(ctx context.Context) error {
+	this.databases = make(map[string]*MemoryDatabaseHandler)
+	return nil
+}
+
+func (this *MemoryHandler) NewHandler(name string, config map[string]interface{}) (NosqlDatabaseHandler, error) {
+	db := &MemoryDatabaseHandler{
+		MaxVersions: DEFAULT_MEMORY_MAX_VERSIONS,
+		tables:      make(map[string]map[string]memoryRow),
+	}
+	configMaxVersions, ok := config["DATABASE_MEMORY_MAX_VERSIONS"]
+	if ok && configMaxVersions != nil {
+		maxVersions, ok := configMaxVersions.(int)
+		if ok {
+			if maxVersions != 0 {
+				db.MaxVersions = maxVersions
+			}
+		} else {
+			return nil, errors.New(errMemoryNewDatabase + ": invalid config DATABASE_MEMORY_MAX_VERSIONS")
+		}
+	}
+	if this.databases == nil {
+		this.databases = make(map[string]*MemoryDatabaseHandler)
+	}
+	this.databases[name] = db
+	return db, nil
+}
+
+func (this *MemoryHandler) GetHandler(name string) (NosqlDatabaseHandler, error) {
+	handlerDatabase, ok := this.databases[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf(errMemoryDatabaseNotExists, name))
+	}
+	return handlerDatabase, nil
+}
+
+// Close drops the tables of every handler.
+func (this *MemoryHandler) Close() error {
+	for name, db := range this.databases {
+		db.Close()
+		delete(this.databases, name)
+	}
+	return nil
+}
+
+// Next returns the next row, io.EOF after the last row.
+func (this *MemoryDatabaseScanner) Next() (*NosqlRow, error) {
+	if len(this.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := this.rows[0]
+	this.rows = this.rows[1:]
+	return row, nil
+}
+func (this *MemoryDatabaseScanner) Close() error {
+	this.rows = nil
+	return nil
+}
+
+// GetHandler returns the handler itself, it has no client.
+func (this *MemoryDatabaseHandler) GetHandler() (client interface{}, err error) {
+	return this, nil
+}
+func (this *MemoryDatabaseHandler) ReleaseHandler(client interface{}) {
+}
+func (this *MemoryDatabaseHandler) GetHandlerPoolSize() int {
+	return 1
+}
+
+// Scan reads the rows of the range at once, the rows written during the scan aren't read.
+func (this *MemoryDatabaseHandler) Scan(ctx context.Context, table string, setters ...NosqlQueryOption) (NosqlDatabaseScanner, error) {
+	options := newNosqlQueryOptions(setters...)
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	if err := this.check(ctx, options); err != nil {
+		return nil, errors.New(errMemoryScan + ": " + err.Error())
+	}
+	keys := make([]string, 0, len(this.tables[table]))
+	for key := range this.tables[table] {
+		// a reversed scan starts from StartRow included down to StopRow excluded
+		if options.Reversed {
+			if (options.StartRow == "" || key <= options.StartRow) && (options.StopRow == "" || key > options.StopRow) {
+				keys = append(keys, key)
+			}
+		} else if key >= options.StartRow && (options.StopRow == "" || key < options.StopRow) {
+			keys = append(keys, key)
+		}
+	}
+	if options.Reversed {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	} else {
+		sort.Strings(keys)
+	}
+	scanner := &MemoryDatabaseScanner{rows: make([]*NosqlRow, 0)}
+	for _, key := range keys {
+		if options.Limit > 0 && len(scanner.rows) >= options.Limit {
+			break
+		}
+		if row := this.read(key, this.tables[table][key], options); row != nil {
+			scanner.rows = append(scanner.rows, row)
+		}
+	}
+	return scanner, nil
+}
+func (this *MemoryDatabaseHandler) Get(ctx context.Context, table string, key string, setters ...NosqlQueryOption) (*NosqlRow, error) {
+	options := newNosqlQueryOptions(setters...)
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	if err := this.check(ctx, options); err != nil {
+		return nil, errors.New(errMemoryGet + ": " + err.Error())
+	}
+	row := this.read(key, this.tables[table][key], options)
+	if row == nil {
+		return nil, errors.New(errMemoryRecordNotFound + ": " + key)
+	}
+	return row, nil
+}
+
+// BatchGet gets the rows of keys, the rows not found are nil at the index of their key.
+func (this *MemoryDatabaseHandler) BatchGet(ctx context.Context, table string, keys []string, setters ...NosqlQueryOption) ([]*NosqlRow, error) {
+	options := newNosqlQueryOptions(setters...)
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	if err := this.check(ctx, options); err != nil {
+		return nil, errors.New(errMemoryGet + ": " + err.Error())
+	}
+	rows := make([]*NosqlRow, len(keys))
+	for index, key := range keys {
+		rows[index] = this.read(key, this.tables[table][key], options)
+	}
+	return rows, nil
+}
+func (this *MemoryDatabaseHandler) Put(ctx context.Context, table string, key string, values map[string]map[string][]byte) (err error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if err := this.check(ctx, nil); err != nil {
+		return errors.New(errMemoryPut + ": " + err.Error())
+	}
+	if err := this.put(table, key, values); err != nil {
+		return errors.New(errMemoryPut + ": " + err.Error())
+	}
+	return nil
+}
+
+// Delete deletes all the versions of the columns of values, the whole family if its qualifiers are empty,
+// and the whole row if values are empty.
+func (this *MemoryDatabaseHandler) Delete(ctx context.Context, table string, key string, values map[string]map[string][]byte) (err error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if err := this.check(ctx, nil); err != nil {
+		return errors.New(errMemoryDelete + ": " + err.Error())
+	}
+	this.delete(table, key, values)
+	return nil
+}
+func (this *MemoryDatabaseHandler) BatchPut(ctx context.Context, table string, rows map[string]map[string]map[string][]byte) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if err := this.check(ctx, nil); err != nil {
+		return errors.New(errMemoryPut + ": " + err.Error())
+	}
+	for _, key := range sortedRowKeys(rows) {
+		if err := this.put(table, key, rows[key]); err != nil {
+			return errors.New(errMemoryPut + ": " + err.Error())
+		}
+	}
+	return nil
+}
+func (this *MemoryDatabaseHandler) BatchDelete(ctx context.Context, table string, rows map[string]map[string]map[string][]byte) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if err := this.check(ctx, nil); err != nil {
+		return errors.New(errMemoryDelete + ": " + err.Error())
+	}
+	for key, values := range rows {
+		this.delete(table, key, values)
+	}
+	return nil
+}
+
+// Append appends the values to the latest versions of their columns.
+func (this *MemoryDatabaseHandler) Append(ctx context.Context, table string, key string, values map[string]map[string][]byte) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if err := this.check(ctx, nil); err != nil {
+		return errors.New(errMemoryAppend + ": " + err.Error())
+	}
+	appended := make(map[string]map[string][]byte, len(values))
+	for family, qualifiers := range values {
+		appended[family] = make(map[string][]byte, len(qualifiers))
+		for qualifier, value := range qualifiers {
+			latest, _ := this.latest(table, key, family, qualifier)
+			appended[family][qualifier] = append(append([]byte{}, latest...), value...)
+		}
+	}
+	if err := this.put(table, key, appended); err != nil {
+		return errors.New(errMemoryAppend + ": " + err.Error())
+	}
+	return nil
+}
+
+// Increment adds the amount of a single column, a 8 bytes big endian int64 as for hbase, and returns its new value.
+func (this *MemoryDatabaseHandler) Increment(ctx context.Context, table string, key string, values map[string]map[string][]byte) (int64, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if err := this.check(ctx, nil); err != nil {
+		return 0, errors.New(errMemoryIncrement + ": " + err.Error())
+	}
+	var family, qualifier string
+	var amount []byte
+	columns := 0
+	for f, qualifiers := range values {
+		for q, value := range qualifiers {
+			family, qualifier, amount = f, q, value
+			columns++
+		}
+	}
+	if columns != 1 {
+		return 0, errors.New(errMemoryIncrement + fmt.Sprintf(": %d columns, but expected exactly one", columns))
+	}
+	if len(amount) != 8 {
+		return 0, errors.New(errMemoryIncrement + ": the amount isn't a 8 bytes int64")
+	}
+	var current int64
+	if latest, ok := this.latest(table, key, family, qualifier); ok {
+		if len(latest) != 8 {
+			return 0, errors.New(errMemoryIncrement + ": the value isn't a 8 bytes int64")
+		}
+		current = int64(binary.BigEndian.Uint64(latest))
+	}
+	current += int64(binary.BigEndian.Uint64(amount))
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(current))
+	if err := this.put(table, key, map[string]map[string][]byte{family: {qualifier: value}}); err != nil {
+		return 0, errors.New(errMemoryIncrement + ": " + err.Error())
+	}
+	return current, nil
+}
+
+// CheckAndPut puts the values if the latest version of family:qualifier is expectedValue,
+// or if the column doesn't exist when expectedValue is empty.
+func (this *MemoryDatabaseHandler) CheckAndPut(ctx context.Context, table string, key string, values map[string]map[string][]byte, family string, qualifier string, expectedValue []byte) (bool, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if err := this.check(ctx, nil); err != nil {
+		return false, errors.New(errMemoryCheckAndPut + ": " + err.Error())
+	}
+	latest, ok := this.latest(table, key, family, qualifier)
+	if len(expectedValue) == 0 && ok || len(expectedValue) != 0 && (!ok || !bytes.Equal(latest, expectedValue)) {
+		return false, nil
+	}
+	if err := this.put(table, key, values); err != nil {
+		return false, errors.New(errMemoryCheckAndPut + ": " + err.Error())
+	}
+	return true, nil
+}
+
+// Close drops the tables, the handler can't be used anymore.
+func (this *MemoryDatabaseHandler) Close() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.tables = nil
+	this.closed = true
+}
+
+// check tests if the operation can run: the handler is open, ctx isn't done, and the options have no filter.
+func (this *MemoryDatabaseHandler) check(ctx context.Context, options *NosqlQueryOptions) error {
+	if this.closed {
+		return errors.New(errMemoryClosed)
+	}
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if options != nil && options.Filter != nil {
+		return errors.New("filters not supported")
+	}
+	return nil
+}
+
+// timestamp returns the current time in milliseconds, increasing on each write so that the versions are ordered.
+func (this *MemoryDatabaseHandler) timestamp() uint64 {
+	now := uint64(time.Now().UnixNano() / 1e6)
+	if now <= this.clock {
+		now = this.clock + 1
+	}
+	this.clock = now
+	return now
+}
+
+func (this *MemoryDatabaseHandler) put(table string, key string, values map[string]map[string][]byte) error {
+	if len(values) == 0 {
+		return errors.New("no columns to put")
+	}
+	if this.tables[table] == nil {
+		this.tables[table] = make(map[string]memoryRow)
+	}
+	row := this.tables[table][key]
+	if row == nil {
+		row = make(memoryRow)
+		this.tables[table][key] = row
+	}
+	timestamp := this.timestamp()
+	for family, qualifiers := range values {
+		if row[family] == nil {
+			row[family] = make(map[string][]*NosqlCell)
+		}
+		for qualifier, value := range qualifiers {
+			cell := &NosqlCell{
+				Row:       key,
+				Family:    family,
+				Qualifier: qualifier,
+				Value:     append([]byte{}, value...),
+				Timestamp: timestamp,
+			}
+			versions := append([]*NosqlCell{cell}, row[family][qualifier]...)
+			if len(versions) > this.MaxVersions {
+				versions = versions[:this.MaxVersions]
+			}
+			row[family][qualifier] = versions
+		}
+	}
+	return nil
+}
+
+func (this *MemoryDatabaseHandler) delete(table string, key string, values map[string]map[string][]byte) {
+	row := this.tables[table][key]
+	if row == nil {
+		return
+	}
+	if len(values) == 0 {
+		delete(this.tables[table], key)
+		return
+	}
+	for family, qualifiers := range values {
+		if len(qualifiers) == 0 {
+			delete(row, family)
+			continue
+		}
+		for qualifier := range qualifiers {
+			delete(row[family], qualifier)
+		}
+		if len(row[family]) == 0 {
+			delete(row, family)
+		}
+	}
+	if len(row) == 0 {
+		delete(this.tables[table], key)
+	}
+}
+
+// latest returns the latest version of the value of family:qualifier.
+func (this *MemoryDatabaseHandler) latest(table string, key string, family string, qualifier string) ([]byte, bool) {
+	versions := this.tables[table][key][family][qualifier]
+	if len(versions) == 0 {
+		return nil, false
+	}
+	return versions[0].Value, true
+}
+
+// read returns the cells of row selected by options, sorted by family and qualifier as hbase does, nil if none.
+func (this *MemoryDatabaseHandler) read(key string, row memoryRow, options *NosqlQueryOptions) *NosqlRow {
+	maxVersions := int(options.MaxVersions)
+	if maxVersions == 0 {
+		maxVersions = 1
+	}
+	families := make([]string, 0, len(row))
+	for family := range row {
+		if _, ok := options.Families[family]; ok || len(options.Families) == 0 {
+			families = append(families, family)
+		}
+	}
+	sort.Strings(families)
+	cells := make([]*NosqlCell, 0)
+	for _, family := range families {
+		qualifiers := make([]string, 0, len(row[family]))
+		if len(options.Families[family]) > 0 {
+			for _, qualifier := range options.Families[family] {
+				if _, ok := row[family][qualifier]; ok {
+					qualifiers = append(qualifiers, qualifier)
+				}
+			}
+		} else {
+			for qualifier := range row[family] {
+				qualifiers = append(qualifiers, qualifier)
+			}
+		}
+		sort.Strings(qualifiers)
+		for _, qualifier := range qualifiers {
+			versions := 0
+			for _, cell := range row[family][qualifier] {
+				if versions >= maxVersions {
+					break
+				}
+				if !options.TimeRangeFrom.IsZero() && cell.Timestamp < uint64(options.TimeRangeFrom.UnixNano()/1e6) {
+					continue
+				}
+				if !options.TimeRangeTo.IsZero() && cell.Timestamp >= uint64(options.TimeRangeTo.UnixNano()/1e6) {
+					continue
+				}
+				copied := *cell
+				copied.Value = append([]byte{}, cell.Value...)
+				cells = append(cells, &copied)
+				versions++
+			}
+		}
+	}
+	if len(cells) == 0 {
+		return nil
+	}
+	return &NosqlRow{Key: key, Cells: cells}
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuna/gohbase/filter"
+)
+
+func newTestMemoryHandler(t *testing.T, config map[string]interface{}) NosqlDatabaseHandler {
+	handler := NewMemoryHandler()
+	assert.Nil(t, handler.Initiate(context.Background()))
+	db, err := handler.NewHandler("test", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func scanKeys(t *testing.T, db NosqlDatabaseHandler, setters ...NosqlQueryOption) []string {
+	scanner, err := db.Scan(context.Background(), "users", setters...)
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	defer scanner.Close()
+	keys := make([]string, 0)
+	for {
+		row, err := scanner.Next()
+		if err == io.EOF {
+			return keys
+		}
+		if !assert.Nil(t, err) {
+			return keys
+		}
+		keys = append(keys, row.Key)
+	}
+}
+
+func TestMemoryDatabaseHandler(t *testing.T) {
+	ctx := context.Background()
+	db := newTestMemoryHandler(t, map[string]interface{}{
+		"DATABASE_MEMORY_MAX_VERSIONS": 2,
+	})
+	defer db.Close()
+
+	_, err := db.Get(ctx, "users", "user1")
+	assert.True(t, NosqlRecordNotFound(err))
+	assert.NotNil(t, db.Put(ctx, "users", "user1", nil))
+
+	assert.Nil(t, db.Put(ctx, "users", "user1", map[string]map[string][]byte{"info": {"name": []byte("Alice"), "age": []byte("20")}}))
+	assert.Nil(t, db.Put(ctx, "users", "user1", map[string]map[string][]byte{"info": {"name": []byte("Bob")}}))
+	assert.Nil(t, db.Put(ctx, "users", "user1", map[string]map[string][]byte{"info": {"name": []byte("Carol")}}))
+	row, err := db.Get(ctx, "users", "user1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]map[string][]byte{"info": {"name": []byte("Carol"), "age": []byte("20")}}, row.Values())
+	// the columns are sorted, the versions are kept up to DATABASE_MEMORY_MAX_VERSIONS
+	row, err = db.Get(ctx, "users", "user1", NosqlMaxVersions(3))
+	assert.Nil(t, err)
+	if assert.Len(t, row.Cells, 3) {
+		assert.Equal(t, "age", row.Cells[0].Qualifier)
+		assert.Equal(t, []byte("Carol"), row.Cells[1].Value)
+		assert.Equal(t, []byte("Bob"), row.Cells[2].Value)
+		assert.True(t, row.Cells[1].Timestamp > row.Cells[2].Timestamp)
+	}
+	row, err = db.Get(ctx, "users", "user1", NosqlFamilies(map[string][]string{"info": {"age"}}))
+	assert.Nil(t, err)
+	assert.Len(t, row.Cells, 1)
+	_, err = db.Get(ctx, "users", "user1", NosqlFilter(filter.NewPrefixFilter([]byte("user"))))
+	assert.NotNil(t, err)
+
+	assert.Nil(t, db.Delete(ctx, "users", "user1", map[string]map[string][]byte{"info": {"name": nil}}))
+	row, err = db.Get(ctx, "users", "user1")
+	assert.Nil(t, err)
+	_, ok := row.Value("info", "name")
+	assert.False(t, ok)
+	assert.Nil(t, db.Delete(ctx, "users", "user1", nil))
+	_, err = db.Get(ctx, "users", "user1")
+	assert.True(t, NosqlRecordNotFound(err))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.NotNil(t, db.Put(canceled, "users", "user1", map[string]map[string][]byte{"info": {"name": []byte("Alice")}}))
+}
+
+func TestMemoryDatabaseHandlerScan(t *testing.T) {
+	ctx := context.Background()
+	db := newTestMemoryHandler(t, map[string]interface{}{})
+	defer db.Close()
+	assert.Nil(t, db.BatchPut(ctx, "users", map[string]map[string]map[string][]byte{
+		"user1": {"info": {"name": []byte("Alice")}},
+		"user2": {"info": {"name": []byte("Bob")}},
+		"user3": {"info": {"name": []byte("Carol")}},
+		"admin": {"info": {"name": []byte("Dave")}},
+	}))
+	assert.Equal(t, []string{"admin", "user1", "user2", "user3"}, scanKeys(t, db))
+	assert.Equal(t, []string{"user1", "user2", "user3"}, scanKeys(t, db, NosqlPrefix("user")))
+	assert.Equal(t, []string{"user1", "user2"}, scanKeys(t, db, NosqlRange("user1", "user3")))
+	assert.Equal(t, []string{"user3", "user2"}, scanKeys(t, db, NosqlRange("user3", "user1"), NosqlReversed()))
+	assert.Equal(t, []string{"admin", "user1"}, scanKeys(t, db, NosqlLimit(2)))
+
+	rows, err := db.BatchGet(ctx, "users", []string{"user2", "unknown", "user1"})
+	assert.Nil(t, err)
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, "user2", rows[0].Key)
+		assert.Nil(t, rows[1])
+		assert.Equal(t, "user1", rows[2].Key)
+	}
+	assert.Nil(t, db.BatchDelete(ctx, "users", map[string]map[string]map[string][]byte{"user1": nil, "user2": nil}))
+	assert.Equal(t, []string{"admin", "user3"}, scanKeys(t, db))
+}
+
+func TestMemoryDatabaseHandlerMutate(t *testing.T) {
+	ctx := context.Background()
+	db := newTestMemoryHandler(t, map[string]interface{}{})
+	assert.Nil(t, db.Append(ctx, "users", "user1", map[string]map[string][]byte{"info": {"tags": []byte("a")}}))
+	assert.Nil(t, db.Append(ctx, "users", "user1", map[string]map[string][]byte{"info": {"tags": []byte(",b")}}))
+	row, err := db.Get(ctx, "users", "user1")
+	assert.Nil(t, err)
+	value, _ := row.Value("info", "tags")
+	assert.Equal(t, []byte("a,b"), value)
+
+	amount := make([]byte, 8)
+	binary.BigEndian.PutUint64(amount, 5)
+	for _, expected := range []int64{5, 10} {
+		i, err := db.Increment(ctx, "users", "user1", map[string]map[string][]byte{"info": {"visits": amount}})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, i)
+	}
+	_, err = db.Increment(ctx, "users", "user1", map[string]map[string][]byte{"info": {"visits": amount, "logins": amount}})
+	assert.NotNil(t, err)
+	_, err = db.Increment(ctx, "users", "user1", map[string]map[string][]byte{"info": {"tags": amount}})
+	assert.NotNil(t, err)
+
+	values := map[string]map[string][]byte{"info": {"name": []byte("Alice")}}
+	ok, err := db.CheckAndPut(ctx, "users", "user1", values, "info", "name", nil)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = db.CheckAndPut(ctx, "users", "user1", values, "info", "name", nil)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.CheckAndPut(ctx, "users", "user1", map[string]map[string][]byte{"info": {"name": []byte("Bob")}}, "info", "name", []byte("Alice"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = db.CheckAndPut(ctx, "users", "user1", values, "info", "name", []byte("Alice"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	db.Close()
+	_, err = db.Get(ctx, "users", "user1")
+	assert.NotNil(t, err)
+	assert.False(t, NosqlRecordNotFound(err))
+}
+
+func TestNewMemoryDatabase(t *testing.T) {
+	ctx := context.Background()
+	first, err := NewMemoryDatabase(ctx)
+	if !assert.Nil(t, err) {
+		return
+	}
+	second, err := NewMemoryDatabase(ctx, map[string]interface{}{"DATABASE_MEMORY_MAX_VERSIONS": 3})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "sqlite3", first.GetProvider())
+
+	firstDb, err := first.NewHandler("test")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer firstDb.Close()
+	secondDb, err := second.NewHandler("test")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer secondDb.Close()
+	// the databases of the same name are isolated
+	assert.Nil(t, firstDb.New().AutoMigrate(&testUser{}).Error())
+	assert.False(t, secondDb.New().HasTable(&testUser{}))
+
+	firstNosql, err := first.NewNosqlHandler("test", map[string]interface{}{})
+	if !assert.Nil(t, err) {
+		return
+	}
+	secondNosql, err := second.NewNosqlHandler("test", map[string]interface{}{})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, firstNosql.Put(ctx, "users", "user1", map[string]map[string][]byte{"info": {"name": []byte("Alice")}}))
+	_, err = secondNosql.Get(ctx, "users", "user1")
+	assert.True(t, NosqlRecordNotFound(err))
+	assert.Equal(t, 3, secondNosql.(*MemoryDatabaseHandler).MaxVersions)
+}
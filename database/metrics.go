@@ -0,0 +1,316 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/juju/errors"
+	"github.com/ltick/tick-framework/metrics"
+	"github.com/ltick/tick-framework/utility"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	errInstrument = "database: instrument '%s' handler error"
+)
+
+const (
+	MetricsDatabaseQueries     = "database_queries_seconds"
+	MetricsDatabaseQueryErrors = "database_query_errors_total"
+
+	metricsStartKey = "ltick:metrics_start"
+)
+
+// metricsOperations are the gorm callbacks instrumented, by operation.
+var metricsOperations = map[string]func(DatabaseCallback) *gorm.CallbackProcessor{
+	"create":    DatabaseCallback.Create,
+	"update":    DatabaseCallback.Update,
+	"delete":    DatabaseCallback.Delete,
+	"query":     DatabaseCallback.Query,
+	"row_query": DatabaseCallback.RowQuery,
+}
+
+type (
+	MetricsOptions struct {
+		SlowQueryThreshold time.Duration
+		SlowQueryLogFunc   utility.LogFunc
+	}
+
+	MetricsOption func(*MetricsOptions)
+)
+
+// MetricsSlowQueryThreshold logs the statements slower than threshold, none if threshold isn't positive.
+func MetricsSlowQueryThreshold(threshold time.Duration) MetricsOption {
+	return func(options *MetricsOptions) {
+		options.SlowQueryThreshold = threshold
+	}
+}
+
+// MetricsSlowQueryLogFunc sets the log of the slow statements, the standard logger by default.
+func MetricsSlowQueryLogFunc(logFunc utility.LogFunc) MetricsOption {
+	return func(options *MetricsOptions) {
+		options.SlowQueryLogFunc = logFunc
+	}
+}
+
+// Instrument registers the gorm callbacks of handler recording the duration and the errors of its statements,
+// by operation and by table, with name as the database label, and exports the stats of its connection pool.
+// The statements executed by Exec don't run the callbacks.
+func Instrument(name string, handler DatabaseHandler, setters ...MetricsOption) error {
+	options := &MetricsOptions{}
+	for _, setter := range setters {
+		setter(options)
+	}
+	if options.SlowQueryLogFunc == nil {
+		options.SlowQueryLogFunc = func(ctx context.Context, format string, data ...interface{}) {
+			log.Printf(format, data...)
+		}
+	}
+	queries, queryErrors, err := databaseMetrics()
+	if err != nil {
+		return errors.Annotatef(err, errInstrument, name)
+	}
+	for _, callback := range callbacksOf(handler) {
+		for operation, processor := range metricsOperations {
+			gormOperation := "gorm:" + operation
+			processor(callback).Before(gormOperation).Register("ltick:metrics_before_"+operation, func(scope *gorm.Scope) {
+				scope.InstanceSet(metricsStartKey, time.Now())
+			})
+			observe := observeFunc(name, operation, queries, queryErrors, options)
+			processor(callback).After(gormOperation).Register("ltick:metrics_after_"+operation, observe)
+		}
+	}
+	defaultStatsCollector.add(name, handler)
+	return nil
+}
+
+func observeFunc(name string, operation string, queries *prometheus.HistogramVec, queryErrors *prometheus.CounterVec, options *MetricsOptions) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		start, ok := scope.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+		duration := time.Since(start.(time.Time))
+		table := scope.TableName()
+		queries.WithLabelValues(name, operation, table).Observe(duration.Seconds())
+		if isQueryError(scope.DB().Error) {
+			queryErrors.WithLabelValues(name, operation, table).Inc()
+		}
+		if options.SlowQueryThreshold > 0 && duration >= options.SlowQueryThreshold {
+			ctx := contextOf(scope.DB())
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			// the bound parameters may be personal data, only their number is logged
+			options.SlowQueryLogFunc(ctx, "LTICK_SLOW_QUERY|%s|%s|%s|%.3f|%s|%d params redacted", name, operation, table, duration.Seconds(), scope.SQL, len(scope.SQLVars))
+		}
+	}
+}
+
+// isQueryError tests if err isn't only gorm.ErrRecordNotFound, which is a result rather than an error.
+func isQueryError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errs, ok := err.(gorm.Errors); ok {
+		for _, e := range errs {
+			if isQueryError(e) {
+				return true
+			}
+		}
+		return false
+	}
+	return err != gorm.ErrRecordNotFound
+}
+
+func databaseMetrics() (*prometheus.HistogramVec, *prometheus.CounterVec, error) {
+	queries := metrics.GetHistogram(MetricsDatabaseQueries)
+	if queries == nil {
+		queries = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    MetricsDatabaseQueries,
+			Help:    "A histogram of the duration of the database statements.",
+			Buckets: []float64{.001, .005, .01, .05, .1, .5, 1, 5},
+		}, []string{"database", "operation", "table"})
+		if err := metrics.RegisterHistogram(MetricsDatabaseQueries, queries); err != nil {
+			return nil, nil, err
+		}
+	}
+	queryErrors := metrics.GetCounter(MetricsDatabaseQueryErrors)
+	if queryErrors == nil {
+		queryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MetricsDatabaseQueryErrors,
+			Help: "A counter of the database statements failed.",
+		}, []string{"database", "operation", "table"})
+		if err := metrics.RegisterCounter(MetricsDatabaseQueryErrors, queryErrors); err != nil {
+			return nil, nil, err
+		}
+	}
+	return queries, queryErrors, nil
+}
+
+// callbacksOf returns the callbacks of the connections of handler, the replicas included.
+func callbacksOf(handler DatabaseHandler) []DatabaseCallback {
+	if traced, ok := handler.(*tracedDatabaseHandler); ok {
+		return callbacksOf(traced.handler)
+	}
+	callbacks := []DatabaseCallback{handler.Callback()}
+	if mysqlHandler, ok := handler.(*MysqlDatabaseHandler); ok && mysqlHandler.replicas != nil {
+		for _, replica := range mysqlHandler.replicas.replicas {
+			callbacks = append(callbacks, replica.Callback())
+		}
+	}
+	return callbacks
+}
+
+// sqlDBOf returns the connection pool of db, nil if db is a transaction.
+func sqlDBOf(db *gorm.DB) *sql.DB {
+	switch sqlDb := db.CommonDB().(type) {
+	case *sql.DB:
+		return sqlDb
+	case *contextDB:
+		return sqlDb.db
+	}
+	return nil
+}
+
+// statsCollector exports the stats of the connection pools of the handlers instrumented.
+type statsCollector struct {
+	mutex      sync.RWMutex
+	registered bool
+	handlers   map[string]DatabaseHandler
+	descs      map[string]*prometheus.Desc
+}
+
+var defaultStatsCollector = &statsCollector{
+	handlers: make(map[string]DatabaseHandler),
+	descs: map[string]*prometheus.Desc{
+		"max_open":      prometheus.NewDesc("database_connections_max_open", "The maximum number of open connections to the database.", []string{"database"}, nil),
+		"open":          prometheus.NewDesc("database_connections_open", "The number of open connections to the database.", []string{"database"}, nil),
+		"in_use":        prometheus.NewDesc("database_connections_in_use", "The number of connections in use.", []string{"database"}, nil),
+		"idle":          prometheus.NewDesc("database_connections_idle", "The number of idle connections.", []string{"database"}, nil),
+		"wait_count":    prometheus.NewDesc("database_connections_wait_total", "The total number of connections waited for.", []string{"database"}, nil),
+		"wait_duration": prometheus.NewDesc("database_connections_wait_seconds_total", "The total time blocked waiting for a new connection.", []string{"database"}, nil),
+	},
+}
+
+func (c *statsCollector) add(name string, handler DatabaseHandler) {
+	c.mutex.Lock()
+	c.handlers[name] = handler
+	register := !c.registered
+	c.registered = true
+	c.mutex.Unlock()
+	if register {
+		prometheus.Register(c)
+	}
+}
+
+func (c *statsCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		descs <- desc
+	}
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for name, handler := range c.handlers {
+		stats := handler.Stats()
+		ch <- prometheus.MustNewConstMetric(c.descs["max_open"], prometheus.GaugeValue, float64(stats.MaxOpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(c.descs["open"], prometheus.GaugeValue, float64(stats.OpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(c.descs["in_use"], prometheus.GaugeValue, float64(stats.InUse), name)
+		ch <- prometheus.MustNewConstMetric(c.descs["idle"], prometheus.GaugeValue, float64(stats.Idle), name)
+		ch <- prometheus.MustNewConstMetric(c.descs["wait_count"], prometheus.CounterValue, float64(stats.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(c.descs["wait_duration"], prometheus.CounterValue, stats.WaitDuration.Seconds(), name)
+	}
+}
+
+// InstrumentNosql exports the stats of the client pool of handler, with name as the database label,
+// if it has a pool.
+func InstrumentNosql(name string, handler NosqlDatabaseHandler) {
+	if traced, ok := handler.(*tracedNosqlDatabaseHandler); ok {
+		handler = traced.handler
+	}
+	if pooled, ok := handler.(pooledNosqlDatabaseHandler); ok {
+		defaultPoolStatsCollector.add(name, pooled)
+	}
+}
+
+type pooledNosqlDatabaseHandler interface {
+	PoolStats() utility.PoolStats
+}
+
+// poolStatsCollector exports the stats of the client pools of the nosql handlers instrumented.
+type poolStatsCollector struct {
+	mutex      sync.RWMutex
+	registered bool
+	handlers   map[string]pooledNosqlDatabaseHandler
+	descs      map[string]*prometheus.Desc
+}
+
+var defaultPoolStatsCollector = &poolStatsCollector{
+	handlers: make(map[string]pooledNosqlDatabaseHandler),
+	descs: map[string]*prometheus.Desc{
+		"open":          prometheus.NewDesc("database_nosql_clients_open", "The number of open clients of the nosql database.", []string{"database"}, nil),
+		"in_use":        prometheus.NewDesc("database_nosql_clients_in_use", "The number of clients in use.", []string{"database"}, nil),
+		"idle":          prometheus.NewDesc("database_nosql_clients_idle", "The number of idle clients.", []string{"database"}, nil),
+		"wait_count":    prometheus.NewDesc("database_nosql_clients_wait_total", "The total number of clients waited for.", []string{"database"}, nil),
+		"wait_duration": prometheus.NewDesc("database_nosql_clients_wait_seconds_total", "The total time blocked waiting for a client.", []string{"database"}, nil),
+		"timeouts":      prometheus.NewDesc("database_nosql_clients_timeouts_total", "The total number of waits for a client timed out.", []string{"database"}, nil),
+	},
+}
+
+func (c *poolStatsCollector) add(name string, handler pooledNosqlDatabaseHandler) {
+	c.mutex.Lock()
+	c.handlers[name] = handler
+	register := !c.registered
+	c.registered = true
+	c.mutex.Unlock()
+	if register {
+		prometheus.Register(c)
+	}
+}
+
+func (c *poolStatsCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		descs <- desc
+	}
+}
+
+func (c *poolStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for name, handler := range c.handlers {
+		stats := handler.PoolStats()
+		ch <- prometheus.MustNewConstMetric(c.descs["open"], prometheus.GaugeValue, float64(stats.Open), name)
+		ch <- prometheus.MustNewConstMetric(c.descs["in_use"], prometheus.GaugeValue, float64(stats.InUse), name)
+		ch <- prometheus.MustNewConstMetric(c.descs["idle"], prometheus.GaugeValue, float64(stats.Idle), name)
+		ch <- prometheus.MustNewConstMetric(c.descs["wait_count"], prometheus.CounterValue, float64(stats.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(c.descs["wait_duration"], prometheus.CounterValue, stats.WaitDuration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(c.descs["timeouts"], prometheus.CounterValue, float64(stats.Timeouts), name)
+	}
+}
+
+// slowQueryThreshold parses the config DATABASE_SLOW_QUERY_THRESHOLD, 0 if empty.
+func slowQueryThreshold(config map[string]interface{}) (time.Duration, error) {
+	configThreshold, ok := config["DATABASE_SLOW_QUERY_THRESHOLD"]
+	if !ok || configThreshold == nil {
+		return 0, nil
+	}
+	threshold, ok := configThreshold.(string)
+	if !ok {
+		return 0, fmt.Errorf("database: invalid config DATABASE_SLOW_QUERY_THRESHOLD")
+	}
+	if threshold == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(threshold)
+	if err != nil {
+		return 0, fmt.Errorf("database: invalid config DATABASE_SLOW_QUERY_THRESHOLD '%s'", threshold)
+	}
+	return duration, nil
+}
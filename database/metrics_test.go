@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument(t *testing.T) {
+	handler := NewSqliteHandler()
+	assert.Nil(t, handler.Initiate(context.Background()))
+	db, err := handler.NewHandler("metrics", map[string]interface{}{
+		"DATABASE_SQLITE_PATH": ":memory:",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+	// the metrics are global, a label of its own keeps the counts of the run
+	name := fmt.Sprintf("metrics_test_%d", time.Now().UnixNano())
+	logs := make([]string, 0)
+	assert.Nil(t, Instrument(name, NewTracedDatabaseHandler(db, nil), MetricsSlowQueryThreshold(time.Nanosecond), MetricsSlowQueryLogFunc(func(ctx context.Context, format string, data ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, data...))
+	})))
+	assert.Nil(t, db.New().AutoMigrate(&testUser{}).Error())
+	assert.Nil(t, db.New().Create(&testUser{Name: "secret"}).Error())
+	assert.Nil(t, db.New().Where("name = ?", "secret").First(&testUser{}).Error())
+	assert.True(t, db.New().Where("name = ?", "unknown").First(&testUser{}).RecordNotFound())
+	assert.NotNil(t, db.New().Table("unknown_users").Find(&[]testUser{}).Error())
+
+	queries, queryErrors, err := databaseMetrics()
+	assert.Nil(t, err)
+	metric := &dto.Metric{}
+	assert.Nil(t, queries.WithLabelValues(name, "query", "test_users").(prometheus.Histogram).Write(metric))
+	assert.Equal(t, uint64(2), metric.GetHistogram().GetSampleCount())
+	assert.Nil(t, queries.WithLabelValues(name, "create", "test_users").(prometheus.Histogram).Write(metric))
+	assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+	assert.Nil(t, queryErrors.WithLabelValues(name, "query", "test_users").Write(metric))
+	assert.Equal(t, float64(0), metric.GetCounter().GetValue())
+	assert.Nil(t, queryErrors.WithLabelValues(name, "query", "unknown_users").Write(metric))
+	assert.Equal(t, float64(1), metric.GetCounter().GetValue())
+
+	if assert.True(t, len(logs) > 0) {
+		assert.Contains(t, logs[0], "LTICK_SLOW_QUERY|"+name+"|create|test_users|")
+		assert.Contains(t, logs[0], "1 params redacted")
+	}
+	for _, log := range logs {
+		assert.NotContains(t, log, "secret")
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.Nil(t, err)
+	open := -1.0
+	for _, family := range families {
+		if family.GetName() != "database_connections_open" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == name {
+				open = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, 1.0, open)
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	threshold, err := slowQueryThreshold(map[string]interface{}{"DATABASE_SLOW_QUERY_THRESHOLD": "200ms"})
+	assert.Nil(t, err)
+	assert.Equal(t, 200*time.Millisecond, threshold)
+	threshold, err = slowQueryThreshold(map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), threshold)
+	_, err = slowQueryThreshold(map[string]interface{}{"DATABASE_SLOW_QUERY_THRESHOLD": "slow"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,101 @@
+package migration
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+var errCommand = "migration: command error"
+
+const commandUsage = `usage: migrate [-dry-run] <command> [argument]
+
+commands:
+  status          print the state of the migrations
+  up [version]    apply the pending migrations, up to version if any
+  down [steps]    revert the last steps applied migrations, 1 by default
+  down-to version revert the applied migrations newer than version
+  unlock          release the lock left by an interrupted deploy
+`
+
+// Command runs the migration subcommand of args, such as os.Args[2:] of a "migrate" subcommand, and prints its result to output.
+func Command(m *Migrator, args []string, output io.Writer) error {
+	flagSet := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flagSet.SetOutput(output)
+	flagSet.Usage = func() {
+		fmt.Fprint(output, commandUsage)
+	}
+	dryRun := flagSet.Bool("dry-run", false, "print the migrations without running them")
+	if err := flagSet.Parse(args); err != nil {
+		return errors.Annotate(err, errCommand)
+	}
+	if flagSet.NArg() == 0 || flagSet.NArg() > 2 {
+		flagSet.Usage()
+		return errors.Annotate(errors.New("migration: invalid arguments"), errCommand)
+	}
+	argument := flagSet.Arg(1)
+	previousDryRun, previousLogWriter := m.DryRun, m.LogWriter
+	m.DryRun = m.DryRun || *dryRun
+	m.LogWriter = output
+	defer func() {
+		m.DryRun, m.LogWriter = previousDryRun, previousLogWriter
+	}()
+	var err error
+	switch flagSet.Arg(0) {
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return errors.Annotate(err, errCommand)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+				if status.Up == nil {
+					state += " (unknown)"
+				}
+			}
+			fmt.Fprintf(output, "%d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return nil
+	case "up":
+		version := int64(-1)
+		if argument != "" {
+			if version, err = strconv.ParseInt(argument, 10, 64); err != nil {
+				return errors.Annotate(errors.Errorf("migration: invalid version '%s'", argument), errCommand)
+			}
+		}
+		_, err = m.UpTo(version)
+	case "down":
+		steps := 1
+		if argument != "" {
+			if steps, err = strconv.Atoi(argument); err != nil || steps < 1 {
+				return errors.Annotate(errors.Errorf("migration: invalid steps '%s'", argument), errCommand)
+			}
+		}
+		_, err = m.Down(steps)
+	case "down-to":
+		version, parseErr := strconv.ParseInt(argument, 10, 64)
+		if parseErr != nil {
+			return errors.Annotate(errors.Errorf("migration: invalid version '%s'", argument), errCommand)
+		}
+		_, err = m.DownTo(version)
+	case "unlock":
+		if err = m.Unlock(); err != nil {
+			return errors.Annotate(err, errCommand)
+		}
+		fmt.Fprintln(output, "migration: unlocked")
+		return nil
+	default:
+		flagSet.Usage()
+		return errors.Annotate(errors.Errorf("migration: unknown command '%s'", flagSet.Arg(0)), errCommand)
+	}
+	if err != nil {
+		return errors.Annotate(err, errCommand)
+	}
+	return nil
+}
@@ -0,0 +1,565 @@
+package migration
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ltick/tick-framework/database"
+)
+
+var (
+	errRegister         = "migration: register error"
+	errLoadDir          = "migration: load dir '%s' error"
+	errStatus           = "migration: status error"
+	errUp               = "migration: up error"
+	errDown             = "migration: down error"
+	errApply            = "migration: apply %d_%s error"
+	errRevert           = "migration: revert %d_%s error"
+	errLock             = "migration: lock error"
+	errLocked           = "migration: locked by '%s' since %s"
+	errUnlock           = "migration: unlock error"
+	errIrreversible     = "migration: %d_%s is irreversible"
+	errUnknownMigration = "migration: applied migration %d is unknown"
+)
+
+const (
+	defaultTable       = "schema_migrations"
+	defaultLockTable   = "schema_migrations_lock"
+	defaultLockTimeout = 30 * time.Second
+	defaultLockExpiry  = time.Hour
+	lockRetryInterval  = 500 * time.Millisecond
+)
+
+// migrationFilePattern matches the files "<version>_<name>.up.sql" and "<version>_<name>.down.sql".
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Func migrates the schema with the handler of the transaction of the migration.
+type Func func(tx database.DatabaseHandler) error
+
+// Migration is a reversible change of the schema, the migrations are applied in the order of their versions.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      Func
+	Down    Func
+	// UpSQL and DownSQL are the statements of the SQL migrations, printed by the dry runs
+	UpSQL   string
+	DownSQL string
+}
+
+// New returns a Go migration, down may be nil if the migration is irreversible.
+func New(version int64, name string, up Func, down Func) *Migration {
+	return &Migration{
+		Version: version,
+		Name:    name,
+		Up:      up,
+		Down:    down,
+	}
+}
+
+// NewSQL returns a migration executing the statements of upSQL and downSQL, separated by a semicolon at the end of a line.
+// downSQL may be empty if the migration is irreversible.
+func NewSQL(version int64, name string, upSQL string, downSQL string) *Migration {
+	migration := &Migration{
+		Version: version,
+		Name:    name,
+		Up:      execFunc(upSQL),
+		UpSQL:   upSQL,
+		DownSQL: downSQL,
+	}
+	if strings.TrimSpace(downSQL) != "" {
+		migration.Down = execFunc(downSQL)
+	}
+	return migration
+}
+
+// LoadDir returns the SQL migrations of the files "<version>_<name>.up.sql" and "<version>_<name>.down.sql" of dir.
+func LoadDir(dir string) ([]*Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Annotatef(err, errLoadDir, dir)
+	}
+	migrationMap := make(map[int64]*Migration)
+	for _, file := range files {
+		matches := migrationFilePattern.FindStringSubmatch(file.Name())
+		if file.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, errors.Annotatef(err, errLoadDir, dir)
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, errors.Annotatef(err, errLoadDir, dir)
+		}
+		migration, ok := migrationMap[version]
+		if !ok {
+			migration = &Migration{
+				Version: version,
+				Name:    matches[2],
+			}
+			migrationMap[version] = migration
+		} else if migration.Name != matches[2] {
+			return nil, errors.Annotatef(errors.Errorf("migration: version %d is used by '%s' and '%s'", version, migration.Name, matches[2]), errLoadDir, dir)
+		}
+		if matches[3] == "up" {
+			migration.UpSQL = string(content)
+			migration.Up = execFunc(migration.UpSQL)
+		} else {
+			migration.DownSQL = string(content)
+			migration.Down = execFunc(migration.DownSQL)
+		}
+	}
+	migrations := make([]*Migration, 0, len(migrationMap))
+	for _, migration := range migrationMap {
+		if migration.Up == nil {
+			return nil, errors.Annotatef(errors.Errorf("migration: missing %d_%s.up.sql", migration.Version, migration.Name), errLoadDir, dir)
+		}
+		migrations = append(migrations, migration)
+	}
+	sortMigrations(migrations)
+	return migrations, nil
+}
+
+// execFunc executes the statements of the SQL script one by one, as the drivers don't all support the multiple statements.
+func execFunc(script string) Func {
+	return func(tx database.DatabaseHandler) error {
+		for _, statement := range splitStatements(script) {
+			if err := tx.New().Exec(statement).Error(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func splitStatements(script string) []string {
+	statements := make([]string, 0)
+	var statement strings.Builder
+	for _, line := range strings.SplitAfter(script, "\n") {
+		statement.WriteString(line)
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if s := strings.TrimSpace(statement.String()); s != ";" {
+				statements = append(statements, s)
+			}
+			statement.Reset()
+		}
+	}
+	if s := strings.TrimSpace(statement.String()); s != "" {
+		statements = append(statements, s)
+	}
+	return statements
+}
+
+func sortMigrations(migrations []*Migration) {
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// schemaMigration is a record of the migration table.
+type schemaMigration struct {
+	Version   int64  `gorm:"primary_key;auto_increment:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+// schemaMigrationLock is the record of the lock table, the primary key prevents the concurrent migrations.
+type schemaMigrationLock struct {
+	ID       int    `gorm:"primary_key;auto_increment:false"`
+	Owner    string `gorm:"size:255"`
+	LockedAt time.Time
+}
+
+// Status is the state of a migration, the migrations applied but unknown have no Up and Down.
+type Status struct {
+	*Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type (
+	MigratorOptions struct {
+		Table       string
+		LockTable   string
+		LockTimeout time.Duration
+		LockExpiry  time.Duration
+		DryRun      bool
+		LogWriter   io.Writer
+	}
+
+	MigratorOption func(*MigratorOptions)
+
+	// Migrator applies and reverts the migrations, recording the applied versions in the migration table.
+	Migrator struct {
+		*MigratorOptions
+		db         database.DatabaseHandler
+		migrations []*Migration
+	}
+)
+
+// MigratorTable sets the table of the applied versions, "schema_migrations" by default.
+func MigratorTable(table string) MigratorOption {
+	return func(options *MigratorOptions) {
+		options.Table = table
+	}
+}
+
+// MigratorLockTable sets the table locking the migrations, "schema_migrations_lock" by default.
+func MigratorLockTable(lockTable string) MigratorOption {
+	return func(options *MigratorOptions) {
+		options.LockTable = lockTable
+	}
+}
+
+// MigratorLockTimeout sets how long to wait for the lock held by another deploy, 30s by default.
+func MigratorLockTimeout(lockTimeout time.Duration) MigratorOption {
+	return func(options *MigratorOptions) {
+		options.LockTimeout = lockTimeout
+	}
+}
+
+// MigratorLockExpiry sets the age of a lock left by a crashed deploy, taken over by the next one, 1h by default.
+// A zero expiry never takes over the locks.
+func MigratorLockExpiry(lockExpiry time.Duration) MigratorOption {
+	return func(options *MigratorOptions) {
+		options.LockExpiry = lockExpiry
+	}
+}
+
+// MigratorDryRun only logs the migrations to apply or to revert.
+func MigratorDryRun(dryRun bool) MigratorOption {
+	return func(options *MigratorOptions) {
+		options.DryRun = dryRun
+	}
+}
+
+func MigratorLogWriter(logWriter io.Writer) MigratorOption {
+	return func(options *MigratorOptions) {
+		options.LogWriter = logWriter
+	}
+}
+
+func NewMigrator(db database.DatabaseHandler, setters ...MigratorOption) *Migrator {
+	options := &MigratorOptions{
+		Table:       defaultTable,
+		LockTable:   defaultLockTable,
+		LockTimeout: defaultLockTimeout,
+		LockExpiry:  defaultLockExpiry,
+		LogWriter:   os.Stdout,
+	}
+	for _, setter := range setters {
+		setter(options)
+	}
+	return &Migrator{
+		MigratorOptions: options,
+		db:              db,
+		migrations:      make([]*Migration, 0),
+	}
+}
+
+// Register adds the migrations, their versions must be unique.
+func (m *Migrator) Register(migrations ...*Migration) error {
+	for _, migration := range migrations {
+		if migration == nil || migration.Up == nil {
+			return errors.Annotate(errors.New("migration: migration or its up is nil"), errRegister)
+		}
+		for _, registered := range m.migrations {
+			if registered.Version == migration.Version {
+				return errors.Annotate(errors.Errorf("migration: version %d is used by '%s' and '%s'", migration.Version, registered.Name, migration.Name), errRegister)
+			}
+		}
+		m.migrations = append(m.migrations, migration)
+	}
+	sortMigrations(m.migrations)
+	return nil
+}
+
+func (m *Migrator) Log(args ...interface{}) {
+	if m.LogWriter != nil {
+		fmt.Fprintln(m.LogWriter, args...)
+	}
+}
+
+// Status returns the state of the registered migrations and of the applied migrations unknown to the migrator, by version.
+func (m *Migrator) Status() ([]*Status, error) {
+	if err := m.prepare(); err != nil {
+		return nil, errors.Annotate(err, errStatus)
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, errors.Annotate(err, errStatus)
+	}
+	statuses := make([]*Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := &Status{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range applied {
+		statuses = append(statuses, &Status{
+			Migration: &Migration{Version: record.Version, Name: record.Name},
+			Applied:   true,
+			AppliedAt: record.AppliedAt,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Up applies the pending migrations and returns them.
+func (m *Migrator) Up() ([]*Migration, error) {
+	return m.UpTo(-1)
+}
+
+// UpTo applies the pending migrations up to version included, all the pending migrations if version is negative.
+func (m *Migrator) UpTo(version int64) (migrations []*Migration, err error) {
+	err = m.locked(func() error {
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		migrations = make([]*Migration, 0)
+		for _, status := range statuses {
+			if status.Applied || (version >= 0 && status.Version > version) {
+				continue
+			}
+			if err := m.apply(status.Migration); err != nil {
+				return err
+			}
+			migrations = append(migrations, status.Migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return migrations, errors.Annotate(err, errUp)
+	}
+	return migrations, nil
+}
+
+// Down reverts the last steps applied migrations and returns them.
+func (m *Migrator) Down(steps int) (migrations []*Migration, err error) {
+	return m.down(func(statuses []*Status) []*Status {
+		if steps < len(statuses) {
+			return statuses[:steps]
+		}
+		return statuses
+	})
+}
+
+// DownTo reverts the applied migrations newer than version and returns them.
+func (m *Migrator) DownTo(version int64) (migrations []*Migration, err error) {
+	return m.down(func(statuses []*Status) []*Status {
+		for i, status := range statuses {
+			if status.Version <= version {
+				return statuses[:i]
+			}
+		}
+		return statuses
+	})
+}
+
+// down reverts the applied migrations selected from the applied migrations, newest first.
+func (m *Migrator) down(selectStatuses func([]*Status) []*Status) (migrations []*Migration, err error) {
+	err = m.locked(func() error {
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		applied := make([]*Status, 0)
+		for i := len(statuses) - 1; i >= 0; i-- {
+			if statuses[i].Applied {
+				applied = append(applied, statuses[i])
+			}
+		}
+		migrations = make([]*Migration, 0)
+		for _, status := range selectStatuses(applied) {
+			if err := m.revert(status.Migration); err != nil {
+				return err
+			}
+			migrations = append(migrations, status.Migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return migrations, errors.Annotate(err, errDown)
+	}
+	return migrations, nil
+}
+
+func (m *Migrator) apply(migration *Migration) error {
+	if m.DryRun {
+		m.Log(fmt.Sprintf("migration: [dry run] apply %d_%s", migration.Version, migration.Name))
+		if migration.UpSQL != "" {
+			m.Log(migration.UpSQL)
+		}
+		return nil
+	}
+	m.Log(fmt.Sprintf("migration: apply %d_%s", migration.Version, migration.Name))
+	err := m.transaction(func(tx database.DatabaseHandler) error {
+		if err := migration.Up(tx.New()); err != nil {
+			return err
+		}
+		return tx.New().Table(m.Table).Create(&schemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now(),
+		}).Error()
+	})
+	if err != nil {
+		return errors.Annotatef(err, errApply, migration.Version, migration.Name)
+	}
+	return nil
+}
+
+func (m *Migrator) revert(migration *Migration) error {
+	if migration.Up == nil {
+		return errors.Errorf(errUnknownMigration, migration.Version)
+	}
+	if migration.Down == nil {
+		return errors.Errorf(errIrreversible, migration.Version, migration.Name)
+	}
+	if m.DryRun {
+		m.Log(fmt.Sprintf("migration: [dry run] revert %d_%s", migration.Version, migration.Name))
+		if migration.DownSQL != "" {
+			m.Log(migration.DownSQL)
+		}
+		return nil
+	}
+	m.Log(fmt.Sprintf("migration: revert %d_%s", migration.Version, migration.Name))
+	err := m.transaction(func(tx database.DatabaseHandler) error {
+		if err := migration.Down(tx.New()); err != nil {
+			return err
+		}
+		return tx.New().Table(m.Table).Where("version = ?", migration.Version).Delete(&schemaMigration{}).Error()
+	})
+	if err != nil {
+		return errors.Annotatef(err, errRevert, migration.Version, migration.Name)
+	}
+	return nil
+}
+
+// transaction runs the migration and its record in a transaction,
+// the statements implicitly committed by the database such as the DDL of MySQL can't be rolled back.
+func (m *Migrator) transaction(migrate func(tx database.DatabaseHandler) error) (err error) {
+	tx := m.db.New().Begin()
+	if err = tx.Error(); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err = migrate(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error()
+}
+
+// prepare creates the migration and lock tables, a dry run does not create them.
+func (m *Migrator) prepare() error {
+	if m.DryRun {
+		return nil
+	}
+	if err := m.db.New().Table(m.Table).AutoMigrate(&schemaMigration{}).Error(); err != nil {
+		return err
+	}
+	return m.db.New().Table(m.LockTable).AutoMigrate(&schemaMigrationLock{}).Error()
+}
+
+func (m *Migrator) applied() (map[int64]*schemaMigration, error) {
+	records := make([]*schemaMigration, 0)
+	// nothing is applied yet when a dry run finds no migration table
+	if m.DryRun && !m.db.New().UsePrimary().HasTable(m.Table) {
+		return map[int64]*schemaMigration{}, nil
+	}
+	// the reads go to the primary, a replica may lag behind the migrations just applied
+	if err := m.db.New().UsePrimary().Table(m.Table).Find(&records).Error(); err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]*schemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// locked runs migrate holding the lock, except for the dry runs.
+func (m *Migrator) locked(migrate func() error) error {
+	if m.DryRun {
+		return migrate()
+	}
+	if err := m.Lock(); err != nil {
+		return err
+	}
+	defer m.Unlock()
+	return migrate()
+}
+
+// Lock takes the lock of the migrations, waiting for the lock timeout if another deploy holds it.
+func (m *Migrator) Lock() error {
+	if err := m.prepare(); err != nil {
+		return errors.Annotate(err, errLock)
+	}
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d", hostname, os.Getpid())
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		err := m.db.New().Table(m.LockTable).Create(&schemaMigrationLock{
+			ID:       1,
+			Owner:    owner,
+			LockedAt: time.Now(),
+		}).Error()
+		if err == nil {
+			return nil
+		}
+		lock := &schemaMigrationLock{}
+		db := m.db.New().UsePrimary().Table(m.LockTable).Where("id = ?", 1).First(lock)
+		switch {
+		case db.RecordNotFound():
+			// the lock is released between the insert and the select, or the insert fails for another reason
+			if !time.Now().Before(deadline) {
+				return errors.Annotate(err, errLock)
+			}
+		case db.Error() != nil:
+			return errors.Annotate(err, errLock)
+		case m.LockExpiry > 0 && time.Since(lock.LockedAt) > m.LockExpiry:
+			// the deploy holding the lock crashed, the owner is checked in case another deploy took it over first
+			m.Log(fmt.Sprintf("migration: take over the lock of '%s' since %s", lock.Owner, lock.LockedAt.Format(time.RFC3339)))
+			if err := m.db.New().Table(m.LockTable).Where("id = ? AND owner = ?", 1, lock.Owner).Delete(&schemaMigrationLock{}).Error(); err != nil {
+				return errors.Annotate(err, errLock)
+			}
+			continue
+		case !time.Now().Before(deadline):
+			return errors.Annotate(errors.Errorf(errLocked, lock.Owner, lock.LockedAt.Format(time.RFC3339)), errLock)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Unlock releases the lock of the migrations, also the lock left by an interrupted deploy.
+func (m *Migrator) Unlock() error {
+	if err := m.db.New().Table(m.LockTable).Where("id = ?", 1).Delete(&schemaMigrationLock{}).Error(); err != nil {
+		return errors.Annotate(err, errUnlock)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ltick/tick-framework/database"
+	_ "github.com/ltick/tick-framework/database/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHandler(t *testing.T, name string) database.DatabaseHandler {
+	handler := database.NewSqliteHandler()
+	assert.Nil(t, handler.Initiate(context.Background()))
+	db, err := handler.NewHandler(name, map[string]interface{}{
+		"DATABASE_SQLITE_PATH": ":memory:",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testMigrations() []*Migration {
+	return []*Migration{
+		NewSQL(2, "add_user_email", "ALTER TABLE users ADD COLUMN email VARCHAR(255);", ""),
+		NewSQL(1, "create_users", `CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	name VARCHAR(255)
+);
+INSERT INTO users (name) VALUES ('ltick');`, "DROP TABLE users;"),
+		New(3, "create_posts", func(tx database.DatabaseHandler) error {
+			return tx.Exec("CREATE TABLE posts (id INTEGER PRIMARY KEY)").Error()
+		}, func(tx database.DatabaseHandler) error {
+			return tx.Exec("DROP TABLE posts").Error()
+		}),
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	db := newTestHandler(t, "migrator")
+	defer db.Close()
+	log := &bytes.Buffer{}
+	migrator := NewMigrator(db, MigratorLogWriter(log))
+	assert.Nil(t, migrator.Register(testMigrations()...))
+	assert.NotNil(t, migrator.Register(NewSQL(1, "duplicate", "SELECT 1;", "")))
+
+	// dry run
+	migrator.DryRun = true
+	migrations, err := migrator.Up()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(migrations))
+	assert.Contains(t, log.String(), "[dry run] apply 1_create_users")
+	assert.False(t, db.New().HasTable("users"))
+	// a dry run does not create the migration tables
+	assert.False(t, db.New().HasTable(migrator.Table))
+	assert.False(t, db.New().HasTable(migrator.LockTable))
+	migrator.DryRun = false
+
+	migrations, err = migrator.UpTo(2)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(migrations)) {
+		assert.Equal(t, int64(1), migrations[0].Version)
+		assert.Equal(t, int64(2), migrations[1].Version)
+	}
+	var count int
+	assert.Nil(t, db.New().Table("users").Where("email IS NULL").Count(&count).Error())
+	assert.Equal(t, 1, count)
+	migrations, err = migrator.Up()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(migrations))
+	assert.True(t, db.New().HasTable("posts"))
+	statuses, err := migrator.Status()
+	assert.Nil(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.Applied)
+	}
+
+	// irreversible
+	migrations, err = migrator.Down(2)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(migrations))
+	assert.False(t, db.New().HasTable("posts"))
+	statuses, err = migrator.Status()
+	assert.Nil(t, err)
+	assert.False(t, statuses[2].Applied)
+	assert.True(t, statuses[1].Applied)
+
+	// a failed migration is rolled back
+	assert.Nil(t, migrator.Register(NewSQL(4, "invalid", "CREATE TABLE comments (id INTEGER PRIMARY KEY);\nINVALID;", "")))
+	_, err = migrator.Up()
+	assert.NotNil(t, err)
+	assert.False(t, db.New().HasTable("comments"))
+	statuses, err = migrator.Status()
+	assert.Nil(t, err)
+	assert.False(t, statuses[3].Applied)
+}
+
+func TestMigratorLock(t *testing.T) {
+	db := newTestHandler(t, "migrator_lock")
+	defer db.Close()
+	migrator := NewMigrator(db, MigratorLogWriter(ioutil.Discard), MigratorLockTimeout(0))
+	assert.Nil(t, migrator.Register(testMigrations()...))
+	assert.Nil(t, migrator.Lock())
+	_, err := NewMigrator(db, MigratorLockTimeout(0)).Up()
+	assert.NotNil(t, err)
+	assert.False(t, db.New().HasTable("users"))
+	assert.Nil(t, migrator.Unlock())
+	migrations, err := migrator.Up()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(migrations))
+
+	// the lock left by a crashed deploy expires
+	assert.Nil(t, db.New().Table(migrator.LockTable).Create(&schemaMigrationLock{ID: 1, Owner: "crashed:1", LockedAt: time.Now().Add(-2 * time.Hour)}).Error())
+	assert.NotNil(t, NewMigrator(db, MigratorLogWriter(ioutil.Discard), MigratorLockTimeout(0), MigratorLockExpiry(0)).Lock())
+	assert.Nil(t, migrator.Lock())
+	assert.Nil(t, migrator.Unlock())
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"1_create_users.up.sql":   "CREATE TABLE users (id INTEGER PRIMARY KEY);",
+		"1_create_users.down.sql": "DROP TABLE users;",
+		"2_create_posts.up.sql":   "CREATE TABLE posts (id INTEGER PRIMARY KEY);",
+		"README.md":               "migrations",
+	}
+	for name, content := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	migrations, err := LoadDir(dir)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(migrations)) {
+		assert.Equal(t, "create_users", migrations[0].Name)
+		assert.NotNil(t, migrations[0].Down)
+		assert.Equal(t, "create_posts", migrations[1].Name)
+		assert.Nil(t, migrations[1].Down)
+	}
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "3_create_tags.down.sql"), []byte("DROP TABLE tags;"), 0644))
+	_, err = LoadDir(dir)
+	assert.NotNil(t, err)
+}
+
+func TestCommand(t *testing.T) {
+	db := newTestHandler(t, "migrator_command")
+	defer db.Close()
+	migrator := NewMigrator(db, MigratorLogWriter(ioutil.Discard))
+	assert.Nil(t, migrator.Register(testMigrations()...))
+	output := &bytes.Buffer{}
+	assert.Nil(t, Command(migrator, []string{"-dry-run", "up"}, output))
+	assert.Contains(t, output.String(), "[dry run] apply 3_create_posts")
+	assert.False(t, migrator.DryRun)
+	output.Reset()
+	assert.Nil(t, Command(migrator, []string{"up", "1"}, output))
+	assert.Nil(t, Command(migrator, []string{"status"}, output))
+	assert.Contains(t, output.String(), "1_create_users\tapplied")
+	assert.Contains(t, output.String(), "2_add_user_email\tpending")
+	assert.Nil(t, Command(migrator, []string{"down"}, output))
+	assert.False(t, db.New().HasTable("users"))
+	assert.NotNil(t, Command(migrator, []string{"down", "zero"}, output))
+	assert.NotNil(t, Command(migrator, []string{"sideways"}, output))
+	assert.Nil(t, Command(migrator, []string{"unlock"}, output))
+}
+
+func TestSplitStatements(t *testing.T) {
+	assert.Equal(t, []string{"CREATE TABLE a (id INT,\nname TEXT);", "DROP TABLE b;", "SELECT 1"}, splitStatements("CREATE TABLE a (id INT,\nname TEXT);\n\nDROP TABLE b;\nSELECT 1\n"))
+}
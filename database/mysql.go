@@ -5,7 +5,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"sync"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
@@ -19,6 +22,8 @@ var (
 
 type MysqlHandler struct {
 	databases map[string]*MysqlDatabaseHandler
+	// mutex guards databases, the shard handlers are created while serving
+	mutex sync.RWMutex
 }
 
 func NewMysqlHandler() Handler {
@@ -160,45 +165,100 @@ func (this *MysqlHandler) NewHandler(name string, config map[string]interface{})
 			return nil, errors.New(errMysqlNewHandler + ": invalid config DATABASE_MYSQL_MAX_IDLE_CONNS")
 		}
 	}
-	args := fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s?timeout=%s&writeTimeout=%s&readTimeout=%s&charset=utf8mb4,utf8&loc=%s&parseTime=true",
-		db.User,
-		db.Password,
-		db.Host,
-		db.Port,
-		db.Database,
-		db.WriteTimeout,
-		db.ReadTimeout,
-		db.Timeout,
-		url.QueryEscape(db.Timezone),
-	)
-	gormDb, err := gorm.Open("mysql", args)
-	if err == nil {
-		gormDb.DB().SetMaxOpenConns(db.MaxOpenConns)
-		gormDb.DB().SetMaxIdleConns(db.MaxIdleConns)
-		configDebug := config["DATABASE_MYSQL_DEBUG"]
-		if configDebug != nil {
-			if debug, ok := configDebug.(bool); ok {
-				if debug {
-					gormDb.Debug()
-				}
-			} else {
-				return nil, errors.New(errMysqlNewHandler + ": invalid DATABASE_MYSQL_DEBUG")
+	configReplicas, ok := config["DATABASE_MYSQL_REPLICAS"]
+	if ok && configReplicas != nil {
+		replicas, ok := configReplicas.(string)
+		if ok {
+			db.Replicas = parseReplicas(replicas)
+		} else {
+			return nil, errors.New(errMysqlNewHandler + ": invalid config DATABASE_MYSQL_REPLICAS")
+		}
+	}
+	replicaCheckInterval := 10 * time.Second
+	configReplicaCheckInterval, ok := config["DATABASE_MYSQL_REPLICA_CHECK_INTERVAL"]
+	if ok && configReplicaCheckInterval != nil {
+		interval, ok := configReplicaCheckInterval.(string)
+		if !ok {
+			return nil, errors.New(errMysqlNewHandler + ": invalid config DATABASE_MYSQL_REPLICA_CHECK_INTERVAL")
+		}
+		if interval != "" {
+			var err error
+			if replicaCheckInterval, err = time.ParseDuration(interval); err != nil {
+				return nil, errors.New(errMysqlNewHandler + ": invalid config DATABASE_MYSQL_REPLICA_CHECK_INTERVAL")
 			}
 		}
-		db.Db = gormDb
-		if this.databases == nil {
-			this.databases = make(map[string]*MysqlDatabaseHandler)
+	}
+	configDebug := config["DATABASE_MYSQL_DEBUG"]
+	var debug bool
+	if configDebug != nil {
+		if debug, ok = configDebug.(bool); !ok {
+			return nil, errors.New(errMysqlNewHandler + ": invalid DATABASE_MYSQL_DEBUG")
 		}
-		this.databases[name] = db
-	} else {
+	}
+	gormDb, err := db.open(db.Host, db.Port, debug)
+	if err != nil {
 		return nil, errors.New(errMysqlNewHandler + ": " + err.Error())
 	}
+	if len(db.Replicas) > 0 {
+		replicas := make([]*gorm.DB, 0, len(db.Replicas))
+		for _, replica := range db.Replicas {
+			host, port, splitErr := net.SplitHostPort(replica)
+			if splitErr != nil {
+				host, port = replica, db.Port
+			}
+			replicaDb, err := db.open(host, port, debug)
+			if err != nil {
+				for _, replicaDb := range replicas {
+					replicaDb.Close()
+				}
+				gormDb.Close()
+				return nil, errors.New(errMysqlNewHandler + ": replica '" + replica + "': " + err.Error())
+			}
+			replicas = append(replicas, replicaDb)
+		}
+		db.replicas = NewReplicaPool(replicas, replicaCheckInterval)
+	}
+	db.Db = gormDb
+	db.primary = gormDb
+	this.mutex.Lock()
+	if this.databases == nil {
+		this.databases = make(map[string]*MysqlDatabaseHandler)
+	}
+	this.databases[name] = db
+	this.mutex.Unlock()
 	return db, nil
 }
 
+// open connects to the primary or to a replica.
+func (this *MysqlDatabaseHandler) open(host string, port string, debug bool) (*gorm.DB, error) {
+	args := fmt.Sprintf(
+		"%s:%s@tcp(%s:%s)/%s?timeout=%s&writeTimeout=%s&readTimeout=%s&charset=utf8mb4,utf8&loc=%s&parseTime=true",
+		this.User,
+		this.Password,
+		host,
+		port,
+		this.Database,
+		this.WriteTimeout,
+		this.ReadTimeout,
+		this.Timeout,
+		url.QueryEscape(this.Timezone),
+	)
+	gormDb, err := gorm.Open("mysql", args)
+	if err != nil {
+		return nil, err
+	}
+	gormDb.DB().SetMaxOpenConns(this.MaxOpenConns)
+	gormDb.DB().SetMaxIdleConns(this.MaxIdleConns)
+	if debug {
+		gormDb = gormDb.Debug()
+	}
+	return gormDb, nil
+}
+
 func (this *MysqlHandler) GetHandler(name string) (DatabaseHandler, error) {
+	this.mutex.RLock()
 	handlerDatabase, ok := this.databases[name]
+	this.mutex.RUnlock()
 	if !ok {
 		return nil, errors.New(fmt.Sprintf(errMysqlConnectionNotExists, name))
 	}
@@ -218,6 +278,14 @@ type MysqlDatabaseHandler struct {
 	ReadTimeout  string
 	MaxOpenConns int
 	MaxIdleConns int
+	// Replicas are the addresses of the read replicas, sharing the user, the password and the database of the primary
+	Replicas []string
+
+	primary    *gorm.DB     // the primary the handler is created from
+	replicas   *ReplicaPool // the read replicas, nil if none
+	scopes     []func(*gorm.DB) *gorm.DB
+	onReplica  bool // Db is the result of a read on a replica
+	usePrimary bool
 }
 
 func (this *MysqlDatabaseHandler) GetConfig() map[string]interface{} {
@@ -233,29 +301,103 @@ func (this *MysqlDatabaseHandler) GetConfig() map[string]interface{} {
 		"write_timeout":  this.WriteTimeout,
 		"max_open_conns": this.MaxOpenConns,
 		"max_idle_conns": this.MaxIdleConns,
+		"replicas":       this.Replicas,
 	}
 }
 
 func (this *MysqlDatabaseHandler) New() DatabaseHandler {
+	if this.primary == nil {
+		return &MysqlDatabaseHandler{
+			Db: this.Db.New(),
+		}
+	}
 	return &MysqlDatabaseHandler{
-		Db: this.Db.New(),
+		Db:       withContext(this.primary.New(), contextOf(this.Db)),
+		primary:  this.primary,
+		replicas: this.replicas,
 	}
 }
+
+// WithContext returns a copy of the handler running its statements with ctx, on the primary and on the replicas,
+// the running statement is canceled and the transaction rolled back when ctx is done.
+func (this *MysqlDatabaseHandler) WithContext(ctx context.Context) DatabaseHandler {
+	handler := *this
+	handler.Db = withContext(this.Db, ctx)
+	handler.scopes = append([]func(*gorm.DB) *gorm.DB{}, this.scopes...)
+	return &handler
+}
 func (this *MysqlDatabaseHandler) Close() error {
+	if this.replicas != nil {
+		this.replicas.Close()
+	}
+	if this.primary != nil {
+		return this.primary.Close()
+	}
 	return this.Db.Close()
 }
-func (this *MysqlDatabaseHandler) Model(value interface{}) DatabaseHandler {
-	this.Db = this.Db.Model(value)
+
+// UsePrimary routes the following reads of the handler to the primary, for the consistency of the reads after the writes.
+func (this *MysqlDatabaseHandler) UsePrimary() DatabaseHandler {
+	this.usePrimary = true
 	return this
 }
-func (this *MysqlDatabaseHandler) Table(name string) DatabaseHandler {
-	this.Db = this.Db.Table(name)
+
+// chain applies the query builder to the handler, the builders are replayed on the replica reading the records.
+func (this *MysqlDatabaseHandler) chain(builder func(*gorm.DB) *gorm.DB) DatabaseHandler {
+	db := this.writer()
+	if this.replicas != nil {
+		this.scopes = append(this.scopes, builder)
+	}
+	this.Db = builder(db)
 	return this
 }
-func (this *MysqlDatabaseHandler) Debug() DatabaseHandler {
-	this.Db = this.Db.Debug()
+
+// read runs the query on a healthy replica, or on the primary if none, if UsePrimary is called
+// or if the replica fails with a connection error.
+func (this *MysqlDatabaseHandler) read(query func(*gorm.DB) *gorm.DB) DatabaseHandler {
+	if replica := this.replica(); replica != nil {
+		db := query(withContext(replica.New(), contextOf(this.Db)).Scopes(this.scopes...))
+		if !this.replicas.Failed(replica, db.Error) {
+			this.Db = db
+			this.onReplica = true
+			return this
+		}
+	}
+	this.Db = query(this.writer())
 	return this
 }
+
+// replica returns the replica reading the records, nil if the reads are routed to the primary.
+func (this *MysqlDatabaseHandler) replica() *gorm.DB {
+	if this.replicas == nil || this.usePrimary {
+		return nil
+	}
+	return this.replicas.Get()
+}
+
+// writer returns the query built on the primary.
+func (this *MysqlDatabaseHandler) writer() *gorm.DB {
+	if this.onReplica {
+		this.onReplica = false
+		return withContext(this.primary.New(), contextOf(this.Db)).Scopes(this.scopes...)
+	}
+	return this.Db
+}
+func (this *MysqlDatabaseHandler) Model(value interface{}) DatabaseHandler {
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Model(value)
+	})
+}
+func (this *MysqlDatabaseHandler) Table(name string) DatabaseHandler {
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Table(name)
+	})
+}
+func (this *MysqlDatabaseHandler) Debug() DatabaseHandler {
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Debug()
+	})
+}
 func (this *MysqlDatabaseHandler) Error() error {
 	return this.Db.Error
 }
@@ -263,6 +405,18 @@ func (this *MysqlDatabaseHandler) Callback() DatabaseCallback {
 	return this.Db.Callback()
 }
 
+// Stats returns the stats of the connection pool of the primary.
+func (this *MysqlDatabaseHandler) Stats() sql.DBStats {
+	db := this.Db
+	if this.primary != nil {
+		db = this.primary
+	}
+	if sqlDb := sqlDBOf(db); sqlDb != nil {
+		return sqlDb.Stats()
+	}
+	return sql.DBStats{}
+}
+
 func (this *MysqlDatabaseHandler) NewRecord(value interface{}) bool {
 	return this.Db.NewRecord(value)
 }
@@ -272,190 +426,238 @@ func (this *MysqlDatabaseHandler) RecordNotFound() bool {
 
 //Table
 func (this *MysqlDatabaseHandler) CreateTable(models ...interface{}) DatabaseHandler {
-	this.Db = this.Db.CreateTable(models...)
+	this.Db = this.writer().CreateTable(models...)
 	return this
 }
 func (this *MysqlDatabaseHandler) Set(name string, value interface{}) DatabaseHandler {
-	this.Db = this.Db.Set(name, value)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Set(name, value)
+	})
 }
 func (this *MysqlDatabaseHandler) AutoMigrate(values ...interface{}) DatabaseHandler {
-	this.Db = this.Db.AutoMigrate(values...)
+	this.Db = this.writer().AutoMigrate(values...)
 	return this
 }
 func (this *MysqlDatabaseHandler) DropTable(values ...interface{}) DatabaseHandler {
-	this.Db = this.Db.DropTable(values...)
+	this.Db = this.writer().DropTable(values...)
 	return this
 }
 func (this *MysqlDatabaseHandler) DropTableIfExists(values ...interface{}) DatabaseHandler {
-	this.Db = this.Db.DropTableIfExists(values...)
+	this.Db = this.writer().DropTableIfExists(values...)
 	return this
 }
 func (this *MysqlDatabaseHandler) HasTable(value interface{}) bool {
-	return this.Db.HasTable(value)
+	return this.writer().HasTable(value)
 }
 func (this *MysqlDatabaseHandler) ModifyColumn(column string, typ string) DatabaseHandler {
-	this.Db = this.Db.ModifyColumn(column, typ)
+	this.Db = this.writer().ModifyColumn(column, typ)
 	return this
 }
 func (this *MysqlDatabaseHandler) DropColumn(column string) DatabaseHandler {
-	this.Db = this.Db.DropColumn(column)
+	this.Db = this.writer().DropColumn(column)
 	return this
 }
 func (this *MysqlDatabaseHandler) AddIndex(indexName string, columns ...string) DatabaseHandler {
-	this.Db = this.Db.AddIndex(indexName, columns...)
+	this.Db = this.writer().AddIndex(indexName, columns...)
 	return this
 }
 func (this *MysqlDatabaseHandler) AddUniqueIndex(indexName string, columns ...string) DatabaseHandler {
-	this.Db = this.Db.AddUniqueIndex(indexName, columns...)
+	this.Db = this.writer().AddUniqueIndex(indexName, columns...)
 	return this
 }
 func (this *MysqlDatabaseHandler) RemoveIndex(indexName string) DatabaseHandler {
-	this.Db = this.Db.RemoveIndex(indexName)
+	this.Db = this.writer().RemoveIndex(indexName)
 	return this
 }
 func (this *MysqlDatabaseHandler) AddForeignKey(field string, dest string, onDelete string, onUpdate string) DatabaseHandler {
-	this.Db = this.Db.AddForeignKey(field, dest, onDelete, onUpdate)
+	this.Db = this.writer().AddForeignKey(field, dest, onDelete, onUpdate)
 	return this
 }
 
 // Query
 func (this *MysqlDatabaseHandler) Where(query interface{}, args ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Where(query, args...)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Where(query, args...)
+	})
 }
 func (this *MysqlDatabaseHandler) Or(query interface{}, args ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Or(query, args...)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Or(query, args...)
+	})
 }
 func (this *MysqlDatabaseHandler) Not(query interface{}, args ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Not(query, args...)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Not(query, args...)
+	})
 }
 func (this *MysqlDatabaseHandler) Limit(limit interface{}) DatabaseHandler {
-	this.Db = this.Db.Limit(limit)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Limit(limit)
+	})
 }
 func (this *MysqlDatabaseHandler) Offset(offset interface{}) DatabaseHandler {
-	this.Db = this.Db.Offset(offset)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Offset(offset)
+	})
 }
 func (this *MysqlDatabaseHandler) Order(value interface{}, reorder ...bool) DatabaseHandler {
-	this.Db = this.Db.Order(value, reorder...)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Order(value, reorder...)
+	})
 }
 func (this *MysqlDatabaseHandler) Select(query interface{}, args ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Select(query, args...)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Select(query, args...)
+	})
 }
 func (this *MysqlDatabaseHandler) Omit(columns ...string) DatabaseHandler {
-	this.Db = this.Db.Omit(columns...)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Omit(columns...)
+	})
 }
 func (this *MysqlDatabaseHandler) Having(query string, values ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Having(query, values...)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Having(query, values...)
+	})
 }
 func (this *MysqlDatabaseHandler) Joins(query string, args ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Joins(query, args...)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Joins(query, args...)
+	})
 }
 func (this *MysqlDatabaseHandler) Find(out interface{}, where ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Find(out, where...)
-	return this
+	return this.read(func(db *gorm.DB) *gorm.DB {
+		return db.Find(out, where...)
+	})
 }
 func (this *MysqlDatabaseHandler) First(out interface{}, where ...interface{}) DatabaseHandler {
-	this.Db = this.Db.First(out, where...)
-	return this
+	return this.read(func(db *gorm.DB) *gorm.DB {
+		return db.First(out, where...)
+	})
 }
 func (this *MysqlDatabaseHandler) Last(out interface{}, where ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Last(out, where...)
-	return this
+	return this.read(func(db *gorm.DB) *gorm.DB {
+		return db.Last(out, where...)
+	})
 }
 func (this *MysqlDatabaseHandler) Row() *sql.Row {
-	return this.Db.Row()
+	if replica := this.replica(); replica != nil {
+		// the error of a row is only known by its Scan, the replica is checked first
+		if !this.replicas.Failed(replica, replica.DB().Ping()) {
+			return withContext(replica.New(), contextOf(this.Db)).Scopes(this.scopes...).Row()
+		}
+	}
+	return this.writer().Row()
 }
 func (this *MysqlDatabaseHandler) Rows() (*sql.Rows, error) {
-	return this.Db.Rows()
+	if replica := this.replica(); replica != nil {
+		rows, err := withContext(replica.New(), contextOf(this.Db)).Scopes(this.scopes...).Rows()
+		if !this.replicas.Failed(replica, err) {
+			return rows, err
+		}
+	}
+	return this.writer().Rows()
 }
 func (this *MysqlDatabaseHandler) Pluck(column string, value interface{}) DatabaseHandler {
-	this.Db = this.Db.Pluck(column, value)
-	return this
+	return this.read(func(db *gorm.DB) *gorm.DB {
+		return db.Pluck(column, value)
+	})
 }
 func (this *MysqlDatabaseHandler) Count(value interface{}) DatabaseHandler {
-	this.Db = this.Db.Count(value)
-	return this
+	return this.read(func(db *gorm.DB) *gorm.DB {
+		return db.Count(value)
+	})
 }
 
 func (this *MysqlDatabaseHandler) Related(value interface{}, foreignKeys ...string) DatabaseHandler {
-	this.Db = this.Db.Related(value, foreignKeys...)
-	return this
+	return this.read(func(db *gorm.DB) *gorm.DB {
+		return db.Related(value, foreignKeys...)
+	})
 }
 func (this *MysqlDatabaseHandler) Scan(dest interface{}) DatabaseHandler {
-	this.Db = this.Db.Scan(dest)
-	return this
+	return this.read(func(db *gorm.DB) *gorm.DB {
+		return db.Scan(dest)
+	})
 }
 
 // Update
 func (this *MysqlDatabaseHandler) Update(attrs ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Update(attrs...)
+	this.Db = this.writer().Update(attrs...)
 	return this
 }
 func (this *MysqlDatabaseHandler) Updates(values interface{}, ignoreProtectedAttrs ...bool) DatabaseHandler {
-	this.Db = this.Db.Updates(values)
+	this.Db = this.writer().Updates(values)
 	return this
 }
 func (this *MysqlDatabaseHandler) UpdateColumn(attrs ...interface{}) DatabaseHandler {
-	this.Db = this.Db.UpdateColumn(attrs...)
+	this.Db = this.writer().UpdateColumn(attrs...)
 	return this
 }
 func (this *MysqlDatabaseHandler) UpdateColumns(values interface{}) DatabaseHandler {
-	this.Db = this.Db.UpdateColumns(values)
+	this.Db = this.writer().UpdateColumns(values)
 	return this
 }
 func (this *MysqlDatabaseHandler) Save(value interface{}) DatabaseHandler {
-	this.Db = this.Db.Save(value)
+	this.Db = this.writer().Save(value)
 	return this
 }
 
 // Insert
 func (this *MysqlDatabaseHandler) Create(value interface{}) DatabaseHandler {
-	this.Db = this.Db.Create(value)
+	this.Db = this.writer().Create(value)
 	return this
 }
 
 // Delete
 func (this *MysqlDatabaseHandler) Delete(value interface{}, where ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Delete(value, where...)
+	this.Db = this.writer().Delete(value, where...)
 	return this
 }
 
 //Unscoped
 func (this *MysqlDatabaseHandler) Unscoped() DatabaseHandler {
-	this.Db = this.Db.Unscoped()
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	})
 }
 
 //Scoped
 func (this *MysqlDatabaseHandler) Scopes(funcs ...func(*gorm.DB) *gorm.DB) DatabaseHandler {
-	this.Db = this.Db.Scopes(funcs...)
-	return this
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(funcs...)
+	})
 }
 
 // Raw Sql
+// Raw routes the statement to the primary since it may write, see RawRead for the reads.
+// It returns a copy of the handler, the handler itself keeps reading on the replicas.
 func (this *MysqlDatabaseHandler) Raw(sql string, values ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Raw(sql, values...)
-	return this
+	handler := *this
+	handler.usePrimary = true
+	handler.scopes = append([]func(*gorm.DB) *gorm.DB{}, this.scopes...)
+	return handler.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Raw(sql, values...)
+	})
+}
+
+// RawRead is Raw for a read only statement, balanced between the replicas like the other reads.
+func (this *MysqlDatabaseHandler) RawRead(sql string, values ...interface{}) DatabaseHandler {
+	return this.chain(func(db *gorm.DB) *gorm.DB {
+		return db.Raw(sql, values...)
+	})
 }
 func (this *MysqlDatabaseHandler) Exec(sql string, values ...interface{}) DatabaseHandler {
-	this.Db = this.Db.Exec(sql, values...)
+	this.Db = this.writer().Exec(sql, values...)
 	return this
 }
 
 // Transaction
+func (this *MysqlDatabaseHandler) Transaction(ctx context.Context, fn func(tx DatabaseHandler) error, setters ...TransactionOption) error {
+	return transaction(this, this.Db, ctx, fn, setters...)
+}
 func (this *MysqlDatabaseHandler) Begin() DatabaseHandler {
 	tx := &MysqlDatabaseHandler{
-		Db: this.Db.Begin(),
+		Db: begin(this.writer()),
 	}
 	return tx
 }
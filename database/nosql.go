@@ -0,0 +1,257 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+// NosqlCell is a version of the value of a column.
+type NosqlCell struct {
+	Row       string
+	Family    string
+	Qualifier string
+	Value     []byte
+	Timestamp uint64 // milliseconds since the epoch
+}
+
+// NosqlRow is a row read by Get or by a scanner, its cells are in the order of the columns, latest version first.
+type NosqlRow struct {
+	Key   string
+	Cells []*NosqlCell
+}
+
+// Value returns the latest version of the value of the column family:qualifier.
+func (r *NosqlRow) Value(family string, qualifier string) ([]byte, bool) {
+	var latest *NosqlCell
+	for _, cell := range r.Cells {
+		if cell.Family == family && cell.Qualifier == qualifier && (latest == nil || cell.Timestamp > latest.Timestamp) {
+			latest = cell
+		}
+	}
+	if latest == nil {
+		return nil, false
+	}
+	return latest.Value, true
+}
+
+// Values returns the latest version of the values of the row by family and qualifier, as the values of Put.
+func (r *NosqlRow) Values() map[string]map[string][]byte {
+	values := make(map[string]map[string][]byte)
+	timestamps := make(map[string]uint64)
+	for _, cell := range r.Cells {
+		if _, ok := values[cell.Family]; !ok {
+			values[cell.Family] = make(map[string][]byte)
+		}
+		column := cell.Family + ":" + cell.Qualifier
+		if timestamp, ok := timestamps[column]; !ok || cell.Timestamp > timestamp {
+			values[cell.Family][cell.Qualifier] = cell.Value
+			timestamps[column] = cell.Timestamp
+		}
+	}
+	return values
+}
+
+// newNosqlRow converts the result of hbase, nil if it has no cells.
+func newNosqlRow(result *hrpc.Result) *NosqlRow {
+	if result == nil || len(result.Cells) == 0 {
+		return nil
+	}
+	row := &NosqlRow{
+		Key:   string(result.Cells[0].Row),
+		Cells: make([]*NosqlCell, len(result.Cells)),
+	}
+	for index, cell := range result.Cells {
+		row.Cells[index] = &NosqlCell{
+			Row:       string(cell.Row),
+			Family:    string(cell.Family),
+			Qualifier: string(cell.Qualifier),
+			Value:     cell.Value,
+		}
+		if cell.Timestamp != nil {
+			row.Cells[index].Timestamp = *cell.Timestamp
+		}
+	}
+	return row
+}
+
+type (
+	// NosqlQueryOptions select the rows and the cells read by Scan and Get,
+	// the row range, the caching, the limit and the order only apply to Scan.
+	NosqlQueryOptions struct {
+		StartRow      string
+		StopRow       string
+		Families      map[string][]string
+		Filter        filter.Filter
+		TimeRangeFrom time.Time
+		TimeRangeTo   time.Time
+		MaxVersions   uint32
+		Caching       uint32
+		Limit         int
+		Reversed      bool
+	}
+
+	NosqlQueryOption func(*NosqlQueryOptions)
+)
+
+// NosqlRange scans the rows from startRow included to stopRow excluded, an empty row being unbounded.
+func NosqlRange(startRow string, stopRow string) NosqlQueryOption {
+	return func(options *NosqlQueryOptions) {
+		options.StartRow = startRow
+		options.StopRow = stopRow
+	}
+}
+
+// NosqlPrefix scans the rows whose key starts with prefix.
+func NosqlPrefix(prefix string) NosqlQueryOption {
+	return func(options *NosqlQueryOptions) {
+		options.StartRow = prefix
+		options.StopRow = prefixStopRow(prefix)
+	}
+}
+
+// NosqlFamilies reads the qualifiers of the families only, all the qualifiers of a family if they are empty.
+func NosqlFamilies(families map[string][]string) NosqlQueryOption {
+	return func(options *NosqlQueryOptions) {
+		options.Families = families
+	}
+}
+
+// NosqlFilter reads the cells passing f only.
+func NosqlFilter(f filter.Filter) NosqlQueryOption {
+	return func(options *NosqlQueryOptions) {
+		options.Filter = f
+	}
+}
+
+// NosqlTimeRange reads the versions written from from included to to excluded.
+func NosqlTimeRange(from time.Time, to time.Time) NosqlQueryOption {
+	return func(options *NosqlQueryOptions) {
+		options.TimeRangeFrom = from
+		options.TimeRangeTo = to
+	}
+}
+
+// NosqlMaxVersions reads up to versions versions of each column, 1 by default.
+func NosqlMaxVersions(versions uint32) NosqlQueryOption {
+	return func(options *NosqlQueryOptions) {
+		options.MaxVersions = versions
+	}
+}
+
+// NosqlCaching sets the number of rows fetched by each RPC of the scanner.
+func NosqlCaching(rows uint32) NosqlQueryOption {
+	return func(options *NosqlQueryOptions) {
+		options.Caching = rows
+	}
+}
+
+// NosqlLimit stops the scanner after limit rows.
+func NosqlLimit(limit int) NosqlQueryOption {
+	return func(options *NosqlQueryOptions) {
+		options.Limit = limit
+	}
+}
+
+// NosqlReversed scans the rows in the reverse order, from StartRow down to StopRow.
+func NosqlReversed() NosqlQueryOption {
+	return func(options *NosqlQueryOptions) {
+		options.Reversed = true
+	}
+}
+
+func newNosqlQueryOptions(setters ...NosqlQueryOption) *NosqlQueryOptions {
+	options := &NosqlQueryOptions{}
+	for _, setter := range setters {
+		setter(options)
+	}
+	return options
+}
+
+// hrpcOptions returns the options of the hbase query, of a scan if scan is true or else of a get.
+func (o *NosqlQueryOptions) hrpcOptions(scan bool) []func(hrpc.Call) error {
+	options := make([]func(hrpc.Call) error, 0)
+	if len(o.Families) > 0 {
+		options = append(options, hrpc.Families(o.Families))
+	}
+	if o.Filter != nil {
+		options = append(options, hrpc.Filters(o.Filter))
+	}
+	if !o.TimeRangeFrom.IsZero() || !o.TimeRangeTo.IsZero() {
+		// an unset bound is unbounded, hbase timestamps are in milliseconds
+		from, to := uint64(0), uint64(math.MaxInt64)
+		if !o.TimeRangeFrom.IsZero() {
+			from = uint64(o.TimeRangeFrom.UnixNano() / 1e6)
+		}
+		if !o.TimeRangeTo.IsZero() {
+			to = uint64(o.TimeRangeTo.UnixNano() / 1e6)
+		}
+		options = append(options, hrpc.TimeRangeUint64(from, to))
+	}
+	if o.MaxVersions > 0 {
+		options = append(options, hrpc.MaxVersions(o.MaxVersions))
+	}
+	if scan {
+		if o.Caching > 0 {
+			options = append(options, hrpc.NumberOfRows(o.Caching))
+		}
+		if o.Reversed {
+			options = append(options, hrpc.Reversed())
+		}
+	}
+	return options
+}
+
+// prefixStopRow returns the first row after the rows starting with prefix, empty if unbounded.
+func prefixStopRow(prefix string) string {
+	stopRow := []byte(prefix)
+	for i := len(stopRow) - 1; i >= 0; i-- {
+		if stopRow[i] < 0xff {
+			stopRow[i]++
+			return string(stopRow[:i+1])
+		}
+	}
+	return ""
+}
+
+// NosqlRecordNotFound tests if err is returned for a row not found.
+func NosqlRecordNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "record not found")
+}
+
+// sortedRowKeys returns the keys of the rows of a batch, sorted as hbase sorts the rows.
+func sortedRowKeys(rows map[string]map[string]map[string][]byte) []string {
+	keys := make([]string, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// batch runs fn for the indexes from 0 to n concurrently, and returns the first error.
+func batch(n int, fn func(index int) error) error {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	wg.Add(n)
+	for index := 0; index < n; index++ {
+		go func(index int) {
+			defer wg.Done()
+			if err := fn(index); err != nil {
+				once.Do(func() {
+					firstErr = err
+				})
+			}
+		}(index)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+)
+
+func TestNosqlRow(t *testing.T) {
+	assert.Nil(t, newNosqlRow(nil))
+	assert.Nil(t, newNosqlRow(&hrpc.Result{}))
+
+	older, newer := uint64(1), uint64(2)
+	row := newNosqlRow(&hrpc.Result{Cells: []*hrpc.Cell{
+		{Row: []byte("user1"), Family: []byte("info"), Qualifier: []byte("name"), Value: []byte("Bob"), Timestamp: &newer},
+		{Row: []byte("user1"), Family: []byte("info"), Qualifier: []byte("name"), Value: []byte("Alice"), Timestamp: &older},
+		{Row: []byte("user1"), Family: []byte("info"), Qualifier: []byte("age"), Value: []byte("20")},
+	}})
+	assert.Equal(t, "user1", row.Key)
+	assert.Len(t, row.Cells, 3)
+	assert.Equal(t, uint64(2), row.Cells[0].Timestamp)
+
+	value, ok := row.Value("info", "name")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("Bob"), value)
+	_, ok = row.Value("info", "email")
+	assert.False(t, ok)
+	assert.Equal(t, map[string]map[string][]byte{
+		"info": {"name": []byte("Bob"), "age": []byte("20")},
+	}, row.Values())
+}
+
+func TestNosqlQueryOptions(t *testing.T) {
+	from := time.Unix(100, 0)
+	options := newNosqlQueryOptions(
+		NosqlPrefix("user"),
+		NosqlFamilies(map[string][]string{"info": {"name"}}),
+		NosqlFilter(filter.NewPrefixFilter([]byte("user"))),
+		NosqlTimeRange(from, time.Time{}),
+		NosqlMaxVersions(3),
+		NosqlCaching(100),
+		NosqlLimit(10),
+	)
+	assert.Equal(t, "user", options.StartRow)
+	assert.Equal(t, "uses", options.StopRow)
+	assert.Equal(t, 10, options.Limit)
+
+	scan, err := hrpc.NewScanRangeStr(context.Background(), "users", options.StartRow, options.StopRow, options.hrpcOptions(true)...)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("user"), scan.StartRow())
+	assert.Equal(t, []byte("uses"), scan.StopRow())
+	assert.Equal(t, uint32(100), scan.NumberOfRows())
+	assert.False(t, scan.Reversed())
+	// the request is serialized for a region
+	regionInfo := region.NewInfo(0, nil, []byte("users"), []byte("users,,1"), nil, nil)
+	scan.SetRegion(regionInfo)
+	scanRequest := scan.ToProto().(*pb.ScanRequest)
+	assert.Equal(t, uint32(3), scanRequest.Scan.GetMaxVersions())
+	assert.Equal(t, uint64(100000), scanRequest.Scan.TimeRange.GetFrom())
+	assert.NotNil(t, scanRequest.Scan.Filter)
+	assert.Len(t, scanRequest.Scan.Column, 1)
+
+	// the options of the scanner only are ignored by Get
+	get, err := hrpc.NewGetStr(context.Background(), "users", "user1", newNosqlQueryOptions(NosqlMaxVersions(2), NosqlCaching(100), NosqlReversed()).hrpcOptions(false)...)
+	assert.Nil(t, err)
+	get.SetRegion(regionInfo)
+	assert.Equal(t, uint32(2), get.ToProto().(*pb.GetRequest).Get.GetMaxVersions())
+
+	scan, err = hrpc.NewScanStr(context.Background(), "users", newNosqlQueryOptions(NosqlReversed()).hrpcOptions(true)...)
+	assert.Nil(t, err)
+	assert.True(t, scan.Reversed())
+}
+
+func TestPrefixStopRow(t *testing.T) {
+	assert.Equal(t, "ab", prefixStopRow("aa"))
+	assert.Equal(t, "b", prefixStopRow("a\xff"))
+	assert.Equal(t, "", prefixStopRow("\xff\xff"))
+	assert.Equal(t, "", prefixStopRow(""))
+}
+
+func TestBatch(t *testing.T) {
+	results := make([]int, 5)
+	assert.Nil(t, batch(len(results), func(index int) error {
+		results[index] = index * index
+		return nil
+	}))
+	assert.Equal(t, []int{0, 1, 4, 9, 16}, results)
+
+	err := batch(3, func(index int) error {
+		if index == 1 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "failed")
+	assert.Nil(t, batch(0, nil))
+}
+
+func TestNosqlRecordNotFound(t *testing.T) {
+	assert.True(t, NosqlRecordNotFound(errors.New(errHbaseRecordNotFound+": user1")))
+	assert.False(t, NosqlRecordNotFound(errors.New(errHbaseGet)))
+	assert.False(t, NosqlRecordNotFound(nil))
+}
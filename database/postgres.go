@@ -0,0 +1,500 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/lib/pq"
+)
+
+var (
+	errPostgresInitiate            = "database(postgres): initiate error"
+	errPostgresNewHandler          = "database(postgres): new handler error"
+	errPostgresConnectionNotExists = "database(postgres): '%s' handler not exists"
+)
+
+type PostgresHandler struct {
+	databases map[string]*PostgresDatabaseHandler
+	// mutex guards databases
+	mutex sync.RWMutex
+}
+
+func NewPostgresHandler() Handler {
+	return &PostgresHandler{}
+}
+
+func (this *PostgresHandler) Initiate(ctx context.Context) error {
+	this.databases = make(map[string]*PostgresDatabaseHandler)
+	return nil
+}
+
+func (this *PostgresHandler) NewHandler(name string, config map[string]interface{}) (DatabaseHandler, error) {
+	db := &PostgresDatabaseHandler{}
+	// Default
+	db.Port = "5432"
+	db.SSLMode = "disable"
+	db.Timezone = "Asia/Shanghai"
+	db.Timeout = "30s"
+	db.MaxOpenConns = 300
+	db.MaxIdleConns = 100
+	configHost := config["DATABASE_POSTGRES_HOST"]
+	if configHost != nil {
+		host, ok := configHost.(string)
+		if ok {
+			db.Host = host
+		} else {
+			return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_HOST")
+		}
+		if host == "" {
+			return nil, errors.New(errPostgresNewHandler + ": empty DATABASE_POSTGRES_HOST")
+		}
+	} else {
+		return nil, errors.New(errPostgresNewHandler + ": empty DATABASE_POSTGRES_HOST")
+	}
+	configPort, ok := config["DATABASE_POSTGRES_PORT"]
+	if ok && configPort != nil {
+		port, ok := configPort.(string)
+		if ok {
+			if port != "" {
+				db.Port = port
+			}
+		} else {
+			return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_PORT")
+		}
+	}
+	configUser, ok := config["DATABASE_POSTGRES_USER"]
+	if ok && configUser != nil {
+		user, ok := configUser.(string)
+		if ok {
+			db.User = user
+		} else {
+			return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_USER")
+		}
+		if user == "" {
+			return nil, errors.New(errPostgresNewHandler + ": empty config DATABASE_POSTGRES_USER")
+		}
+	}
+	configPassword, ok := config["DATABASE_POSTGRES_PASSWORD"]
+	if ok && configPassword != nil {
+		password, ok := configPassword.(string)
+		if ok {
+			db.Password = password
+		} else {
+			return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_PASSWORD")
+		}
+	}
+	configDatabase, ok := config["DATABASE_POSTGRES_DATABASE"]
+	if ok && configDatabase != nil {
+		database, ok := configDatabase.(string)
+		if ok {
+			db.Database = database
+		} else {
+			return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_DATABASE")
+		}
+		if database == "" {
+			return nil, errors.New(errPostgresNewHandler + ": empty config DATABASE_POSTGRES_DATABASE")
+		}
+	}
+	configSSLMode, ok := config["DATABASE_POSTGRES_SSLMODE"]
+	if ok && configSSLMode != nil {
+		sslMode, ok := configSSLMode.(string)
+		if ok {
+			if sslMode != "" {
+				db.SSLMode = sslMode
+			}
+		} else {
+			return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_SSLMODE")
+		}
+	}
+	configTimezone, ok := config["DATABASE_POSTGRES_TIMEZONE"]
+	if ok && configTimezone != nil {
+		timezone, ok := configTimezone.(string)
+		if ok {
+			if timezone != "" {
+				db.Timezone = timezone
+			}
+		} else {
+			return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_TIMEZONE")
+		}
+	}
+	configTimeout, ok := config["DATABASE_POSTGRES_TIMEOUT"]
+	if ok && configTimeout != nil {
+		timeout, ok := configTimeout.(string)
+		if ok {
+			if timeout != "" {
+				db.Timeout = timeout
+			}
+		} else {
+			return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_TIMEOUT")
+		}
+	}
+	timeout, err := time.ParseDuration(db.Timeout)
+	if err != nil {
+		return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_TIMEOUT")
+	}
+	configMaxOpenConns, ok := config["DATABASE_POSTGRES_MAX_OPEN_CONNS"]
+	if ok && configMaxOpenConns != nil {
+		maxOpenConns, ok := configMaxOpenConns.(int)
+		if ok {
+			if maxOpenConns != 0 {
+				db.MaxOpenConns = maxOpenConns
+			}
+		} else {
+			return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_MAX_OPEN_CONNS")
+		}
+	}
+	configMaxIdleConns, ok := config["DATABASE_POSTGRES_MAX_IDLE_CONNS"]
+	if ok && configMaxIdleConns != nil {
+		maxIdleConns, ok := configMaxIdleConns.(int)
+		if ok {
+			if maxIdleConns != 0 {
+				db.MaxIdleConns = maxIdleConns
+			}
+		} else {
+			return nil, errors.New(errPostgresNewHandler + ": invalid config DATABASE_POSTGRES_MAX_IDLE_CONNS")
+		}
+	}
+	args := fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s connect_timeout=%d TimeZone=%s",
+		postgresQuote(db.Host),
+		postgresQuote(db.Port),
+		postgresQuote(db.User),
+		postgresQuote(db.Password),
+		postgresQuote(db.Database),
+		postgresQuote(db.SSLMode),
+		int(timeout.Seconds()),
+		postgresQuote(db.Timezone),
+	)
+	gormDb, err := gorm.Open("postgres", args)
+	if err == nil {
+		gormDb.DB().SetMaxOpenConns(db.MaxOpenConns)
+		gormDb.DB().SetMaxIdleConns(db.MaxIdleConns)
+		configDebug := config["DATABASE_POSTGRES_DEBUG"]
+		if configDebug != nil {
+			if debug, ok := configDebug.(bool); ok {
+				if debug {
+					gormDb = gormDb.Debug()
+				}
+			} else {
+				return nil, errors.New(errPostgresNewHandler + ": invalid DATABASE_POSTGRES_DEBUG")
+			}
+		}
+		db.Db = gormDb
+		this.mutex.Lock()
+		if this.databases == nil {
+			this.databases = make(map[string]*PostgresDatabaseHandler)
+		}
+		this.databases[name] = db
+		this.mutex.Unlock()
+	} else {
+		return nil, errors.New(errPostgresNewHandler + ": " + err.Error())
+	}
+	return db, nil
+}
+
+func (this *PostgresHandler) GetHandler(name string) (DatabaseHandler, error) {
+	this.mutex.RLock()
+	handlerDatabase, ok := this.databases[name]
+	this.mutex.RUnlock()
+	if !ok {
+		return nil, errors.New(fmt.Sprintf(errPostgresConnectionNotExists, name))
+	}
+	return handlerDatabase, nil
+}
+
+// postgresQuote quotes the values of the connection string, as required by the empty values and the values with spaces.
+func postgresQuote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+type PostgresDatabaseHandler struct {
+	Db           *gorm.DB
+	User         string
+	Password     string
+	Host         string
+	Port         string
+	Database     string
+	SSLMode      string
+	Timezone     string
+	Timeout      string
+	MaxOpenConns int
+	MaxIdleConns int
+}
+
+func (this *PostgresDatabaseHandler) GetConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"host":           this.Host,
+		"port":           this.Port,
+		"user":           this.User,
+		"password":       this.Password,
+		"database":       this.Database,
+		"sslmode":        this.SSLMode,
+		"timezone":       this.Timezone,
+		"timeout":        this.Timeout,
+		"max_open_conns": this.MaxOpenConns,
+		"max_idle_conns": this.MaxIdleConns,
+	}
+}
+
+func (this *PostgresDatabaseHandler) New() DatabaseHandler {
+	return &PostgresDatabaseHandler{
+		Db: this.Db.New(),
+	}
+}
+
+// WithContext returns a copy of the handler running its statements with ctx,
+// the running statement is canceled and the transaction rolled back when ctx is done.
+func (this *PostgresDatabaseHandler) WithContext(ctx context.Context) DatabaseHandler {
+	return &PostgresDatabaseHandler{
+		Db: withContext(this.Db, ctx),
+	}
+}
+func (this *PostgresDatabaseHandler) Close() error {
+	return this.Db.Close()
+}
+func (this *PostgresDatabaseHandler) Model(value interface{}) DatabaseHandler {
+	this.Db = this.Db.Model(value)
+	return this
+}
+func (this *PostgresDatabaseHandler) Table(name string) DatabaseHandler {
+	this.Db = this.Db.Table(name)
+	return this
+}
+func (this *PostgresDatabaseHandler) Debug() DatabaseHandler {
+	this.Db = this.Db.Debug()
+	return this
+}
+
+// UsePrimary does nothing, the handler has no read replicas.
+func (this *PostgresDatabaseHandler) UsePrimary() DatabaseHandler {
+	return this
+}
+func (this *PostgresDatabaseHandler) Error() error {
+	return this.Db.Error
+}
+func (this *PostgresDatabaseHandler) Callback() DatabaseCallback {
+	return this.Db.Callback()
+}
+
+func (this *PostgresDatabaseHandler) Stats() sql.DBStats {
+	if db := sqlDBOf(this.Db); db != nil {
+		return db.Stats()
+	}
+	return sql.DBStats{}
+}
+
+func (this *PostgresDatabaseHandler) NewRecord(value interface{}) bool {
+	return this.Db.NewRecord(value)
+}
+func (this *PostgresDatabaseHandler) RecordNotFound() bool {
+	return this.Db.RecordNotFound()
+}
+
+// Table
+func (this *PostgresDatabaseHandler) CreateTable(models ...interface{}) DatabaseHandler {
+	this.Db = this.Db.CreateTable(models...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Set(name string, value interface{}) DatabaseHandler {
+	this.Db = this.Db.Set(name, value)
+	return this
+}
+func (this *PostgresDatabaseHandler) AutoMigrate(values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.AutoMigrate(values...)
+	return this
+}
+func (this *PostgresDatabaseHandler) DropTable(values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.DropTable(values...)
+	return this
+}
+func (this *PostgresDatabaseHandler) DropTableIfExists(values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.DropTableIfExists(values...)
+	return this
+}
+func (this *PostgresDatabaseHandler) HasTable(value interface{}) bool {
+	return this.Db.HasTable(value)
+}
+func (this *PostgresDatabaseHandler) ModifyColumn(column string, typ string) DatabaseHandler {
+	this.Db = this.Db.ModifyColumn(column, typ)
+	return this
+}
+func (this *PostgresDatabaseHandler) DropColumn(column string) DatabaseHandler {
+	this.Db = this.Db.DropColumn(column)
+	return this
+}
+func (this *PostgresDatabaseHandler) AddIndex(indexName string, columns ...string) DatabaseHandler {
+	this.Db = this.Db.AddIndex(indexName, columns...)
+	return this
+}
+func (this *PostgresDatabaseHandler) AddUniqueIndex(indexName string, columns ...string) DatabaseHandler {
+	this.Db = this.Db.AddUniqueIndex(indexName, columns...)
+	return this
+}
+func (this *PostgresDatabaseHandler) RemoveIndex(indexName string) DatabaseHandler {
+	this.Db = this.Db.RemoveIndex(indexName)
+	return this
+}
+func (this *PostgresDatabaseHandler) AddForeignKey(field string, dest string, onDelete string, onUpdate string) DatabaseHandler {
+	this.Db = this.Db.AddForeignKey(field, dest, onDelete, onUpdate)
+	return this
+}
+
+// Query
+func (this *PostgresDatabaseHandler) Where(query interface{}, args ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Where(query, args...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Or(query interface{}, args ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Or(query, args...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Not(query interface{}, args ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Not(query, args...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Limit(limit interface{}) DatabaseHandler {
+	this.Db = this.Db.Limit(limit)
+	return this
+}
+func (this *PostgresDatabaseHandler) Offset(offset interface{}) DatabaseHandler {
+	this.Db = this.Db.Offset(offset)
+	return this
+}
+func (this *PostgresDatabaseHandler) Order(value interface{}, reorder ...bool) DatabaseHandler {
+	this.Db = this.Db.Order(value, reorder...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Select(query interface{}, args ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Select(query, args...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Omit(columns ...string) DatabaseHandler {
+	this.Db = this.Db.Omit(columns...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Having(query string, values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Having(query, values...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Joins(query string, args ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Joins(query, args...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Find(out interface{}, where ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Find(out, where...)
+	return this
+}
+func (this *PostgresDatabaseHandler) First(out interface{}, where ...interface{}) DatabaseHandler {
+	this.Db = this.Db.First(out, where...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Last(out interface{}, where ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Last(out, where...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Row() *sql.Row {
+	return this.Db.Row()
+}
+func (this *PostgresDatabaseHandler) Rows() (*sql.Rows, error) {
+	return this.Db.Rows()
+}
+func (this *PostgresDatabaseHandler) Pluck(column string, value interface{}) DatabaseHandler {
+	this.Db = this.Db.Pluck(column, value)
+	return this
+}
+func (this *PostgresDatabaseHandler) Count(value interface{}) DatabaseHandler {
+	this.Db = this.Db.Count(value)
+	return this
+}
+
+func (this *PostgresDatabaseHandler) Related(value interface{}, foreignKeys ...string) DatabaseHandler {
+	this.Db = this.Db.Related(value, foreignKeys...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Scan(dest interface{}) DatabaseHandler {
+	this.Db = this.Db.Scan(dest)
+	return this
+}
+
+// Update
+func (this *PostgresDatabaseHandler) Update(attrs ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Update(attrs...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Updates(values interface{}, ignoreProtectedAttrs ...bool) DatabaseHandler {
+	this.Db = this.Db.Updates(values)
+	return this
+}
+func (this *PostgresDatabaseHandler) UpdateColumn(attrs ...interface{}) DatabaseHandler {
+	this.Db = this.Db.UpdateColumn(attrs...)
+	return this
+}
+func (this *PostgresDatabaseHandler) UpdateColumns(values interface{}) DatabaseHandler {
+	this.Db = this.Db.UpdateColumns(values)
+	return this
+}
+func (this *PostgresDatabaseHandler) Save(value interface{}) DatabaseHandler {
+	this.Db = this.Db.Save(value)
+	return this
+}
+
+// Insert
+func (this *PostgresDatabaseHandler) Create(value interface{}) DatabaseHandler {
+	this.Db = this.Db.Create(value)
+	return this
+}
+
+// Delete
+func (this *PostgresDatabaseHandler) Delete(value interface{}, where ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Delete(value, where...)
+	return this
+}
+
+// Unscoped
+func (this *PostgresDatabaseHandler) Unscoped() DatabaseHandler {
+	this.Db = this.Db.Unscoped()
+	return this
+}
+
+// Scoped
+func (this *PostgresDatabaseHandler) Scopes(funcs ...func(*gorm.DB) *gorm.DB) DatabaseHandler {
+	this.Db = this.Db.Scopes(funcs...)
+	return this
+}
+
+// Raw Sql
+func (this *PostgresDatabaseHandler) Raw(sql string, values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Raw(sql, values...)
+	return this
+}
+func (this *PostgresDatabaseHandler) Exec(sql string, values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Exec(sql, values...)
+	return this
+}
+
+// Transaction
+func (this *PostgresDatabaseHandler) Transaction(ctx context.Context, fn func(tx DatabaseHandler) error, setters ...TransactionOption) error {
+	return transaction(this, this.Db, ctx, fn, setters...)
+}
+func (this *PostgresDatabaseHandler) Begin() DatabaseHandler {
+	tx := &PostgresDatabaseHandler{
+		Db: begin(this.Db),
+	}
+	return tx
+}
+
+func (this *PostgresDatabaseHandler) Commit() DatabaseHandler {
+	this.Db = this.Db.Commit()
+	return this
+}
+
+func (this *PostgresDatabaseHandler) Rollback() DatabaseHandler {
+	this.Db = this.Db.Rollback()
+	return this
+}
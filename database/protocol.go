@@ -9,13 +9,15 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/juju/errors"
 	"github.com/ltick/tick-framework/config"
-	"github.com/tsuna/gohbase/hrpc"
+	"github.com/ltick/tick-framework/tracing"
+	"github.com/ltick/tick-framework/utility"
 )
 
 var (
 	errPrepare       = "database: prepare '%s' error"
 	errInitiate      = "database: initiate '%s' error"
 	errStartup       = "database: startup '%s' error"
+	errShutdown      = "database: shutdown '%s' error"
 	errRegister      = "database: register error"
 	errNosqlRegister = "database: register error"
 	errNosqlUse      = "database: register error"
@@ -35,24 +37,56 @@ type Database struct {
 	handler       Handler
 	nosqlProvider string
 	nosqlHandler  NosqlHandler
+	// Tracer traces the operations of the handlers when set
+	Tracer tracing.Tracer
+	// SlowQueryLog logs the statements slower than DATABASE_SLOW_QUERY_THRESHOLD, the standard logger if nil
+	SlowQueryLog utility.LogFunc
+	sharding     *Sharding
 }
 
 func (d *Database) Prepare(ctx context.Context) (context.Context, error) {
 	var configs map[string]config.Option = map[string]config.Option{
-		"DATABASE_PROVIDER":             config.Option{Type: config.String, EnvironmentKey: "DATABASE_PROVIDER"},
-		"DATABASE_MYSQL_HOST":           config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_HOST"},
-		"DATABASE_MYSQL_PORT":           config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_PORT"},
-		"DATABASE_MYSQL_USER":           config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_USER"},
-		"DATABASE_MYSQL_PASSWORD":       config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_PASSWORD"},
-		"DATABASE_MYSQL_DATABASE":       config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_DATABASE"},
-		"DATABASE_MYSQL_TIMEOUT":        config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_TIMEOUT"},
-		"DATABASE_MYSQL_MAX_OPEN_CONNS": config.Option{Type: config.Int, EnvironmentKey: "DATABASE_MYSQL_MAX_OPEN_CONNS"},
-		"DATABASE_MYSQL_MAX_IDLE_CONNS": config.Option{Type: config.Int, EnvironmentKey: "DATABASE_MYSQL_MAX_IDLE_CONNS"},
+		"DATABASE_PROVIDER":                     config.Option{Type: config.String, EnvironmentKey: "DATABASE_PROVIDER"},
+		"DATABASE_METRICS":                      config.Option{Type: config.Bool, EnvironmentKey: "DATABASE_METRICS"},
+		"DATABASE_SLOW_QUERY_THRESHOLD":         config.Option{Type: config.String, EnvironmentKey: "DATABASE_SLOW_QUERY_THRESHOLD"},
+		"DATABASE_MYSQL_HOST":                   config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_HOST"},
+		"DATABASE_MYSQL_PORT":                   config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_PORT"},
+		"DATABASE_MYSQL_USER":                   config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_USER"},
+		"DATABASE_MYSQL_PASSWORD":               config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_PASSWORD"},
+		"DATABASE_MYSQL_DATABASE":               config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_DATABASE"},
+		"DATABASE_MYSQL_TIMEOUT":                config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_TIMEOUT"},
+		"DATABASE_MYSQL_MAX_OPEN_CONNS":         config.Option{Type: config.Int, EnvironmentKey: "DATABASE_MYSQL_MAX_OPEN_CONNS"},
+		"DATABASE_MYSQL_MAX_IDLE_CONNS":         config.Option{Type: config.Int, EnvironmentKey: "DATABASE_MYSQL_MAX_IDLE_CONNS"},
+		"DATABASE_MYSQL_REPLICAS":               config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_REPLICAS"},
+		"DATABASE_MYSQL_REPLICA_CHECK_INTERVAL": config.Option{Type: config.String, EnvironmentKey: "DATABASE_MYSQL_REPLICA_CHECK_INTERVAL"},
 
-		"DATABASE_NOSQL_PROVIDER":   config.Option{Type: config.String, EnvironmentKey: "DATABASE_NOSQL_PROVIDER"},
-		"DATABASE_HBASE_HOST":       config.Option{Type: config.String, EnvironmentKey: "DATABASE_HBASE_HOST"},
-		"DATABASE_HBASE_TIMEOUT":    config.Option{Type: config.String, EnvironmentKey: "DATABASE_HBASE_TIMEOUT"},
-		"DATABASE_HBASE_MAX_ACTIVE": config.Option{Type: config.Int, EnvironmentKey: "DATABASE_HBASE_MAX_ACTIVE"},
+		"DATABASE_POSTGRES_HOST":           config.Option{Type: config.String, EnvironmentKey: "DATABASE_POSTGRES_HOST"},
+		"DATABASE_POSTGRES_PORT":           config.Option{Type: config.String, EnvironmentKey: "DATABASE_POSTGRES_PORT"},
+		"DATABASE_POSTGRES_USER":           config.Option{Type: config.String, EnvironmentKey: "DATABASE_POSTGRES_USER"},
+		"DATABASE_POSTGRES_PASSWORD":       config.Option{Type: config.String, EnvironmentKey: "DATABASE_POSTGRES_PASSWORD"},
+		"DATABASE_POSTGRES_DATABASE":       config.Option{Type: config.String, EnvironmentKey: "DATABASE_POSTGRES_DATABASE"},
+		"DATABASE_POSTGRES_SSLMODE":        config.Option{Type: config.String, EnvironmentKey: "DATABASE_POSTGRES_SSLMODE"},
+		"DATABASE_POSTGRES_TIMEZONE":       config.Option{Type: config.String, EnvironmentKey: "DATABASE_POSTGRES_TIMEZONE"},
+		"DATABASE_POSTGRES_TIMEOUT":        config.Option{Type: config.String, EnvironmentKey: "DATABASE_POSTGRES_TIMEOUT"},
+		"DATABASE_POSTGRES_MAX_OPEN_CONNS": config.Option{Type: config.Int, EnvironmentKey: "DATABASE_POSTGRES_MAX_OPEN_CONNS"},
+		"DATABASE_POSTGRES_MAX_IDLE_CONNS": config.Option{Type: config.Int, EnvironmentKey: "DATABASE_POSTGRES_MAX_IDLE_CONNS"},
+
+		"DATABASE_SQLITE_PATH":           config.Option{Type: config.String, EnvironmentKey: "DATABASE_SQLITE_PATH"},
+		"DATABASE_SQLITE_TIMEOUT":        config.Option{Type: config.String, EnvironmentKey: "DATABASE_SQLITE_TIMEOUT"},
+		"DATABASE_SQLITE_MAX_OPEN_CONNS": config.Option{Type: config.Int, EnvironmentKey: "DATABASE_SQLITE_MAX_OPEN_CONNS"},
+		"DATABASE_SQLITE_MAX_IDLE_CONNS": config.Option{Type: config.Int, EnvironmentKey: "DATABASE_SQLITE_MAX_IDLE_CONNS"},
+
+		"DATABASE_NOSQL_PROVIDER":     config.Option{Type: config.String, EnvironmentKey: "DATABASE_NOSQL_PROVIDER"},
+		"DATABASE_HBASE_HOST":         config.Option{Type: config.String, EnvironmentKey: "DATABASE_HBASE_HOST"},
+		"DATABASE_HBASE_TIMEOUT":      config.Option{Type: config.String, EnvironmentKey: "DATABASE_HBASE_TIMEOUT"},
+		"DATABASE_HBASE_MAX_ACTIVE":   config.Option{Type: config.Int, EnvironmentKey: "DATABASE_HBASE_MAX_ACTIVE"},
+		"DATABASE_HBASE_IDLE_TIMEOUT": config.Option{Type: config.String, EnvironmentKey: "DATABASE_HBASE_IDLE_TIMEOUT"},
+
+		"DATABASE_MEMORY_MAX_VERSIONS": config.Option{Type: config.Int, EnvironmentKey: "DATABASE_MEMORY_MAX_VERSIONS"},
+
+		"DATABASE_SHARDS":       config.Option{Type: config.String, EnvironmentKey: "DATABASE_SHARDS"},
+		"DATABASE_SHARD_FUNC":   config.Option{Type: config.String, EnvironmentKey: "DATABASE_SHARD_FUNC"},
+		"DATABASE_SHARD_RANGES": config.Option{Type: config.String, EnvironmentKey: "DATABASE_SHARD_RANGES"},
 	}
 	err := d.Config.SetOptions(configs)
 	if err != nil {
@@ -66,6 +100,14 @@ func (d *Database) Initiate(ctx context.Context) (context.Context, error) {
 	if err != nil {
 		return ctx, errors.Annotate(err, fmt.Sprintf(errInitiate, d.provider))
 	}
+	err = Register("postgres", NewPostgresHandler)
+	if err != nil {
+		return ctx, errors.Annotate(err, fmt.Sprintf(errInitiate, d.provider))
+	}
+	err = Register("sqlite3", NewSqliteHandler)
+	if err != nil {
+		return ctx, errors.Annotate(err, fmt.Sprintf(errInitiate, d.provider))
+	}
 	err = d.Use(ctx, "mysql")
 	if err != nil {
 		return ctx, errors.Annotate(err, fmt.Sprintf(errInitiate, d.provider))
@@ -74,11 +116,21 @@ func (d *Database) Initiate(ctx context.Context) (context.Context, error) {
 	if err != nil {
 		return ctx, errors.Annotate(err, fmt.Sprintf(errInitiate, d.nosqlProvider))
 	}
+	err = NosqlRegister("memory", NewMemoryHandler)
+	if err != nil {
+		return ctx, errors.Annotate(err, fmt.Sprintf(errInitiate, d.nosqlProvider))
+	}
 	err = d.NosqlUse(ctx, "hbase")
 	if err != nil {
 		return ctx, errors.Annotate(err, fmt.Sprintf(errInitiate, d.nosqlProvider))
 	}
 	d.configs = make(map[string]interface{})
+	if _, ok := d.configs["DATABASE_METRICS"]; !ok {
+		d.configs["DATABASE_METRICS"] = d.Config.GetBool("DATABASE_METRICS")
+	}
+	if _, ok := d.configs["DATABASE_SLOW_QUERY_THRESHOLD"]; !ok {
+		d.configs["DATABASE_SLOW_QUERY_THRESHOLD"] = d.Config.GetString("DATABASE_SLOW_QUERY_THRESHOLD")
+	}
 	if _, ok := d.configs["DATABASE_MYSQL_HOST"]; !ok {
 		d.configs["DATABASE_MYSQL_HOST"] = d.Config.GetString("DATABASE_MYSQL_HOST")
 	}
@@ -112,6 +164,54 @@ func (d *Database) Initiate(ctx context.Context) (context.Context, error) {
 	if _, ok := d.configs["DATABASE_MYSQL_MAX_IDLE_CONNS"]; !ok {
 		d.configs["DATABASE_MYSQL_MAX_IDLE_CONNS"] = d.Config.GetInt("DATABASE_MYSQL_MAX_IDLE_CONNS")
 	}
+	if _, ok := d.configs["DATABASE_MYSQL_REPLICAS"]; !ok {
+		d.configs["DATABASE_MYSQL_REPLICAS"] = d.Config.GetString("DATABASE_MYSQL_REPLICAS")
+	}
+	if _, ok := d.configs["DATABASE_MYSQL_REPLICA_CHECK_INTERVAL"]; !ok {
+		d.configs["DATABASE_MYSQL_REPLICA_CHECK_INTERVAL"] = d.Config.GetString("DATABASE_MYSQL_REPLICA_CHECK_INTERVAL")
+	}
+	if _, ok := d.configs["DATABASE_POSTGRES_HOST"]; !ok {
+		d.configs["DATABASE_POSTGRES_HOST"] = d.Config.GetString("DATABASE_POSTGRES_HOST")
+	}
+	if _, ok := d.configs["DATABASE_POSTGRES_PORT"]; !ok {
+		d.configs["DATABASE_POSTGRES_PORT"] = d.Config.GetString("DATABASE_POSTGRES_PORT")
+	}
+	if _, ok := d.configs["DATABASE_POSTGRES_USER"]; !ok {
+		d.configs["DATABASE_POSTGRES_USER"] = d.Config.GetString("DATABASE_POSTGRES_USER")
+	}
+	if _, ok := d.configs["DATABASE_POSTGRES_PASSWORD"]; !ok {
+		d.configs["DATABASE_POSTGRES_PASSWORD"] = d.Config.GetString("DATABASE_POSTGRES_PASSWORD")
+	}
+	if _, ok := d.configs["DATABASE_POSTGRES_DATABASE"]; !ok {
+		d.configs["DATABASE_POSTGRES_DATABASE"] = d.Config.GetString("DATABASE_POSTGRES_DATABASE")
+	}
+	if _, ok := d.configs["DATABASE_POSTGRES_SSLMODE"]; !ok {
+		d.configs["DATABASE_POSTGRES_SSLMODE"] = d.Config.GetString("DATABASE_POSTGRES_SSLMODE")
+	}
+	if _, ok := d.configs["DATABASE_POSTGRES_TIMEZONE"]; !ok {
+		d.configs["DATABASE_POSTGRES_TIMEZONE"] = d.Config.GetString("DATABASE_POSTGRES_TIMEZONE")
+	}
+	if _, ok := d.configs["DATABASE_POSTGRES_TIMEOUT"]; !ok {
+		d.configs["DATABASE_POSTGRES_TIMEOUT"] = d.Config.GetString("DATABASE_POSTGRES_TIMEOUT")
+	}
+	if _, ok := d.configs["DATABASE_POSTGRES_MAX_OPEN_CONNS"]; !ok {
+		d.configs["DATABASE_POSTGRES_MAX_OPEN_CONNS"] = d.Config.GetInt("DATABASE_POSTGRES_MAX_OPEN_CONNS")
+	}
+	if _, ok := d.configs["DATABASE_POSTGRES_MAX_IDLE_CONNS"]; !ok {
+		d.configs["DATABASE_POSTGRES_MAX_IDLE_CONNS"] = d.Config.GetInt("DATABASE_POSTGRES_MAX_IDLE_CONNS")
+	}
+	if _, ok := d.configs["DATABASE_SQLITE_PATH"]; !ok {
+		d.configs["DATABASE_SQLITE_PATH"] = d.Config.GetString("DATABASE_SQLITE_PATH")
+	}
+	if _, ok := d.configs["DATABASE_SQLITE_TIMEOUT"]; !ok {
+		d.configs["DATABASE_SQLITE_TIMEOUT"] = d.Config.GetString("DATABASE_SQLITE_TIMEOUT")
+	}
+	if _, ok := d.configs["DATABASE_SQLITE_MAX_OPEN_CONNS"]; !ok {
+		d.configs["DATABASE_SQLITE_MAX_OPEN_CONNS"] = d.Config.GetInt("DATABASE_SQLITE_MAX_OPEN_CONNS")
+	}
+	if _, ok := d.configs["DATABASE_SQLITE_MAX_IDLE_CONNS"]; !ok {
+		d.configs["DATABASE_SQLITE_MAX_IDLE_CONNS"] = d.Config.GetInt("DATABASE_SQLITE_MAX_IDLE_CONNS")
+	}
 	return ctx, nil
 }
 func (d *Database) OnStartup(ctx context.Context) (context.Context, error) {
@@ -130,9 +230,26 @@ func (d *Database) OnStartup(ctx context.Context) (context.Context, error) {
 			return ctx, errors.Annotate(err, fmt.Sprintf(errStartup+": "+err.Error(), d.nosqlProvider))
 		}
 	}
+	sharding, err := d.shardingFromConfig(map[string]interface{}{
+		"DATABASE_SHARDS":       d.Config.GetString("DATABASE_SHARDS"),
+		"DATABASE_SHARD_FUNC":   d.Config.GetString("DATABASE_SHARD_FUNC"),
+		"DATABASE_SHARD_RANGES": d.Config.GetString("DATABASE_SHARD_RANGES"),
+	})
+	if err != nil {
+		return ctx, errors.Annotate(err, fmt.Sprintf(errStartup, d.provider))
+	}
+	if sharding != nil {
+		d.sharding = sharding
+	}
 	return ctx, nil
 }
 func (d *Database) OnShutdown(ctx context.Context) (context.Context, error) {
+	if d.nosqlHandler != nil {
+		err := d.nosqlHandler.Close()
+		if err != nil {
+			return ctx, errors.Annotate(err, fmt.Sprintf(errShutdown, d.nosqlProvider))
+		}
+	}
 	return ctx, nil
 }
 func (d *Database) GetProvider() string {
@@ -154,8 +271,9 @@ func (d *Database) Use(ctx context.Context, Provider string) error {
 func (d *Database) NewHandler(name string, configs ...map[string]interface{}) (DatabaseHandler, error) {
 	databaseHandler, err := d.handler.GetHandler(name)
 	if err == nil {
-		return databaseHandler, nil
+		return NewTracedDatabaseHandler(databaseHandler, d.Tracer), nil
 	}
+	handlerConfig := d.configs
 	if len(configs) > 0 {
 		// merge
 		for key, value := range d.configs {
@@ -163,6 +281,7 @@ func (d *Database) NewHandler(name string, configs ...map[string]interface{}) (D
 				configs[0][key] = value
 			}
 		}
+		handlerConfig = configs[0]
 		databaseHandler, err = d.handler.NewHandler(name, configs[0])
 	} else {
 		databaseHandler, err = d.handler.NewHandler(name, d.configs)
@@ -173,14 +292,40 @@ func (d *Database) NewHandler(name string, configs ...map[string]interface{}) (D
 	if databaseHandler == nil {
 		return nil, errors.Annotate(errors.New("database: empty database"), fmt.Sprintf(errNewHandler, name))
 	}
-	return databaseHandler, nil
+	if err = d.instrument(name, databaseHandler, handlerConfig); err != nil {
+		return nil, errors.Annotate(err, fmt.Sprintf(errNewHandler, name))
+	}
+	return NewTracedDatabaseHandler(databaseHandler, d.Tracer), nil
+}
+
+// instrument records the metrics of the handler if DATABASE_METRICS is set.
+func (d *Database) instrument(name string, databaseHandler DatabaseHandler, config map[string]interface{}) error {
+	enabled, _ := config["DATABASE_METRICS"].(bool)
+	if !enabled {
+		return nil
+	}
+	threshold, err := slowQueryThreshold(config)
+	if err != nil {
+		return err
+	}
+	return Instrument(name, databaseHandler, MetricsSlowQueryThreshold(threshold), MetricsSlowQueryLogFunc(d.SlowQueryLog))
 }
 func (d *Database) GetHandler(name string) (DatabaseHandler, error) {
 	databaseHandler, err := d.handler.GetHandler(name)
 	if err != nil {
 		return nil, errors.Annotate(err, fmt.Sprintf(errGetHandler, name))
 	}
-	return databaseHandler, err
+	return NewTracedDatabaseHandler(databaseHandler, d.Tracer), err
+}
+
+// GetContextHandler returns the handler named name bound to ctx, e.g. the RequestContext of an api.Context:
+// its statements are canceled when ctx is done.
+func (d *Database) GetContextHandler(ctx context.Context, name string) (DatabaseHandler, error) {
+	handler, err := d.GetHandler(name)
+	if err != nil {
+		return nil, err
+	}
+	return handler.WithContext(ctx), nil
 }
 
 type Handler interface {
@@ -203,8 +348,14 @@ type DatabaseHandler interface {
 	Model(value interface{}) DatabaseHandler
 	Table(name string) DatabaseHandler
 	Debug() DatabaseHandler
+	// UsePrimary routes the reads to the primary when the handler has read replicas
+	UsePrimary() DatabaseHandler
+	// WithContext returns a copy of the handler canceling its statements and its transactions when ctx is done
+	WithContext(ctx context.Context) DatabaseHandler
 	Error() error
 	Callback() DatabaseCallback
+	// Stats returns the stats of the connection pool, zero for a transaction
+	Stats() sql.DBStats
 	// NewRecord check if value's primary key is blank
 	NewRecord(value interface{}) bool
 	// RecordNotFound check if returning error
@@ -258,11 +409,28 @@ type DatabaseHandler interface {
 	Raw(sql string, values ...interface{}) DatabaseHandler
 	Exec(sql string, values ...interface{}) DatabaseHandler
 	// Transaction
+	// Transaction runs fn in a transaction committed if fn succeeds, rolled back if it fails or panics,
+	// retried on a deadlock, fn runs in a savepoint if the handler is a transaction
+	Transaction(ctx context.Context, fn func(tx DatabaseHandler) error, setters ...TransactionOption) error
 	Begin() DatabaseHandler
 	Commit() DatabaseHandler
 	Rollback() DatabaseHandler
 }
 
+// ReplicaRawReader is implemented by the handlers having read replicas, whose Raw statements run on the primary.
+type ReplicaRawReader interface {
+	// RawRead is Raw for a read only statement, which may run on a read replica
+	RawRead(sql string, values ...interface{}) DatabaseHandler
+}
+
+// RawRead builds the read only statement sql on db, run on a read replica if db has some.
+func RawRead(db DatabaseHandler, sql string, values ...interface{}) DatabaseHandler {
+	if reader, ok := db.(ReplicaRawReader); ok {
+		return reader.RawRead(sql, values...)
+	}
+	return db.Raw(sql, values...)
+}
+
 type databaseHandler func() Handler
 
 var databaseHandlers = make(map[string]databaseHandler)
@@ -298,9 +466,9 @@ func (d *Database) NosqlUse(ctx context.Context, Provider string) error {
 	return nil
 }
 func (d *Database) NewNosqlHandler(name string, config map[string]interface{}) (NosqlDatabaseHandler, error) {
-	database, err := d.GetNosqlHandler(name)
+	database, err := d.nosqlHandler.GetHandler(name)
 	if err == nil {
-		return database, nil
+		return NewTracedNosqlDatabaseHandler(database, d.Tracer), nil
 	}
 	if _, ok := config["DATABASE_HBASE_HOST"]; !ok {
 		config["DATABASE_HBASE_HOST"] = d.Config.GetString("DATABASE_HBASE_HOST")
@@ -323,6 +491,12 @@ func (d *Database) NewNosqlHandler(name string, config map[string]interface{}) (
 	if _, ok := config["DATABASE_HBASE_MAX_ACTIVE"]; !ok {
 		config["DATABASE_HBASE_MAX_ACTIVE"] = d.Config.GetInt("DATABASE_HBASE_MAX_ACTIVE")
 	}
+	if _, ok := config["DATABASE_HBASE_IDLE_TIMEOUT"]; !ok {
+		config["DATABASE_HBASE_IDLE_TIMEOUT"] = d.Config.GetString("DATABASE_HBASE_IDLE_TIMEOUT")
+	}
+	if _, ok := config["DATABASE_MEMORY_MAX_VERSIONS"]; !ok {
+		config["DATABASE_MEMORY_MAX_VERSIONS"] = d.Config.GetInt("DATABASE_MEMORY_MAX_VERSIONS")
+	}
 	database, err = d.nosqlHandler.NewHandler(name, config)
 	if err != nil {
 		return nil, errors.Annotate(err, fmt.Sprintf(errNewHandler, name))
@@ -330,38 +504,46 @@ func (d *Database) NewNosqlHandler(name string, config map[string]interface{}) (
 	if database == nil {
 		return nil, errors.Annotate(err, fmt.Sprintf(errNewHandler+": empty database", name))
 	}
-	return database, nil
+	if enabled, _ := d.configs["DATABASE_METRICS"].(bool); enabled {
+		InstrumentNosql(name, database)
+	}
+	return NewTracedNosqlDatabaseHandler(database, d.Tracer), nil
 }
 func (d *Database) GetNosqlHandler(name string) (NosqlDatabaseHandler, error) {
 	databaseHandler, err := d.nosqlHandler.GetHandler(name)
+	if err != nil && HandlerNotExists(err) {
+		databaseHandler, err = d.nosqlHandler.NewHandler(name, d.configs)
+	}
 	if err != nil {
-		if HandlerNotExists(err) {
-			databaseHandler, err = d.nosqlHandler.NewHandler(name, d.configs)
-		}
 		return nil, errors.Annotate(err, fmt.Sprintf(errGetHandler, name))
 	}
-	return databaseHandler, err
+	return NewTracedNosqlDatabaseHandler(databaseHandler, d.Tracer), err
 }
 
 type NosqlHandler interface {
 	Initiate(ctx context.Context) error
 	NewHandler(name string, config map[string]interface{}) (NosqlDatabaseHandler, error)
 	GetHandler(name string) (NosqlDatabaseHandler, error)
+	// Close closes the clients of every handler
+	Close() error
 }
 type NosqlDatabaseCallback interface {
 }
 type NosqlDatabaseScanner interface {
-	Next() (*hrpc.Result, error)
+	Next() (*NosqlRow, error)
 	Close() error
 }
 type NosqlDatabaseHandler interface {
 	GetHandler() (client interface{}, err error)
 	ReleaseHandler(client interface{})
 	GetHandlerPoolSize() int
-	Scan(ctx context.Context, table string) (NosqlDatabaseScanner, error)
-	Get(ctx context.Context, table string, key string) ([]map[string]string, error)
+	Scan(ctx context.Context, table string, setters ...NosqlQueryOption) (NosqlDatabaseScanner, error)
+	Get(ctx context.Context, table string, key string, setters ...NosqlQueryOption) (*NosqlRow, error)
+	BatchGet(ctx context.Context, table string, keys []string, setters ...NosqlQueryOption) ([]*NosqlRow, error)
 	Put(ctx context.Context, table string, key string, values map[string]map[string][]byte) (err error)
 	Delete(ctx context.Context, table string, key string, values map[string]map[string][]byte) (err error)
+	BatchPut(ctx context.Context, table string, rows map[string]map[string]map[string][]byte) error
+	BatchDelete(ctx context.Context, table string, rows map[string]map[string]map[string][]byte) error
 	Append(ctx context.Context, table string, key string, values map[string]map[string][]byte) error
 	Increment(ctx context.Context, table string, key string, values map[string]map[string][]byte) (int64, error)
 	CheckAndPut(ctx context.Context, table string, key string, values map[string]map[string][]byte, family string, qualifier string, expectedValue []byte) (bool, error)
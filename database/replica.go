@@ -0,0 +1,163 @@
+package database
+
+import (
+	"database/sql/driver"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+)
+
+// ReplicaPool balances the reads of a handler between its read replicas,
+// the replicas failing with a connection error are ejected until they answer the health check again.
+type ReplicaPool struct {
+	mutex    sync.RWMutex
+	replicas []*gorm.DB
+	healthy  []bool
+	next     int
+	done     chan struct{}
+	closed   bool
+}
+
+// NewReplicaPool returns the pool of the replicas, checked every checkInterval if positive.
+func NewReplicaPool(replicas []*gorm.DB, checkInterval time.Duration) *ReplicaPool {
+	pool := &ReplicaPool{
+		replicas: replicas,
+		healthy:  make([]bool, len(replicas)),
+		done:     make(chan struct{}),
+	}
+	for i := range pool.healthy {
+		pool.healthy[i] = true
+	}
+	if checkInterval > 0 && len(replicas) > 0 {
+		go pool.checkEvery(checkInterval)
+	}
+	return pool
+}
+
+// Len returns the number of replicas, healthy or not.
+func (p *ReplicaPool) Len() int {
+	return len(p.replicas)
+}
+
+// Healthy returns the number of healthy replicas.
+func (p *ReplicaPool) Healthy() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	count := 0
+	for _, healthy := range p.healthy {
+		if healthy {
+			count++
+		}
+	}
+	return count
+}
+
+// Get returns the next healthy replica in turn, nil if none.
+func (p *ReplicaPool) Get() *gorm.DB {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i := 0; i < len(p.replicas); i++ {
+		index := (p.next + i) % len(p.replicas)
+		if p.healthy[index] {
+			p.next = index + 1
+			return p.replicas[index]
+		}
+	}
+	return nil
+}
+
+// Eject marks the replica unhealthy until the next successful health check.
+func (p *ReplicaPool) Eject(replica *gorm.DB) {
+	p.setHealthy(replica, false)
+}
+
+// Failed ejects the replica if err is a connection error, the read should then be retried on the primary.
+func (p *ReplicaPool) Failed(replica *gorm.DB, err error) bool {
+	if !IsConnectionError(err) {
+		return false
+	}
+	p.Eject(replica)
+	return true
+}
+
+// Check pings the replicas, ejecting the ones not answering and restoring the others.
+func (p *ReplicaPool) Check() {
+	for _, replica := range p.replicas {
+		p.setHealthy(replica, replica.DB().Ping() == nil)
+	}
+}
+
+func (p *ReplicaPool) setHealthy(replica *gorm.DB, healthy bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i, r := range p.replicas {
+		if r == replica {
+			p.healthy[i] = healthy
+		}
+	}
+}
+
+func (p *ReplicaPool) checkEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.Check()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Close stops the health checks and closes the replicas.
+func (p *ReplicaPool) Close() error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	p.mutex.Unlock()
+	var err error
+	for _, replica := range p.replicas {
+		if closeErr := replica.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// IsConnectionError tests if err is caused by the connection to the database rather than by the query.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == driver.ErrBadConn || err == mysqlDriver.ErrInvalidConn {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "connection refused") ||
+		strings.Contains(message, "broken pipe") ||
+		strings.Contains(message, "bad connection") ||
+		strings.Contains(message, "database is closed")
+}
+
+// parseReplicas returns the addresses of a comma separated list of replicas.
+func parseReplicas(replicas string) []string {
+	addresses := make([]string, 0)
+	for _, address := range strings.Split(replicas, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
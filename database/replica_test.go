@@ -0,0 +1,95 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestReplica(t *testing.T, name string, user string) *gorm.DB {
+	db, err := gorm.Open("sqlite3", "file:"+name+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	assert.Nil(t, db.AutoMigrate(&testUser{}).Error)
+	assert.Nil(t, db.Create(&testUser{Name: user}).Error)
+	return db
+}
+
+func TestReplicaPool(t *testing.T) {
+	primary := openTestReplica(t, "replica_primary", "primary")
+	replica := openTestReplica(t, "replica_replica", "replica")
+	pool := NewReplicaPool([]*gorm.DB{replica}, 0)
+	handler := &MysqlDatabaseHandler{Db: primary, primary: primary, replicas: pool}
+	defer handler.Close()
+	assert.Equal(t, 1, pool.Len())
+	assert.Equal(t, 1, pool.Healthy())
+
+	var user testUser
+	assert.Nil(t, handler.New().Where("id = ?", 1).First(&user).Error())
+	assert.Equal(t, "replica", user.Name)
+	user = testUser{}
+	assert.Nil(t, handler.New().UsePrimary().Where("id = ?", 1).First(&user).Error())
+	assert.Equal(t, "primary", user.Name)
+
+	// the writes go to the primary, even after a read on the replica
+	db := handler.New().Model(&testUser{}).Where("id = ?", 1)
+	var count int
+	assert.Nil(t, db.Count(&count).Error())
+	assert.Equal(t, 1, count)
+	assert.Nil(t, db.Update("name", "updated").Error())
+	user = testUser{}
+	assert.Nil(t, primary.First(&user, 1).Error)
+	assert.Equal(t, "updated", user.Name)
+	user = testUser{}
+	assert.Nil(t, replica.First(&user, 1).Error)
+	assert.Equal(t, "replica", user.Name)
+
+	// the raw statements run on the primary unless they are reads
+	var name string
+	assert.Nil(t, handler.New().Raw("SELECT name FROM test_users WHERE id = ?", 1).Row().Scan(&name))
+	assert.Equal(t, "updated", name)
+	assert.Nil(t, RawRead(handler.New(), "SELECT name FROM test_users WHERE id = ?", 1).Row().Scan(&name))
+	assert.Equal(t, "replica", name)
+	// Raw on the named handler does not route its later reads to the primary
+	assert.Nil(t, handler.Raw("SELECT name FROM test_users WHERE id = ?", 1).Row().Scan(&name))
+	assert.Equal(t, "updated", name)
+	user = testUser{}
+	assert.Nil(t, handler.New().First(&user, 1).Error())
+	assert.Equal(t, "replica", user.Name)
+	assert.False(t, handler.usePrimary)
+
+	// a replica failing with a connection error is ejected and the read falls back to the primary
+	assert.Nil(t, replica.DB().Close())
+	assert.Nil(t, RawRead(handler.New(), "SELECT name FROM test_users WHERE id = ?", 1).Row().Scan(&name))
+	assert.Equal(t, "updated", name)
+	assert.Equal(t, 0, pool.Healthy())
+	pool.Check()
+	user = testUser{}
+	assert.Nil(t, handler.New().First(&user, 1).Error())
+	assert.Equal(t, "updated", user.Name)
+	assert.Equal(t, 0, pool.Healthy())
+	assert.Nil(t, pool.Get())
+	pool.Check()
+	assert.Equal(t, 0, pool.Healthy())
+}
+
+func TestReplicaPoolCheck(t *testing.T) {
+	replica := openTestReplica(t, "replica_check", "replica")
+	defer replica.Close()
+	pool := NewReplicaPool([]*gorm.DB{replica}, 0)
+	pool.Eject(replica)
+	assert.Equal(t, 0, pool.Healthy())
+	pool.Check()
+	assert.Equal(t, 1, pool.Healthy())
+	assert.Equal(t, replica, pool.Get())
+	assert.False(t, pool.Failed(replica, gorm.ErrRecordNotFound))
+	assert.Equal(t, 1, pool.Healthy())
+}
+
+func TestParseReplicas(t *testing.T) {
+	assert.Equal(t, []string{"10.0.0.1:3306", "10.0.0.2"}, parseReplicas(" 10.0.0.1:3306, ,10.0.0.2"))
+	assert.Equal(t, []string{}, parseReplicas(""))
+}
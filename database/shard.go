@@ -0,0 +1,370 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+var (
+	errShard         = "database: shard of '%v' error"
+	errShardConfig   = "database: invalid config %s"
+	errNoSharding    = "database: no sharding"
+	errShardUnknown  = "database: unknown shard function '%s'"
+	errShardKeyType  = "database: invalid shard key type %T"
+	errShardOutRange = "database: shard %d out of %d shards"
+)
+
+const (
+	ShardModulo         = "modulo"
+	ShardRange          = "range"
+	ShardConsistentHash = "consistent_hash"
+
+	// defaultShardVirtualNodes is the number of points of each shard on the ring of the consistent hash
+	defaultShardVirtualNodes = 160
+)
+
+// ShardFunc returns the index of the shard of key.
+type ShardFunc func(key interface{}) (int, error)
+
+// Shard is a handler of the sharding, its config is merged with the config of the database.
+type Shard struct {
+	Name   string
+	Config map[string]interface{}
+}
+
+// Sharding routes the keys to the handlers of their shards.
+type Sharding struct {
+	shards    []Shard
+	shardFunc ShardFunc
+	// mutex serializes the creation of the handlers of the shards, the provider handlers guard their own maps
+	mutex sync.Mutex
+}
+
+// ModuloShard returns the shard of an integer key modulo shards, a string key is hashed unless it is an integer.
+func ModuloShard(shards int) ShardFunc {
+	return func(key interface{}) (int, error) {
+		if shards <= 0 {
+			return 0, errors.New(errNoSharding)
+		}
+		if s, ok := key.(string); ok {
+			if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+				h := fnv.New32a()
+				h.Write([]byte(s))
+				return int(h.Sum32() % uint32(shards)), nil
+			}
+		}
+		n, err := shardInt(key)
+		if err != nil {
+			return 0, err
+		}
+		shard := n % int64(shards)
+		if shard < 0 {
+			shard += int64(shards)
+		}
+		return int(shard), nil
+	}
+}
+
+// RangeShard returns the first shard whose bound is greater than the integer key,
+// the shard after the last bound for the greater keys: len(bounds)+1 shards are needed.
+func RangeShard(bounds []int64) ShardFunc {
+	return func(key interface{}) (int, error) {
+		n, err := shardInt(key)
+		if err != nil {
+			return 0, err
+		}
+		return sort.Search(len(bounds), func(i int) bool {
+			return n < bounds[i]
+		}), nil
+	}
+}
+
+// ConsistentHashShard returns the shard of key on a ring of the names of the shards, so that
+// adding or removing a shard only moves the keys of its neighbours, virtualNodes points by shard if positive.
+func ConsistentHashShard(names []string, virtualNodes int) ShardFunc {
+	if virtualNodes <= 0 {
+		virtualNodes = defaultShardVirtualNodes
+	}
+	points := make([]uint32, 0, len(names)*virtualNodes)
+	shards := make(map[uint32]int, len(names)*virtualNodes)
+	for index, name := range names {
+		for node := 0; node < virtualNodes; node++ {
+			point := crc32.ChecksumIEEE([]byte(name + "#" + strconv.Itoa(node)))
+			if _, ok := shards[point]; ok {
+				continue
+			}
+			shards[point] = index
+			points = append(points, point)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i] < points[j]
+	})
+	return func(key interface{}) (int, error) {
+		if len(points) == 0 {
+			return 0, errors.New(errNoSharding)
+		}
+		hash := crc32.ChecksumIEEE([]byte(fmt.Sprint(key)))
+		i := sort.Search(len(points), func(i int) bool {
+			return points[i] >= hash
+		})
+		if i == len(points) {
+			i = 0
+		}
+		return shards[points[i]], nil
+	}
+}
+
+func shardInt(key interface{}) (int64, error) {
+	switch k := key.(type) {
+	case int:
+		return int64(k), nil
+	case int8:
+		return int64(k), nil
+	case int16:
+		return int64(k), nil
+	case int32:
+		return int64(k), nil
+	case int64:
+		return k, nil
+	case uint:
+		return int64(k), nil
+	case uint8:
+		return int64(k), nil
+	case uint16:
+		return int64(k), nil
+	case uint32:
+		return int64(k), nil
+	case uint64:
+		return int64(k), nil
+	case string:
+		n, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return 0, errors.Errorf(errShardKeyType, key)
+		}
+		return n, nil
+	}
+	return 0, errors.Errorf(errShardKeyType, key)
+}
+
+// NewSharding returns the sharding of the keys between shards by shardFunc.
+func NewSharding(shards []Shard, shardFunc ShardFunc) *Sharding {
+	return &Sharding{
+		shards:    shards,
+		shardFunc: shardFunc,
+	}
+}
+
+// Shards returns the shards.
+func (s *Sharding) Shards() []Shard {
+	return s.shards
+}
+
+// Locate returns the shard of key.
+func (s *Sharding) Locate(key interface{}) (Shard, error) {
+	index, err := s.shardFunc(key)
+	if err != nil {
+		return Shard{}, err
+	}
+	if index < 0 || index >= len(s.shards) {
+		return Shard{}, errors.Errorf(errShardOutRange, index, len(s.shards))
+	}
+	return s.shards[index], nil
+}
+
+// UseSharding routes the keys to the handlers of shards by shardFunc,
+// the handlers are created with the config of their shard on their first use.
+func (d *Database) UseSharding(shards []Shard, shardFunc ShardFunc) {
+	d.sharding = NewSharding(shards, shardFunc)
+}
+
+// Sharding returns the sharding of the database, nil if none.
+func (d *Database) Sharding() *Sharding {
+	return d.sharding
+}
+
+// Shard returns the handler of the shard of key.
+func (d *Database) Shard(key interface{}) (DatabaseHandler, error) {
+	if d.sharding == nil {
+		return nil, errors.Annotatef(errors.New(errNoSharding), errShard, key)
+	}
+	shard, err := d.sharding.Locate(key)
+	if err != nil {
+		return nil, errors.Annotatef(err, errShard, key)
+	}
+	handler, err := d.shardHandler(shard)
+	if err != nil {
+		return nil, errors.Annotatef(err, errShard, key)
+	}
+	return handler, nil
+}
+
+func (d *Database) shardHandler(shard Shard) (DatabaseHandler, error) {
+	if handler, err := d.GetHandler(shard.Name); err == nil {
+		return handler, nil
+	}
+	d.sharding.mutex.Lock()
+	defer d.sharding.mutex.Unlock()
+	// NewHandler merges the config of the database into the config given
+	config := make(map[string]interface{}, len(shard.Config))
+	for key, value := range shard.Config {
+		config[key] = value
+	}
+	return d.NewHandler(shard.Name, config)
+}
+
+// GroupByShard groups keys by the name of their shard, for a read of each shard by ScatterGather.
+func (d *Database) GroupByShard(keys ...interface{}) (map[string][]interface{}, error) {
+	if d.sharding == nil {
+		return nil, errors.New(errNoSharding)
+	}
+	groups := make(map[string][]interface{})
+	for _, key := range keys {
+		shard, err := d.sharding.Locate(key)
+		if err != nil {
+			return nil, errors.Annotatef(err, errShard, key)
+		}
+		groups[shard.Name] = append(groups[shard.Name], key)
+	}
+	return groups, nil
+}
+
+// ShardResult is the result of the read of a shard by ScatterGather.
+type ShardResult struct {
+	Shard string
+	Value interface{}
+	Error error
+}
+
+// ScatterGather runs fn on the handler of every shard concurrently, bound to ctx, and returns their results
+// in the order of the shards. The first error cancels the other reads and is returned.
+func (d *Database) ScatterGather(ctx context.Context, fn func(ctx context.Context, shard string, db DatabaseHandler) (interface{}, error)) ([]ShardResult, error) {
+	if d.sharding == nil {
+		return nil, errors.New(errNoSharding)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	shards := d.sharding.Shards()
+	results := make([]ShardResult, len(shards))
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for index, shard := range shards {
+		results[index].Shard = shard.Name
+		handler, err := d.shardHandler(shard)
+		if err != nil {
+			results[index].Error = err
+			once.Do(func() {
+				firstErr = errors.Annotatef(err, errShard, shard.Name)
+			})
+			cancel()
+			continue
+		}
+		wg.Add(1)
+		go func(index int, shard Shard, handler DatabaseHandler) {
+			defer wg.Done()
+			value, err := fn(ctx, shard.Name, handler.New().WithContext(ctx))
+			results[index].Value = value
+			results[index].Error = err
+			if err != nil {
+				once.Do(func() {
+					firstErr = errors.Annotatef(err, errShard, shard.Name)
+				})
+				cancel()
+			}
+		}(index, shard, handler)
+	}
+	wg.Wait()
+	return results, firstErr
+}
+
+// shardingFromConfig parses the shards of DATABASE_SHARDS, a comma separated list of names of handlers,
+// each followed by =address to override the address of the database: host:port for mysql and postgres,
+// the path for sqlite, and the shard function of DATABASE_SHARD_FUNC.
+func (d *Database) shardingFromConfig(config map[string]interface{}) (*Sharding, error) {
+	configShards, _ := config["DATABASE_SHARDS"].(string)
+	shards := make([]Shard, 0)
+	names := make([]string, 0)
+	for _, entry := range strings.Split(configShards, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		shard := Shard{Config: make(map[string]interface{})}
+		shard.Name = entry
+		if i := strings.Index(entry, "="); i >= 0 {
+			shard.Name = strings.TrimSpace(entry[:i])
+			if err := d.shardAddress(shard.Config, strings.TrimSpace(entry[i+1:])); err != nil {
+				return nil, err
+			}
+		}
+		if shard.Name == "" {
+			return nil, errors.Errorf(errShardConfig, "DATABASE_SHARDS")
+		}
+		shards = append(shards, shard)
+		names = append(names, shard.Name)
+	}
+	if len(shards) == 0 {
+		return nil, nil
+	}
+	var shardFunc ShardFunc
+	funcName, _ := config["DATABASE_SHARD_FUNC"].(string)
+	switch funcName {
+	case "", ShardModulo:
+		shardFunc = ModuloShard(len(shards))
+	case ShardRange:
+		configBounds, _ := config["DATABASE_SHARD_RANGES"].(string)
+		bounds := make([]int64, 0)
+		for _, bound := range strings.Split(configBounds, ",") {
+			if bound = strings.TrimSpace(bound); bound == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(bound, 10, 64)
+			if err != nil || len(bounds) > 0 && n <= bounds[len(bounds)-1] {
+				return nil, errors.Errorf(errShardConfig, "DATABASE_SHARD_RANGES")
+			}
+			bounds = append(bounds, n)
+		}
+		if len(bounds)+1 != len(shards) {
+			return nil, errors.Errorf(errShardConfig, "DATABASE_SHARD_RANGES: the ranges of the shards are the intervals between the bounds")
+		}
+		shardFunc = RangeShard(bounds)
+	case ShardConsistentHash:
+		shardFunc = ConsistentHashShard(names, 0)
+	default:
+		return nil, errors.Errorf(errShardUnknown, funcName)
+	}
+	return NewSharding(shards, shardFunc), nil
+}
+
+// shardAddress sets the address of the database of a shard in its config, by provider.
+func (d *Database) shardAddress(config map[string]interface{}, address string) error {
+	switch d.provider {
+	case "mysql", "postgres":
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return errors.Annotatef(err, errShardConfig, "DATABASE_SHARDS")
+		}
+		prefix := "DATABASE_" + strings.ToUpper(d.provider)
+		config[prefix+"_HOST"] = host
+		config[prefix+"_PORT"] = port
+	case "sqlite3":
+		config["DATABASE_SQLITE_PATH"] = address
+	default:
+		return errors.Errorf(errShardConfig, "DATABASE_SHARDS: no address for the provider "+d.provider)
+	}
+	return nil
+}
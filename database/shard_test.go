@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModuloShard(t *testing.T) {
+	shardFunc := ModuloShard(3)
+	for key, expected := range map[interface{}]int{7: 1, int64(9): 0, uint8(5): 2, -1: 2, "4": 1} {
+		shard, err := shardFunc(key)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, shard, "%v", key)
+	}
+	// a string key is hashed
+	first, err := shardFunc("tenant")
+	assert.Nil(t, err)
+	second, _ := shardFunc("tenant")
+	assert.Equal(t, first, second)
+	_, err = shardFunc(1.5)
+	assert.NotNil(t, err)
+	_, err = ModuloShard(0)(1)
+	assert.NotNil(t, err)
+}
+
+func TestRangeShard(t *testing.T) {
+	shardFunc := RangeShard([]int64{100, 200})
+	for key, expected := range map[interface{}]int{-5: 0, 99: 0, 100: 1, "150": 1, 200: 2, 1000: 2} {
+		shard, err := shardFunc(key)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, shard, "%v", key)
+	}
+	_, err := shardFunc("tenant")
+	assert.NotNil(t, err)
+}
+
+func TestConsistentHashShard(t *testing.T) {
+	names := []string{"shard0", "shard1", "shard2"}
+	shardFunc := ConsistentHashShard(names, 0)
+	counts := make([]int, len(names))
+	shards := make(map[int]int)
+	for key := 0; key < 3000; key++ {
+		shard, err := shardFunc(key)
+		assert.Nil(t, err)
+		counts[shard]++
+		shards[key] = shard
+	}
+	for _, count := range counts {
+		assert.True(t, count > 500, "%v", counts)
+	}
+	// the keys of the other shards stay in place when a shard is added
+	added := ConsistentHashShard(append(names, "shard3"), 0)
+	for key, shard := range shards {
+		moved, _ := added(key)
+		assert.True(t, moved == shard || moved == 3)
+	}
+	_, err := ConsistentHashShard(nil, 0)(1)
+	assert.NotNil(t, err)
+}
+
+func newTestShardDatabase(t *testing.T) *Database {
+	d, err := NewMemoryDatabase(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.UseSharding([]Shard{{Name: "shard0"}, {Name: "shard1"}}, ModuloShard(2))
+	for _, tenant := range []int{0, 1} {
+		db, err := d.Shard(tenant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, db.New().AutoMigrate(&testUser{}).Error())
+	}
+	return d
+}
+
+func TestDatabaseShard(t *testing.T) {
+	d, err := NewMemoryDatabase(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = d.Shard(1)
+	assert.NotNil(t, err)
+
+	d = newTestShardDatabase(t)
+	even, err := d.Shard(2)
+	assert.Nil(t, err)
+	assert.Nil(t, even.New().Create(&testUser{Name: "Alice"}).Error())
+	odd, err := d.Shard(3)
+	assert.Nil(t, err)
+	var count int
+	assert.Nil(t, odd.New().Model(&testUser{}).Count(&count).Error())
+	assert.Equal(t, 0, count)
+	again, err := d.Shard(4)
+	assert.Nil(t, err)
+	assert.Nil(t, again.New().Model(&testUser{}).Count(&count).Error())
+	assert.Equal(t, 1, count)
+
+	_, err = d.Shard("")
+	assert.Nil(t, err)
+	_, err = d.Shard(1.5)
+	assert.NotNil(t, err)
+	d.UseSharding([]Shard{{Name: "shard0"}}, ModuloShard(2))
+	_, err = d.Shard(1)
+	assert.NotNil(t, err)
+}
+
+func TestDatabaseShardConcurrent(t *testing.T) {
+	d, err := NewMemoryDatabase(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = d.NewHandler("main")
+	assert.Nil(t, err)
+	d.UseSharding([]Shard{{Name: "shard0"}, {Name: "shard1"}, {Name: "shard2"}}, ModuloShard(3))
+	// the handlers of the shards are created while the other handlers are read
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(2)
+		go func(key int) {
+			defer wg.Done()
+			_, err := d.Shard(key)
+			assert.Nil(t, err)
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := d.GetHandler("main")
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDatabaseScatterGather(t *testing.T) {
+	d := newTestShardDatabase(t)
+	groups, err := d.GroupByShard(1, 2, 3, 4, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]interface{}{"shard0": {2, 4}, "shard1": {1, 3, 5}}, groups)
+	for _, keys := range groups {
+		for _, key := range keys {
+			db, err := d.Shard(key)
+			assert.Nil(t, err)
+			assert.Nil(t, db.New().Create(&testUser{Name: "tenant"}).Error())
+		}
+	}
+
+	results, err := d.ScatterGather(context.Background(), func(ctx context.Context, shard string, db DatabaseHandler) (interface{}, error) {
+		var users []testUser
+		err := db.New().Where("id IN (?)", []int{1, 2, 3}).Find(&users).Error()
+		return len(users), err
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, ShardResult{Shard: "shard0", Value: 2}, results[0])
+		assert.Equal(t, ShardResult{Shard: "shard1", Value: 3}, results[1])
+	}
+
+	failed := errors.New("failed")
+	results, err = d.ScatterGather(context.Background(), func(ctx context.Context, shard string, db DatabaseHandler) (interface{}, error) {
+		if shard == "shard1" {
+			return nil, failed
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	assert.NotNil(t, err)
+	shards := make([]string, 0)
+	for _, result := range results {
+		assert.NotNil(t, result.Error)
+		shards = append(shards, result.Shard)
+	}
+	sort.Strings(shards)
+	assert.Equal(t, []string{"shard0", "shard1"}, shards)
+	assert.Equal(t, failed, results[1].Error)
+}
+
+func TestShardingFromConfig(t *testing.T) {
+	d := &Database{provider: "mysql"}
+	sharding, err := d.shardingFromConfig(map[string]interface{}{"DATABASE_SHARDS": ""})
+	assert.Nil(t, err)
+	assert.Nil(t, sharding)
+
+	sharding, err = d.shardingFromConfig(map[string]interface{}{
+		"DATABASE_SHARDS":       "tenants0=10.0.0.1:3306, tenants1=10.0.0.2:3307",
+		"DATABASE_SHARD_FUNC":   ShardRange,
+		"DATABASE_SHARD_RANGES": "1000",
+	})
+	if assert.Nil(t, err) {
+		shard, err := sharding.Locate(1000)
+		assert.Nil(t, err)
+		assert.Equal(t, "tenants1", shard.Name)
+		assert.Equal(t, map[string]interface{}{"DATABASE_MYSQL_HOST": "10.0.0.2", "DATABASE_MYSQL_PORT": "3307"}, shard.Config)
+	}
+	sharding, err = d.shardingFromConfig(map[string]interface{}{"DATABASE_SHARDS": "tenants0,tenants1", "DATABASE_SHARD_FUNC": ShardConsistentHash})
+	if assert.Nil(t, err) {
+		assert.Len(t, sharding.Shards(), 2)
+		assert.Empty(t, sharding.Shards()[0].Config)
+	}
+
+	for _, config := range []map[string]interface{}{
+		{"DATABASE_SHARDS": "tenants0=10.0.0.1"},
+		{"DATABASE_SHARDS": "=10.0.0.1:3306"},
+		{"DATABASE_SHARDS": "tenants0,tenants1", "DATABASE_SHARD_FUNC": "random"},
+		{"DATABASE_SHARDS": "tenants0,tenants1", "DATABASE_SHARD_FUNC": ShardRange, "DATABASE_SHARD_RANGES": "10,20"},
+		{"DATABASE_SHARDS": "a,b,c", "DATABASE_SHARD_FUNC": ShardRange, "DATABASE_SHARD_RANGES": "20,10"},
+	} {
+		_, err = d.shardingFromConfig(config)
+		assert.NotNil(t, err, "%v", config)
+	}
+	_, err = (&Database{provider: "sqlite3"}).shardingFromConfig(map[string]interface{}{"DATABASE_SHARDS": "tenants0=/tmp/tenants0.db"})
+	assert.Nil(t, err)
+}
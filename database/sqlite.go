@@ -0,0 +1,435 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	errSqliteInitiate            = "database(sqlite3): initiate error"
+	errSqliteNewHandler          = "database(sqlite3): new handler error"
+	errSqliteConnectionNotExists = "database(sqlite3): '%s' handler not exists"
+	errSqliteDriverNotRegistered = "database(sqlite3): driver not registered, import github.com/ltick/tick-framework/database/sqlite"
+)
+
+type SqliteHandler struct {
+	databases map[string]*SqliteDatabaseHandler
+	// mutex guards databases
+	mutex sync.RWMutex
+	// memory isolates the ":memory:" databases of the handler from those of the other handlers
+	memory uint64
+}
+
+// sqliteMemorySequence numbers the handlers opening ":memory:" databases.
+var sqliteMemorySequence uint64
+
+func NewSqliteHandler() Handler {
+	return &SqliteHandler{
+		memory: atomic.AddUint64(&sqliteMemorySequence, 1),
+	}
+}
+
+func (this *SqliteHandler) Initiate(ctx context.Context) error {
+	this.databases = make(map[string]*SqliteDatabaseHandler)
+	return nil
+}
+
+func (this *SqliteHandler) NewHandler(name string, config map[string]interface{}) (DatabaseHandler, error) {
+	if !sqliteDriverRegistered() {
+		return nil, errors.New(errSqliteNewHandler + ": " + errSqliteDriverNotRegistered)
+	}
+	db := &SqliteDatabaseHandler{}
+	// Default
+	db.Timeout = "5s"
+	// sqlite serializes the writes
+	db.MaxOpenConns = 1
+	db.MaxIdleConns = 1
+	configPath := config["DATABASE_SQLITE_PATH"]
+	if configPath != nil {
+		path, ok := configPath.(string)
+		if ok {
+			db.Path = path
+		} else {
+			return nil, errors.New(errSqliteNewHandler + ": invalid config DATABASE_SQLITE_PATH")
+		}
+		if path == "" {
+			return nil, errors.New(errSqliteNewHandler + ": empty DATABASE_SQLITE_PATH")
+		}
+	} else {
+		return nil, errors.New(errSqliteNewHandler + ": empty DATABASE_SQLITE_PATH")
+	}
+	configTimeout, ok := config["DATABASE_SQLITE_TIMEOUT"]
+	if ok && configTimeout != nil {
+		timeout, ok := configTimeout.(string)
+		if ok {
+			if timeout != "" {
+				db.Timeout = timeout
+			}
+		} else {
+			return nil, errors.New(errSqliteNewHandler + ": invalid config DATABASE_SQLITE_TIMEOUT")
+		}
+	}
+	timeout, err := time.ParseDuration(db.Timeout)
+	if err != nil {
+		return nil, errors.New(errSqliteNewHandler + ": invalid config DATABASE_SQLITE_TIMEOUT")
+	}
+	configMaxOpenConns, ok := config["DATABASE_SQLITE_MAX_OPEN_CONNS"]
+	if ok && configMaxOpenConns != nil {
+		maxOpenConns, ok := configMaxOpenConns.(int)
+		if ok {
+			if maxOpenConns != 0 {
+				db.MaxOpenConns = maxOpenConns
+			}
+		} else {
+			return nil, errors.New(errSqliteNewHandler + ": invalid config DATABASE_SQLITE_MAX_OPEN_CONNS")
+		}
+	}
+	configMaxIdleConns, ok := config["DATABASE_SQLITE_MAX_IDLE_CONNS"]
+	if ok && configMaxIdleConns != nil {
+		maxIdleConns, ok := configMaxIdleConns.(int)
+		if ok {
+			if maxIdleConns != 0 {
+				db.MaxIdleConns = maxIdleConns
+			}
+		} else {
+			return nil, errors.New(errSqliteNewHandler + ": invalid config DATABASE_SQLITE_MAX_IDLE_CONNS")
+		}
+	}
+	// ":memory:" opens a database shared by the connections of the handler
+	args := db.Path
+	if args == ":memory:" {
+		args = fmt.Sprintf("file:%s_%d?mode=memory&cache=shared", name, this.memory)
+	}
+	separator := "?"
+	if strings.Contains(args, "?") {
+		separator = "&"
+	}
+	args += fmt.Sprintf("%s_busy_timeout=%d&_foreign_keys=1", separator, timeout/time.Millisecond)
+	gormDb, err := gorm.Open("sqlite3", args)
+	if err == nil {
+		gormDb.DB().SetMaxOpenConns(db.MaxOpenConns)
+		gormDb.DB().SetMaxIdleConns(db.MaxIdleConns)
+		configDebug := config["DATABASE_SQLITE_DEBUG"]
+		if configDebug != nil {
+			if debug, ok := configDebug.(bool); ok {
+				if debug {
+					gormDb = gormDb.Debug()
+				}
+			} else {
+				return nil, errors.New(errSqliteNewHandler + ": invalid DATABASE_SQLITE_DEBUG")
+			}
+		}
+		db.Db = gormDb
+		this.mutex.Lock()
+		if this.databases == nil {
+			this.databases = make(map[string]*SqliteDatabaseHandler)
+		}
+		this.databases[name] = db
+		this.mutex.Unlock()
+	} else {
+		return nil, errors.New(errSqliteNewHandler + ": " + err.Error())
+	}
+	return db, nil
+}
+
+// sqliteDriverRegistered reports whether the sqlite3 driver is linked, see the database/sqlite package.
+func sqliteDriverRegistered() bool {
+	for _, driver := range sql.Drivers() {
+		if driver == "sqlite3" {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *SqliteHandler) GetHandler(name string) (DatabaseHandler, error) {
+	this.mutex.RLock()
+	handlerDatabase, ok := this.databases[name]
+	this.mutex.RUnlock()
+	if !ok {
+		return nil, errors.New(fmt.Sprintf(errSqliteConnectionNotExists, name))
+	}
+	return handlerDatabase, nil
+}
+
+type SqliteDatabaseHandler struct {
+	Db           *gorm.DB
+	Path         string
+	Timeout      string
+	MaxOpenConns int
+	MaxIdleConns int
+}
+
+func (this *SqliteDatabaseHandler) GetConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"path":           this.Path,
+		"timeout":        this.Timeout,
+		"max_open_conns": this.MaxOpenConns,
+		"max_idle_conns": this.MaxIdleConns,
+	}
+}
+
+func (this *SqliteDatabaseHandler) New() DatabaseHandler {
+	return &SqliteDatabaseHandler{
+		Db: this.Db.New(),
+	}
+}
+
+// WithContext returns a copy of the handler running its statements with ctx,
+// the running statement is canceled and the transaction rolled back when ctx is done.
+func (this *SqliteDatabaseHandler) WithContext(ctx context.Context) DatabaseHandler {
+	return &SqliteDatabaseHandler{
+		Db: withContext(this.Db, ctx),
+	}
+}
+func (this *SqliteDatabaseHandler) Close() error {
+	return this.Db.Close()
+}
+func (this *SqliteDatabaseHandler) Model(value interface{}) DatabaseHandler {
+	this.Db = this.Db.Model(value)
+	return this
+}
+func (this *SqliteDatabaseHandler) Table(name string) DatabaseHandler {
+	this.Db = this.Db.Table(name)
+	return this
+}
+func (this *SqliteDatabaseHandler) Debug() DatabaseHandler {
+	this.Db = this.Db.Debug()
+	return this
+}
+
+// UsePrimary does nothing, the handler has no read replicas.
+func (this *SqliteDatabaseHandler) UsePrimary() DatabaseHandler {
+	return this
+}
+func (this *SqliteDatabaseHandler) Error() error {
+	return this.Db.Error
+}
+func (this *SqliteDatabaseHandler) Callback() DatabaseCallback {
+	return this.Db.Callback()
+}
+
+func (this *SqliteDatabaseHandler) Stats() sql.DBStats {
+	if db := sqlDBOf(this.Db); db != nil {
+		return db.Stats()
+	}
+	return sql.DBStats{}
+}
+
+func (this *SqliteDatabaseHandler) NewRecord(value interface{}) bool {
+	return this.Db.NewRecord(value)
+}
+func (this *SqliteDatabaseHandler) RecordNotFound() bool {
+	return this.Db.RecordNotFound()
+}
+
+// Table
+func (this *SqliteDatabaseHandler) CreateTable(models ...interface{}) DatabaseHandler {
+	this.Db = this.Db.CreateTable(models...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Set(name string, value interface{}) DatabaseHandler {
+	this.Db = this.Db.Set(name, value)
+	return this
+}
+func (this *SqliteDatabaseHandler) AutoMigrate(values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.AutoMigrate(values...)
+	return this
+}
+func (this *SqliteDatabaseHandler) DropTable(values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.DropTable(values...)
+	return this
+}
+func (this *SqliteDatabaseHandler) DropTableIfExists(values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.DropTableIfExists(values...)
+	return this
+}
+func (this *SqliteDatabaseHandler) HasTable(value interface{}) bool {
+	return this.Db.HasTable(value)
+}
+func (this *SqliteDatabaseHandler) ModifyColumn(column string, typ string) DatabaseHandler {
+	this.Db = this.Db.ModifyColumn(column, typ)
+	return this
+}
+func (this *SqliteDatabaseHandler) DropColumn(column string) DatabaseHandler {
+	this.Db = this.Db.DropColumn(column)
+	return this
+}
+func (this *SqliteDatabaseHandler) AddIndex(indexName string, columns ...string) DatabaseHandler {
+	this.Db = this.Db.AddIndex(indexName, columns...)
+	return this
+}
+func (this *SqliteDatabaseHandler) AddUniqueIndex(indexName string, columns ...string) DatabaseHandler {
+	this.Db = this.Db.AddUniqueIndex(indexName, columns...)
+	return this
+}
+func (this *SqliteDatabaseHandler) RemoveIndex(indexName string) DatabaseHandler {
+	this.Db = this.Db.RemoveIndex(indexName)
+	return this
+}
+func (this *SqliteDatabaseHandler) AddForeignKey(field string, dest string, onDelete string, onUpdate string) DatabaseHandler {
+	this.Db = this.Db.AddForeignKey(field, dest, onDelete, onUpdate)
+	return this
+}
+
+// Query
+func (this *SqliteDatabaseHandler) Where(query interface{}, args ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Where(query, args...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Or(query interface{}, args ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Or(query, args...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Not(query interface{}, args ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Not(query, args...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Limit(limit interface{}) DatabaseHandler {
+	this.Db = this.Db.Limit(limit)
+	return this
+}
+func (this *SqliteDatabaseHandler) Offset(offset interface{}) DatabaseHandler {
+	this.Db = this.Db.Offset(offset)
+	return this
+}
+func (this *SqliteDatabaseHandler) Order(value interface{}, reorder ...bool) DatabaseHandler {
+	this.Db = this.Db.Order(value, reorder...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Select(query interface{}, args ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Select(query, args...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Omit(columns ...string) DatabaseHandler {
+	this.Db = this.Db.Omit(columns...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Having(query string, values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Having(query, values...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Joins(query string, args ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Joins(query, args...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Find(out interface{}, where ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Find(out, where...)
+	return this
+}
+func (this *SqliteDatabaseHandler) First(out interface{}, where ...interface{}) DatabaseHandler {
+	this.Db = this.Db.First(out, where...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Last(out interface{}, where ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Last(out, where...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Row() *sql.Row {
+	return this.Db.Row()
+}
+func (this *SqliteDatabaseHandler) Rows() (*sql.Rows, error) {
+	return this.Db.Rows()
+}
+func (this *SqliteDatabaseHandler) Pluck(column string, value interface{}) DatabaseHandler {
+	this.Db = this.Db.Pluck(column, value)
+	return this
+}
+func (this *SqliteDatabaseHandler) Count(value interface{}) DatabaseHandler {
+	this.Db = this.Db.Count(value)
+	return this
+}
+
+func (this *SqliteDatabaseHandler) Related(value interface{}, foreignKeys ...string) DatabaseHandler {
+	this.Db = this.Db.Related(value, foreignKeys...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Scan(dest interface{}) DatabaseHandler {
+	this.Db = this.Db.Scan(dest)
+	return this
+}
+
+// Update
+func (this *SqliteDatabaseHandler) Update(attrs ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Update(attrs...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Updates(values interface{}, ignoreProtectedAttrs ...bool) DatabaseHandler {
+	this.Db = this.Db.Updates(values)
+	return this
+}
+func (this *SqliteDatabaseHandler) UpdateColumn(attrs ...interface{}) DatabaseHandler {
+	this.Db = this.Db.UpdateColumn(attrs...)
+	return this
+}
+func (this *SqliteDatabaseHandler) UpdateColumns(values interface{}) DatabaseHandler {
+	this.Db = this.Db.UpdateColumns(values)
+	return this
+}
+func (this *SqliteDatabaseHandler) Save(value interface{}) DatabaseHandler {
+	this.Db = this.Db.Save(value)
+	return this
+}
+
+// Insert
+func (this *SqliteDatabaseHandler) Create(value interface{}) DatabaseHandler {
+	this.Db = this.Db.Create(value)
+	return this
+}
+
+// Delete
+func (this *SqliteDatabaseHandler) Delete(value interface{}, where ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Delete(value, where...)
+	return this
+}
+
+// Unscoped
+func (this *SqliteDatabaseHandler) Unscoped() DatabaseHandler {
+	this.Db = this.Db.Unscoped()
+	return this
+}
+
+// Scoped
+func (this *SqliteDatabaseHandler) Scopes(funcs ...func(*gorm.DB) *gorm.DB) DatabaseHandler {
+	this.Db = this.Db.Scopes(funcs...)
+	return this
+}
+
+// Raw Sql
+func (this *SqliteDatabaseHandler) Raw(sql string, values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Raw(sql, values...)
+	return this
+}
+func (this *SqliteDatabaseHandler) Exec(sql string, values ...interface{}) DatabaseHandler {
+	this.Db = this.Db.Exec(sql, values...)
+	return this
+}
+
+// Transaction
+func (this *SqliteDatabaseHandler) Transaction(ctx context.Context, fn func(tx DatabaseHandler) error, setters ...TransactionOption) error {
+	return transaction(this, this.Db, ctx, fn, setters...)
+}
+func (this *SqliteDatabaseHandler) Begin() DatabaseHandler {
+	tx := &SqliteDatabaseHandler{
+		Db: begin(this.Db),
+	}
+	return tx
+}
+
+func (this *SqliteDatabaseHandler) Commit() DatabaseHandler {
+	this.Db = this.Db.Commit()
+	return this
+}
+
+func (this *SqliteDatabaseHandler) Rollback() DatabaseHandler {
+	this.Db = this.Db.Rollback()
+	return this
+}
@@ -0,0 +1,9 @@
+// Package sqlite registers the driver of the sqlite3 provider of the database component,
+// the driver needs cgo so it is only linked in the programs importing this package:
+//
+//	import _ "github.com/ltick/tick-framework/database/sqlite"
+package sqlite
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
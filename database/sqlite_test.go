@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/ltick/tick-framework/database/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+type testUser struct {
+	ID   uint `gorm:"primary_key"`
+	Name string
+}
+
+func TestSqliteHandler(t *testing.T) {
+	handler := NewSqliteHandler()
+	assert.Nil(t, handler.Initiate(context.Background()))
+	_, err := handler.NewHandler("test", map[string]interface{}{})
+	assert.NotNil(t, err)
+	_, err = handler.GetHandler("test")
+	assert.NotNil(t, err)
+	assert.True(t, HandlerNotExists(err))
+
+	db, err := handler.NewHandler("test", map[string]interface{}{
+		"DATABASE_SQLITE_PATH":    ":memory:",
+		"DATABASE_SQLITE_TIMEOUT": "1s",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+	assert.Equal(t, ":memory:", db.GetConfig()["path"])
+	assert.Nil(t, db.New().AutoMigrate(&testUser{}).Error())
+	assert.Nil(t, db.New().Create(&testUser{Name: "ltick"}).Error())
+
+	getDb, err := handler.GetHandler("test")
+	assert.Nil(t, err)
+	var user testUser
+	assert.Nil(t, getDb.New().Where("name = ?", "ltick").First(&user).Error())
+	assert.Equal(t, uint(1), user.ID)
+	assert.True(t, getDb.New().Where("name = ?", "unknown").First(&testUser{}).RecordNotFound())
+
+	tx := getDb.New().Begin()
+	assert.Nil(t, tx.Create(&testUser{Name: "rollback"}).Error())
+	assert.Nil(t, tx.Rollback().Error())
+	var count int
+	assert.Nil(t, getDb.New().Model(&testUser{}).Count(&count).Error())
+	assert.Equal(t, 1, count)
+}
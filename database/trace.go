@@ -0,0 +1,451 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"github.com/ltick/tick-framework/tracing"
+)
+
+const (
+	databaseTraceComponent      = "database"
+	nosqlDatabaseTraceComponent = "nosql"
+)
+
+// tracedDatabaseHandler records every statement executed by a DatabaseHandler
+// as a span, the query building methods are only forwarded.
+type tracedDatabaseHandler struct {
+	handler DatabaseHandler
+	tracer  tracing.Tracer
+	target  string
+	ctx     context.Context // the parent of the spans, set by WithContext
+}
+
+// NewTracedDatabaseHandler wraps handler so that its operations are traced by
+// tracer, handler is returned as is when tracer is nil.
+func NewTracedDatabaseHandler(handler DatabaseHandler, tracer tracing.Tracer) DatabaseHandler {
+	if handler == nil || tracer == nil {
+		return handler
+	}
+	if _, ok := handler.(*tracedDatabaseHandler); ok {
+		return handler
+	}
+	return &tracedDatabaseHandler{
+		handler: handler,
+		tracer:  tracer,
+		target:  databaseTarget(handler.GetConfig()),
+	}
+}
+
+func databaseTarget(config map[string]interface{}) string {
+	return fmt.Sprintf("%v:%v/%v", config["host"], config["port"], config["database"])
+}
+
+func (this *tracedDatabaseHandler) wrap(handler DatabaseHandler) DatabaseHandler {
+	return &tracedDatabaseHandler{
+		handler: handler,
+		tracer:  this.tracer,
+		target:  this.target,
+		ctx:     this.ctx,
+	}
+}
+
+func (this *tracedDatabaseHandler) trace(operation string, execute func() DatabaseHandler) DatabaseHandler {
+	span, _ := tracing.StartOperation(this.ctx, this.tracer, databaseTraceComponent, operation, this.target)
+	this.handler = execute()
+	span.Finish(this.handler.Error())
+	return this
+}
+
+func (this *tracedDatabaseHandler) GetConfig() map[string]interface{} {
+	return this.handler.GetConfig()
+}
+func (this *tracedDatabaseHandler) New() DatabaseHandler {
+	return this.wrap(this.handler.New())
+}
+func (this *tracedDatabaseHandler) WithContext(ctx context.Context) DatabaseHandler {
+	handler := this.wrap(this.handler.WithContext(ctx)).(*tracedDatabaseHandler)
+	handler.ctx = ctx
+	return handler
+}
+func (this *tracedDatabaseHandler) Close() error {
+	span, _ := tracing.StartOperation(this.ctx, this.tracer, databaseTraceComponent, "Close", this.target)
+	err := this.handler.Close()
+	span.Finish(err)
+	return err
+}
+func (this *tracedDatabaseHandler) Model(value interface{}) DatabaseHandler {
+	this.handler = this.handler.Model(value)
+	return this
+}
+func (this *tracedDatabaseHandler) UsePrimary() DatabaseHandler {
+	this.handler = this.handler.UsePrimary()
+	return this
+}
+func (this *tracedDatabaseHandler) Table(name string) DatabaseHandler {
+	this.handler = this.handler.Table(name)
+	return this
+}
+func (this *tracedDatabaseHandler) Debug() DatabaseHandler {
+	this.handler = this.handler.Debug()
+	return this
+}
+func (this *tracedDatabaseHandler) Error() error {
+	return this.handler.Error()
+}
+func (this *tracedDatabaseHandler) Stats() sql.DBStats {
+	return this.handler.Stats()
+}
+func (this *tracedDatabaseHandler) Callback() DatabaseCallback {
+	return this.handler.Callback()
+}
+func (this *tracedDatabaseHandler) NewRecord(value interface{}) bool {
+	return this.handler.NewRecord(value)
+}
+func (this *tracedDatabaseHandler) RecordNotFound() bool {
+	return this.handler.RecordNotFound()
+}
+
+// Table
+func (this *tracedDatabaseHandler) CreateTable(models ...interface{}) DatabaseHandler {
+	return this.trace("CreateTable", func() DatabaseHandler {
+		return this.handler.CreateTable(models...)
+	})
+}
+func (this *tracedDatabaseHandler) Set(name string, value interface{}) DatabaseHandler {
+	this.handler = this.handler.Set(name, value)
+	return this
+}
+func (this *tracedDatabaseHandler) AutoMigrate(values ...interface{}) DatabaseHandler {
+	return this.trace("AutoMigrate", func() DatabaseHandler {
+		return this.handler.AutoMigrate(values...)
+	})
+}
+func (this *tracedDatabaseHandler) DropTable(values ...interface{}) DatabaseHandler {
+	return this.trace("DropTable", func() DatabaseHandler {
+		return this.handler.DropTable(values...)
+	})
+}
+func (this *tracedDatabaseHandler) DropTableIfExists(values ...interface{}) DatabaseHandler {
+	return this.trace("DropTableIfExists", func() DatabaseHandler {
+		return this.handler.DropTableIfExists(values...)
+	})
+}
+func (this *tracedDatabaseHandler) HasTable(value interface{}) bool {
+	span, _ := tracing.StartOperation(this.ctx, this.tracer, databaseTraceComponent, "HasTable", this.target)
+	hasTable := this.handler.HasTable(value)
+	span.Finish(nil)
+	return hasTable
+}
+func (this *tracedDatabaseHandler) ModifyColumn(column string, typ string) DatabaseHandler {
+	return this.trace("ModifyColumn", func() DatabaseHandler {
+		return this.handler.ModifyColumn(column, typ)
+	})
+}
+func (this *tracedDatabaseHandler) DropColumn(column string) DatabaseHandler {
+	return this.trace("DropColumn", func() DatabaseHandler {
+		return this.handler.DropColumn(column)
+	})
+}
+func (this *tracedDatabaseHandler) AddIndex(indexName string, columns ...string) DatabaseHandler {
+	return this.trace("AddIndex", func() DatabaseHandler {
+		return this.handler.AddIndex(indexName, columns...)
+	})
+}
+func (this *tracedDatabaseHandler) AddUniqueIndex(indexName string, columns ...string) DatabaseHandler {
+	return this.trace("AddUniqueIndex", func() DatabaseHandler {
+		return this.handler.AddUniqueIndex(indexName, columns...)
+	})
+}
+func (this *tracedDatabaseHandler) RemoveIndex(indexName string) DatabaseHandler {
+	return this.trace("RemoveIndex", func() DatabaseHandler {
+		return this.handler.RemoveIndex(indexName)
+	})
+}
+func (this *tracedDatabaseHandler) AddForeignKey(field string, dest string, onDelete string, onUpdate string) DatabaseHandler {
+	return this.trace("AddForeignKey", func() DatabaseHandler {
+		return this.handler.AddForeignKey(field, dest, onDelete, onUpdate)
+	})
+}
+
+// Query
+func (this *tracedDatabaseHandler) Where(query interface{}, args ...interface{}) DatabaseHandler {
+	this.handler = this.handler.Where(query, args...)
+	return this
+}
+func (this *tracedDatabaseHandler) Or(query interface{}, args ...interface{}) DatabaseHandler {
+	this.handler = this.handler.Or(query, args...)
+	return this
+}
+func (this *tracedDatabaseHandler) Not(query interface{}, args ...interface{}) DatabaseHandler {
+	this.handler = this.handler.Not(query, args...)
+	return this
+}
+func (this *tracedDatabaseHandler) Limit(limit interface{}) DatabaseHandler {
+	this.handler = this.handler.Limit(limit)
+	return this
+}
+func (this *tracedDatabaseHandler) Offset(offset interface{}) DatabaseHandler {
+	this.handler = this.handler.Offset(offset)
+	return this
+}
+func (this *tracedDatabaseHandler) Order(value interface{}, reorder ...bool) DatabaseHandler {
+	this.handler = this.handler.Order(value, reorder...)
+	return this
+}
+func (this *tracedDatabaseHandler) Select(query interface{}, args ...interface{}) DatabaseHandler {
+	this.handler = this.handler.Select(query, args...)
+	return this
+}
+func (this *tracedDatabaseHandler) Omit(columns ...string) DatabaseHandler {
+	this.handler = this.handler.Omit(columns...)
+	return this
+}
+func (this *tracedDatabaseHandler) Having(query string, values ...interface{}) DatabaseHandler {
+	this.handler = this.handler.Having(query, values...)
+	return this
+}
+func (this *tracedDatabaseHandler) Joins(query string, args ...interface{}) DatabaseHandler {
+	this.handler = this.handler.Joins(query, args...)
+	return this
+}
+func (this *tracedDatabaseHandler) Find(out interface{}, where ...interface{}) DatabaseHandler {
+	return this.trace("Find", func() DatabaseHandler {
+		return this.handler.Find(out, where...)
+	})
+}
+func (this *tracedDatabaseHandler) First(out interface{}, where ...interface{}) DatabaseHandler {
+	return this.trace("First", func() DatabaseHandler {
+		return this.handler.First(out, where...)
+	})
+}
+func (this *tracedDatabaseHandler) Last(out interface{}, where ...interface{}) DatabaseHandler {
+	return this.trace("Last", func() DatabaseHandler {
+		return this.handler.Last(out, where...)
+	})
+}
+func (this *tracedDatabaseHandler) Row() *sql.Row {
+	span, _ := tracing.StartOperation(this.ctx, this.tracer, databaseTraceComponent, "Row", this.target)
+	row := this.handler.Row()
+	span.Finish(nil)
+	return row
+}
+func (this *tracedDatabaseHandler) Rows() (*sql.Rows, error) {
+	span, _ := tracing.StartOperation(this.ctx, this.tracer, databaseTraceComponent, "Rows", this.target)
+	rows, err := this.handler.Rows()
+	span.Finish(err)
+	return rows, err
+}
+func (this *tracedDatabaseHandler) Pluck(column string, value interface{}) DatabaseHandler {
+	return this.trace("Pluck", func() DatabaseHandler {
+		return this.handler.Pluck(column, value)
+	})
+}
+func (this *tracedDatabaseHandler) Count(value interface{}) DatabaseHandler {
+	return this.trace("Count", func() DatabaseHandler {
+		return this.handler.Count(value)
+	})
+}
+func (this *tracedDatabaseHandler) Related(value interface{}, foreignKeys ...string) DatabaseHandler {
+	return this.trace("Related", func() DatabaseHandler {
+		return this.handler.Related(value, foreignKeys...)
+	})
+}
+func (this *tracedDatabaseHandler) Scan(dest interface{}) DatabaseHandler {
+	return this.trace("Scan", func() DatabaseHandler {
+		return this.handler.Scan(dest)
+	})
+}
+
+// Update
+func (this *tracedDatabaseHandler) Update(attrs ...interface{}) DatabaseHandler {
+	return this.trace("Update", func() DatabaseHandler {
+		return this.handler.Update(attrs...)
+	})
+}
+func (this *tracedDatabaseHandler) Updates(values interface{}, ignoreProtectedAttrs ...bool) DatabaseHandler {
+	return this.trace("Updates", func() DatabaseHandler {
+		return this.handler.Updates(values, ignoreProtectedAttrs...)
+	})
+}
+func (this *tracedDatabaseHandler) UpdateColumn(attrs ...interface{}) DatabaseHandler {
+	return this.trace("UpdateColumn", func() DatabaseHandler {
+		return this.handler.UpdateColumn(attrs...)
+	})
+}
+func (this *tracedDatabaseHandler) UpdateColumns(values interface{}) DatabaseHandler {
+	return this.trace("UpdateColumns", func() DatabaseHandler {
+		return this.handler.UpdateColumns(values)
+	})
+}
+func (this *tracedDatabaseHandler) Save(value interface{}) DatabaseHandler {
+	return this.trace("Save", func() DatabaseHandler {
+		return this.handler.Save(value)
+	})
+}
+
+// Insert
+func (this *tracedDatabaseHandler) Create(value interface{}) DatabaseHandler {
+	return this.trace("Create", func() DatabaseHandler {
+		return this.handler.Create(value)
+	})
+}
+
+// Delete
+func (this *tracedDatabaseHandler) Delete(value interface{}, where ...interface{}) DatabaseHandler {
+	return this.trace("Delete", func() DatabaseHandler {
+		return this.handler.Delete(value, where...)
+	})
+}
+func (this *tracedDatabaseHandler) Unscoped() DatabaseHandler {
+	this.handler = this.handler.Unscoped()
+	return this
+}
+func (this *tracedDatabaseHandler) Scopes(funcs ...func(*gorm.DB) *gorm.DB) DatabaseHandler {
+	this.handler = this.handler.Scopes(funcs...)
+	return this
+}
+
+// Raw Sql
+func (this *tracedDatabaseHandler) Raw(sql string, values ...interface{}) DatabaseHandler {
+	this.handler = this.handler.Raw(sql, values...)
+	return this
+}
+func (this *tracedDatabaseHandler) RawRead(sql string, values ...interface{}) DatabaseHandler {
+	this.handler = RawRead(this.handler, sql, values...)
+	return this
+}
+func (this *tracedDatabaseHandler) Exec(sql string, values ...interface{}) DatabaseHandler {
+	return this.trace("Exec", func() DatabaseHandler {
+		return this.handler.Exec(sql, values...)
+	})
+}
+
+// Transaction
+func (this *tracedDatabaseHandler) Transaction(ctx context.Context, fn func(tx DatabaseHandler) error, setters ...TransactionOption) error {
+	if ctx == nil {
+		ctx = this.ctx
+	}
+	span, spanCtx := tracing.StartOperation(ctx, this.tracer, databaseTraceComponent, "Transaction", this.target)
+	err := this.handler.Transaction(ctx, func(tx DatabaseHandler) error {
+		traced := this.wrap(tx).(*tracedDatabaseHandler)
+		traced.ctx = spanCtx
+		return fn(traced)
+	}, setters...)
+	span.Finish(err)
+	return err
+}
+func (this *tracedDatabaseHandler) Begin() DatabaseHandler {
+	span, _ := tracing.StartOperation(this.ctx, this.tracer, databaseTraceComponent, "Begin", this.target)
+	tx := this.handler.Begin()
+	span.Finish(tx.Error())
+	return this.wrap(tx)
+}
+func (this *tracedDatabaseHandler) Commit() DatabaseHandler {
+	return this.trace("Commit", func() DatabaseHandler {
+		return this.handler.Commit()
+	})
+}
+func (this *tracedDatabaseHandler) Rollback() DatabaseHandler {
+	return this.trace("Rollback", func() DatabaseHandler {
+		return this.handler.Rollback()
+	})
+}
+
+/****************** Nosql ******************/
+
+// tracedNosqlDatabaseHandler records every table operation of a NosqlDatabaseHandler as a span.
+type tracedNosqlDatabaseHandler struct {
+	handler NosqlDatabaseHandler
+	tracer  tracing.Tracer
+}
+
+// NewTracedNosqlDatabaseHandler wraps handler so that its table operations are
+// traced by tracer, handler is returned as is when tracer is nil.
+func NewTracedNosqlDatabaseHandler(handler NosqlDatabaseHandler, tracer tracing.Tracer) NosqlDatabaseHandler {
+	if handler == nil || tracer == nil {
+		return handler
+	}
+	if _, ok := handler.(*tracedNosqlDatabaseHandler); ok {
+		return handler
+	}
+	return &tracedNosqlDatabaseHandler{
+		handler: handler,
+		tracer:  tracer,
+	}
+}
+
+func (this *tracedNosqlDatabaseHandler) GetHandler() (client interface{}, err error) {
+	return this.handler.GetHandler()
+}
+func (this *tracedNosqlDatabaseHandler) ReleaseHandler(client interface{}) {
+	this.handler.ReleaseHandler(client)
+}
+func (this *tracedNosqlDatabaseHandler) GetHandlerPoolSize() int {
+	return this.handler.GetHandlerPoolSize()
+}
+func (this *tracedNosqlDatabaseHandler) Scan(ctx context.Context, table string, setters ...NosqlQueryOption) (NosqlDatabaseScanner, error) {
+	span, ctx := tracing.StartOperation(ctx, this.tracer, nosqlDatabaseTraceComponent, "Scan", table)
+	scanner, err := this.handler.Scan(ctx, table, setters...)
+	span.Finish(err)
+	return scanner, err
+}
+func (this *tracedNosqlDatabaseHandler) Get(ctx context.Context, table string, key string, setters ...NosqlQueryOption) (*NosqlRow, error) {
+	span, ctx := tracing.StartOperation(ctx, this.tracer, nosqlDatabaseTraceComponent, "Get", table)
+	row, err := this.handler.Get(ctx, table, key, setters...)
+	span.Finish(err)
+	return row, err
+}
+func (this *tracedNosqlDatabaseHandler) BatchGet(ctx context.Context, table string, keys []string, setters ...NosqlQueryOption) ([]*NosqlRow, error) {
+	span, ctx := tracing.StartOperation(ctx, this.tracer, nosqlDatabaseTraceComponent, "BatchGet", table)
+	rows, err := this.handler.BatchGet(ctx, table, keys, setters...)
+	span.Finish(err)
+	return rows, err
+}
+func (this *tracedNosqlDatabaseHandler) Put(ctx context.Context, table string, key string, values map[string]map[string][]byte) (err error) {
+	span, ctx := tracing.StartOperation(ctx, this.tracer, nosqlDatabaseTraceComponent, "Put", table)
+	err = this.handler.Put(ctx, table, key, values)
+	span.Finish(err)
+	return err
+}
+func (this *tracedNosqlDatabaseHandler) Delete(ctx context.Context, table string, key string, values map[string]map[string][]byte) (err error) {
+	span, ctx := tracing.StartOperation(ctx, this.tracer, nosqlDatabaseTraceComponent, "Delete", table)
+	err = this.handler.Delete(ctx, table, key, values)
+	span.Finish(err)
+	return err
+}
+func (this *tracedNosqlDatabaseHandler) BatchPut(ctx context.Context, table string, rows map[string]map[string]map[string][]byte) error {
+	span, ctx := tracing.StartOperation(ctx, this.tracer, nosqlDatabaseTraceComponent, "BatchPut", table)
+	err := this.handler.BatchPut(ctx, table, rows)
+	span.Finish(err)
+	return err
+}
+func (this *tracedNosqlDatabaseHandler) BatchDelete(ctx context.Context, table string, rows map[string]map[string]map[string][]byte) error {
+	span, ctx := tracing.StartOperation(ctx, this.tracer, nosqlDatabaseTraceComponent, "BatchDelete", table)
+	err := this.handler.BatchDelete(ctx, table, rows)
+	span.Finish(err)
+	return err
+}
+func (this *tracedNosqlDatabaseHandler) Append(ctx context.Context, table string, key string, values map[string]map[string][]byte) error {
+	span, ctx := tracing.StartOperation(ctx, this.tracer, nosqlDatabaseTraceComponent, "Append", table)
+	err := this.handler.Append(ctx, table, key, values)
+	span.Finish(err)
+	return err
+}
+func (this *tracedNosqlDatabaseHandler) Increment(ctx context.Context, table string, key string, values map[string]map[string][]byte) (int64, error) {
+	span, ctx := tracing.StartOperation(ctx, this.tracer, nosqlDatabaseTraceComponent, "Increment", table)
+	i, err := this.handler.Increment(ctx, table, key, values)
+	span.Finish(err)
+	return i, err
+}
+func (this *tracedNosqlDatabaseHandler) CheckAndPut(ctx context.Context, table string, key string, values map[string]map[string][]byte, family string, qualifier string, expectedValue []byte) (bool, error) {
+	span, ctx := tracing.StartOperation(ctx, this.tracer, nosqlDatabaseTraceComponent, "CheckAndPut", table)
+	b, err := this.handler.CheckAndPut(ctx, table, key, values, family, qualifier, expectedValue)
+	span.Finish(err)
+	return b, err
+}
+func (this *tracedNosqlDatabaseHandler) Close() {
+	this.handler.Close()
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/juju/errors"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultTransactionRetries    = 3
+	defaultTransactionBackoff    = 50 * time.Millisecond
+	defaultTransactionMaxBackoff = time.Second
+
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrLockDeadlock    = 1213
+
+	postgresErrSerializationFailure = "40001"
+	postgresErrDeadlockDetected     = "40P01"
+)
+
+type (
+	TransactionOptions struct {
+		Retries    int
+		Backoff    time.Duration
+		MaxBackoff time.Duration
+	}
+
+	TransactionOption func(*TransactionOptions)
+)
+
+// TransactionRetries sets how many times a transaction failing with a deadlock or a lock wait timeout is retried, 3 by default.
+func TransactionRetries(retries int) TransactionOption {
+	return func(options *TransactionOptions) {
+		options.Retries = retries
+	}
+}
+
+// TransactionBackoff sets the wait before the first retry, doubled on each retry up to maxBackoff, 50ms and 1s by default.
+func TransactionBackoff(backoff time.Duration, maxBackoff time.Duration) TransactionOption {
+	return func(options *TransactionOptions) {
+		options.Backoff = backoff
+		options.MaxBackoff = maxBackoff
+	}
+}
+
+// savepointSequence numbers the savepoints of the nested transactions.
+var savepointSequence uint64
+
+// transaction runs fn in a transaction of handler, whose connection is db: the transaction is committed if fn succeeds,
+// rolled back if it fails or panics, and retried if it fails with a deadlock or a lock wait timeout.
+// Inside a transaction, fn runs in a savepoint, rolled back on its failure only.
+func transaction(handler DatabaseHandler, db *gorm.DB, ctx context.Context, fn func(tx DatabaseHandler) error, setters ...TransactionOption) error {
+	if inTransaction(db) {
+		return savepoint(handler, ctx, fn)
+	}
+	options := &TransactionOptions{
+		Retries:    defaultTransactionRetries,
+		Backoff:    defaultTransactionBackoff,
+		MaxBackoff: defaultTransactionMaxBackoff,
+	}
+	for _, setter := range setters {
+		setter(options)
+	}
+	backoff := options.Backoff
+	for retry := 0; ; retry++ {
+		err := runTransaction(handler, ctx, fn)
+		if err == nil || retry >= options.Retries || !IsRetryableError(err) {
+			return err
+		}
+		// the jitter spreads the retries of the transactions in conflict
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if ctx != nil {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(wait):
+			}
+		} else {
+			time.Sleep(wait)
+		}
+		if backoff *= 2; backoff > options.MaxBackoff {
+			backoff = options.MaxBackoff
+		}
+	}
+}
+
+func runTransaction(handler DatabaseHandler, ctx context.Context, fn func(tx DatabaseHandler) error) (err error) {
+	tx := handler.New()
+	if ctx != nil {
+		tx = tx.WithContext(ctx)
+	}
+	tx = tx.Begin()
+	if err = tx.Error(); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	// fn gets a copy, so that its errors handled such as gorm.ErrRecordNotFound don't fail the commit
+	if err = fn(tx.New()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error()
+}
+
+func savepoint(handler DatabaseHandler, ctx context.Context, fn func(tx DatabaseHandler) error) (err error) {
+	tx := handler.New()
+	if ctx != nil {
+		tx = tx.WithContext(ctx)
+	}
+	name := fmt.Sprintf("ltick_savepoint_%d", atomic.AddUint64(&savepointSequence, 1))
+	if err = tx.New().Exec("SAVEPOINT " + name).Error(); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.New().Exec("ROLLBACK TO SAVEPOINT " + name)
+			panic(r)
+		}
+	}()
+	if err = fn(tx.New()); err != nil {
+		tx.New().Exec("ROLLBACK TO SAVEPOINT " + name)
+		return err
+	}
+	return tx.New().Exec("RELEASE SAVEPOINT " + name).Error()
+}
+
+func inTransaction(db *gorm.DB) bool {
+	switch db.CommonDB().(type) {
+	case *sql.Tx, *contextTx:
+		return true
+	}
+	return false
+}
+
+// IsRetryableError tests if err is a deadlock or a lock wait timeout, after which the transaction can be retried.
+func IsRetryableError(err error) bool {
+	switch err := errors.Cause(err).(type) {
+	case *mysqlDriver.MySQLError:
+		return err.Number == mysqlErrLockDeadlock || err.Number == mysqlErrLockWaitTimeout
+	case *pq.Error:
+		return err.Code == postgresErrSerializationFailure || err.Code == postgresErrDeadlockDetected
+	case gorm.Errors:
+		for _, e := range err {
+			if IsRetryableError(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
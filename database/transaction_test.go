@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	jujuErrors "github.com/juju/errors"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction(t *testing.T) {
+	handler := NewSqliteHandler()
+	assert.Nil(t, handler.Initiate(context.Background()))
+	db, err := handler.NewHandler("transaction", map[string]interface{}{
+		"DATABASE_SQLITE_PATH": ":memory:",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+	assert.Nil(t, db.New().AutoMigrate(&testUser{}).Error())
+	count := func() int {
+		var count int
+		assert.Nil(t, db.New().Model(&testUser{}).Count(&count).Error())
+		return count
+	}
+
+	assert.Nil(t, db.Transaction(context.Background(), func(tx DatabaseHandler) error {
+		// the errors handled don't fail the commit
+		assert.True(t, tx.New().Where("name = ?", "unknown").First(&testUser{}).RecordNotFound())
+		return tx.New().Create(&testUser{Name: "commit"}).Error()
+	}))
+	assert.Equal(t, 1, count())
+
+	errRollback := errors.New("rollback")
+	assert.Equal(t, errRollback, db.Transaction(nil, func(tx DatabaseHandler) error {
+		assert.Nil(t, tx.New().Create(&testUser{Name: "rollback"}).Error())
+		return errRollback
+	}))
+	assert.Equal(t, 1, count())
+	assert.Panics(t, func() {
+		db.Transaction(nil, func(tx DatabaseHandler) error {
+			assert.Nil(t, tx.New().Create(&testUser{Name: "panic"}).Error())
+			panic("panic")
+		})
+	})
+	assert.Equal(t, 1, count())
+
+	// savepoints
+	assert.Nil(t, db.Transaction(nil, func(tx DatabaseHandler) error {
+		assert.Nil(t, tx.New().Create(&testUser{Name: "outer"}).Error())
+		assert.Equal(t, errRollback, tx.Transaction(nil, func(tx DatabaseHandler) error {
+			assert.Nil(t, tx.New().Create(&testUser{Name: "inner"}).Error())
+			return errRollback
+		}))
+		return tx.Transaction(nil, func(tx DatabaseHandler) error {
+			return tx.New().Create(&testUser{Name: "released"}).Error()
+		})
+	}))
+	assert.Equal(t, 3, count())
+	assert.True(t, db.New().Where("name = ?", "inner").First(&testUser{}).RecordNotFound())
+
+	// retries
+	deadlock := &mysqlDriver.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	attempts := 0
+	assert.Nil(t, db.Transaction(nil, func(tx DatabaseHandler) error {
+		attempts++
+		assert.Nil(t, tx.New().Create(&testUser{Name: "retry"}).Error())
+		if attempts < 3 {
+			return deadlock
+		}
+		return nil
+	}, TransactionBackoff(time.Millisecond, 2*time.Millisecond)))
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 4, count())
+	attempts = 0
+	assert.Equal(t, deadlock, db.Transaction(nil, func(tx DatabaseHandler) error {
+		attempts++
+		return deadlock
+	}, TransactionRetries(1), TransactionBackoff(time.Millisecond, time.Millisecond)))
+	assert.Equal(t, 2, attempts)
+	attempts = 0
+	assert.Equal(t, errRollback, db.Transaction(nil, func(tx DatabaseHandler) error {
+		attempts++
+		return errRollback
+	}))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestIsRetryableError(t *testing.T) {
+	assert.True(t, IsRetryableError(&mysqlDriver.MySQLError{Number: 1213}))
+	assert.True(t, IsRetryableError(&mysqlDriver.MySQLError{Number: 1205}))
+	assert.False(t, IsRetryableError(&mysqlDriver.MySQLError{Number: 1062}))
+	assert.True(t, IsRetryableError(&pq.Error{Code: "40P01"}))
+	assert.True(t, IsRetryableError(jujuErrors.Annotate(&mysqlDriver.MySQLError{Number: 1213}, "update")))
+	assert.True(t, IsRetryableError(gorm.Errors{gorm.ErrRecordNotFound, &mysqlDriver.MySQLError{Number: 1213}}))
+	assert.False(t, IsRetryableError(gorm.ErrRecordNotFound))
+	assert.False(t, IsRetryableError(nil))
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 	"net/http"
 
+	"github.com/ltick/tick-framework/tracing"
 	"github.com/ltick/tick-framework/utility"
 	"github.com/ltick/tick-routing/access"
 	"github.com/ltick/tick-routing/fault"
@@ -105,6 +106,11 @@ func DefaultAccessLogFunc(req *http.Request, rw *access.LogResponseWriter, elaps
 	forwardRequestId := req.Context().Value("uniqid")
 	//请求ID
 	requestId := req.Context().Value("requestId")
+	//链路ID, 追加在行尾, 不影响已有字段的位置
+	traceId := "-"
+	if traceContext := tracing.TraceContextFromContext(req.Context()); traceContext != nil {
+		traceId = traceContext.TraceID
+	}
 	//客户端IP
 	clientIP := req.Context().Value(req.RemoteAddr)
 	//服务端IP
@@ -115,9 +121,9 @@ func DefaultAccessLogFunc(req *http.Request, rw *access.LogResponseWriter, elaps
 		*debug = req.Context().Value("DEBUG").(bool)
 	}
 	if *debug {
-		DefaultLogFunc(req.Context(), `LTICK_ACCESS|%s|%s|%s|%s - %s [%s] "%s" %d %d %d %.3f "%s" "%s" %s %s "%v" "%v"`, forwardRequestId, requestId, serverAddress, clientIP, req.Host, time.Now().Format("2/Jan/2006:15:04:05 -0700"), requestLine, req.ContentLength, rw.Status, rw.BytesWritten, elapsed/1e3, req.Header.Get("Referer"), req.Header.Get("User-Agent"), req.RemoteAddr, serverAddress, req.Header, rw.Header())
+		DefaultLogFunc(req.Context(), `LTICK_ACCESS|%s|%s|%s|%s - %s [%s] "%s" %d %d %d %.3f "%s" "%s" %s %s "%v" "%v" %s`, forwardRequestId, requestId, serverAddress, clientIP, req.Host, time.Now().Format("2/Jan/2006:15:04:05 -0700"), requestLine, req.ContentLength, rw.Status, rw.BytesWritten, elapsed/1e3, req.Header.Get("Referer"), req.Header.Get("User-Agent"), req.RemoteAddr, serverAddress, req.Header, rw.Header(), traceId)
 	} else {
-		DefaultLogFunc(req.Context(), `LTICK_ACCESS|%s|%s|%s|%s - %s [%s] "%s" %d %d %d %.3f "%s" "%s" %s %s "-" "-"`, forwardRequestId, requestId, serverAddress, clientIP, req.Host, time.Now().Format("2/Jan/2006:15:04:05 -0700"), requestLine, req.ContentLength, rw.Status, rw.BytesWritten, elapsed/1e3, req.Header.Get("Referer"), req.Header.Get("User-Agent"), req.RemoteAddr, serverAddress)
+		DefaultLogFunc(req.Context(), `LTICK_ACCESS|%s|%s|%s|%s - %s [%s] "%s" %d %d %d %.3f "%s" "%s" %s %s "-" "-" %s`, forwardRequestId, requestId, serverAddress, clientIP, req.Host, time.Now().Format("2/Jan/2006:15:04:05 -0700"), requestLine, req.ContentLength, rw.Status, rw.BytesWritten, elapsed/1e3, req.Header.Get("Referer"), req.Header.Get("User-Agent"), req.RemoteAddr, serverAddress, traceId)
 	}
 	if *debug {
 		DefaultLogFunc(req.Context(), `%s - %s [%s] "%s" %d %d %d %.3f "%s" "%s" %s %s "%v" "%v"`, clientIP, req.Host, time.Now().Format("2/Jan/2006:15:04:05 -0700"), requestLine, req.ContentLength, rw.Status, rw.BytesWritten, elapsed/1e3, req.Header.Get("Referer"), req.Header.Get("User-Agent"), req.RemoteAddr, serverAddress, req.Header, rw.Header())
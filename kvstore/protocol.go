@@ -7,6 +7,7 @@ import (
 
 	"github.com/juju/errors"
 	"github.com/ltick/tick-framework/config"
+	"github.com/ltick/tick-framework/tracing"
 )
 
 var (
@@ -30,6 +31,8 @@ type Kvstore struct {
 	configs  map[string]interface{}
 	provider string
 	handler  Handler
+	// Tracer traces the commands of the handlers when set
+	Tracer tracing.Tracer
 }
 
 func (c *Kvstore) Prepare(ctx context.Context) (context.Context, error) {
@@ -145,14 +148,14 @@ func (c *Kvstore) NewHandler(name string, configs ...map[string]interface{}) (Kv
 	if kvstoreHandler == nil {
 		return nil, errors.Annotate(err, fmt.Sprintf(errNewHandler+": empty pool", name))
 	}
-	return kvstoreHandler, nil
+	return NewTracedKvstoreHandler(kvstoreHandler, c.Tracer), nil
 }
 func (c *Kvstore) GetHandler(name string) (KvstoreHandler, error) {
 	kvstoreHandler, err := c.handler.GetHandler(name)
 	if err != nil {
 		return nil, errors.Annotate(err, fmt.Sprintf(errGetHandler, name))
 	}
-	return kvstoreHandler, err
+	return NewTracedKvstoreHandler(kvstoreHandler, c.Tracer), err
 }
 
 type Handler interface {
@@ -194,6 +197,25 @@ type KvstoreHandler interface {
 	Sort(key interface{}, by interface{}, offest int64, count int64, asc *bool, alpha *bool, get ...interface{}) ([]string, error)
 }
 
+// KvstoreCounter is implemented by the handlers supporting atomic counters.
+type KvstoreCounter interface {
+	Incrby(key interface{}, increment int64) (int64, error)
+}
+
+// KvstoreContextHandler is implemented by the handlers whose commands can be bound to a context.
+type KvstoreContextHandler interface {
+	WithContext(ctx context.Context) KvstoreHandler
+}
+
+// WithContext binds the commands of handler to ctx, e.g. to trace them within
+// a request, handler is returned as is when it does not support it.
+func WithContext(ctx context.Context, handler KvstoreHandler) KvstoreHandler {
+	if contextHandler, ok := handler.(KvstoreContextHandler); ok {
+		return contextHandler.WithContext(ctx)
+	}
+	return handler
+}
+
 type kvstoreHandler func() Handler
 
 var kvstoreHandlers = make(map[string]kvstoreHandler)
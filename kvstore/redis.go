@@ -239,6 +239,18 @@ func (this *RedisPool) Expire(key interface{}, expire int64) error {
 	_, err = c.Do("EXPIRE", sKey, expire)
 	return err
 }
+func (this *RedisPool) Incrby(key interface{}, increment int64) (int64, error) {
+	c := this.Pool.Get()
+	if this.Debug {
+		c = redis.NewLoggingConn(c, log.New(os.Stdout, "", log.LstdFlags), "")
+	}
+	defer c.Close()
+	sKey, err := this.generateKey(key)
+	if err != nil {
+		return 0, err
+	}
+	return redis.Int64(c.Do("INCRBY", sKey, increment))
+}
 func (this *RedisPool) Hmset(key interface{}, args ...interface{}) error {
 	c := this.Pool.Get()
 	if this.Debug {
@@ -0,0 +1,246 @@
+package kvstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ltick/tick-framework/tracing"
+)
+
+const kvstoreTraceComponent = "kvstore"
+
+// tracedKvstoreHandler records every command of a KvstoreHandler as a span.
+type tracedKvstoreHandler struct {
+	handler KvstoreHandler
+	tracer  tracing.Tracer
+	target  string
+	ctx     context.Context // the parent of the spans, set by WithContext
+}
+
+// tracedKvstoreCounter is the traced handler of a KvstoreCounter, so that
+// the wrapper is a counter only if the handler it wraps is one.
+type tracedKvstoreCounter struct {
+	*tracedKvstoreHandler
+}
+
+// NewTracedKvstoreHandler wraps handler so that its commands are traced by
+// tracer, handler is returned as is when tracer is nil.
+func NewTracedKvstoreHandler(handler KvstoreHandler, tracer tracing.Tracer) KvstoreHandler {
+	if handler == nil || tracer == nil {
+		return handler
+	}
+	switch handler.(type) {
+	case *tracedKvstoreHandler, *tracedKvstoreCounter:
+		return handler
+	}
+	config := handler.GetConfig()
+	return (&tracedKvstoreHandler{
+		handler: handler,
+		tracer:  tracer,
+		target:  fmt.Sprintf("%v:%v/%v", config["host"], config["port"], config["database"]),
+	}).wrap()
+}
+
+// wrap returns the handler as a counter if the handler it wraps is one.
+func (this *tracedKvstoreHandler) wrap() KvstoreHandler {
+	if _, ok := this.handler.(KvstoreCounter); ok {
+		return &tracedKvstoreCounter{this}
+	}
+	return this
+}
+
+func (this *tracedKvstoreHandler) start(operation string) *tracing.Span {
+	span, _ := tracing.StartOperation(this.ctx, this.tracer, kvstoreTraceComponent, operation, this.target)
+	return span
+}
+
+// WithContext returns a copy of the handler whose spans are children of the span of ctx.
+func (this *tracedKvstoreHandler) WithContext(ctx context.Context) KvstoreHandler {
+	return (&tracedKvstoreHandler{
+		handler: this.handler,
+		tracer:  this.tracer,
+		target:  this.target,
+		ctx:     ctx,
+	}).wrap()
+}
+
+func (this *tracedKvstoreHandler) GetConfig() map[string]interface{} {
+	return this.handler.GetConfig()
+}
+func (this *tracedKvstoreHandler) Set(key interface{}, value interface{}) error {
+	span := this.start("Set")
+	err := this.handler.Set(key, value)
+	span.Finish(err)
+	return err
+}
+func (this *tracedKvstoreHandler) Get(key interface{}) (interface{}, error) {
+	span := this.start("Get")
+	value, err := this.handler.Get(key)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Keys(key interface{}) (interface{}, error) {
+	span := this.start("Keys")
+	value, err := this.handler.Keys(key)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Expire(key interface{}, expire int64) error {
+	span := this.start("Expire")
+	err := this.handler.Expire(key, expire)
+	span.Finish(err)
+	return err
+}
+func (this *tracedKvstoreCounter) Incrby(key interface{}, increment int64) (int64, error) {
+	span := this.start("Incrby")
+	value, err := this.handler.(KvstoreCounter).Incrby(key, increment)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Hmset(key interface{}, value ...interface{}) error {
+	span := this.start("Hmset")
+	err := this.handler.Hmset(key, value...)
+	span.Finish(err)
+	return err
+}
+func (this *tracedKvstoreHandler) Hmget(key interface{}, value ...interface{}) (interface{}, error) {
+	span := this.start("Hmget")
+	values, err := this.handler.Hmget(key, value...)
+	span.Finish(err)
+	return values, err
+}
+func (this *tracedKvstoreHandler) Del(key interface{}) (interface{}, error) {
+	span := this.start("Del")
+	value, err := this.handler.Del(key)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Hset(key interface{}, field interface{}, value interface{}) error {
+	span := this.start("Hset")
+	err := this.handler.Hset(key, field, value)
+	span.Finish(err)
+	return err
+}
+func (this *tracedKvstoreHandler) Hget(key interface{}, field interface{}) (interface{}, error) {
+	span := this.start("Hget")
+	value, err := this.handler.Hget(key, field)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Hdel(key interface{}, field interface{}) (interface{}, error) {
+	span := this.start("Hdel")
+	value, err := this.handler.Hdel(key, field)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Hgetall(key interface{}) (interface{}, error) {
+	span := this.start("Hgetall")
+	value, err := this.handler.Hgetall(key)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Hlen(key interface{}) (interface{}, error) {
+	span := this.start("Hlen")
+	value, err := this.handler.Hlen(key)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Hscan(key interface{}, cursor string, match string, count int64) (interface{}, error) {
+	span := this.start("Hscan")
+	value, err := this.handler.Hscan(key, cursor, match, count)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Exists(key interface{}) (bool, error) {
+	span := this.start("Exists")
+	exists, err := this.handler.Exists(key)
+	span.Finish(err)
+	return exists, err
+}
+func (this *tracedKvstoreHandler) ScanStruct(src []interface{}, dest interface{}) error {
+	return this.handler.ScanStruct(src, dest)
+}
+func (this *tracedKvstoreHandler) Sadd(key interface{}, args ...interface{}) error {
+	span := this.start("Sadd")
+	err := this.handler.Sadd(key, args...)
+	span.Finish(err)
+	return err
+}
+func (this *tracedKvstoreHandler) Scard(key interface{}) (int64, error) {
+	span := this.start("Scard")
+	value, err := this.handler.Scard(key)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Zadd(key interface{}, args ...interface{}) error {
+	span := this.start("Zadd")
+	err := this.handler.Zadd(key, args...)
+	span.Finish(err)
+	return err
+}
+func (this *tracedKvstoreHandler) Zrem(key interface{}, field interface{}) (interface{}, error) {
+	span := this.start("Zrem")
+	value, err := this.handler.Zrem(key, field)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Zrange(key interface{}, start, end interface{}) (interface{}, error) {
+	span := this.start("Zrange")
+	value, err := this.handler.Zrange(key, start, end)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Zrevrange(key interface{}, start, end interface{}) (interface{}, error) {
+	span := this.start("Zrevrange")
+	value, err := this.handler.Zrevrange(key, start, end)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) ZrangeByScore(key interface{}, min, max interface{}, limits ...interface{}) (interface{}, error) {
+	span := this.start("ZrangeByScore")
+	value, err := this.handler.ZrangeByScore(key, min, max, limits...)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) ZrevrangeByScore(key interface{}, min, max interface{}, limits ...interface{}) (interface{}, error) {
+	span := this.start("ZrevrangeByScore")
+	value, err := this.handler.ZrevrangeByScore(key, min, max, limits...)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Zscore(key interface{}, field interface{}) (interface{}, error) {
+	span := this.start("Zscore")
+	value, err := this.handler.Zscore(key, field)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Zcard(key interface{}) (int64, error) {
+	span := this.start("Zcard")
+	value, err := this.handler.Zcard(key)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Zscan(key interface{}, cursor string, match string, count int64) (nextCursor string, keys []string, err error) {
+	span := this.start("Zscan")
+	nextCursor, keys, err = this.handler.Zscan(key, cursor, match, count)
+	span.Finish(err)
+	return nextCursor, keys, err
+}
+func (this *tracedKvstoreHandler) Sscan(key interface{}, cursor string, match string, count int64) (interface{}, error) {
+	span := this.start("Sscan")
+	value, err := this.handler.Sscan(key, cursor, match, count)
+	span.Finish(err)
+	return value, err
+}
+func (this *tracedKvstoreHandler) Scan(cursor string, match string, count int64) (nextCursor string, keys []string, err error) {
+	span := this.start("Scan")
+	nextCursor, keys, err = this.handler.Scan(cursor, match, count)
+	span.Finish(err)
+	return nextCursor, keys, err
+}
+func (this *tracedKvstoreHandler) Sort(key interface{}, by interface{}, offest int64, count int64, asc *bool, alpha *bool, get ...interface{}) ([]string, error) {
+	span := this.start("Sort")
+	values, err := this.handler.Sort(key, by, offest, count, asc, alpha, get...)
+	span.Finish(err)
+	return values, err
+}
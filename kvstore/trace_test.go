@@ -0,0 +1,65 @@
+package kvstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ltick/tick-framework/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+type testKvstoreHandler struct {
+	KvstoreHandler
+}
+
+func (h *testKvstoreHandler) GetConfig() map[string]interface{} {
+	return map[string]interface{}{"host": "127.0.0.1", "port": "6379", "database": 0}
+}
+func (h *testKvstoreHandler) Get(key interface{}) (interface{}, error) {
+	return "value", nil
+}
+
+func TestTracedKvstoreHandlerWithContext(t *testing.T) {
+	collector := tracing.NewInMemoryCollector()
+	handler := NewTracedKvstoreHandler(&testKvstoreHandler{}, tracing.NewTracer(collector))
+	parent, ctx := tracing.StartSpan(context.Background(), "GET /", tracing.SpanKindServer, nil)
+
+	_, err := WithContext(ctx, handler).Get("key")
+	assert.Nil(t, err)
+	_, err = handler.Get("key")
+	assert.Nil(t, err)
+	spans := collector.Spans()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "kvstore.Get", spans[0].Name)
+		assert.Equal(t, parent.TraceID, spans[0].TraceID)
+		assert.Equal(t, parent.SpanID, spans[0].ParentSpanID)
+		// the handler itself is not bound to the request
+		assert.NotEqual(t, parent.TraceID, spans[1].TraceID)
+	}
+	// the handlers without tracer are returned as is
+	untraced := &testKvstoreHandler{}
+	assert.Equal(t, untraced, WithContext(ctx, untraced))
+}
+
+type testKvstoreCounter struct {
+	testKvstoreHandler
+}
+
+func (h *testKvstoreCounter) Incrby(key interface{}, increment int64) (int64, error) {
+	return increment, nil
+}
+
+func TestTracedKvstoreCounter(t *testing.T) {
+	tracer := tracing.NewTracer(tracing.NewInMemoryCollector())
+	// the traced handler is a counter only if the handler it wraps is one
+	_, ok := NewTracedKvstoreHandler(&testKvstoreHandler{}, tracer).(KvstoreCounter)
+	assert.False(t, ok)
+	handler := NewTracedKvstoreHandler(&testKvstoreCounter{}, tracer)
+	counter, ok := WithContext(context.Background(), handler).(KvstoreCounter)
+	if assert.True(t, ok) {
+		value, err := counter.Incrby("key", 2)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), value)
+	}
+	assert.Equal(t, handler, NewTracedKvstoreHandler(handler, tracer))
+}
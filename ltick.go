@@ -651,14 +651,15 @@ func (e *Engine) Startup() (err error) {
 						for _, route := range list {
 							for _, host := range route.Host {
 								if utility.WildcardMatch(host, requestHost) {
-									if route.BasicAuth != nil {
-										ctx.Request.SetBasicAuth(route.BasicAuth.Username, route.BasicAuth.Password)
-									}
 									ctx.Context = utility.MergeContext(ctx.Request.Context(), ctx.Context)
-									return route.Handler.Serve(&api.Context{
+									apiCtx := &api.Context{
 										Context:  ctx,
 										Response: api.NewResponse(ctx),
-									})
+									}
+									if err := route.authenticate(apiCtx); err != nil {
+										return err
+									}
+									return route.Handler.Serve(apiCtx)
 								}
 							}
 						}
@@ -693,6 +694,15 @@ func (e *Engine) Startup() (err error) {
 					Handler:   metricsHandler{},
 				})
 			}
+			if server.Router.OpenAPI != nil {
+				addMesh("GET", server.Router.OpenAPI.Group, server.Router.OpenAPI.Path, routeHandler{
+					Host:      server.Router.OpenAPI.Host,
+					BasicAuth: server.Router.OpenAPI.BasicAuth,
+					Handler: openAPIHandler{
+						document: server.OpenAPIDocument(server.Router.OpenAPI.Info),
+					},
+				})
+			}
 			if server.Router.Pprof != nil {
 				addMesh("ANY", "/debug/pprof", "*", routeHandler{
 					Host:      server.Router.Pprof.Host,
@@ -760,9 +770,15 @@ func (e *Engine) Startup() (err error) {
 								}
 							}
 						}
+						if route.Stream || api.IsStreamHandler(handler) {
+							if err = server.Router.addStreamRoute(method, route.Group+route.Path); err != nil {
+								return errors.Annotatef(err, errStartup)
+							}
+						}
 						addMesh(method, route.Group, route.Path, routeHandler{
 							Host:      route.Host,
 							BasicAuth: route.BasicAuth,
+							Auth:      route.Auth,
 							Handler:   handler,
 						})
 					}
@@ -779,10 +795,12 @@ func (e *Engine) Startup() (err error) {
 				}
 				for _, meshKey := range sortedMesh {
 					meshes := strings.SplitN(meshKey, "$", 3)
+					// the typed path params are constrained by their patterns
+					group, path := expandPathParamTypes(meshes[1]), expandPathParamTypes(meshes[2])
 					if strings.Compare(strings.ToLower(meshes[0]), "any") == 0 {
-						server.Router.Group(meshes[1]).Any(meshes[2], genHandlerFunc(mesh[meshes[0]][meshes[1]][meshes[2]]))
+						server.Router.Group(group).Any(path, genHandlerFunc(mesh[meshes[0]][meshes[1]][meshes[2]]))
 					} else {
-						server.Router.Group(meshes[1]).To(meshes[0], meshes[2], genHandlerFunc(mesh[meshes[0]][meshes[1]][meshes[2]]))
+						server.Router.Group(group).To(meshes[0], path, genHandlerFunc(mesh[meshes[0]][meshes[1]][meshes[2]]))
 					}
 				}
 			}
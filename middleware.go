@@ -46,6 +46,9 @@ type Middleware struct {
 var (
 	OptionalMiddlewares = Middlewares{
 		&Middleware{Name: "IPFilter", Middleware: &middleware.IPFilter{}},
+		&Middleware{Name: "RateLimiter", Middleware: &middleware.RateLimiter{}},
+		&Middleware{Name: "RequestTracer", Middleware: &middleware.RequestTracer{}},
+		&Middleware{Name: "ResponseCache", Middleware: &middleware.ResponseCache{}},
 	}
 )
 
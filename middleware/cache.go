@@ -0,0 +1,563 @@
+package middleware
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ltick/tick-framework/api"
+	"github.com/ltick/tick-framework/config"
+	"github.com/ltick/tick-framework/filesystem"
+	"github.com/ltick/tick-framework/kvstore"
+	"github.com/ltick/tick-framework/utility"
+	"github.com/ltick/tick-routing"
+)
+
+var (
+	errResponseCacheInitiate = "middleware: response cache initiate error"
+	errResponseCacheGet      = "middleware: response cache get '%s' error"
+	errResponseCacheSet      = "middleware: response cache set '%s' error"
+)
+
+const (
+	HeaderXCache = "X-Cache"
+
+	responseCacheRecorderKey = "LTICK_RESPONSE_CACHE_RECORDER"
+	// defaultResponseCacheMaxBodySize is the size over which a response is not cached
+	defaultResponseCacheMaxBodySize = 1 << 20
+)
+
+// DefaultResponseCacheVaryHeaders are the request headers a cached response may vary on.
+var DefaultResponseCacheVaryHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language"}
+
+type (
+	// CachedResponse is a response stored by the ResponseCache.
+	CachedResponse struct {
+		Status  int         `json:"status"`
+		Header  http.Header `json:"header"`
+		Body    []byte      `json:"body"`
+		Created time.Time   `json:"created"`
+		Expires time.Time   `json:"expires"`
+		// Shared is set when the response is explicitly public, it is then served to the requests with credentials
+		Shared bool `json:"shared"`
+	}
+	// ResponseCacheStore keeps the cached responses, Get returns nil without error on a miss.
+	ResponseCacheStore interface {
+		Get(key string) (*CachedResponse, error)
+		Set(key string, response *CachedResponse) error
+		Delete(key string) error
+	}
+
+	// MemoryResponseCacheStore is a LRU store local to the process.
+	MemoryResponseCacheStore struct {
+		mutex    sync.Mutex
+		capacity int
+		entries  map[string]*list.Element
+		lru      *list.List
+		now      func() time.Time
+	}
+	memoryResponseCacheEntry struct {
+		key      string
+		response *CachedResponse
+	}
+
+	// KvstoreResponseCacheStore keeps the cached responses in a kvstore shared by all processes.
+	KvstoreResponseCacheStore struct {
+		handler kvstore.KvstoreHandler
+		prefix  string
+	}
+
+	// FilesystemResponseCacheStore keeps the cached responses in the filesystem component.
+	FilesystemResponseCacheStore struct {
+		filesystem *filesystem.Filesystem
+		prefix     string
+		now        func() time.Time
+	}
+
+	// ResponseCache serves the GET and HEAD requests from the responses cached for TTL,
+	// or for the TTL of the first route pattern matching the path.
+	// A response is cached when its status is cachable and its Cache-Control allows it,
+	// its max-age or s-maxage overriding the TTL. The response to a request with an
+	// Authorization or a Cookie header is only cached, and a cached response only served to it,
+	// when the response is explicitly shared by the public or s-maxage directive.
+	ResponseCache struct {
+		Config *config.Config `inject:"true"`
+		Store  ResponseCacheStore
+		TTL    time.Duration
+		// VaryHeaders are the request headers included in the cache key,
+		// a response varying on another header is not cached.
+		VaryHeaders []string
+		MaxBodySize int
+
+		mutex     sync.RWMutex
+		routeTTLs []responseCacheRouteTTL
+	}
+	responseCacheRouteTTL struct {
+		pattern string
+		ttl     time.Duration
+	}
+
+	responseCacheRecorder struct {
+		http.ResponseWriter
+		key         string
+		status      int
+		body        []byte
+		maxBodySize int
+		// credentials is set when the request has an Authorization or a Cookie header
+		credentials bool
+		// uncachable is set when the response is streamed, hijacked or too large
+		uncachable bool
+	}
+)
+
+/********** Memory Store **********/
+func NewMemoryResponseCacheStore(capacity int) *MemoryResponseCacheStore {
+	return &MemoryResponseCacheStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		now:      time.Now,
+	}
+}
+
+func (s *MemoryResponseCacheStore) Get(key string) (*CachedResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := element.Value.(*memoryResponseCacheEntry)
+	if !s.now().Before(entry.response.Expires) {
+		s.lru.Remove(element)
+		delete(s.entries, key)
+		return nil, nil
+	}
+	s.lru.MoveToFront(element)
+	return entry.response, nil
+}
+
+func (s *MemoryResponseCacheStore) Set(key string, response *CachedResponse) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if element, ok := s.entries[key]; ok {
+		element.Value.(*memoryResponseCacheEntry).response = response
+		s.lru.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.lru.PushFront(&memoryResponseCacheEntry{key: key, response: response})
+	for s.capacity > 0 && s.lru.Len() > s.capacity {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryResponseCacheEntry).key)
+	}
+	return nil
+}
+
+func (s *MemoryResponseCacheStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if element, ok := s.entries[key]; ok {
+		s.lru.Remove(element)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+/********** Kvstore Store **********/
+func NewKvstoreResponseCacheStore(handler kvstore.KvstoreHandler, prefix string) *KvstoreResponseCacheStore {
+	return &KvstoreResponseCacheStore{
+		handler: handler,
+		prefix:  prefix,
+	}
+}
+
+func (s *KvstoreResponseCacheStore) Get(key string) (*CachedResponse, error) {
+	value, err := s.handler.Get(s.prefix + key)
+	if err != nil {
+		if kvstore.ErrNil(err) {
+			return nil, nil
+		}
+		return nil, errors.Annotatef(err, errResponseCacheGet, key)
+	}
+	var content []byte
+	switch v := value.(type) {
+	case string:
+		content = []byte(v)
+	case []byte:
+		content = v
+	default:
+		return nil, errors.Annotatef(errors.New("invalid value type"), errResponseCacheGet, key)
+	}
+	response := &CachedResponse{}
+	if err = json.Unmarshal(content, response); err != nil {
+		return nil, errors.Annotatef(err, errResponseCacheGet, key)
+	}
+	return response, nil
+}
+
+// Set stores the response and lets the kvstore expire it.
+func (s *KvstoreResponseCacheStore) Set(key string, response *CachedResponse) error {
+	content, err := json.Marshal(response)
+	if err != nil {
+		return errors.Annotatef(err, errResponseCacheSet, key)
+	}
+	if err = s.handler.Set(s.prefix+key, content); err != nil {
+		return errors.Annotatef(err, errResponseCacheSet, key)
+	}
+	expire := int64(math.Ceil(time.Until(response.Expires).Seconds()))
+	if expire < 1 {
+		expire = 1
+	}
+	if err = s.handler.Expire(s.prefix+key, expire); err != nil {
+		return errors.Annotatef(err, errResponseCacheSet, key)
+	}
+	return nil
+}
+
+func (s *KvstoreResponseCacheStore) Delete(key string) error {
+	_, err := s.handler.Del(s.prefix + key)
+	return err
+}
+
+/********** Filesystem Store **********/
+func NewFilesystemResponseCacheStore(filesystem *filesystem.Filesystem, prefix string) *FilesystemResponseCacheStore {
+	return &FilesystemResponseCacheStore{
+		filesystem: filesystem,
+		prefix:     prefix,
+		now:        time.Now,
+	}
+}
+
+// filesystemKey hashes the key since the cache keys are not valid file names.
+func (s *FilesystemResponseCacheStore) filesystemKey(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return s.prefix + hex.EncodeToString(sum[:])
+}
+
+// Get returns nil when the content does not exist or has expired.
+func (s *FilesystemResponseCacheStore) Get(key string) (*CachedResponse, error) {
+	content, err := s.filesystem.GetContent(s.filesystemKey(key))
+	if err != nil || len(content) == 0 {
+		return nil, nil
+	}
+	response := &CachedResponse{}
+	if err = json.Unmarshal(content, response); err != nil {
+		return nil, errors.Annotatef(err, errResponseCacheGet, key)
+	}
+	if !s.now().Before(response.Expires) {
+		s.filesystem.DelContent(s.filesystemKey(key))
+		return nil, nil
+	}
+	return response, nil
+}
+
+func (s *FilesystemResponseCacheStore) Set(key string, response *CachedResponse) error {
+	content, err := json.Marshal(response)
+	if err != nil {
+		return errors.Annotatef(err, errResponseCacheSet, key)
+	}
+	if err = s.filesystem.SetContent(s.filesystemKey(key), content); err != nil {
+		return errors.Annotatef(err, errResponseCacheSet, key)
+	}
+	return nil
+}
+
+func (s *FilesystemResponseCacheStore) Delete(key string) error {
+	return s.filesystem.DelContent(s.filesystemKey(key))
+}
+
+/********** Recorder **********/
+func (r *responseCacheRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseCacheRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if !r.uncachable {
+		if len(r.body)+len(b) > r.maxBodySize {
+			r.uncachable = true
+			r.body = nil
+		} else {
+			r.body = append(r.body, b...)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseCacheRecorder) Flush() {
+	r.uncachable = true
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *responseCacheRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.uncachable = true
+	if hijacker, ok := r.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("middleware: response writer does not support hijacking")
+}
+
+/********** Cache-Control **********/
+// parseCacheControl returns the directives of a Cache-Control header, lower cased.
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(header, ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+		if index := strings.Index(directive, "="); index >= 0 {
+			directives[strings.ToLower(strings.TrimSpace(directive[:index]))] = strings.Trim(strings.TrimSpace(directive[index+1:]), "\"")
+		} else {
+			directives[strings.ToLower(directive)] = ""
+		}
+	}
+	return directives
+}
+
+/********** Middleware **********/
+
+// SetRouteTTL caches the responses of the paths matching the wildcard pattern for ttl,
+// a ttl of 0 disables the cache for them. The first pattern matching wins.
+func (rc *ResponseCache) SetRouteTTL(pattern string, ttl time.Duration) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	for index, routeTTL := range rc.routeTTLs {
+		if routeTTL.pattern == pattern {
+			rc.routeTTLs[index].ttl = ttl
+			return
+		}
+	}
+	rc.routeTTLs = append(rc.routeTTLs, responseCacheRouteTTL{pattern: pattern, ttl: ttl})
+}
+
+func (rc *ResponseCache) ttl(path string) time.Duration {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+	for _, routeTTL := range rc.routeTTLs {
+		if utility.WildcardMatch(routeTTL.pattern, path) {
+			return routeTTL.ttl
+		}
+	}
+	return rc.TTL
+}
+
+func (rc *ResponseCache) key(req *http.Request) string {
+	key := http.MethodGet + " " + req.Host + req.URL.RequestURI()
+	for _, header := range rc.VaryHeaders {
+		key += "\n" + header + ":" + req.Header.Get(header)
+	}
+	return key
+}
+
+// hasCredentials reports whether the response to the request may be specific to a user.
+func hasCredentials(req *http.Request) bool {
+	return req.Header.Get(api.HeaderAuthorization) != "" || req.Header.Get(api.HeaderCookie) != ""
+}
+
+// varies reports whether the response varies on a request header not in the cache key.
+func (rc *ResponseCache) varies(header http.Header) bool {
+	for _, vary := range header[api.HeaderVary] {
+		for _, field := range strings.Split(vary, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if field == "*" {
+				return true
+			}
+			found := false
+			for _, varyHeader := range rc.VaryHeaders {
+				if strings.EqualFold(field, varyHeader) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (rc *ResponseCache) Prepare(ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+func (rc *ResponseCache) Initiate(ctx context.Context) (context.Context, error) {
+	if rc.Config != nil {
+		var options map[string]config.Option = map[string]config.Option{
+			"RESPONSECACHE_TTL":      config.Option{Type: config.Duration, EnvironmentKey: "RESPONSECACHE_TTL"},
+			"RESPONSECACHE_CAPACITY": config.Option{Type: config.Int, Default: 1024, EnvironmentKey: "RESPONSECACHE_CAPACITY"},
+			"RESPONSECACHE_VARY":     config.Option{Type: config.StringSlice, EnvironmentKey: "RESPONSECACHE_VARY"},
+		}
+		err := rc.Config.SetOptions(options)
+		if err != nil {
+			return ctx, errors.Annotate(err, errResponseCacheInitiate)
+		}
+		if rc.TTL == 0 {
+			rc.TTL = rc.Config.GetDuration("RESPONSECACHE_TTL")
+		}
+		if rc.VaryHeaders == nil {
+			if varyHeaders := rc.Config.GetStringSlice("RESPONSECACHE_VARY"); len(varyHeaders) > 0 {
+				rc.VaryHeaders = varyHeaders
+			}
+		}
+		if rc.Store == nil {
+			rc.Store = NewMemoryResponseCacheStore(rc.Config.GetInt("RESPONSECACHE_CAPACITY"))
+		}
+	}
+	if rc.VaryHeaders == nil {
+		rc.VaryHeaders = DefaultResponseCacheVaryHeaders
+	}
+	if rc.MaxBodySize == 0 {
+		rc.MaxBodySize = defaultResponseCacheMaxBodySize
+	}
+	if rc.Store == nil {
+		rc.Store = NewMemoryResponseCacheStore(1024)
+	}
+	return ctx, nil
+}
+func (rc *ResponseCache) OnRequestStartup(c *routing.Context) error {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return nil
+	}
+	if rc.ttl(c.Request.URL.Path) <= 0 {
+		return nil
+	}
+	requestCacheControl := parseCacheControl(c.Request.Header.Get(api.HeaderCacheControl))
+	if _, ok := requestCacheControl["no-store"]; ok {
+		return nil
+	}
+	key := rc.key(c.Request)
+	credentials := hasCredentials(c.Request)
+	_, noCache := requestCacheControl["no-cache"]
+	if maxAge, ok := requestCacheControl["max-age"]; ok && maxAge == "0" {
+		noCache = true
+	}
+	if !noCache {
+		// a failing store does not fail the request
+		if cached, err := rc.Store.Get(key); err == nil && cached != nil && (!credentials || cached.Shared) {
+			rc.serve(c, cached)
+			c.Abort()
+			return nil
+		}
+	}
+	if c.Request.Method == http.MethodHead {
+		return nil
+	}
+	recorder := &responseCacheRecorder{
+		ResponseWriter: c.ResponseWriter,
+		key:            key,
+		maxBodySize:    rc.MaxBodySize,
+		credentials:    credentials,
+	}
+	c.ResponseWriter = recorder
+	c.Set(responseCacheRecorderKey, recorder)
+	c.ResponseWriter.Header().Set(HeaderXCache, "MISS")
+	return nil
+}
+
+func (rc *ResponseCache) serve(c *routing.Context, cached *CachedResponse) {
+	header := c.ResponseWriter.Header()
+	for name, values := range cached.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set(HeaderXCache, "HIT")
+	header.Set("Age", strconv.FormatInt(int64(time.Since(cached.Created).Seconds()), 10))
+	if ifNoneMatch := c.Request.Header.Get(api.HeaderIfNoneMatch); ifNoneMatch != "" && api.ETagWeakMatch(ifNoneMatch, cached.Header.Get(api.HeaderETag)) {
+		header.Del(api.HeaderContentLength)
+		header.Del(api.HeaderContentType)
+		c.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set(api.HeaderContentLength, strconv.Itoa(len(cached.Body)))
+	c.ResponseWriter.WriteHeader(cached.Status)
+	if c.Request.Method != http.MethodHead {
+		c.ResponseWriter.Write(cached.Body)
+	}
+}
+
+func (rc *ResponseCache) OnRequestShutdown(c *routing.Context) error {
+	recorder, ok := c.Get(responseCacheRecorderKey).(*responseCacheRecorder)
+	if !ok {
+		return nil
+	}
+	c.ResponseWriter = recorder.ResponseWriter
+	if recorder.uncachable || recorder.status == 0 || !api.IsCachableStatus(recorder.status) ||
+		recorder.status == http.StatusNotModified || recorder.status == http.StatusPartialContent {
+		return nil
+	}
+	header := recorder.Header()
+	if header.Get(api.HeaderSetCookie) != "" || header.Get(api.HeaderContentEncoding) != "" || rc.varies(header) {
+		return nil
+	}
+	ttl := rc.ttl(c.Request.URL.Path)
+	responseCacheControl := parseCacheControl(header.Get(api.HeaderCacheControl))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := responseCacheControl[directive]; ok {
+			// the response stored before must not be served anymore
+			if !recorder.credentials {
+				rc.Store.Delete(recorder.key)
+			}
+			return nil
+		}
+	}
+	_, public := responseCacheControl["public"]
+	_, sharedMaxAge := responseCacheControl["s-maxage"]
+	shared := public || sharedMaxAge
+	if recorder.credentials && !shared {
+		return nil
+	}
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, ok := responseCacheControl[directive]; ok {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds <= 0 {
+				return nil
+			}
+			ttl = time.Duration(seconds) * time.Second
+			break
+		}
+	}
+	cachedHeader := make(http.Header, len(header))
+	for name, values := range header {
+		if name == HeaderXCache {
+			continue
+		}
+		cachedHeader[name] = append([]string(nil), values...)
+	}
+	if cachedHeader.Get(api.HeaderETag) == "" {
+		sum := sha1.Sum(recorder.body)
+		cachedHeader.Set(api.HeaderETag, "W/\""+hex.EncodeToString(sum[:])+"\"")
+	}
+	now := time.Now()
+	// a failing store does not fail the request
+	rc.Store.Set(recorder.key, &CachedResponse{
+		Status:  recorder.status,
+		Header:  cachedHeader,
+		Body:    recorder.body,
+		Created: now,
+		Expires: now.Add(ttl),
+		Shared:  shared,
+	})
+	return nil
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ltick/tick-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryResponseCacheStore(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	store := NewMemoryResponseCacheStore(2)
+	store.now = func() time.Time {
+		return now
+	}
+	for _, key := range []string{"a", "b"} {
+		assert.Nil(t, store.Set(key, &CachedResponse{Status: http.StatusOK, Expires: now.Add(time.Minute)}))
+	}
+	response, err := store.Get("a")
+	assert.Nil(t, err)
+	assert.NotNil(t, response)
+	// "b" is the least recently used
+	assert.Nil(t, store.Set("c", &CachedResponse{Status: http.StatusOK, Expires: now.Add(time.Minute)}))
+	response, _ = store.Get("b")
+	assert.Nil(t, response)
+	response, _ = store.Get("a")
+	assert.NotNil(t, response)
+	now = now.Add(time.Minute)
+	response, _ = store.Get("a")
+	assert.Nil(t, response)
+}
+
+func TestResponseCache(t *testing.T) {
+	cache := &ResponseCache{TTL: time.Minute}
+	_, err := cache.Initiate(context.Background())
+	assert.Nil(t, err)
+	cache.SetRouteTTL("/private*", 0)
+	calls := 0
+	router := routing.New()
+	router.AppendStartupHandler(func(c *routing.Context) (err error) {
+		if err = cache.OnRequestStartup(c); err != nil {
+			c.Abort()
+			return err
+		}
+		err = c.Next()
+		cache.OnRequestShutdown(c)
+		return err
+	})
+	handler := func(c *routing.Context) error {
+		calls++
+		if c.Query("cache") == "no-store" {
+			c.ResponseWriter.Header().Set("Cache-Control", "no-store")
+		}
+		_, err := c.ResponseWriter.Write([]byte("ltick"))
+		return err
+	}
+	router.Get("/public", handler)
+	router.Get("/private", handler)
+
+	request := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+	res := request("/public", nil)
+	assert.Equal(t, "MISS", res.Header().Get(HeaderXCache))
+	res = request("/public", nil)
+	assert.Equal(t, "HIT", res.Header().Get(HeaderXCache))
+	assert.Equal(t, "ltick", res.Body.String())
+	assert.Equal(t, 1, calls)
+	etag := res.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	// revalidation
+	res = request("/public", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Equal(t, 0, res.Body.Len())
+	// the client asks for a fresh response
+	res = request("/public", http.Header{"Cache-Control": {"no-cache"}})
+	assert.Equal(t, "MISS", res.Header().Get(HeaderXCache))
+	assert.Equal(t, 2, calls)
+	// the response forbids caching
+	request("/public?cache=no-store", nil)
+	request("/public?cache=no-store", nil)
+	assert.Equal(t, 4, calls)
+	// the route is not cached
+	request("/private", nil)
+	request("/private", nil)
+	assert.Equal(t, 6, calls)
+}
+
+func TestResponseCacheCredentials(t *testing.T) {
+	cache := &ResponseCache{TTL: time.Minute}
+	_, err := cache.Initiate(context.Background())
+	assert.Nil(t, err)
+	calls := 0
+	router := routing.New()
+	router.AppendStartupHandler(func(c *routing.Context) (err error) {
+		if err = cache.OnRequestStartup(c); err != nil {
+			c.Abort()
+			return err
+		}
+		err = c.Next()
+		cache.OnRequestShutdown(c)
+		return err
+	})
+	authenticate := func(c *routing.Context) error {
+		if c.Request.Header.Get("Authorization") == "" {
+			c.ResponseWriter.WriteHeader(http.StatusUnauthorized)
+			c.Abort()
+		}
+		return nil
+	}
+	handler := func(c *routing.Context) error {
+		calls++
+		if c.Query("cache") != "" {
+			c.ResponseWriter.Header().Set("Cache-Control", c.Query("cache"))
+		}
+		_, err := c.ResponseWriter.Write([]byte(c.Request.Header.Get("Authorization")))
+		return err
+	}
+	router.Get("/account", authenticate, handler)
+
+	request := func(path string, authorization string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+	res := request("/account", "alice")
+	assert.Equal(t, "alice", res.Body.String())
+	// the response of a user is not served to another user, nor to an anonymous client
+	res = request("/account", "bob")
+	assert.Equal(t, "MISS", res.Header().Get(HeaderXCache))
+	assert.Equal(t, "bob", res.Body.String())
+	res = request("/account", "")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, 2, calls)
+	// a private response is not cached
+	request("/account?cache=private,max-age=60", "alice")
+	request("/account?cache=private,max-age=60", "alice")
+	assert.Equal(t, 4, calls)
+	// an explicitly public response is shared
+	res = request("/account?cache=public,max-age=60", "alice")
+	assert.Equal(t, "MISS", res.Header().Get(HeaderXCache))
+	res = request("/account?cache=public,max-age=60", "bob")
+	assert.Equal(t, "HIT", res.Header().Get(HeaderXCache))
+	assert.Equal(t, "alice", res.Body.String())
+	assert.Equal(t, 5, calls)
+}
@@ -2,70 +2,243 @@ package middleware
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 
+	"github.com/juju/errors"
+	"github.com/ltick/tick-framework/config"
+	"github.com/ltick/tick-framework/utility"
 	"github.com/ltick/tick-routing"
 )
 
-type IPFilter struct {
-	whitelist []string
-	realIP    bool
+var (
+	errIPFilterInitiate = "middleware: ip filter initiate error"
+	errIPFilterReload   = "middleware: ip filter reload error"
+	errParseIPRule      = "middleware: parse ip rule '%s' error"
+)
+
+type (
+	// IPFilter forbids the requests from the blacklist and, when the whitelist
+	// is not empty, the requests from outside of it.
+	// Rules are single ips, CIDR ranges or ip prefixes ending with "*".
+	IPFilter struct {
+		Config *config.Config `inject:"true"`
+
+		mutex     sync.RWMutex
+		whitelist *ipRules
+		blacklist *ipRules
+		// trustedProxies are the proxies whose X-Forwarded-For and X-Real-IP headers are believed.
+		trustedProxies *ipRules
+		// realIP trusts the client ip headers of any peer, only kept for compatibility.
+		realIP bool
+		// routes are the path patterns the filter applies to, all paths if empty.
+		routes []string
+	}
+	ipRules struct {
+		nets     []*net.IPNet
+		prefixes []string
+	}
+)
+
+func parseIPRules(rules []string) (*ipRules, error) {
+	r := &ipRules{
+		nets:     make([]*net.IPNet, 0),
+		prefixes: make([]string, 0),
+	}
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		switch {
+		case rule == "":
+			continue
+		case strings.HasSuffix(rule, "*"):
+			r.prefixes = append(r.prefixes, rule[:len(rule)-1])
+		case strings.Contains(rule, "/"):
+			_, ipNet, err := net.ParseCIDR(rule)
+			if err != nil {
+				return nil, errors.Annotatef(err, errParseIPRule, rule)
+			}
+			r.nets = append(r.nets, ipNet)
+		default:
+			ip := net.ParseIP(rule)
+			if ip == nil {
+				return nil, errors.Annotatef(errors.New("invalid ip"), errParseIPRule, rule)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			r.nets = append(r.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return r, nil
 }
 
-func (i *IPFilter) Prepare(ctx context.Context) (context.Context, error) {
-	ctxWhitelist := ctx.Value("LTICK_IPFILTER_WHITELIST")
-	whitelist, ok := ctxWhitelist.([]string)
-	if ok {
-		i.whitelist = whitelist
+func (r *ipRules) empty() bool {
+	return r == nil || (len(r.nets) == 0 && len(r.prefixes) == 0)
+}
+
+func (r *ipRules) contains(ip string) bool {
+	if r == nil {
+		return false
+	}
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(ip, prefix) {
+			return true
+		}
+	}
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+	for _, ipNet := range r.nets {
+		if ipNet.Contains(parsedIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRules replaces the filter rules, an empty whitelist allows every ip not in the blacklist.
+func (i *IPFilter) SetRules(whitelist []string, blacklist []string, trustedProxies []string) error {
+	whitelistRules, err := parseIPRules(whitelist)
+	if err != nil {
+		return err
+	}
+	blacklistRules, err := parseIPRules(blacklist)
+	if err != nil {
+		return err
+	}
+	trustedProxyRules, err := parseIPRules(trustedProxies)
+	if err != nil {
+		return err
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.whitelist = whitelistRules
+	i.blacklist = blacklistRules
+	i.trustedProxies = trustedProxyRules
+	return nil
+}
+
+// SetRoutes scopes the filter to the request paths matching one of the wildcard patterns.
+func (i *IPFilter) SetRoutes(routes ...string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.routes = routes
+}
+
+// Reload reads the rules from the config again, the routes are cleared when
+// IPFILTER_ROUTES is empty. The filter is updated at once.
+func (i *IPFilter) Reload() error {
+	if i.Config == nil {
+		return errors.Annotate(errors.New("config is not injected"), errIPFilterReload)
+	}
+	whitelistRules, err := parseIPRules(i.Config.GetStringSlice("IPFILTER_WHITELIST"))
+	if err != nil {
+		return errors.Annotate(err, errIPFilterReload)
+	}
+	blacklistRules, err := parseIPRules(i.Config.GetStringSlice("IPFILTER_BLACKLIST"))
+	if err != nil {
+		return errors.Annotate(err, errIPFilterReload)
 	}
-	ctxRealIP := ctx.Value("LTICK_IPFILTER_REALIP")
-	realIP, ok := ctxRealIP.(bool)
-	if ok {
-		i.realIP = realIP
+	trustedProxyRules, err := parseIPRules(i.Config.GetStringSlice("IPFILTER_TRUSTED_PROXIES"))
+	if err != nil {
+		return errors.Annotate(err, errIPFilterReload)
 	}
+	realIP := i.Config.GetBool("IPFILTER_REALIP")
+	routes := i.Config.GetStringSlice("IPFILTER_ROUTES")
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.whitelist = whitelistRules
+	i.blacklist = blacklistRules
+	i.trustedProxies = trustedProxyRules
+	i.realIP = realIP
+	i.routes = routes
+	return nil
+}
+
+func (i *IPFilter) Prepare(ctx context.Context) (context.Context, error) {
 	return ctx, nil
 }
 func (i *IPFilter) Initiate(ctx context.Context) (context.Context, error) {
+	if i.Config == nil {
+		return ctx, nil
+	}
+	var options map[string]config.Option = map[string]config.Option{
+		"IPFILTER_WHITELIST":       config.Option{Type: config.StringSlice, EnvironmentKey: "IPFILTER_WHITELIST"},
+		"IPFILTER_BLACKLIST":       config.Option{Type: config.StringSlice, EnvironmentKey: "IPFILTER_BLACKLIST"},
+		"IPFILTER_TRUSTED_PROXIES": config.Option{Type: config.StringSlice, EnvironmentKey: "IPFILTER_TRUSTED_PROXIES"},
+		"IPFILTER_REALIP":          config.Option{Type: config.Bool, EnvironmentKey: "IPFILTER_REALIP"},
+		"IPFILTER_ROUTES":          config.Option{Type: config.StringSlice, EnvironmentKey: "IPFILTER_ROUTES"},
+	}
+	err := i.Config.SetOptions(options)
+	if err != nil {
+		return ctx, errors.Annotate(err, errIPFilterInitiate)
+	}
+	err = i.Reload()
+	if err != nil {
+		return ctx, errors.Annotate(err, errIPFilterInitiate)
+	}
 	return ctx, nil
 }
-func (i *IPFilter) OnRequestStartup(c *routing.Context) error {
-	var forbidden bool
-	var match []string
-	var prefix []string
-	if len(i.whitelist) == 0 {
-		forbidden = true
-	} else {
-		for _, s := range i.whitelist {
-			if strings.HasSuffix(s, "*") {
-				prefix = append(prefix, s[:len(s)-1])
-			} else {
-				match = append(match, s)
+
+// clientIP returns the address the rules are checked against.
+func (i *IPFilter) clientIP(c *routing.Context) string {
+	if i.realIP {
+		return c.GetClientRealIP()
+	}
+	return trustedClientIP(c, i.trustedProxies)
+}
+
+// trustedClientIP returns the peer address, or the client address reported by the
+// peer when the peer is a trusted proxy.
+func trustedClientIP(c *routing.Context, trustedProxies *ipRules) string {
+	remoteIP := c.GetClientRemoteIP()
+	if trustedProxies.empty() || !trustedProxies.contains(remoteIP) {
+		return remoteIP
+	}
+	if forwardedFor := c.Request.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		// the nearest address not belonging to a trusted proxy
+		ips := strings.Split(forwardedFor, ",")
+		for index := len(ips) - 1; index >= 0; index-- {
+			ip := strings.TrimSpace(ips[index])
+			if !trustedProxies.contains(ip) {
+				return ip
 			}
 		}
 	}
-	if forbidden {
-		return routing.NewHTTPError(http.StatusForbidden)
+	if realIP := c.Request.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
 	}
-	var ip string
-	if i.realIP {
-		ip = c.GetClientRealIP()
-	} else {
-		ip = c.GetClientRemoteIP()
-	}
-	for _, ipMatch := range match {
-		if ipMatch == ip {
-			c.Next()
-			return nil
+	return remoteIP
+}
+
+func (i *IPFilter) OnRequestStartup(c *routing.Context) error {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	if len(i.routes) > 0 {
+		matched := false
+		for _, route := range i.routes {
+			if utility.WildcardMatch(route, c.Request.URL.Path) {
+				matched = true
+				break
+			}
 		}
-	}
-	for _, ipPrefix := range prefix {
-		if strings.HasPrefix(ip, ipPrefix) {
-			c.Next()
+		if !matched {
 			return nil
 		}
 	}
-	return routing.NewHTTPError(http.StatusForbidden, "access not allow for ip: "+ip)
+	ip := i.clientIP(c)
+	if i.blacklist.contains(ip) {
+		return routing.NewHTTPError(http.StatusForbidden, "access not allow for ip: "+ip)
+	}
+	if !i.whitelist.empty() && !i.whitelist.contains(ip) {
+		return routing.NewHTTPError(http.StatusForbidden, "access not allow for ip: "+ip)
+	}
+	return nil
 }
 func (i *IPFilter) OnRequestShutdown(c *routing.Context) error {
 	return nil
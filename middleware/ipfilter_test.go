@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ltick/tick-framework/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIPRules(t *testing.T) {
+	rules, err := parseIPRules([]string{"10.0.0.0/8", "192.168.1.1", "172.16.*", "2001:db8::/32", "::1"})
+	assert.Nil(t, err)
+	assert.True(t, rules.contains("10.1.2.3"))
+	assert.True(t, rules.contains("192.168.1.1"))
+	assert.False(t, rules.contains("192.168.1.2"))
+	assert.True(t, rules.contains("172.16.0.1"))
+	assert.False(t, rules.contains("172.17.0.1"))
+	assert.True(t, rules.contains("2001:db8::1"))
+	assert.False(t, rules.contains("2001:db9::1"))
+	assert.True(t, rules.contains("::1"))
+	assert.False(t, rules.contains("invalid"))
+	assert.False(t, rules.empty())
+
+	rules, err = parseIPRules([]string{""})
+	assert.Nil(t, err)
+	assert.True(t, rules.empty())
+	assert.False(t, rules.contains("127.0.0.1"))
+
+	_, err = parseIPRules([]string{"10.0.0.0/33"})
+	assert.NotNil(t, err)
+	_, err = parseIPRules([]string{"10.0.0.256"})
+	assert.NotNil(t, err)
+}
+
+func TestIPFilterSetRules(t *testing.T) {
+	filter := &IPFilter{}
+	err := filter.SetRules([]string{"10.0.0.0/8"}, []string{"10.0.0.1"}, nil)
+	assert.Nil(t, err)
+	assert.True(t, filter.whitelist.contains("10.0.0.2"))
+	assert.True(t, filter.blacklist.contains("10.0.0.1"))
+	assert.True(t, filter.trustedProxies.empty())
+	// invalid rules keep the previous ones
+	err = filter.SetRules([]string{"invalid"}, nil, nil)
+	assert.NotNil(t, err)
+	assert.True(t, filter.whitelist.contains("10.0.0.2"))
+}
+
+func TestIPFilterReload(t *testing.T) {
+	ctx := context.Background()
+	c := config.NewConfig()
+	ctx, err := c.Initiate(ctx)
+	if !assert.Nil(t, err) {
+		return
+	}
+	filter := &IPFilter{Config: c}
+	c.Set("IPFILTER_WHITELIST", []string{"10.0.0.0/8"})
+	c.Set("IPFILTER_ROUTES", []string{"/admin/*"})
+	_, err = filter.Initiate(ctx)
+	assert.Nil(t, err)
+	assert.True(t, filter.whitelist.contains("10.0.0.2"))
+	assert.Equal(t, []string{"/admin/*"}, filter.routes)
+
+	// the routes cleared in the config are cleared in the filter
+	c.Set("IPFILTER_ROUTES", []string{})
+	c.Set("IPFILTER_REALIP", true)
+	assert.Nil(t, filter.Reload())
+	assert.Empty(t, filter.routes)
+	assert.True(t, filter.realIP)
+
+	// invalid rules keep the previous filter
+	c.Set("IPFILTER_ROUTES", []string{"/admin/*"})
+	c.Set("IPFILTER_BLACKLIST", []string{"invalid"})
+	assert.NotNil(t, filter.Reload())
+	assert.Empty(t, filter.routes)
+	assert.True(t, filter.whitelist.contains("10.0.0.2"))
+}
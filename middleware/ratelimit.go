@@ -0,0 +1,290 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ltick/tick-framework/api"
+	"github.com/ltick/tick-framework/config"
+	"github.com/ltick/tick-framework/kvstore"
+	"github.com/ltick/tick-routing"
+)
+
+var (
+	errRateLimiterInitiate = "middleware: rate limiter initiate error"
+	errRateLimitTake       = "middleware: rate limit take '%s' error"
+)
+
+// Rate limit headers
+const (
+	HeaderRetryAfter          = "Retry-After"
+	HeaderXRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderXRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderXRateLimitReset     = "X-RateLimit-Reset"
+)
+
+type (
+	// RateLimitResult is the outcome of taking one request from a quota.
+	RateLimitResult struct {
+		Allowed   bool
+		Limit     int64
+		Remaining int64
+		// ResetAfter is the time until one more request is allowed when Allowed is false,
+		// the time until the quota is restored otherwise.
+		ResetAfter time.Duration
+	}
+	// RateLimitStore keeps the quota of every rate limit key.
+	RateLimitStore interface {
+		Take(key string, limit int64, window time.Duration) (*RateLimitResult, error)
+	}
+	// RateLimitKeyFunc returns the key a request is throttled by, an empty key is never throttled.
+	RateLimitKeyFunc func(c *routing.Context) string
+
+	// MemoryRateLimitStore is a token bucket store local to the process.
+	MemoryRateLimitStore struct {
+		mutex     sync.Mutex
+		buckets   map[string]*tokenBucket
+		lastSweep time.Time
+		now       func() time.Time
+	}
+	tokenBucket struct {
+		tokens float64
+		last   time.Time
+	}
+
+	// KvstoreRateLimitStore is a sliding window store shared by all processes using the same kvstore.
+	// The kvstore handler must implement kvstore.KvstoreCounter.
+	KvstoreRateLimitStore struct {
+		handler kvstore.KvstoreHandler
+		prefix  string
+		now     func() time.Time
+	}
+
+	// RateLimiter throttles requests to Limit per Window for each key returned by KeyFunc.
+	RateLimiter struct {
+		Config  *config.Config `inject:"true"`
+		Limit   int64
+		Window  time.Duration
+		KeyFunc RateLimitKeyFunc
+		Store   RateLimitStore
+	}
+)
+
+/********** Key **********/
+// RateLimitByIP keys on the peer address, the client ip headers are never believed.
+func RateLimitByIP(c *routing.Context) string {
+	return c.GetClientRemoteIP()
+}
+
+// RateLimitByClientIP keys on the client address reported by the trusted proxies,
+// on the peer address for the requests not coming from one of them.
+func RateLimitByClientIP(trustedProxies []string) (RateLimitKeyFunc, error) {
+	trustedProxyRules, err := parseIPRules(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return func(c *routing.Context) string {
+		return trustedClientIP(c, trustedProxyRules)
+	}, nil
+}
+
+func RateLimitByRoute(c *routing.Context) string {
+	return c.Request.Method + " " + c.Request.URL.Path
+}
+
+func RateLimitByAPIKey(header string) RateLimitKeyFunc {
+	return func(c *routing.Context) string {
+		return c.Request.Header.Get(header)
+	}
+}
+
+/********** Memory Store **********/
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryRateLimitStore) Take(key string, limit int64, window time.Duration) (*RateLimitResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now()
+	rate := float64(limit) / float64(window)
+	s.sweep(now, window)
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{
+			tokens: float64(limit),
+			last:   now,
+		}
+		s.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit), bucket.tokens+float64(now.Sub(bucket.last))*rate)
+	bucket.last = now
+	result := &RateLimitResult{
+		Limit: limit,
+	}
+	if bucket.tokens < 1 {
+		result.ResetAfter = time.Duration((1 - bucket.tokens) / rate)
+		return result, nil
+	}
+	bucket.tokens--
+	result.Allowed = true
+	result.Remaining = int64(bucket.tokens)
+	result.ResetAfter = time.Duration((float64(limit) - bucket.tokens) / rate)
+	return result, nil
+}
+
+// sweep drops the buckets which have been refilled, at most once per window.
+func (s *MemoryRateLimitStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+	for key, bucket := range s.buckets {
+		if now.Sub(bucket.last) >= window {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+/********** Kvstore Store **********/
+func NewKvstoreRateLimitStore(handler kvstore.KvstoreHandler, prefix string) *KvstoreRateLimitStore {
+	return &KvstoreRateLimitStore{
+		handler: handler,
+		prefix:  prefix,
+		now:     time.Now,
+	}
+}
+
+// Take approximates a sliding window by weighting the previous fixed window
+// count with the part of it still covered by the sliding window.
+func (s *KvstoreRateLimitStore) Take(key string, limit int64, window time.Duration) (*RateLimitResult, error) {
+	now := s.now()
+	current := now.UnixNano() / int64(window)
+	elapsed := time.Duration(now.UnixNano() - current*int64(window))
+	currentKey := s.prefix + key + ":" + strconv.FormatInt(current, 10)
+	previousKey := s.prefix + key + ":" + strconv.FormatInt(current-1, 10)
+	counter, ok := s.handler.(kvstore.KvstoreCounter)
+	if !ok {
+		return nil, errors.Annotatef(errors.New("kvstore handler is not a counter"), errRateLimitTake, key)
+	}
+	count, err := counter.Incrby(currentKey, 1)
+	if err != nil {
+		return nil, errors.Annotatef(err, errRateLimitTake, key)
+	}
+	if count == 1 {
+		// keep the window alive while it is the previous one
+		err = s.handler.Expire(currentKey, int64(math.Ceil((2 * window).Seconds())))
+		if err != nil {
+			return nil, errors.Annotatef(err, errRateLimitTake, key)
+		}
+	}
+	var previous int64
+	value, err := s.handler.Get(previousKey)
+	if err != nil && !kvstore.ErrNil(err) {
+		return nil, errors.Annotatef(err, errRateLimitTake, key)
+	}
+	if err == nil {
+		if previous, err = strconv.ParseInt(value.(string), 10, 64); err != nil {
+			return nil, errors.Annotatef(err, errRateLimitTake, key)
+		}
+	}
+	weight := 1 - float64(elapsed)/float64(window)
+	estimated := float64(previous)*weight + float64(count)
+	result := &RateLimitResult{
+		Limit:      limit,
+		ResetAfter: window - elapsed,
+	}
+	if estimated > float64(limit) {
+		// a rejected request does not consume the quota
+		if _, err = counter.Incrby(currentKey, -1); err != nil {
+			return nil, errors.Annotatef(err, errRateLimitTake, key)
+		}
+		return result, nil
+	}
+	result.Allowed = true
+	result.Remaining = limit - int64(math.Ceil(estimated))
+	return result, nil
+}
+
+/********** Middleware **********/
+func (r *RateLimiter) Prepare(ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+func (r *RateLimiter) Initiate(ctx context.Context) (context.Context, error) {
+	if r.Config != nil {
+		var options map[string]config.Option = map[string]config.Option{
+			"RATELIMIT_LIMIT":  config.Option{Type: config.Int64, EnvironmentKey: "RATELIMIT_LIMIT"},
+			"RATELIMIT_WINDOW": config.Option{Type: config.Duration, Default: "1s", EnvironmentKey: "RATELIMIT_WINDOW"},
+			"RATELIMIT_KEY":    config.Option{Type: config.String, Default: "ip", EnvironmentKey: "RATELIMIT_KEY"},
+			// the proxies are shared with the ip filter
+			"IPFILTER_TRUSTED_PROXIES": config.Option{Type: config.StringSlice, EnvironmentKey: "IPFILTER_TRUSTED_PROXIES"},
+		}
+		err := r.Config.SetOptions(options)
+		if err != nil {
+			return ctx, errors.Annotate(err, errRateLimiterInitiate)
+		}
+		if r.Limit == 0 {
+			r.Limit = r.Config.GetInt64("RATELIMIT_LIMIT")
+		}
+		if r.Window == 0 {
+			r.Window = r.Config.GetDuration("RATELIMIT_WINDOW")
+		}
+		if r.KeyFunc == nil {
+			switch key := r.Config.GetString("RATELIMIT_KEY"); key {
+			case "", "ip":
+				r.KeyFunc, err = RateLimitByClientIP(r.Config.GetStringSlice("IPFILTER_TRUSTED_PROXIES"))
+				if err != nil {
+					return ctx, errors.Annotate(err, errRateLimiterInitiate)
+				}
+			case "route":
+				r.KeyFunc = RateLimitByRoute
+			default:
+				// any other value names the header holding the api key
+				r.KeyFunc = RateLimitByAPIKey(key)
+			}
+		}
+	}
+	if r.Window == 0 {
+		r.Window = time.Second
+	}
+	if r.KeyFunc == nil {
+		r.KeyFunc = RateLimitByIP
+	}
+	if r.Store == nil {
+		r.Store = NewMemoryRateLimitStore()
+	}
+	return ctx, nil
+}
+func (r *RateLimiter) OnRequestStartup(c *routing.Context) error {
+	if r.Limit <= 0 {
+		return nil
+	}
+	key := r.KeyFunc(c)
+	if key == "" {
+		return nil
+	}
+	result, err := r.Store.Take(key, r.Limit, r.Window)
+	if err != nil {
+		return err
+	}
+	header := c.ResponseWriter.Header()
+	header.Set(HeaderXRateLimitLimit, strconv.FormatInt(result.Limit, 10))
+	header.Set(HeaderXRateLimitRemaining, strconv.FormatInt(result.Remaining, 10))
+	header.Set(HeaderXRateLimitReset, strconv.FormatInt(int64(math.Ceil(result.ResetAfter.Seconds())), 10))
+	if !result.Allowed {
+		header.Set(HeaderRetryAfter, strconv.FormatInt(int64(math.Ceil(result.ResetAfter.Seconds())), 10))
+		slowDown := api.NewResponseData("SlowDown", nil)
+		return routing.NewHTTPError(slowDown.GetStatus(), slowDown.GetMessage())
+	}
+	return nil
+}
+func (r *RateLimiter) OnRequestShutdown(c *routing.Context) error {
+	return nil
+}
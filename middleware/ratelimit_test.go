@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/ltick/tick-framework/kvstore"
+	"github.com/ltick/tick-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time {
+		return now
+	}
+	for i := int64(2); i >= 0; i-- {
+		result, err := store.Take("127.0.0.1", 3, time.Second)
+		assert.Nil(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+	result, err := store.Take("127.0.0.1", 3, time.Second)
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second/3, result.ResetAfter)
+	// other keys have their own bucket
+	result, err = store.Take("127.0.0.2", 3, time.Second)
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	// one token is refilled every third of the window
+	now = now.Add(time.Second/3 + time.Nanosecond)
+	result, err = store.Take("127.0.0.1", 3, time.Second)
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+	result, err = store.Take("127.0.0.1", 3, time.Second)
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	// idle buckets are dropped once full
+	now = now.Add(2 * time.Second)
+	result, err = store.Take("127.0.0.1", 3, time.Second)
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, len(store.buckets))
+}
+
+// memoryCounter is the part of a kvstore handler the kvstore rate limit store uses.
+type memoryCounter struct {
+	kvstore.KvstoreHandler
+	values  map[string]int64
+	expires map[string]int64
+}
+
+func (m *memoryCounter) Get(key interface{}) (interface{}, error) {
+	value, ok := m.values[key.(string)]
+	if !ok {
+		return nil, errors.New(redis.ErrNil.Error())
+	}
+	return strconv.FormatInt(value, 10), nil
+}
+func (m *memoryCounter) Expire(key interface{}, expire int64) error {
+	m.expires[key.(string)] = expire
+	return nil
+}
+func (m *memoryCounter) Incrby(key interface{}, increment int64) (int64, error) {
+	m.values[key.(string)] += increment
+	return m.values[key.(string)], nil
+}
+
+func TestKvstoreRateLimitStore(t *testing.T) {
+	counter := &memoryCounter{values: make(map[string]int64), expires: make(map[string]int64)}
+	store := NewKvstoreRateLimitStore(counter, "ratelimit:")
+	// a quarter of the second window
+	now := time.Unix(1500000001, int64(250*time.Millisecond))
+	store.now = func() time.Time {
+		return now
+	}
+	for i := int64(2); i >= 0; i-- {
+		result, err := store.Take("127.0.0.1", 3, time.Second)
+		assert.Nil(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+		assert.Equal(t, 750*time.Millisecond, result.ResetAfter)
+	}
+	assert.Equal(t, int64(2), counter.expires["ratelimit:127.0.0.1:1500000001"])
+	result, err := store.Take("127.0.0.1", 3, time.Second)
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	// a rejected request does not consume the quota
+	assert.Equal(t, int64(3), counter.values["ratelimit:127.0.0.1:1500000001"])
+
+	// three quarters of the previous window are still counted
+	now = now.Add(time.Second)
+	result, err = store.Take("127.0.0.1", 3, time.Second)
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	// half of them
+	now = now.Add(time.Second / 4)
+	result, err = store.Take("127.0.0.1", 3, time.Second)
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+
+	// the handler must be a counter
+	_, err = NewKvstoreRateLimitStore(struct{ kvstore.KvstoreHandler }{}, "").Take("127.0.0.1", 3, time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	newContext := func(remoteAddr string, forwardedFor string) *routing.Context {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("X-Real-IP", forwardedFor)
+		return routing.NewContext(httptest.NewRecorder(), req)
+	}
+	// the client ip headers are ignored
+	assert.Equal(t, "192.0.2.1", RateLimitByIP(newContext("192.0.2.1:1234", "198.51.100.1")))
+
+	keyFunc, err := RateLimitByClientIP([]string{"10.0.0.0/8"})
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1", keyFunc(newContext("192.0.2.1:1234", "198.51.100.1")))
+	assert.Equal(t, "198.51.100.1", keyFunc(newContext("10.0.0.1:1234", "203.0.113.1, 198.51.100.1")))
+	_, err = RateLimitByClientIP([]string{"invalid"})
+	assert.NotNil(t, err)
+}
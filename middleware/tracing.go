@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ltick/tick-framework/tracing"
+	"github.com/ltick/tick-routing"
+	"github.com/ltick/tick-routing/access"
+)
+
+const requestTracerSpanKey = "LTICK_REQUEST_TRACER_SPAN"
+
+// RequestTracer accepts or generates the X-Request-ID and traceparent of every
+// request, makes them available to the handlers and the access log through the
+// request context, echoes the request id in the response and exports a server
+// span per request to Exporter. A malformed X-Request-ID is replaced.
+type RequestTracer struct {
+	Exporter tracing.Exporter
+}
+
+func (t *RequestTracer) Prepare(ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+func (t *RequestTracer) Initiate(ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+func (t *RequestTracer) OnRequestStartup(c *routing.Context) error {
+	requestID := c.Request.Header.Get(tracing.HeaderXRequestID)
+	if !tracing.ValidRequestID(requestID) {
+		requestID = tracing.NewRequestID()
+	}
+	ctx := tracing.WithRequestID(c.Request.Context(), requestID)
+	if traceparent := c.Request.Header.Get(tracing.HeaderTraceparent); traceparent != "" {
+		// an invalid traceparent starts a new trace
+		if traceContext, err := tracing.ParseTraceparent(traceparent); err == nil {
+			ctx = tracing.WithTraceContext(ctx, traceContext)
+		}
+	}
+	span, ctx := tracing.StartSpan(ctx, c.Request.Method+" "+c.Request.URL.Path, tracing.SpanKindServer, t.Exporter)
+	span.SetAttribute("http.host", c.Request.Host)
+	c.Request = c.Request.WithContext(ctx)
+	c.Context = tracing.WithTraceContext(tracing.WithRequestID(c.Context, requestID), tracing.TraceContextFromContext(ctx))
+	c.Set(requestTracerSpanKey, span)
+	c.ResponseWriter.Header().Set(tracing.HeaderXRequestID, requestID)
+	return nil
+}
+func (t *RequestTracer) OnRequestShutdown(c *routing.Context) error {
+	span, ok := c.Get(requestTracerSpanKey).(*tracing.Span)
+	if !ok {
+		return nil
+	}
+	if rw, ok := c.ResponseWriter.(*access.LogResponseWriter); ok {
+		span.SetAttribute("http.status_code", strconv.Itoa(rw.Status))
+	}
+	span.Finish(nil)
+	return nil
+}
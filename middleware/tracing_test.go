@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ltick/tick-framework/tracing"
+	"github.com/ltick/tick-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestTracer(t *testing.T) {
+	tracer := &RequestTracer{}
+	handle := func(requestID string) (*routing.Context, string) {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(tracing.HeaderXRequestID, requestID)
+		c := routing.NewContext(httptest.NewRecorder(), req)
+		c.Context = context.Background()
+		assert.Nil(t, tracer.OnRequestStartup(c))
+		assert.Nil(t, tracer.OnRequestShutdown(c))
+		return c, c.ResponseWriter.Header().Get(tracing.HeaderXRequestID)
+	}
+	c, requestID := handle("req-1")
+	assert.Equal(t, "req-1", requestID)
+	assert.Equal(t, "req-1", tracing.RequestIDFromContext(c.Request.Context()))
+
+	// the ids which could forge the access log are replaced
+	for _, invalid := range []string{"req|1|forged", "req-1\nforged", string(make([]byte, 129))} {
+		c, requestID = handle(invalid)
+		assert.NotEqual(t, invalid, requestID)
+		assert.True(t, tracing.ValidRequestID(requestID))
+		assert.Equal(t, requestID, tracing.RequestIDFromContext(c.Request.Context()))
+	}
+}
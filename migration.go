@@ -0,0 +1,61 @@
+package ltick
+
+import (
+	"github.com/juju/errors"
+	"github.com/ltick/tick-framework/database"
+	"github.com/ltick/tick-framework/database/migration"
+)
+
+var errMigrationCallback = "ltick: migration startup error"
+
+// MigrationCallback applies the pending migrations on the engine startup, once the components are started,
+// then calls the callback of the application if any. It is set with EngineCallback.
+type MigrationCallback struct {
+	Callback
+	Database   *database.Database `inject:"true"`
+	Handler    string
+	Migrations []*migration.Migration
+	Options    []migration.MigratorOption
+}
+
+// NewMigrationCallback returns the callback migrating the database handler named handler, wrapping callback which may be nil.
+func NewMigrationCallback(callback Callback, handler string, migrations []*migration.Migration, setters ...migration.MigratorOption) *MigrationCallback {
+	return &MigrationCallback{
+		Callback:   callback,
+		Handler:    handler,
+		Migrations: migrations,
+		Options:    setters,
+	}
+}
+
+func (c *MigrationCallback) OnStartup(e *Engine) error {
+	if c.Database == nil {
+		return errors.Annotate(errors.New("ltick: database component not injected"), errMigrationCallback)
+	}
+	db, err := c.Database.GetHandler(c.Handler)
+	if err != nil {
+		return errors.Annotate(err, errMigrationCallback)
+	}
+	migrator := migration.NewMigrator(db, append([]migration.MigratorOption{migration.MigratorLogWriter(e.GetLogWriter())}, c.Options...)...)
+	if err := migrator.Register(c.Migrations...); err != nil {
+		return errors.Annotate(err, errMigrationCallback)
+	}
+	if _, err := migrator.Up(); err != nil {
+		return errors.Annotate(err, errMigrationCallback)
+	}
+	if c.Callback != nil {
+		// the engine only injects the components to the callback it knows
+		if err := e.Registry.InjectComponentTo([]interface{}{c.Callback}); err != nil {
+			return errors.Annotate(err, errMigrationCallback)
+		}
+		return c.Callback.OnStartup(e)
+	}
+	return nil
+}
+
+func (c *MigrationCallback) OnShutdown(e *Engine) error {
+	if c.Callback != nil {
+		return c.Callback.OnShutdown(e)
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/bsm/sarama-cluster"
+	"github.com/ltick/tick-framework/tracing"
 )
 
 var (
@@ -129,15 +130,29 @@ func (c *Consumer) Close() {
 type Producer struct {
 	topic    string
 	producer sarama.AsyncProducer
+	tracer   tracing.Tracer
+}
+
+// SetTracer traces the messages produced, the span only covers queueing the
+// message since the delivery errors are reported to the error handle.
+func (p *Producer) SetTracer(tracer tracing.Tracer) {
+	p.tracer = tracer
 }
 
 // 生产
 func (p *Producer) Produce(message []byte) {
+	p.ProduceContext(context.Background(), message)
+}
+
+// ProduceContext produces message, its span is a child of the span of ctx.
+func (p *Producer) ProduceContext(ctx context.Context, message []byte) {
+	span, _ := tracing.StartOperation(ctx, p.tracer, queueTraceComponent, "Produce", p.topic)
 	producerMessage := &sarama.ProducerMessage{
 		Topic: p.topic,
 		Value: sarama.ByteEncoder(message),
 	}
 	p.producer.Input() <- producerMessage
+	span.Finish(nil)
 }
 
 // 启动写入错误处理
@@ -6,6 +6,7 @@ import (
 
 	"github.com/juju/errors"
 	"github.com/ltick/tick-framework/config"
+	"github.com/ltick/tick-framework/tracing"
 )
 
 var (
@@ -28,6 +29,8 @@ type Queue struct {
 	configs  map[string]interface{}
 	Provider string
 	handler  Handler
+	// Tracer traces the messages produced when set
+	Tracer tracing.Tracer
 }
 
 func (q *Queue) Prepare(ctx context.Context) (context.Context, error) {
@@ -130,7 +133,7 @@ func (q *Queue) NewQueue(ctx context.Context, name string, configs ...map[string
 	if queueHandler == nil {
 		return nil, errors.Annotate(err, fmt.Sprintf(errNewQueue+": empty pool", name))
 	}
-	return queueHandler, nil
+	return NewTracedQueueHandler(queueHandler, q.Tracer), nil
 }
 func (q *Queue) GetQueue(name string) (QueueHandler, error) {
 	if q.handler == nil {
@@ -140,7 +143,7 @@ func (q *Queue) GetQueue(name string) (QueueHandler, error) {
 	if err != nil {
 		return nil, errors.Annotate(err, fmt.Sprintf(errGetQueue, name))
 	}
-	return queueHandler, err
+	return NewTracedQueueHandler(queueHandler, q.Tracer), err
 }
 
 type Handler interface {
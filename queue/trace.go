@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/ltick/tick-framework/tracing"
+)
+
+const queueTraceComponent = "queue"
+
+// tracedQueueHandler sets its tracer to the producers created by a QueueHandler.
+type tracedQueueHandler struct {
+	QueueHandler
+	tracer tracing.Tracer
+}
+
+// NewTracedQueueHandler wraps handler so that the messages produced by its
+// producers are traced by tracer, handler is returned as is when tracer is nil.
+func NewTracedQueueHandler(handler QueueHandler, tracer tracing.Tracer) QueueHandler {
+	if handler == nil || tracer == nil {
+		return handler
+	}
+	if _, ok := handler.(*tracedQueueHandler); ok {
+		return handler
+	}
+	return &tracedQueueHandler{
+		QueueHandler: handler,
+		tracer:       tracer,
+	}
+}
+
+func (this *tracedQueueHandler) NewProducer(ctx context.Context, topic string, errHandles ...func(context.Context, string, string, error)) (*Producer, error) {
+	producer, err := this.QueueHandler.NewProducer(ctx, topic, errHandles...)
+	if err != nil {
+		return nil, err
+	}
+	producer.SetTracer(this.tracer)
+	return producer, nil
+}
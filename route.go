@@ -0,0 +1,171 @@
+package ltick
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/ltick/tick-framework/api"
+)
+
+var (
+	errRouteNotExists     = "ltick: route '%s' not exists"
+	errRouteParamMissing  = "ltick: route '%s' param '%s' missing"
+	errRouteParamMismatch = "ltick: route '%s' param '%s' value '%s' does not match '%s'"
+)
+
+// pathParamPattern matches the path params, `<id>` or `<id:constraint>`,
+// the constraint is the name of a type registered by RegisterPathParamType or a regular expression.
+var pathParamPattern = regexp.MustCompile(`<(\w+)(?::([^>]*))?>`)
+
+var pathParamTypes = struct {
+	sync.RWMutex
+	m map[string]string
+}{
+	m: map[string]string{
+		"int":   `-?[0-9]+`,
+		"uint":  `[0-9]+`,
+		"alpha": `[a-zA-Z]+`,
+		"alnum": `[a-zA-Z0-9]+`,
+		"slug":  `[a-zA-Z0-9_-]+`,
+		"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	},
+}
+
+// RegisterPathParamType registers the type of the path params constrained by its name, e.g. `/users/<id:int>`,
+// the requests whose param does not match the pattern are not routed (404 Not Found).
+func RegisterPathParamType(name string, pattern string) {
+	pathParamTypes.Lock()
+	pathParamTypes.m[name] = pattern
+	pathParamTypes.Unlock()
+}
+
+func pathParamType(constraint string) string {
+	pathParamTypes.RLock()
+	defer pathParamTypes.RUnlock()
+	if pattern, ok := pathParamTypes.m[constraint]; ok {
+		return pattern
+	}
+	return constraint
+}
+
+// expandPathParamTypes replaces the type names constraining the path params with their patterns.
+func expandPathParamTypes(path string) string {
+	return pathParamPattern.ReplaceAllStringFunc(path, func(param string) string {
+		match := pathParamPattern.FindStringSubmatch(param)
+		if match[2] == "" {
+			return param
+		}
+		return "<" + match[1] + ":" + pathParamType(match[2]) + ">"
+	})
+}
+
+// openAPIPathParams converts the path params of the route path to the OpenAPI templating, `{id}`,
+// and adds their schemas by name to schemas.
+func openAPIPathParams(routePath string, schemas map[string]*api.OpenAPISchema) string {
+	return pathParamPattern.ReplaceAllStringFunc(routePath, func(param string) string {
+		match := pathParamPattern.FindStringSubmatch(param)
+		schemas[match[1]] = pathParamSchema(match[2])
+		return "{" + match[1] + "}"
+	})
+}
+
+// pathParamSchema returns the OpenAPI schema of a path param constrained by constraint.
+func pathParamSchema(constraint string) *api.OpenAPISchema {
+	switch constraint {
+	case "":
+		return &api.OpenAPISchema{Type: "string"}
+	case "int":
+		return &api.OpenAPISchema{Type: "integer"}
+	case "uint":
+		minimum := 0.0
+		return &api.OpenAPISchema{Type: "integer", Minimum: &minimum}
+	case "uuid":
+		return &api.OpenAPISchema{Type: "string", Format: "uuid"}
+	}
+	return &api.OpenAPISchema{Type: "string", Pattern: "^(?:" + pathParamType(constraint) + ")$"}
+}
+
+// routePathRegexp returns the regular expression matching the request paths of the route path,
+// whose params match their constraints and trailing `*` any suffix, as the router does.
+func routePathRegexp(routePath string) (*regexp.Regexp, error) {
+	wildcard := strings.HasSuffix(routePath, "*")
+	routePath = strings.TrimSuffix(routePath, "*")
+	pattern := "^"
+	last := 0
+	for _, loc := range pathParamPattern.FindAllStringSubmatchIndex(routePath, -1) {
+		pattern += regexp.QuoteMeta(routePath[last:loc[0]])
+		if loc[4] >= 0 && loc[5] > loc[4] {
+			pattern += "(?:" + pathParamType(routePath[loc[4]:loc[5]]) + ")"
+		} else {
+			pattern += "[^/]*"
+		}
+		last = loc[1]
+	}
+	pattern += regexp.QuoteMeta(routePath[last:])
+	if wildcard {
+		pattern += ".*"
+	}
+	return regexp.Compile(pattern + "$")
+}
+
+// joinRoutePath joins the group and the path of a route, keeping the trailing slash of the path.
+func joinRoutePath(group string, routePath string) string {
+	joined := path.Join("/", group, routePath)
+	if strings.HasSuffix(routePath, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// Name names the route added last, for Server.URL.
+func (s *Server) Name(name string) *Server {
+	if len(s.Router.Routes) > 0 {
+		s.Router.Routes[len(s.Router.Routes)-1].Name = name
+	}
+	return s
+}
+
+// URL builds the URL path of the route named name with the path params,
+// the params must match the constraints of the route.
+func (s *Server) URL(name string, params map[string]interface{}) (string, error) {
+	var route *ServerRouterRoute
+	for _, r := range s.Router.Routes {
+		if r != nil && r.Name == name {
+			route = r
+			break
+		}
+	}
+	if route == nil {
+		return "", errors.Errorf(errRouteNotExists, name)
+	}
+	var err error
+	routeURL := pathParamPattern.ReplaceAllStringFunc(joinRoutePath(route.Group, route.Path), func(param string) string {
+		if err != nil {
+			return ""
+		}
+		match := pathParamPattern.FindStringSubmatch(param)
+		value, ok := params[match[1]]
+		if !ok {
+			err = errors.Errorf(errRouteParamMissing, name, match[1])
+			return ""
+		}
+		s := fmt.Sprint(value)
+		if match[2] != "" {
+			pattern := pathParamType(match[2])
+			if matched, _ := regexp.MatchString("^(?:"+pattern+")$", s); !matched {
+				err = errors.Errorf(errRouteParamMismatch, name, match[1], s, match[2])
+				return ""
+			}
+		}
+		return url.PathEscape(s)
+	})
+	if err != nil {
+		return "", err
+	}
+	return routeURL, nil
+}
@@ -0,0 +1,139 @@
+package ltick
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ltick/tick-framework/api"
+	"github.com/ltick/tick-routing"
+	"github.com/ltick/tick-routing/content"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathParamTypes(t *testing.T) {
+	assert.Equal(t, "/users/<id:-?[0-9]+>/posts/<slug>", expandPathParamTypes("/users/<id:int>/posts/<slug>"))
+	assert.Equal(t, `/files/<name:\w+\.txt>`, expandPathParamTypes(`/files/<name:\w+\.txt>`))
+
+	router := routing.New()
+	group := &ServerRouteGroup{RouteGroup: router.Group("/users")}
+	group.AddRoute("GET", "/<id:int>", func(c *routing.Context) error {
+		return c.Write("user " + c.Param("id"))
+	})
+	group.AddRoute("GET", "/<id:uuid>/avatar", func(c *routing.Context) error {
+		return c.Write("avatar " + c.Param("id"))
+	})
+	for path, status := range map[string]int{
+		"/users/42":     http.StatusOK,
+		"/users/-1":     http.StatusOK,
+		"/users/ltick":  http.StatusNotFound,
+		"/users/4.2":    http.StatusNotFound,
+		"/users/42/bio": http.StatusNotFound,
+		"/users/6ba7b810-9dad-11d1-80b4-00c04fd430c8/avatar": http.StatusOK,
+		"/users/6ba7b810/avatar":                             http.StatusNotFound,
+	} {
+		req, _ := http.NewRequest("GET", path, nil)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		assert.Equal(t, status, res.Code, path)
+	}
+}
+
+func TestServerURL(t *testing.T) {
+	server := &Server{Router: &ServerRouter{}}
+	server.Get([]string{"*"}, "/users", "/<id:int>/posts/<slug>", metricsHandler{}).Name("user-post")
+	server.Get([]string{"*"}, "/users", "/<id:uuid>", metricsHandler{}).Name("user")
+	server.Get([]string{"*"}, "/users/", "/<id:int>/posts/", metricsHandler{}).Name("user-posts")
+	server.Get([]string{"*"}, "v1", "users", metricsHandler{}).Name("users")
+
+	url, err := server.URL("user-post", map[string]interface{}{"id": 42, "slug": "hello world"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/users/42/posts/hello%20world", url)
+
+	// the group and the path are joined, the trailing slash is kept
+	url, err = server.URL("user-posts", map[string]interface{}{"id": 42})
+	assert.Nil(t, err)
+	assert.Equal(t, "/users/42/posts/", url)
+	url, err = server.URL("users", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "/v1/users", url)
+
+	_, err = server.URL("user-post", map[string]interface{}{"id": "ltick", "slug": "hello"})
+	assert.NotNil(t, err)
+	_, err = server.URL("user-post", map[string]interface{}{"id": 42})
+	assert.NotNil(t, err)
+	_, err = server.URL("user", map[string]interface{}{"id": 42})
+	assert.NotNil(t, err)
+	_, err = server.URL("unknown", nil)
+	assert.NotNil(t, err)
+}
+
+func TestServerRouterStreamRoute(t *testing.T) {
+	router := &ServerRouter{}
+	assert.Nil(t, router.addStreamRoute("GET", "/events/<id:int>"))
+	assert.Nil(t, router.addStreamRoute("ANY", "/ws/*"))
+	assert.NotNil(t, router.addStreamRoute("GET", "/<id:[>"))
+	for _, c := range []struct {
+		method string
+		path   string
+		stream bool
+	}{
+		{"GET", "/events/42", true},
+		{"POST", "/events/42", false},
+		{"GET", "/events/ltick", false},
+		{"GET", "/events/42/more", false},
+		{"POST", "/ws/chat", true},
+		{"GET", "/users", false},
+	} {
+		req, _ := http.NewRequest(c.method, c.path, nil)
+		// the client headers do not exempt a request from the timeout
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Upgrade", "websocket")
+		assert.Equal(t, c.stream, router.isStreamRoute(req), c.method+" "+c.path)
+	}
+}
+
+func TestServerOpenAPIDocument(t *testing.T) {
+	server := &Server{Router: &ServerRouter{}}
+	server.Get([]string{"*"}, "/tenants/<tenant:slug>", "/users/<id:int>/files/<file:uuid>/<name>", metricsHandler{})
+	document := server.OpenAPIDocument(api.OpenAPIInfo{Title: "test", Version: "1.0"})
+	operation := document.Paths["/tenants/{tenant}/users/{id}/files/{file}/{name}"]["get"]
+	if assert.NotNil(t, operation) && assert.Len(t, operation.Parameters, 4) {
+		params := make(map[string]*api.OpenAPIParameter)
+		for _, param := range operation.Parameters {
+			assert.Equal(t, "path", param.In)
+			assert.True(t, param.Required)
+			params[param.Name] = param
+		}
+		assert.Equal(t, "integer", params["id"].Schema.Type)
+		assert.Equal(t, "string", params["file"].Schema.Type)
+		assert.Equal(t, "uuid", params["file"].Schema.Format)
+		assert.Equal(t, "^(?:[a-zA-Z0-9_-]+)$", params["tenant"].Schema.Pattern)
+		assert.Equal(t, "string", params["name"].Schema.Type)
+	}
+}
+
+func TestDefaultTypeNegotiator(t *testing.T) {
+	router := &ServerRouter{}
+	for mime, writer := range api.DataWriters {
+		router.AddTypeNegotiator(mime, writer)
+	}
+	negotiator := content.TypeNegotiator(defaultTypeNegotiator...)
+	for accept, expected := range map[string]string{
+		"":                                  JSON,
+		"*/*":                               HTML,
+		"application/xml":                   XML,
+		"application/yaml":                  YAML,
+		"application/msgpack":               MSGPACK,
+		"application/protobuf":              PROTOBUF,
+		"application/x-www-form-urlencoded": FORM,
+	} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", accept)
+		res := httptest.NewRecorder()
+		c := routing.NewContext(res, req)
+		assert.Nil(t, negotiator(c))
+		assert.True(t, strings.HasPrefix(res.Header().Get("Content-Type"), expected), accept+": "+res.Header().Get("Content-Type"))
+	}
+}
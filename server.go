@@ -95,17 +95,29 @@ type (
 		Host      []string
 		BasicAuth *ServerBasicAuth
 	}
+	ServerRouterOpenAPI struct {
+		Host      []string
+		Group     string
+		Path      string
+		BasicAuth *ServerBasicAuth
+		Info      api.OpenAPIInfo
+	}
 	ServerRouterRoute struct {
+		Name      string // the name of the route for Server.URL
 		Host      []string
 		Group     string
 		Method    []string
 		Path      string
 		BasicAuth *ServerBasicAuth
+		Auth      api.Authenticator
 		Handlers  []api.Handler
+		// Stream exempts the requests of the route from the request timeout
+		Stream bool
 	}
 	routeHandler struct {
 		Host      []string
 		BasicAuth *ServerBasicAuth
+		Auth      api.Authenticator
 		Handler   api.Handler
 	}
 
@@ -123,6 +135,7 @@ type (
 		SlashRemover           *int
 		LanguageNegotiator     []string
 		Cors                   *cors.Options
+		Compression            *CompressionOptions
 		RouteProviders         map[string]interface{}
 	}
 
@@ -134,8 +147,16 @@ type (
 		Middlewares []MiddlewareInterface
 		Metrics     *ServerRouterMetrics
 		Pprof       *ServerRouterPprof
+		OpenAPI     *ServerRouterOpenAPI
 		Proxys      []*ServerRouterProxy
 		Routes      []*ServerRouterRoute
+
+		streamRoutes []serverRouterStreamRoute
+	}
+	// serverRouterStreamRoute matches the requests of a route exempted from the request timeout
+	serverRouterStreamRoute struct {
+		method string
+		path   *regexp.Regexp
 	}
 	ServerRouteGroup struct {
 		*routing.RouteGroup
@@ -317,6 +338,13 @@ func ServerRouterCors(cors *cors.Options) ServerRouterOption {
 		}
 	}
 }
+func ServerRouterCompression(compression *CompressionOptions) ServerRouterOption {
+	return func(options *ServerRouterOptions) {
+		if compression != nil {
+			options.Compression = compression
+		}
+	}
+}
 func ServerRouterRouteProviders(routeProviders map[string]interface{}) ServerRouterOption {
 	return func(options *ServerRouterOptions) {
 		options.RouteProviders = routeProviders
@@ -370,10 +398,13 @@ func (r *ServerRouter) Resolve() {
 		r.WithRecoveryHandler(DefaultErrorLogFunc(), r.Options.RecoveryHandler)
 	}
 	// Type
+	for mime, writer := range api.DataWriters {
+		r.AddTypeNegotiator(mime, writer)
+	}
 	if r.Options.TypeNegotiator != nil {
 		r.WithTypeNegotiator(r.Options.TypeNegotiator...)
 	} else {
-		r.WithTypeNegotiator(JSON, XML, XML2, HTML)
+		r.WithTypeNegotiator(defaultTypeNegotiator...)
 	}
 	// Slash
 	if r.Options.SlashRemover != nil {
@@ -387,6 +418,10 @@ func (r *ServerRouter) Resolve() {
 	if r.Options.Cors != nil {
 		r.WithCors(*r.Options.Cors)
 	}
+	// Compression
+	if r.Options.Compression != nil {
+		r.WithCompression(*r.Options.Compression)
+	}
 	// Timeout
 	if r.Options.RequestTimeout.Duration > 0 {
 		r.WithTimeout(r.Options.RequestTimeout.Duration)
@@ -449,6 +484,24 @@ func (sp *ServerRouterProxy) Serve(c *api.Context) (error) {
 	return nil
 }
 
+// Authenticate verifies the request carries the configured basic auth credentials.
+func (a *ServerBasicAuth) Authenticate(ctx *api.Context) error {
+	return api.NewBasicAuthenticator("", map[string]string{a.Username: api.PasswordPlainPrefix + a.Password}).Authenticate(ctx)
+}
+
+// authenticate runs the route authenticators, BasicAuth first.
+func (h routeHandler) authenticate(ctx *api.Context) error {
+	if h.BasicAuth != nil {
+		if err := h.BasicAuth.Authenticate(ctx); err != nil {
+			return err
+		}
+	}
+	if h.Auth != nil {
+		return h.Auth.Authenticate(ctx)
+	}
+	return nil
+}
+
 func (e *Engine) RegisterServer(name string, server *Server) {
 	if e.ServerMap == nil {
 		e.ServerMap = make(map[string]*Server, 0)
@@ -615,6 +668,26 @@ func (s *Server) Proxy(host []string, group string, path string, upstream string
 	})
 	return s
 }
+
+// Authenticate protects the routes registered under group and path with auth.
+func (s *Server) Authenticate(group string, path string, auth api.Authenticator) *Server {
+	for _, route := range s.Router.Routes {
+		if route != nil && route.Group == group && route.Path == path {
+			route.Auth = auth
+		}
+	}
+	return s
+}
+// Stream exempts the routes registered under group and path from the request timeout,
+// for the handlers of event streams not wrapped by api.NewStreamHandler.
+func (s *Server) Stream(group string, path string) *Server {
+	for _, route := range s.Router.Routes {
+		if route != nil && route.Group == group && route.Path == path {
+			route.Stream = true
+		}
+	}
+	return s
+}
 func (s *Server) Pprof(host []string, basicAuth *ServerBasicAuth) *Server {
 	s.Router.Pprof = &ServerRouterPprof{
 		Host:      host,
@@ -631,6 +704,50 @@ func (s *Server) Metrics(host []string, group string, basicAuth *ServerBasicAuth
 	return s
 }
 
+// OpenAPI serves the OpenAPI document of the routes of the server at the group and the path.
+func (s *Server) OpenAPI(host []string, group string, path string, info api.OpenAPIInfo, basicAuth *ServerBasicAuth) *Server {
+	s.Router.OpenAPI = &ServerRouterOpenAPI{
+		Host:      host,
+		Group:     group,
+		Path:      path,
+		BasicAuth: basicAuth,
+		Info:      info,
+	}
+	return s
+}
+
+// OpenAPIDocument generates the OpenAPI document of the routes of the server.
+func (s *Server) OpenAPIDocument(info api.OpenAPIInfo) *api.OpenAPIDocument {
+	routes := make([]api.OpenAPIRoute, 0)
+	for _, route := range s.Router.Routes {
+		if route == nil {
+			continue
+		}
+		for index, method := range route.Method {
+			if index >= len(route.Handlers) {
+				continue
+			}
+			pathParams := make(map[string]*api.OpenAPISchema)
+			routes = append(routes, api.OpenAPIRoute{
+				Method:     method,
+				Group:      openAPIPathParams(route.Group, pathParams),
+				Path:       openAPIPathParams(route.Path, pathParams),
+				Handler:    route.Handlers[index],
+				PathParams: pathParams,
+			})
+		}
+	}
+	return api.NewOpenAPIDocument(info, routes)
+}
+
+type openAPIHandler struct {
+	document *api.OpenAPIDocument
+}
+
+func (h openAPIHandler) Serve(ctx *api.Context) error {
+	return ctx.ResponseJSON(http.StatusOK, h.document)
+}
+
 type metricsHandler struct {
 }
 
@@ -656,7 +773,9 @@ type pprofHandler struct {
 
 func (h pprofHandler) Serve(ctx *api.Context) error {
 	if h.basicAuth != nil {
-		ctx.Request.SetBasicAuth(h.basicAuth.Username, h.basicAuth.Username)
+		if err := h.basicAuth.Authenticate(ctx); err != nil {
+			return err
+		}
 	}
 	ctx.ResponseWriter.Header().Set("Content-Type", "text/html")
 	h.httpHandler.ServeHTTP(ctx.ResponseWriter, ctx.Request)
@@ -736,8 +855,39 @@ func (r *ServerRouter) AddMiddlewares(middleware RouterCallback) *ServerRouter {
 	return r
 }
 
+// addStreamRoute exempts the requests of the route from the request timeout, method "ANY" matching every method.
+func (r *ServerRouter) addStreamRoute(method string, routePath string) error {
+	path, err := routePathRegexp(routePath)
+	if err != nil {
+		return err
+	}
+	r.streamRoutes = append(r.streamRoutes, serverRouterStreamRoute{
+		method: strings.ToUpper(method),
+		path:   path,
+	})
+	return nil
+}
+
+// isStreamRoute reports whether the request is routed to a stream route.
+func (r *ServerRouter) isStreamRoute(req *http.Request) bool {
+	for _, route := range r.streamRoutes {
+		if (route.method == "ANY" || route.method == req.Method) && route.path.MatchString(req.URL.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithTimeout limits the duration of the requests, except those of the stream routes:
+// the routes of the api.StreamHandler handlers and the routes marked by Server.Stream.
 func (r *ServerRouter) WithTimeout(timeout time.Duration) *ServerRouter {
-	r.AppendStartupHandler(fault.TimeoutHandler(timeout))
+	timeoutHandler := fault.TimeoutHandler(timeout)
+	r.AppendStartupHandler(func(c *routing.Context) error {
+		if r.isStreamRoute(c.Request) {
+			return c.Next()
+		}
+		return timeoutHandler(c)
+	})
 	return r
 }
 
@@ -788,12 +938,20 @@ func (r *ServerRouter) WithLanguageNegotiator(languages ...string) *ServerRouter
 //
 // If you do not specify any supported MIME types, the negotiator will use "text/html" as the response MIME type.
 const (
-	JSON = content.JSON
-	XML  = content.XML
-	XML2 = content.XML2
-	HTML = content.HTML
+	JSON     = content.JSON
+	XML      = content.XML
+	XML2     = content.XML2
+	HTML     = content.HTML
+	YAML     = api.MIMEApplicationYAML
+	MSGPACK  = api.MIMEApplicationMsgpack
+	PROTOBUF = api.MIMEApplicationProtobuf
+	FORM     = api.MIMEApplicationForm
 )
 
+// defaultTypeNegotiator are the formats negotiated unless ServerRouterTypeNegotiator is set, JSON without Accept.
+// HTML stays last: the negotiator answers "*/*" with the last format.
+var defaultTypeNegotiator = []string{JSON, XML, XML2, YAML, MSGPACK, PROTOBUF, FORM, HTML}
+
 func (r *ServerRouter) AddTypeNegotiator(mime string, writer routing.DataWriter) *ServerRouter {
 	content.DataWriters[mime] = writer
 	return r
@@ -830,6 +988,22 @@ func (r *ServerRouter) WithCors(opts cors.Options) *ServerRouter {
 	return r
 }
 
+// The responses are compressed with the gzip or deflate coding accepted by the client,
+// the methods, the level and the min length compressed are set by acceptencoder.InitGzip,
+// the GET responses are compressed at the best speed by default.
+//
+//     import (
+//         "github.com/ltick/tick-framework"
+//         "github.com/ltick/tick-framework/api/acceptencoder"
+//     )
+//
+//     acceptencoder.InitGzip(1024, 6, []string{"GET", "POST"})
+//     r.WithCompression(ltick.CompressionOptions{})
+func (r *ServerRouter) WithCompression(opts CompressionOptions) *ServerRouter {
+	r.AppendStartupHandler(Compressor(opts))
+	return r
+}
+
 // The handler will redirect the browser to the new URL without the trailing slash.
 // The status parameter should be either http.StatusMovedPermanently (301) or http.StatusFound (302), which is to
 // be used for redirecting GET requests. For other requests, the status code will be http.StatusTemporaryRedirect (307).
@@ -883,14 +1057,14 @@ func (g *ServerRouteGroup) AddApiRoute(method string, path string, handlerRoutes
 		for _, route := range handlerRoutes {
 			for _, host := range route.Host {
 				if utility.WildcardMatch(host, requestHost) {
-					if route.BasicAuth != nil {
-						ctx.Request.SetBasicAuth(route.BasicAuth.Username, route.BasicAuth.Password)
-					}
 					ctx.Context = utility.MergeContext(ctx.Request.Context(), ctx.Context)
 					apiCtx := &api.Context{
 						Context:  ctx,
 						Response: api.NewResponse(ctx),
 					}
+					if err := route.authenticate(apiCtx); err != nil {
+						return err
+					}
 					return route.Handler.Serve(apiCtx)
 				}
 			}
@@ -903,6 +1077,7 @@ func (g *ServerRouteGroup) AddApiRoute(method string, path string, handlerRoutes
 
 // 添加API路由
 func (g *ServerRouteGroup) AddRoute(method string, path string, handlers ...routing.Handler) {
+	path = expandPathParamTypes(path)
 	switch strings.ToUpper(method) {
 	case "GET":
 		g.Get(path, handlers...)
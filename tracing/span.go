@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Span kinds
+const (
+	SpanKindServer = "server"
+	SpanKindClient = "client"
+)
+
+type (
+	// Span records one timed operation of a trace.
+	Span struct {
+		TraceID      string
+		SpanID       string
+		ParentSpanID string
+		RequestID    string
+		Name         string
+		Kind         string
+		Start        time.Time
+		Duration     time.Duration
+		Err          error
+		Attributes   map[string]string
+
+		exporter Exporter
+	}
+
+	// Exporter ships finished spans to a tracing backend.
+	Exporter interface {
+		Export(span *Span)
+	}
+
+	// InMemoryCollector is an Exporter keeping the spans in memory, mostly for tests.
+	InMemoryCollector struct {
+		mutex sync.Mutex
+		spans []*Span
+	}
+)
+
+// StartSpan starts a span as a child of the trace carried by ctx, or as the root
+// of a new trace, and returns a copy of ctx carrying the span context.
+// The span is exported by exporter when finished, exporter may be nil.
+func StartSpan(ctx context.Context, name string, kind string, exporter Exporter) (*Span, context.Context) {
+	var traceContext *TraceContext
+	parentSpanID := ""
+	if parent := TraceContextFromContext(ctx); parent != nil {
+		traceContext = parent.Child()
+		parentSpanID = parent.SpanID
+	} else {
+		traceContext = NewTraceContext()
+	}
+	span := &Span{
+		TraceID:      traceContext.TraceID,
+		SpanID:       traceContext.SpanID,
+		ParentSpanID: parentSpanID,
+		RequestID:    RequestIDFromContext(ctx),
+		Name:         name,
+		Kind:         kind,
+		Start:        time.Now(),
+		Attributes:   make(map[string]string),
+		exporter:     exporter,
+	}
+	return span, WithTraceContext(ctx, traceContext)
+}
+
+func (s *Span) SetAttribute(key string, value string) *Span {
+	if s == nil {
+		return nil
+	}
+	s.Attributes[key] = value
+	return s
+}
+
+// Finish records the duration and the error of the span and exports it.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.Duration = time.Since(s.Start)
+	s.Err = err
+	if s.exporter != nil {
+		s.exporter.Export(s)
+	}
+}
+
+func NewInMemoryCollector() *InMemoryCollector {
+	return &InMemoryCollector{
+		spans: make([]*Span, 0),
+	}
+}
+
+func (c *InMemoryCollector) Export(span *Span) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.spans = append(c.spans, span)
+}
+
+// Spans returns the spans collected so far.
+func (c *InMemoryCollector) Spans() []*Span {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	spans := make([]*Span, len(c.spans))
+	copy(spans, c.spans)
+	return spans
+}
+
+// Reset drops the spans collected so far.
+func (c *InMemoryCollector) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.spans = make([]*Span, 0)
+}
@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+var (
+	errParseTraceparent = "tracing: parse traceparent '%s' error"
+)
+
+// Propagation headers
+const (
+	HeaderXRequestID  = "X-Request-ID"
+	HeaderTraceparent = "traceparent"
+)
+
+// Context keys, "requestId" is also read by the access log.
+const (
+	RequestIDContextKey    = "requestId"
+	TraceContextContextKey = "traceContext"
+)
+
+const (
+	traceparentVersion = "00"
+	FlagSampled        = 0x01
+	// maxRequestIDLength bounds the request ids accepted from the clients
+	maxRequestIDLength = 128
+)
+
+// TraceContext identifies a span within a trace, as carried by the W3C traceparent header.
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+	Flags   byte
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewRequestID returns a random 128 bit request id.
+func NewRequestID() string {
+	return randomHex(16)
+}
+
+// ValidRequestID reports whether id may be accepted from a client: it is echoed
+// in the response and written to the logs, so it is limited to 128 letters,
+// digits, '.', '_' and '-'.
+func ValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		switch c := id[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewTraceContext starts a new sampled trace.
+func NewTraceContext() *TraceContext {
+	return &TraceContext{
+		TraceID: randomHex(16),
+		SpanID:  randomHex(8),
+		Flags:   FlagSampled,
+	}
+}
+
+// ParseTraceparent parses a "version-traceid-spanid-flags" header value.
+func ParseTraceparent(traceparent string) (*TraceContext, error) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == traceparentVersion && len(parts) != 4) {
+		return nil, errors.Annotatef(errors.New("invalid format"), errParseTraceparent, traceparent)
+	}
+	if !isHex(parts[1], 32) || parts[1] == strings.Repeat("0", 32) {
+		return nil, errors.Annotatef(errors.New("invalid trace id"), errParseTraceparent, traceparent)
+	}
+	if !isHex(parts[2], 16) || parts[2] == strings.Repeat("0", 16) {
+		return nil, errors.Annotatef(errors.New("invalid span id"), errParseTraceparent, traceparent)
+	}
+	if !isHex(parts[3], 2) {
+		return nil, errors.Annotatef(errors.New("invalid flags"), errParseTraceparent, traceparent)
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	return &TraceContext{
+		TraceID: parts[1],
+		SpanID:  parts[2],
+		Flags:   flags[0],
+	}, nil
+}
+
+func isHex(s string, length int) bool {
+	if len(s) != length || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Child returns the context of a new span in the same trace.
+func (t *TraceContext) Child() *TraceContext {
+	return &TraceContext{
+		TraceID: t.TraceID,
+		SpanID:  randomHex(8),
+		Flags:   t.Flags,
+	}
+}
+
+func (t *TraceContext) Sampled() bool {
+	return t.Flags&FlagSampled != 0
+}
+
+// String formats t as a traceparent header value.
+func (t *TraceContext) String() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, t.TraceID, t.SpanID, t.Flags)
+}
+
+// WithRequestID returns a copy of ctx carrying requestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, RequestIDContextKey, requestID)
+}
+
+// RequestIDFromContext returns the request id carried by ctx, empty if none.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(RequestIDContextKey).(string)
+	return requestID
+}
+
+// WithTraceContext returns a copy of ctx carrying traceContext.
+func WithTraceContext(ctx context.Context, traceContext *TraceContext) context.Context {
+	return context.WithValue(ctx, TraceContextContextKey, traceContext)
+}
+
+// TraceContextFromContext returns the trace context carried by ctx, nil if none.
+func TraceContextFromContext(ctx context.Context) *TraceContext {
+	traceContext, _ := ctx.Value(TraceContextContextKey).(*TraceContext)
+	return traceContext
+}
@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	traceContext, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Nil(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceContext.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", traceContext.SpanID)
+	assert.True(t, traceContext.Sampled())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", traceContext.String())
+
+	for _, traceparent := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, err = ParseTraceparent(traceparent)
+		assert.NotNil(t, err, traceparent)
+	}
+}
+
+func TestStartSpan(t *testing.T) {
+	collector := NewInMemoryCollector()
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := WithTraceContext(WithRequestID(context.Background(), "request-id"), parent)
+	span, spanCtx := StartSpan(ctx, "operation", SpanKindServer, collector)
+	assert.Equal(t, parent.TraceID, span.TraceID)
+	assert.Equal(t, parent.SpanID, span.ParentSpanID)
+	assert.Equal(t, "request-id", span.RequestID)
+	assert.Equal(t, span.SpanID, TraceContextFromContext(spanCtx).SpanID)
+	assert.Equal(t, 0, len(collector.Spans()))
+	span.Finish(nil)
+	assert.Equal(t, []*Span{span}, collector.Spans())
+
+	root, _ := StartSpan(context.Background(), "root", SpanKindServer, nil)
+	assert.Equal(t, "", root.ParentSpanID)
+	assert.Equal(t, 32, len(root.TraceID))
+}
+
+func TestTransport(t *testing.T) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+	}))
+	defer server.Close()
+	collector := NewInMemoryCollector()
+	client := &http.Client{Transport: NewTransport(nil, collector)}
+
+	req, _ := http.NewRequest("GET", server.URL+"/test", nil)
+	_, err := client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "", headers.Get(HeaderXRequestID))
+	assert.Equal(t, "", headers.Get(HeaderTraceparent))
+	assert.Equal(t, 0, len(collector.Spans()))
+
+	parent := NewTraceContext()
+	ctx := WithTraceContext(WithRequestID(context.Background(), "request-id"), parent)
+	req, _ = http.NewRequest("GET", server.URL+"/test", nil)
+	_, err = client.Do(req.WithContext(ctx))
+	assert.Nil(t, err)
+	assert.Equal(t, "request-id", headers.Get(HeaderXRequestID))
+	assert.Equal(t, "", req.Header.Get(HeaderTraceparent))
+	traceContext, err := ParseTraceparent(headers.Get(HeaderTraceparent))
+	assert.Nil(t, err)
+	assert.Equal(t, parent.TraceID, traceContext.TraceID)
+	spans := collector.Spans()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, traceContext.SpanID, spans[0].SpanID)
+	assert.Equal(t, parent.SpanID, spans[0].ParentSpanID)
+	assert.Equal(t, "200", spans[0].Attributes["http.status_code"])
+}
+
+func TestStartOperation(t *testing.T) {
+	span, ctx := StartOperation(context.Background(), nil, "kvstore", "Get", "127.0.0.1:6379/0")
+	assert.Nil(t, span)
+	assert.Nil(t, TraceContextFromContext(ctx))
+	// a nil span is safe to use
+	span.SetAttribute("key", "value").Finish(nil)
+
+	collector := NewInMemoryCollector()
+	parent, ctx := StartSpan(WithRequestID(context.Background(), "request"), "GET /", SpanKindServer, nil)
+	span, _ = StartOperation(ctx, NewTracer(collector), "kvstore", "Get", "127.0.0.1:6379/0")
+	span.Finish(errors.New("kvstore: get error"))
+	spans := collector.Spans()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, "kvstore.Get", spans[0].Name)
+	assert.Equal(t, SpanKindClient, spans[0].Kind)
+	assert.Equal(t, parent.TraceID, spans[0].TraceID)
+	assert.Equal(t, parent.SpanID, spans[0].ParentSpanID)
+	assert.Equal(t, "request", spans[0].RequestID)
+	assert.Equal(t, "kvstore", spans[0].Attributes[AttributeComponent])
+	assert.Equal(t, "Get", spans[0].Attributes[AttributeOperation])
+	assert.Equal(t, "127.0.0.1:6379/0", spans[0].Attributes[AttributeTarget])
+	assert.NotNil(t, spans[0].Err)
+}
+
+func TestValidRequestID(t *testing.T) {
+	assert.True(t, ValidRequestID(NewRequestID()))
+	assert.True(t, ValidRequestID("req-1.2_3"))
+	assert.True(t, ValidRequestID(strings.Repeat("a", 128)))
+	for _, requestID := range []string{"", strings.Repeat("a", 129), "req|1", "req\n1", "req 1", "réq"} {
+		assert.False(t, ValidRequestID(requestID), requestID)
+	}
+}
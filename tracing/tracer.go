@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+)
+
+// Span attributes of the component operations
+const (
+	AttributeComponent = "component"
+	AttributeOperation = "operation"
+	AttributeTarget    = "target"
+)
+
+type (
+	// Tracer starts the spans of the operations performed by the components,
+	// implement it to plug in another tracing backend.
+	Tracer interface {
+		StartSpan(ctx context.Context, name string, kind string) (*Span, context.Context)
+	}
+
+	// ExporterTracer is a Tracer whose spans are exported to Exporter.
+	ExporterTracer struct {
+		Exporter Exporter
+	}
+)
+
+func NewTracer(exporter Exporter) *ExporterTracer {
+	return &ExporterTracer{
+		Exporter: exporter,
+	}
+}
+
+func (t *ExporterTracer) StartSpan(ctx context.Context, name string, kind string) (*Span, context.Context) {
+	return StartSpan(ctx, name, kind, t.Exporter)
+}
+
+// StartOperation starts a client span named "component.operation" recording an
+// operation of a component on target, e.g. a database or a topic.
+// It returns a nil span, which is safe to use, when tracer is nil.
+func StartOperation(ctx context.Context, tracer Tracer, component string, operation string, target string) (*Span, context.Context) {
+	if tracer == nil {
+		return nil, ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	span, ctx := tracer.StartSpan(ctx, component+"."+operation, SpanKindClient)
+	if span == nil {
+		return nil, ctx
+	}
+	span.SetAttribute(AttributeComponent, component)
+	span.SetAttribute(AttributeOperation, operation)
+	span.SetAttribute(AttributeTarget, target)
+	return span, ctx
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Transport forwards the request id and the trace context of the outgoing
+// request context, and exports a client span for each request.
+type Transport struct {
+	Base     http.RoundTripper
+	Exporter Exporter
+}
+
+func NewTransport(base http.RoundTripper, exporter Exporter) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		Base:     base,
+		Exporter: exporter,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	requestID := RequestIDFromContext(ctx)
+	if requestID == "" && TraceContextFromContext(ctx) == nil {
+		// nothing to propagate, the request is not part of a traced request
+		return t.Base.RoundTrip(req)
+	}
+	span, ctx := StartSpan(ctx, req.Method+" "+req.URL.Path, SpanKindClient, t.Exporter)
+	span.SetAttribute("http.host", req.URL.Host)
+	// RoundTrip must not modify the request
+	req = req.WithContext(ctx)
+	req.Header = cloneHeader(req.Header)
+	if requestID != "" {
+		req.Header.Set(HeaderXRequestID, requestID)
+	}
+	req.Header.Set(HeaderTraceparent, TraceContextFromContext(ctx).String())
+	resp, err := t.Base.RoundTrip(req)
+	if resp != nil {
+		span.SetAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+	}
+	span.Finish(err)
+	return resp, err
+}
+
+func cloneHeader(h http.Header) http.Header {
+	cloned := make(http.Header, len(h))
+	for key, values := range h {
+		cloned[key] = append([]string(nil), values...)
+	}
+	return cloned
+}
@@ -8,7 +8,8 @@ import (
 )
 
 var (
-	errPoolClosed error = fmt.Errorf("pool: connection pool closed")
+	errPoolClosed  error = fmt.Errorf("pool: connection pool closed")
+	errPoolTimeout error = fmt.Errorf("pool: get connection timeout")
 )
 
 type Conn interface {
@@ -59,17 +60,57 @@ type Pool interface {
 	Put(conn Conn) error
 	Remove(conn Conn) error
 	Close() error
+	Stats() PoolStats
+}
+
+type (
+	PoolOptions struct {
+		WaitTimeout time.Duration
+		IdleTimeout time.Duration
+	}
+
+	PoolOption func(*PoolOptions)
+)
+
+// PoolWaitTimeout makes Get fail after waiting timeout for a connection when all are in use, it waits forever by default.
+func PoolWaitTimeout(timeout time.Duration) PoolOption {
+	return func(options *PoolOptions) {
+		options.WaitTimeout = timeout
+	}
+}
+
+// PoolIdleTimeout closes the connections idle for longer than timeout, they are kept by default.
+func PoolIdleTimeout(timeout time.Duration) PoolOption {
+	return func(options *PoolOptions) {
+		options.IdleTimeout = timeout
+	}
+}
+
+// PoolStats are the stats of the connections of a pool.
+type PoolStats struct {
+	Open         int           // the connections open, idle or in use
+	Idle         int           // the connections idle
+	InUse        int           // the connections in use
+	WaitCount    int64         // the total number of connections waited for
+	WaitDuration time.Duration // the total time waited for a connection
+	Timeouts     int64         // the total number of Get failed after waiting WaitTimeout
 }
 
 type pool struct {
 	MaxIdle      int
 	NewFn        func() (Conn, error)
 	TestOnBorrow func(Conn, time.Time) error
+	WaitTimeout  time.Duration
+	IdleTimeout  time.Duration
 
-	cond    *sync.Cond
-	idleNum int
-	idle    *list.List
-	closed  bool
+	cond         *sync.Cond
+	idleNum      int
+	idle         *list.List
+	closed       bool
+	done         chan struct{}
+	waitCount    int64
+	waitDuration time.Duration
+	timeouts     int64
 }
 
 type idleItem struct {
@@ -81,19 +122,48 @@ func NewPool(
 	maxIdle int,
 	newFn func() (Conn, error),
 	testOnBorrow func(Conn, time.Time) error,
+	setters ...PoolOption,
 ) Pool {
-	return &pool{
+	options := &PoolOptions{}
+	for _, setter := range setters {
+		setter(options)
+	}
+	p := &pool{
 		MaxIdle:      maxIdle,
 		NewFn:        newFn,
 		TestOnBorrow: testOnBorrow,
+		WaitTimeout:  options.WaitTimeout,
+		IdleTimeout:  options.IdleTimeout,
 		cond:         sync.NewCond(&sync.Mutex{}),
 		idle:         list.New(),
+		done:         make(chan struct{}),
+	}
+	if p.IdleTimeout > 0 {
+		go p.evictLoop()
 	}
+	return p
 }
 
 func (p *pool) Get() (conn Conn, err error) {
+	var (
+		waitStart time.Time
+		timer     *time.Timer
+	)
+	// waited records the wait for the connection, with the lock held
+	waited := func() {
+		if !waitStart.IsZero() {
+			p.waitDuration += time.Since(waitStart)
+			waitStart = time.Time{}
+		}
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+	}
 	p.cond.L.Lock()
 	for {
+		// 关闭空闲超时的连接
+		p.evict()
 		// 获取idle连接
 		for i, n := 0, p.idle.Len(); i < n; i++ {
 			var e *list.Element
@@ -101,6 +171,7 @@ func (p *pool) Get() (conn Conn, err error) {
 				break
 			}
 			p.idle.Remove(e)
+			waited()
 			p.cond.L.Unlock()
 			var (
 				item         idleItem                    = e.Value.(idleItem)
@@ -116,6 +187,7 @@ func (p *pool) Get() (conn Conn, err error) {
 		}
 		// 检测是否已被关闭
 		if p.closed {
+			waited()
 			p.cond.L.Unlock()
 			return nil, errPoolClosed
 		}
@@ -123,6 +195,7 @@ func (p *pool) Get() (conn Conn, err error) {
 		if p.MaxIdle == 0 || p.idleNum < p.MaxIdle {
 			p.idleNum++
 			var NewFn func() (Conn, error) = p.NewFn
+			waited()
 			p.cond.L.Unlock()
 			if conn, err = NewFn(); err != nil {
 				p.cond.L.Lock()
@@ -133,6 +206,23 @@ func (p *pool) Get() (conn Conn, err error) {
 			}
 			return conn.BindPool(p), err
 		}
+		// 等待连接被回收, 超过WaitTimeout返回
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+			p.waitCount++
+			if p.WaitTimeout > 0 {
+				timer = time.AfterFunc(p.WaitTimeout, func() {
+					p.cond.L.Lock()
+					p.cond.Broadcast()
+					p.cond.L.Unlock()
+				})
+			}
+		} else if p.WaitTimeout > 0 && time.Since(waitStart) >= p.WaitTimeout {
+			p.timeouts++
+			waited()
+			p.cond.L.Unlock()
+			return nil, errPoolTimeout
+		}
 		p.cond.Wait()
 	}
 }
@@ -140,11 +230,14 @@ func (p *pool) Get() (conn Conn, err error) {
 func (p *pool) Put(conn Conn) error {
 	p.cond.L.Lock()
 	if p.closed {
+		// 连接池已关闭, 关闭回收的连接
+		p.idleNum--
 		p.cond.L.Unlock()
+		conn.Close()
 		return errPoolClosed
 	}
 	p.idle.PushFront(idleItem{idleTime: time.Now(), idleConn: conn})
-	if p.idle.Len() > p.MaxIdle {
+	if p.MaxIdle > 0 && p.idle.Len() > p.MaxIdle {
 		if conn = p.idle.Remove(p.idle.Back()).(idleItem).idleConn; conn != nil {
 			p.idleNum--
 		}
@@ -161,11 +254,14 @@ func (p *pool) Put(conn Conn) error {
 
 func (p *pool) Remove(conn Conn) error {
 	p.cond.L.Lock()
+	p.idleNum--
 	if p.closed {
 		p.cond.L.Unlock()
+		if conn != nil {
+			conn.Close()
+		}
 		return errPoolClosed
 	}
-	p.idleNum--
 	p.cond.Signal()
 	p.cond.L.Unlock()
 	if conn != nil {
@@ -183,7 +279,9 @@ func (p *pool) Close() error {
 
 	var idle *list.List = p.idle
 	p.closed = true
-	p.idle.Init()
+	p.idle = list.New()
+	p.idleNum -= idle.Len()
+	close(p.done)
 	p.cond.Broadcast()
 	p.cond.L.Unlock()
 	for e := idle.Front(); e != nil; e = e.Next() {
@@ -192,6 +290,67 @@ func (p *pool) Close() error {
 	return nil
 }
 
+// Stats returns the stats of the connections of the pool.
+func (p *pool) Stats() PoolStats {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	return PoolStats{
+		Open:         p.idleNum,
+		Idle:         p.idle.Len(),
+		InUse:        p.idleNum - p.idle.Len(),
+		WaitCount:    p.waitCount,
+		WaitDuration: p.waitDuration,
+		Timeouts:     p.timeouts,
+	}
+}
+
+// evict closes the connections idle for longer than IdleTimeout, with the lock held.
+func (p *pool) evict() {
+	if p.IdleTimeout <= 0 {
+		return
+	}
+	expired := make([]Conn, 0)
+	// Put pushes to the front, the oldest connections are at the back
+	for e := p.idle.Back(); e != nil && time.Since(e.Value.(idleItem).idleTime) > p.IdleTimeout; e = p.idle.Back() {
+		p.idle.Remove(e)
+		p.idleNum--
+		expired = append(expired, e.Value.(idleItem).idleConn)
+	}
+	if len(expired) == 0 {
+		return
+	}
+	p.cond.Broadcast()
+	// 关闭连接不持有锁
+	p.cond.L.Unlock()
+	for _, conn := range expired {
+		conn.Close()
+	}
+	p.cond.L.Lock()
+}
+
+// evictLoop evicts the idle connections until the pool is closed.
+func (p *pool) evictLoop() {
+	interval := p.IdleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.cond.L.Lock()
+			p.evict()
+			p.cond.L.Unlock()
+		}
+	}
+}
+
 func (p *pool) IdleNum() int {
 	p.cond.L.Lock()
 	var idleNum int = p.idleNum